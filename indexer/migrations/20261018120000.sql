@@ -0,0 +1,23 @@
+-- Modify "transaction" table
+ALTER TABLE "public"."transaction" ADD COLUMN "chain_id" character varying(32) NULL;
+-- Existing transactions were indexed from the single configured chain
+UPDATE "public"."transaction" SET "chain_id" = (SELECT "chain_id" FROM "public"."status" ORDER BY "id" LIMIT 1);
+ALTER TABLE "public"."transaction" ALTER COLUMN "chain_id" SET NOT NULL;
+-- Create index "idx_tx_chain_height" to table: "transaction"
+CREATE INDEX "idx_tx_chain_height" ON "public"."transaction" ("chain_id", "height");
+-- Modify "token" table
+DROP INDEX "public"."token_ticker_key";
+CREATE UNIQUE INDEX "token_ticker_key" ON "public"."token" ("chain_id", "ticker");
+-- Modify "collection" table
+DROP INDEX "public"."collection_content_hash_key";
+CREATE UNIQUE INDEX "collection_content_hash_key" ON "public"."collection" ("chain_id", "content_hash");
+DROP INDEX "public"."collection_name_key";
+CREATE UNIQUE INDEX "collection_name_key" ON "public"."collection" ("chain_id", "name");
+DROP INDEX "public"."collection_symbol_key";
+CREATE UNIQUE INDEX "collection_symbol_key" ON "public"."collection" ("chain_id", "symbol");
+-- Modify "inscription" table
+ALTER TABLE "public"."inscription" DROP CONSTRAINT "inscription_content_hash_key", ADD CONSTRAINT "inscription_content_hash_key" UNIQUE ("chain_id", "content_hash");
+DROP INDEX "public"."inscription_number";
+CREATE UNIQUE INDEX "inscription_number" ON "public"."inscription" ("chain_id", "inscription_number");
+-- Modify "troll_post" table
+ALTER TABLE "public"."troll_post" DROP CONSTRAINT "troll_post_content_hash_key", ADD CONSTRAINT "troll_post_content_hash_key" UNIQUE ("chain_id", "content_hash");
@@ -0,0 +1,11 @@
+-- Create "base_token_price" table
+CREATE TABLE "public"."base_token_price" (
+  "id" serial NOT NULL,
+  "chain_id" character varying(32) NOT NULL,
+  "price_usd" double precision NOT NULL,
+  "sources" integer NOT NULL,
+  "date_created" timestamp NOT NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_base_token_price_chain_date" to table: "base_token_price"
+CREATE INDEX "idx_base_token_price_chain_date" ON "public"."base_token_price" ("chain_id", "date_created");
@@ -0,0 +1,13 @@
+-- Modify "status" table
+ALTER TABLE "public"."status" ADD COLUMN "state_checksum" character varying(64) NOT NULL DEFAULT '';
+-- Create "block_checksum" table
+CREATE TABLE "public"."block_checksum" (
+  "id" serial NOT NULL,
+  "chain_id" character varying(32) NOT NULL,
+  "height" integer NOT NULL,
+  "checksum" character varying(64) NOT NULL,
+  "changes" integer NOT NULL,
+  "date_created" timestamp NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "block_checksum_chain_height_key" UNIQUE ("chain_id", "height")
+);
@@ -0,0 +1,2 @@
+-- Modify "transaction" table
+ALTER TABLE "public"."transaction" ADD COLUMN "error_code" character varying(64) NULL, ADD COLUMN "error_details" jsonb NULL;
@@ -0,0 +1,31 @@
+-- Create "event_outbox" table
+CREATE TABLE "public"."event_outbox" (
+  "id" bigserial NOT NULL,
+  "chain_id" character varying(32) NOT NULL,
+  "height" integer NOT NULL,
+  "transaction_id" integer NOT NULL,
+  "transaction_hash" character varying(100) NOT NULL,
+  "event_type" character varying(64) NOT NULL,
+  "data" jsonb NOT NULL,
+  "date_created" timestamp NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "event_outbox_transaction_fk" FOREIGN KEY ("transaction_id") REFERENCES "public"."transaction" ("id")
+);
+-- Create index "idx_event_outbox_chain_id" to table: "event_outbox"
+CREATE INDEX "idx_event_outbox_chain_id" ON "public"."event_outbox" ("chain_id", "id");
+-- Create "webhook_subscription" table
+CREATE TABLE "public"."webhook_subscription" (
+  "id" serial NOT NULL,
+  "chain_id" character varying(32) NOT NULL,
+  "url" character varying(2048) NOT NULL,
+  "secret" character varying(256) NOT NULL,
+  "event_types" character varying(1024) NOT NULL DEFAULT '',
+  "last_event_id" bigint NOT NULL DEFAULT 0,
+  "is_enabled" boolean NOT NULL DEFAULT true,
+  "failure_count" integer NOT NULL DEFAULT 0,
+  "retry_at" timestamp NULL,
+  "last_error" text NOT NULL DEFAULT '',
+  "date_updated" timestamp NOT NULL,
+  "date_created" timestamp NOT NULL,
+  PRIMARY KEY ("id")
+);
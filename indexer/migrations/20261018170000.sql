@@ -0,0 +1,2 @@
+-- Create index "idx_event_outbox_chain_height" to table: "event_outbox"
+CREATE INDEX "idx_event_outbox_chain_height" ON "public"."event_outbox" ("chain_id", "height");
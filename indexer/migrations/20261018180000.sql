@@ -0,0 +1,2 @@
+-- Create index "idx_tx_error_code" to table: "transaction"
+CREATE INDEX "idx_tx_error_code" ON "public"."transaction" ("error_code", "id") WHERE ("error_code" IS NOT NULL);
@@ -0,0 +1,4 @@
+-- Modify "collection" table
+ALTER TABLE "public"."collection" ADD COLUMN "computed_hash" character varying(64) NULL, ADD COLUMN "is_hash_mismatch" boolean NOT NULL DEFAULT false;
+-- Modify "inscription" table
+ALTER TABLE "public"."inscription" ADD COLUMN "computed_hash" character varying(64) NULL, ADD COLUMN "is_hash_mismatch" boolean NOT NULL DEFAULT false;
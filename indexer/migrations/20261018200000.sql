@@ -0,0 +1,8 @@
+-- Modify "collection" table
+ALTER TABLE "public"."collection" ADD COLUMN "declared_mime" character varying(255) NULL, ADD COLUMN "detected_mime" character varying(255) NULL, ADD COLUMN "is_active_content" boolean NOT NULL DEFAULT false;
+-- Modify "inscription" table
+ALTER TABLE "public"."inscription" ADD COLUMN "declared_mime" character varying(255) NULL, ADD COLUMN "detected_mime" character varying(255) NULL, ADD COLUMN "is_active_content" boolean NOT NULL DEFAULT false;
+-- Modify "token" table
+ALTER TABLE "public"."token" ADD COLUMN "declared_mime" character varying(255) NULL, ADD COLUMN "detected_mime" character varying(255) NULL, ADD COLUMN "is_active_content" boolean NOT NULL DEFAULT false;
+-- Modify "troll_post" table
+ALTER TABLE "public"."troll_post" ADD COLUMN "declared_mime" character varying(255) NULL, ADD COLUMN "detected_mime" character varying(255) NULL, ADD COLUMN "is_active_content" boolean NOT NULL DEFAULT false;
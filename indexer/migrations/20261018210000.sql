@@ -0,0 +1,6 @@
+-- Modify "collection" table
+ALTER TABLE "public"."collection" ADD COLUMN "preview_path" character varying(255) NULL, ADD COLUMN "preview_width" integer NULL, ADD COLUMN "preview_height" integer NULL;
+-- Modify "inscription" table
+ALTER TABLE "public"."inscription" ADD COLUMN "preview_path" character varying(255) NULL, ADD COLUMN "preview_width" integer NULL, ADD COLUMN "preview_height" integer NULL;
+-- Modify "troll_post" table
+ALTER TABLE "public"."troll_post" ADD COLUMN "preview_path" character varying(255) NULL, ADD COLUMN "preview_width" integer NULL, ADD COLUMN "preview_height" integer NULL;
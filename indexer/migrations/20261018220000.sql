@@ -0,0 +1,22 @@
+-- Create "inscription_part" table
+CREATE TABLE "public"."inscription_part" (
+  "id" serial NOT NULL,
+  "chain_id" character varying(32) NOT NULL,
+  "height" integer NOT NULL,
+  "transaction_id" integer NOT NULL,
+  "creator" character varying(128) NOT NULL,
+  "content_hash" character varying(128) NOT NULL,
+  "part_index" integer NOT NULL,
+  "part_total" integer NOT NULL,
+  "metadata" jsonb NULL,
+  "content" bytea NOT NULL,
+  "expires_height" integer NOT NULL,
+  "date_created" timestamp NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "inscription_part_index_key" UNIQUE ("chain_id", "creator", "content_hash", "part_index"),
+  CONSTRAINT "inscription_part_transaction_fk" FOREIGN KEY ("transaction_id") REFERENCES "public"."transaction" ("id")
+);
+-- Create index "idx_inscription_part_content_hash" to table: "inscription_part"
+CREATE INDEX "idx_inscription_part_content_hash" ON "public"."inscription_part" ("chain_id", "content_hash");
+-- Create index "idx_inscription_part_expires_height" to table: "inscription_part"
+CREATE INDEX "idx_inscription_part_expires_height" ON "public"."inscription_part" ("chain_id", "expires_height");
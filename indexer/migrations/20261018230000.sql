@@ -0,0 +1,2 @@
+-- Modify "transaction" table
+ALTER TABLE "public"."transaction" DROP CONSTRAINT "transaction_hash_key", ADD CONSTRAINT "transaction_hash_key" UNIQUE ("chain_id", "hash");
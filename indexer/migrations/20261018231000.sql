@@ -0,0 +1,9 @@
+-- Create "job_outbox" table
+CREATE TABLE "public"."job_outbox" (
+  "id" bigserial NOT NULL,
+  "kind" character varying(64) NOT NULL,
+  "args" jsonb NOT NULL,
+  "scheduled_at" timestamp NOT NULL,
+  "date_created" timestamp NOT NULL,
+  PRIMARY KEY ("id")
+);
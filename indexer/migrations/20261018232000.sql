@@ -0,0 +1,4 @@
+-- Modify "inscription_trade_history" table
+ALTER TABLE "public"."inscription_trade_history" ALTER COLUMN "total_usd" DROP NOT NULL, ALTER COLUMN "total_usd" DROP DEFAULT;
+-- Modify "token_trade_history" table
+ALTER TABLE "public"."token_trade_history" ALTER COLUMN "total_usd" DROP NOT NULL, ALTER COLUMN "total_usd" DROP DEFAULT;
@@ -16,10 +16,47 @@ CREATE TABLE public.status (
     base_token_usd float4 NOT NULL,
     date_updated timestamp NOT NULL,
     last_known_height int4 NULL DEFAULT 0,
+    state_checksum varchar(64) NOT NULL DEFAULT '',
     CONSTRAINT status_pkey PRIMARY KEY (id)
 );
 
 
+-- public.block_checksum definition
+
+-- Drop table
+
+-- DROP TABLE public.block_checksum;
+
+CREATE TABLE public.block_checksum (
+    id serial4 NOT NULL,
+    chain_id varchar(32) NOT NULL,
+    height int4 NOT NULL,
+    checksum varchar(64) NOT NULL,
+    changes int4 NOT NULL,
+    date_created timestamp NOT NULL,
+    CONSTRAINT block_checksum_pkey PRIMARY KEY (id),
+    CONSTRAINT block_checksum_chain_height_key UNIQUE (chain_id, height)
+);
+
+
+-- public.base_token_price definition
+
+-- Drop table
+
+-- DROP TABLE public.base_token_price;
+
+CREATE TABLE public.base_token_price (
+    id serial4 NOT NULL,
+    chain_id varchar(32) NOT NULL,
+    price_usd float8 NOT NULL,
+    sources int4 NOT NULL,
+    date_created timestamp NOT NULL,
+    CONSTRAINT base_token_price_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX "idx_base_token_price_chain_date" ON "public"."base_token_price" USING btree ("chain_id", "date_created");
+
+
 -- public."transaction" definition
 
 -- Drop table
@@ -28,6 +65,7 @@ CREATE TABLE public.status (
 
 CREATE TABLE public."transaction" (
     id serial4 NOT NULL,
+    chain_id varchar(32) NOT NULL,
     height int4 NOT NULL,
     hash varchar(100) NOT NULL,
     "content" text NOT NULL,
@@ -35,11 +73,15 @@ CREATE TABLE public."transaction" (
     fees varchar(100) NOT NULL,
     content_length int4 NOT NULL,
     status_message varchar(255) NULL,
+    error_code varchar(64) NULL,
+    error_details jsonb NULL,
     date_created timestamp NOT NULL,
-    CONSTRAINT transaction_hash_key UNIQUE (hash),
+    CONSTRAINT transaction_hash_key UNIQUE (chain_id, hash),
     CONSTRAINT transaction_pkey PRIMARY KEY (id)
 );
 CREATE INDEX idx_tx_hash ON public.transaction USING btree (hash);
+CREATE INDEX idx_tx_chain_height ON public.transaction USING btree (chain_id, height);
+CREATE INDEX idx_tx_error_code ON public.transaction USING btree (error_code, id) WHERE (error_code IS NOT NULL);
 
 -- public."collection" definition
 
@@ -54,6 +96,8 @@ CREATE TABLE public."collection" (
     "version" varchar(32) NOT NULL,
     transaction_id int4 NOT NULL,
     content_hash varchar(128) NOT NULL,
+    computed_hash varchar(64) NULL,
+    is_hash_mismatch bool NOT NULL DEFAULT false,
     creator varchar(128) NOT NULL,
     minter varchar(128) NULL,
     "name" varchar(32) NOT NULL,
@@ -63,12 +107,18 @@ CREATE TABLE public."collection" (
     metadata jsonb NOT NULL,
     content_path varchar(255) NULL DEFAULT NULL::character varying,
     content_size_bytes int4 NULL,
+    declared_mime varchar(255) NULL,
+    detected_mime varchar(255) NULL,
+    is_active_content bool NOT NULL DEFAULT false,
+    preview_path varchar(255) NULL,
+    preview_width int4 NULL,
+    preview_height int4 NULL,
     is_explicit bool NULL DEFAULT false,
     date_created timestamp NOT NULL,
     CONSTRAINT collection_pkey PRIMARY KEY (id),
-    CONSTRAINT collection_content_hash_key UNIQUE (content_hash),
-    CONSTRAINT collection_symbol_key UNIQUE (symbol),
-    CONSTRAINT collection_name_key UNIQUE ("name"),
+    CONSTRAINT collection_content_hash_key UNIQUE (chain_id, content_hash),
+    CONSTRAINT collection_symbol_key UNIQUE (chain_id, symbol),
+    CONSTRAINT collection_name_key UNIQUE (chain_id, "name"),
     CONSTRAINT collection_tx_id UNIQUE (transaction_id),
     CONSTRAINT collection_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction"(id)
 );
@@ -136,18 +186,26 @@ CREATE TABLE public.inscription (
     collection_id int4 NULL,
     token_id int4 NULL,
     content_hash varchar(128) NOT NULL,
+    computed_hash varchar(64) NULL,
+    is_hash_mismatch bool NOT NULL DEFAULT false,
     creator varchar(255) NOT NULL,
     current_owner varchar(128) NOT NULL,
     "type" varchar(128) NOT NULL,
     metadata jsonb NOT NULL,
     content_path varchar(255) NOT NULL,
     content_size_bytes int4 NOT NULL,
+    declared_mime varchar(255) NULL,
+    detected_mime varchar(255) NULL,
+    is_active_content bool NOT NULL DEFAULT false,
+    preview_path varchar(255) NULL,
+    preview_width int4 NULL,
+    preview_height int4 NULL,
     date_created timestamp NOT NULL,
     is_explicit bool NULL DEFAULT false,
-    CONSTRAINT inscription_content_hash_key UNIQUE (content_hash),
+    CONSTRAINT inscription_content_hash_key UNIQUE (chain_id, content_hash),
     CONSTRAINT inscription_pkey PRIMARY KEY (id),
     CONSTRAINT inscription_tx_id UNIQUE (transaction_id),
-    CONSTRAINT inscription_number UNIQUE (inscription_number),
+    CONSTRAINT inscription_number UNIQUE (chain_id, inscription_number),
     CONSTRAINT inscription_collection_token_id UNIQUE ("collection_id", "token_id"),
     CONSTRAINT inscription_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction"(id),
     CONSTRAINT inscription_collection_fk FOREIGN KEY (collection_id) REFERENCES public."collection"(id)
@@ -271,13 +329,16 @@ CREATE TABLE public."token" (
     metadata text NULL,
     content_path varchar(255) NULL DEFAULT NULL::character varying,
     content_size_bytes int4 NULL,
+    declared_mime varchar(255) NULL,
+    detected_mime varchar(255) NULL,
+    is_active_content bool NOT NULL DEFAULT false,
     circulating_supply int8 NOT NULL DEFAULT 0,
     last_price_base int8 NOT NULL DEFAULT 0,
     volume_24_base int8 NOT NULL DEFAULT 0,
     date_created timestamp NOT NULL,
     is_explicit bool NULL DEFAULT false,
     CONSTRAINT token_pkey PRIMARY KEY (id),
-    CONSTRAINT token_ticker_key UNIQUE (ticker),
+    CONSTRAINT token_ticker_key UNIQUE (chain_id, ticker),
     CONSTRAINT token_tx_id UNIQUE (transaction_id),
     CONSTRAINT token_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction"(id)
 );
@@ -374,7 +435,7 @@ CREATE TABLE public.token_trade_history (
     amount_base int8 NOT NULL,
     amount_quote int8 NOT NULL,
     rate int4 NOT NULL DEFAULT 0,
-    total_usd float4 NOT NULL DEFAULT 0,
+    total_usd float4 NULL,
     date_created timestamp NOT NULL,
     CONSTRAINT tth_key PRIMARY KEY (id),
     CONSTRAINT token_id_fk FOREIGN KEY (token_id) REFERENCES public."token"(id),
@@ -414,7 +475,7 @@ CREATE TABLE public.inscription_trade_history (
     seller_address varchar(128) NOT NULL,
     buyer_address varchar(128) NULL,
     amount_quote int8 NOT NULL,
-    total_usd float4 NOT NULL DEFAULT 0,
+    total_usd float4 NULL,
     date_created timestamp NOT NULL,
     CONSTRAINT ith_key PRIMARY KEY (id),
     CONSTRAINT inscription_id_fk FOREIGN KEY (inscription_id) REFERENCES public."inscription"(id),
@@ -678,10 +739,16 @@ CREATE TABLE public."troll_post" (
     "text" text NOT NULL,
     content_path varchar(255) NULL DEFAULT NULL::character varying,
     content_size_bytes int4 NULL,
+    declared_mime varchar(255) NULL,
+    detected_mime varchar(255) NULL,
+    is_active_content bool NOT NULL DEFAULT false,
+    preview_path varchar(255) NULL,
+    preview_width int4 NULL,
+    preview_height int4 NULL,
     is_explicit bool NULL DEFAULT false,
     date_created timestamp NOT NULL,
     CONSTRAINT troll_post_pkey PRIMARY KEY (id),
-    CONSTRAINT troll_post_content_hash_key UNIQUE (content_hash),
+    CONSTRAINT troll_post_content_hash_key UNIQUE (chain_id, content_hash),
     CONSTRAINT troll_post_tx_id UNIQUE (transaction_id),
     CONSTRAINT troll_post_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction"(id),
     CONSTRAINT troll_post_launchpad_fk FOREIGN KEY (launchpad_id) REFERENCES public."launchpad"(id)
@@ -692,6 +759,92 @@ CREATE INDEX "idx_troll_post_transaction_id" ON "public"."troll_post" USING btre
 CREATE INDEX "idx_troll_post_launchpad_id" ON "public"."troll_post" USING btree ("launchpad_id");
 CREATE INDEX idx_trgm_troll_post_text ON "public"."troll_post" USING gin (("text") gin_trgm_ops);
 
+-- public.event_outbox definition
+
+-- Drop table
+
+-- DROP TABLE public.event_outbox;
+
+CREATE TABLE public.event_outbox (
+    id bigserial NOT NULL,
+    chain_id varchar(32) NOT NULL,
+    height int4 NOT NULL,
+    transaction_id int4 NOT NULL,
+    transaction_hash varchar(100) NOT NULL,
+    event_type varchar(64) NOT NULL,
+    "data" jsonb NOT NULL,
+    date_created timestamp NOT NULL,
+    CONSTRAINT event_outbox_pkey PRIMARY KEY (id),
+    CONSTRAINT event_outbox_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction"(id)
+);
+
+CREATE INDEX "idx_event_outbox_chain_id" ON "public"."event_outbox" USING btree ("chain_id", "id");
+CREATE INDEX "idx_event_outbox_chain_height" ON "public"."event_outbox" USING btree ("chain_id", "height");
+
+-- public.job_outbox definition
+
+-- Drop table
+
+-- DROP TABLE public.job_outbox;
+
+CREATE TABLE public.job_outbox (
+    id bigserial NOT NULL,
+    kind varchar(64) NOT NULL,
+    args jsonb NOT NULL,
+    scheduled_at timestamp NOT NULL,
+    date_created timestamp NOT NULL,
+    CONSTRAINT job_outbox_pkey PRIMARY KEY (id)
+);
+
+-- public.inscription_part definition
+
+-- Drop table
+
+-- DROP TABLE public.inscription_part;
+
+CREATE TABLE public.inscription_part (
+    id serial4 NOT NULL,
+    chain_id varchar(32) NOT NULL,
+    height int4 NOT NULL,
+    transaction_id int4 NOT NULL,
+    creator varchar(128) NOT NULL,
+    content_hash varchar(128) NOT NULL,
+    part_index int4 NOT NULL,
+    part_total int4 NOT NULL,
+    metadata jsonb NULL,
+    "content" bytea NOT NULL,
+    expires_height int4 NOT NULL,
+    date_created timestamp NOT NULL,
+    CONSTRAINT inscription_part_pkey PRIMARY KEY (id),
+    CONSTRAINT inscription_part_index_key UNIQUE (chain_id, creator, content_hash, part_index),
+    CONSTRAINT inscription_part_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction"(id)
+);
+
+CREATE INDEX "idx_inscription_part_content_hash" ON "public"."inscription_part" USING btree ("chain_id", "content_hash");
+CREATE INDEX "idx_inscription_part_expires_height" ON "public"."inscription_part" USING btree ("chain_id", "expires_height");
+
+-- public.webhook_subscription definition
+
+-- Drop table
+
+-- DROP TABLE public.webhook_subscription;
+
+CREATE TABLE public.webhook_subscription (
+    id serial4 NOT NULL,
+    chain_id varchar(32) NOT NULL,
+    url varchar(2048) NOT NULL,
+    secret varchar(256) NOT NULL,
+    event_types varchar(1024) NOT NULL DEFAULT '',
+    last_event_id int8 NOT NULL DEFAULT 0,
+    is_enabled bool NOT NULL DEFAULT true,
+    failure_count int4 NOT NULL DEFAULT 0,
+    retry_at timestamp NULL,
+    last_error text NOT NULL DEFAULT '',
+    date_updated timestamp NOT NULL,
+    date_created timestamp NOT NULL,
+    CONSTRAINT webhook_subscription_pkey PRIMARY KEY (id)
+);
+
 -- public.inscription_market view definition
 
 CREATE OR REPLACE VIEW public.inscription_market AS 
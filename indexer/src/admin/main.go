@@ -0,0 +1,604 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	cosmostypes "github.com/cosmos/cosmos-sdk/types"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/worker"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/worker/workers"
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/riverqueue/river"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Config defines the environment variables for the admin CLI, it shares the
+// .env file of the indexer
+type Config struct {
+	DatabaseDSN      string `envconfig:"DATABASE_DSN" required:"true"`
+	LogLevel         string `envconfig:"LOG_LEVEL" default:"info"`
+	ReservationsFile string `envconfig:"RESERVATIONS_FILE"`
+}
+
+var config Config
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	root := &cobra.Command{
+		Use:               "admin",
+		Short:             "Operate the inscription indexer",
+		SilenceUsage:      true,
+		SilenceErrors:     true,
+		PersistentPreRunE: setup,
+	}
+	root.AddCommand(statusCommand(), txCommand(), jobsCommand(), reservationsCommand(), contentCommand())
+
+	err := root.ExecuteContext(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// setup loads the configuration and sets up logging before a command runs
+func setup(cmd *cobra.Command, args []string) error {
+	// load ENV vars from .env
+	err := godotenv.Load()
+	if err != nil {
+		log.Warn("Error loading .env file")
+	}
+
+	err = envconfig.Process("", &config)
+	if err != nil {
+		return fmt.Errorf("unable to process config: %w", err)
+	}
+
+	// Logs go to stderr so that the command output can be piped
+	log.SetOutput(os.Stderr)
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp:   true,
+		TimestampFormat: "Jan 02 15:04:05",
+	})
+	logLevel, err := log.ParseLevel(config.LogLevel)
+	if err != nil {
+		return fmt.Errorf("unable to parse log level: %w", err)
+	}
+	log.SetLevel(logLevel)
+	return nil
+}
+
+// openDB connects to the indexer database
+func openDB() (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(config.DatabaseDSN), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
+
+// newTable returns a tab aligned writer for stdout
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+// printJSON prints value as indented JSON
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func statusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the indexing status of every chain",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDB()
+			if err != nil {
+				return err
+			}
+
+			var statuses []models.Status
+			err = db.WithContext(cmd.Context()).Order("chain_id").Find(&statuses).Error
+			if err != nil {
+				return err
+			}
+
+			table := newTable()
+			fmt.Fprintln(table, "CHAIN\tPROCESSED\tKNOWN\tLAG\tBASE TOKEN\tUSD\tCHECKSUM\tUPDATED")
+			for _, status := range statuses {
+				var lag uint64
+				if status.LastKnownHeight > status.LastProcessedHeight {
+					lag = status.LastKnownHeight - status.LastProcessedHeight
+				}
+				fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%s\t%.4f\t%s\t%s\n",
+					status.ChainID,
+					status.LastProcessedHeight,
+					status.LastKnownHeight,
+					lag,
+					status.BaseToken,
+					status.BaseTokenUSD,
+					status.StateChecksum,
+					status.DateUpdated.Format("2006-01-02 15:04:05"),
+				)
+			}
+			return table.Flush()
+		},
+	}
+}
+
+func txCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "tx",
+		Short: "Inspect and retry stored transactions",
+	}
+	command.AddCommand(txShowCommand(), txRetryCommand(), txFailedCommand(), txErrorsCommand())
+	return command
+}
+
+func txShowCommand() *cobra.Command {
+	var chainID string
+	command := &cobra.Command{
+		Use:   "show <hash>",
+		Short: "Decode and print a stored transaction",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDB()
+			if err != nil {
+				return err
+			}
+
+			txModel, err := indexer.FindTransaction(db.WithContext(cmd.Context()), chainID, args[0])
+			if err != nil {
+				return err
+			}
+
+			var rawTransaction types.Transaction
+			err = json.Unmarshal([]byte(txModel.Content), &rawTransaction)
+			if err != nil {
+				return fmt.Errorf("unable to decode transaction %s: %w", txModel.Hash, err)
+			}
+
+			sender, err := rawTransaction.GetSenderAddress()
+			if err != nil {
+				sender = err.Error()
+			}
+
+			table := newTable()
+			fmt.Fprintf(table, "Hash:\t%s\n", txModel.Hash)
+			fmt.Fprintf(table, "Chain:\t%s\n", txModel.ChainID)
+			fmt.Fprintf(table, "Height:\t%d\n", txModel.Height)
+			fmt.Fprintf(table, "Date:\t%s\n", txModel.DateCreated.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(table, "Status:\t%s\n", txModel.StatusMessage)
+			if txModel.ErrorCode.Valid {
+				fmt.Fprintf(table, "Error code:\t%s\n", txModel.ErrorCode.String)
+			}
+			if len(txModel.ErrorDetails) > 0 {
+				fmt.Fprintf(table, "Error details:\t%s\n", txModel.ErrorDetails)
+			}
+			fmt.Fprintf(table, "Sender:\t%s\n", sender)
+			fmt.Fprintf(table, "Memo:\t%s\n", rawTransaction.Memo())
+			fmt.Fprintf(table, "Fees:\t%s\n", rawTransaction.Fees())
+			for index, message := range rawTransaction.EffectiveMessages() {
+				description := cosmostypes.MsgTypeURL(message.Msg)
+				if message.Grantee != "" {
+					description += " (executed by " + message.Grantee + ")"
+				}
+				fmt.Fprintf(table, "Message %d:\t%s\n", index, description)
+			}
+			err = table.Flush()
+			if err != nil {
+				return err
+			}
+
+			fmt.Println()
+			return printJSON(json.RawMessage(txModel.Content))
+		},
+	}
+	command.Flags().StringVar(&chainID, "chain", "", "chain of the transaction, required if the hash is stored on more than one chain")
+	return command
+}
+
+func txRetryCommand() *cobra.Command {
+	var chainID string
+	var apply bool
+	command := &cobra.Command{
+		Use:   "retry <hash>",
+		Short: "Re-run a stored transaction through its processor",
+		Long: `Re-run the metaprotocol operation of a stored transaction against the
+current state. The changes are rolled back unless --apply is given, only
+failed transactions can be applied. Applied changes are not part of the
+state checksum and a reindex replays the transaction at its original height.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := indexer.New(log.WithFields(log.Fields{
+				"service": "admin",
+			}))
+			if err != nil {
+				return err
+			}
+
+			result, err := service.RetryTransaction(cmd.Context(), chainID, args[0], apply)
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+	command.Flags().StringVar(&chainID, "chain", "", "chain of the transaction, required if the hash is stored on more than one chain")
+	command.Flags().BoolVar(&apply, "apply", false, "keep the changes and store the new status")
+	return command
+}
+
+func txFailedCommand() *cobra.Command {
+	var chainID string
+	var code string
+	var limit int
+	command := &cobra.Command{
+		Use:   "failed",
+		Short: "List failed transactions, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDB()
+			if err != nil {
+				return err
+			}
+
+			query := db.WithContext(cmd.Context()).Where("error_code IS NOT NULL")
+			if chainID != "" {
+				query = query.Where("chain_id = ?", chainID)
+			}
+			if code != "" {
+				query = query.Where("error_code = ?", code)
+			}
+			var transactions []models.Transaction
+			err = query.Omit("content").Order("id DESC").Limit(limit).Find(&transactions).Error
+			if err != nil {
+				return err
+			}
+
+			table := newTable()
+			fmt.Fprintln(table, "HASH\tCHAIN\tHEIGHT\tCODE\tSTATUS")
+			for _, transaction := range transactions {
+				fmt.Fprintf(table, "%s\t%s\t%d\t%s\t%s\n",
+					transaction.Hash,
+					transaction.ChainID,
+					transaction.Height,
+					transaction.ErrorCode.String,
+					transaction.StatusMessage,
+				)
+			}
+			return table.Flush()
+		},
+	}
+	command.Flags().StringVar(&chainID, "chain", "", "only list transactions of this chain")
+	command.Flags().StringVar(&code, "code", "", "only list transactions with this error code")
+	command.Flags().IntVar(&limit, "limit", 50, "maximum number of transactions to list")
+	return command
+}
+
+func txErrorsCommand() *cobra.Command {
+	var chainID string
+	command := &cobra.Command{
+		Use:   "errors",
+		Short: "Count failed transactions by error code",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDB()
+			if err != nil {
+				return err
+			}
+
+			query := db.WithContext(cmd.Context()).Model(&models.Transaction{}).Where("error_code IS NOT NULL")
+			if chainID != "" {
+				query = query.Where("chain_id = ?", chainID)
+			}
+			var counts []struct {
+				ErrorCode string
+				Count     uint64
+			}
+			err = query.Select("error_code, COUNT(*) AS count").Group("error_code").Order("count DESC, error_code").Scan(&counts).Error
+			if err != nil {
+				return err
+			}
+
+			table := newTable()
+			fmt.Fprintln(table, "CODE\tCOUNT")
+			for _, count := range counts {
+				fmt.Fprintf(table, "%s\t%d\n", count.ErrorCode, count.Count)
+			}
+			return table.Flush()
+		},
+	}
+	command.Flags().StringVar(&chainID, "chain", "", "only count transactions of this chain")
+	return command
+}
+
+func jobsCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "jobs",
+		Short: "Queue worker jobs",
+	}
+	command.AddCommand(
+		collectionJobCommand("collection-stats", "Queue a stats update of collections", func(id uint64) river.JobArgs {
+			return workers.CollectionStatsArgs{CollectionID: id}
+		}),
+		collectionJobCommand("collection-traits", "Queue a traits update of collections", func(id uint64) river.JobArgs {
+			return workers.CollectionTraitsArgs{CollectionID: id}
+		}),
+		previewJobCommand(),
+		&cobra.Command{
+			Use:   "content-hash-audit",
+			Short: "Queue an audit of the content hashes of indexed inscriptions",
+			Long: `Queue a job that computes the content hash of collections and inscriptions
+indexed before content hashes were verified, and flags the ones with a
+declared hash that doesn't match their content.`,
+			Args: cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				logger := log.WithFields(log.Fields{
+					"service": "admin",
+				})
+				workerClient, err := worker.NewWorkerClient(logger)
+				if err != nil {
+					return err
+				}
+				jobID, err := workerClient.Insert(cmd.Context(), workers.ContentHashAuditArgs{})
+				if err != nil {
+					return fmt.Errorf("unable to queue content hash audit job: %w", err)
+				}
+				logger.WithFields(log.Fields{
+					"job_id": jobID,
+				}).Info("Queued job")
+				return nil
+			},
+		},
+	)
+	return command
+}
+
+// collectionJobCommand returns a command that queues the job returned by
+// newArgs for each collection ID
+func collectionJobCommand(use string, short string, newArgs func(id uint64) river.JobArgs) *cobra.Command {
+	var all bool
+	command := &cobra.Command{
+		Use:   use + " [collection ID...]",
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all == (len(args) > 0) {
+				return fmt.Errorf("either collection IDs or --all is required")
+			}
+
+			var collectionIDs []uint64
+			for _, arg := range args {
+				id, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid collection ID '%s'", arg)
+				}
+				collectionIDs = append(collectionIDs, id)
+			}
+			if all {
+				db, err := openDB()
+				if err != nil {
+					return err
+				}
+				err = db.WithContext(cmd.Context()).Model(&models.Collection{}).Order("id").Pluck("id", &collectionIDs).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			logger := log.WithFields(log.Fields{
+				"service": "admin",
+			})
+			workerClient, err := worker.NewWorkerClient(logger)
+			if err != nil {
+				return err
+			}
+			for _, id := range collectionIDs {
+				jobID, err := workerClient.Insert(cmd.Context(), newArgs(id))
+				if err != nil {
+					return fmt.Errorf("unable to queue %s job for collection %d: %w", use, id, err)
+				}
+				logger.WithFields(log.Fields{
+					"collection_id": id,
+					"job_id":        jobID,
+				}).Info("Queued job")
+			}
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&all, "all", false, "queue the job for every collection")
+	return command
+}
+
+// previewBatchSize is the number of preview jobs queued at once
+const previewBatchSize = 1000
+
+func previewJobCommand() *cobra.Command {
+	var missing bool
+	command := &cobra.Command{
+		Use:   "preview <collection|inscription|troll_post> [ID...]",
+		Short: "Queue preview generation of stored content",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			table := args[0]
+			if !workers.PreviewTables[table] {
+				return fmt.Errorf("previews are not generated for '%s'", table)
+			}
+			if missing == (len(args) > 1) {
+				return fmt.Errorf("either IDs or --missing is required")
+			}
+
+			var ids []uint64
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid ID '%s'", arg)
+				}
+				ids = append(ids, id)
+			}
+			if missing {
+				db, err := openDB()
+				if err != nil {
+					return err
+				}
+				err = db.WithContext(cmd.Context()).Table(table).
+					Where("content_path <> '' AND preview_path IS NULL AND NOT is_active_content").
+					Order("id").
+					Pluck("id", &ids).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			logger := log.WithFields(log.Fields{
+				"service": "admin",
+			})
+			workerClient, err := worker.NewWorkerClient(logger)
+			if err != nil {
+				return err
+			}
+			var queued int64
+			for start := 0; start < len(ids); start += previewBatchSize {
+				batch := ids[start:min(start+previewBatchSize, len(ids))]
+				jobs := make([]river.JobArgs, len(batch))
+				for i, id := range batch {
+					jobs[i] = workers.PreviewArgs{Table: table, ID: id}
+				}
+				count, err := workerClient.InsertMany(cmd.Context(), jobs)
+				if err != nil {
+					return fmt.Errorf("unable to queue preview jobs: %w", err)
+				}
+				queued += count
+			}
+			logger.WithFields(log.Fields{
+				"table": table,
+				"jobs":  queued,
+			}).Info("Queued preview jobs")
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&missing, "missing", false, "queue the job for every row without a preview")
+	return command
+}
+
+func reservationsCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "reservations",
+		Short: "Manage the collection name and ticker reservations",
+	}
+	command.AddCommand(&cobra.Command{
+		Use:   "reload",
+		Short: "Reload the reservations file in the running indexers",
+		Long: `Validate the reservations file and notify the running indexers to reload it.
+The indexers read the file from their own RESERVATIONS_FILE, which must be
+updated before reloading. An indexer keeps its reservations if the reload fails.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if config.ReservationsFile == "" {
+				return fmt.Errorf("RESERVATIONS_FILE is not set")
+			}
+			byName, byTicker, err := metaprotocol.LoadReservations(config.ReservationsFile)
+			if err != nil {
+				return fmt.Errorf("invalid reservations file: %w", err)
+			}
+
+			db, err := openDB()
+			if err != nil {
+				return err
+			}
+			err = db.WithContext(cmd.Context()).Exec("SELECT pg_notify(?, '')", indexer.ReloadChannel).Error
+			if err != nil {
+				return err
+			}
+
+			log.WithFields(log.Fields{
+				"names":   len(byName),
+				"tickers": len(byTicker),
+			}).Info("Notified indexers to reload reservations")
+			return nil
+		},
+	})
+	return command
+}
+
+func contentCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "content",
+		Short: "Manage the stored content",
+	}
+
+	var from string
+	var dryRun bool
+	backfill := &cobra.Command{
+		Use:   "backfill",
+		Short: "Copy the stored content to the configured content store",
+		Long: `Copy the content referenced by tokens, collections, inscriptions and troll
+posts from the source store to the content store configured by CONTENT_STORE
+and update the content paths. The source store is configured by the same
+variables prefixed with --from, ie --from OLD reads OLD_CONTENT_STORE,
+OLD_S3_BUCKET and so on. Content is renamed to the hash of its content,
+content already in the target store is skipped.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if from == "" {
+				return fmt.Errorf("the --from prefix is required")
+			}
+
+			var sourceConfig contentstore.Config
+			err := envconfig.Process(from, &sourceConfig)
+			if err != nil {
+				return fmt.Errorf("unable to process source config: %w", err)
+			}
+			var targetConfig contentstore.Config
+			err = envconfig.Process("", &targetConfig)
+			if err != nil {
+				return fmt.Errorf("unable to process target config: %w", err)
+			}
+			source, err := contentstore.New(sourceConfig)
+			if err != nil {
+				return fmt.Errorf("unable to create source store: %w", err)
+			}
+			target, err := contentstore.New(targetConfig)
+			if err != nil {
+				return fmt.Errorf("unable to create target store: %w", err)
+			}
+			if source == nil || target == nil {
+				return fmt.Errorf("storing content is disabled for the source or target store")
+			}
+
+			db, err := openDB()
+			if err != nil {
+				return err
+			}
+			result, err := contentstore.Backfill(cmd.Context(), db, source, target, dryRun, log.WithFields(log.Fields{
+				"service": "admin",
+			}))
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+	backfill.Flags().StringVar(&from, "from", "", "environment variable prefix of the source store")
+	backfill.Flags().BoolVar(&dryRun, "dry-run", false, "copy the content without updating the content paths")
+	command.AddCommand(backfill)
+	return command
+}
@@ -0,0 +1,86 @@
+// Package feed streams the blocks and events committed by the indexer using
+// Postgres LISTEN/NOTIFY. The indexer notifies a channel per event type when a
+// block is committed. Notifications are not durable, the subscriber catches up
+// from the event outbox after reconnecting
+package feed
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// BlockChannel is notified with a Block after every committed block
+const BlockChannel = "indexer_block"
+
+// eventChannelPrefix is the prefix of the event channels
+const eventChannelPrefix = "indexer_event_"
+
+// maxPayloadBytes keeps a notification below the 8000 byte payload limit of
+// Postgres, larger event data is loaded by the subscriber
+const maxPayloadBytes = 7900
+
+// EventTypes are the event types written to the event outbox
+var EventTypes = []string{
+	"cft20.mint",
+	"cft20.transfer",
+	"cft20.burn",
+	"inscription.inscribe",
+	"inscription.transfer",
+	"listing.created",
+	"listing.deposited",
+	"listing.filled",
+	"listing.cancelled",
+	"launchpad.reservation",
+	"bridge.send",
+	"bridge.recv",
+}
+
+// Event is a state change written to the event outbox
+type Event struct {
+	ID              uint64          `json:"id"`
+	Type            string          `json:"type"`
+	ChainID         string          `json:"chain_id"`
+	Height          uint64          `json:"height"`
+	TransactionHash string          `json:"transaction_hash"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DateCreated     time.Time       `json:"date_created"`
+	// Truncated is set when the data didn't fit in the notification
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Block is a committed block
+type Block struct {
+	ChainID       string    `json:"chain_id"`
+	Height        uint64    `json:"height"`
+	Transactions  int       `json:"transactions"`
+	Events        int       `json:"events"`
+	StateChecksum string    `json:"state_checksum"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// EventChannel returns the channel notified with events of eventType, ie
+// indexer_event_cft20_mint
+func EventChannel(eventType string) string {
+	return eventChannelPrefix + strings.ReplaceAll(eventType, ".", "_")
+}
+
+// EncodeEvent returns the notification payload of event. The data is left
+// out if the payload would exceed the notification limit
+func EncodeEvent(event Event) (string, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	if len(payload) <= maxPayloadBytes {
+		return string(payload), nil
+	}
+
+	event.Data = nil
+	event.Truncated = true
+	payload, err = json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
@@ -0,0 +1,36 @@
+package feed
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventChannel(t *testing.T) {
+	assert.Equal(t, "indexer_event_cft20_mint", EventChannel("cft20.mint"))
+	assert.Equal(t, "indexer_event_launchpad_reservation", EventChannel("launchpad.reservation"))
+}
+
+func TestEncodeEvent(t *testing.T) {
+	event := Event{ID: 1, Type: "cft20.mint", ChainID: "cosmoshub-4", Data: json.RawMessage(`{"ticker":"ROIDS"}`)}
+	payload, err := EncodeEvent(event)
+	assert.NoError(t, err)
+
+	var decoded Event
+	assert.NoError(t, json.Unmarshal([]byte(payload), &decoded))
+	assert.False(t, decoded.Truncated)
+	assert.JSONEq(t, `{"ticker":"ROIDS"}`, string(decoded.Data))
+
+	// Large data is left out and loaded by the subscriber
+	event.Data = json.RawMessage(`{"text":"` + strings.Repeat("a", maxPayloadBytes) + `"}`)
+	payload, err = EncodeEvent(event)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(payload), maxPayloadBytes)
+	decoded = Event{}
+	assert.NoError(t, json.Unmarshal([]byte(payload), &decoded))
+	assert.True(t, decoded.Truncated)
+	assert.Empty(t, decoded.Data)
+	assert.Equal(t, uint64(1), decoded.ID)
+}
@@ -0,0 +1,233 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+)
+
+// maxReconnectDelay limits the wait between reconnection attempts
+const maxReconnectDelay = 30 * time.Second
+
+// Options configures a Subscriber
+type Options struct {
+	// EventTypes are the event types to receive, all event types when empty
+	EventTypes []string
+	// Blocks enables the block stream
+	Blocks bool
+	// Buffer is the size of the event and block channels
+	Buffer int
+}
+
+// Subscriber receives the blocks and events committed by the indexer. Events
+// are delivered at least once and in order per chain, events committed while
+// the subscriber was disconnected are loaded from the event outbox. Blocks
+// committed while disconnected are not delivered
+type Subscriber struct {
+	dsn        string
+	eventTypes []string
+	blocks     bool
+	logger     *logrus.Entry
+
+	events      chan Event
+	blockEvents chan Block
+	// lastEventIDs is the ID of the last delivered event of every chain
+	lastEventIDs map[string]uint64
+}
+
+// NewSubscriber returns a subscriber for the indexer database at dsn
+func NewSubscriber(dsn string, options Options, logger *logrus.Entry) *Subscriber {
+	eventTypes := options.EventTypes
+	if len(eventTypes) == 0 {
+		eventTypes = EventTypes
+	}
+	return &Subscriber{
+		dsn:          dsn,
+		eventTypes:   eventTypes,
+		blocks:       options.Blocks,
+		logger:       logger,
+		events:       make(chan Event, options.Buffer),
+		blockEvents:  make(chan Block, options.Buffer),
+		lastEventIDs: make(map[string]uint64),
+	}
+}
+
+// Events returns the event stream, it is closed when Run returns
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Blocks returns the block stream, it is closed when Run returns
+func (s *Subscriber) Blocks() <-chan Block {
+	return s.blockEvents
+}
+
+// Run listens for notifications until ctx is done, reconnecting when the
+// connection is lost
+func (s *Subscriber) Run(ctx context.Context) error {
+	defer close(s.events)
+	defer close(s.blockEvents)
+
+	delay := time.Second
+	for {
+		connected, err := s.listen(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			delay = time.Second
+		}
+		s.logger.WithFields(logrus.Fields{
+			"err":   err,
+			"retry": delay,
+		}).Warn("Feed connection lost, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// listen connects, catches up on missed events and delivers notifications
+// until the connection fails. connected is true if listening started
+func (s *Subscriber) listen(ctx context.Context) (connected bool, err error) {
+	conn, err := pgx.Connect(ctx, s.dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	channels := make([]string, 0, len(s.eventTypes)+1)
+	for _, eventType := range s.eventTypes {
+		channels = append(channels, EventChannel(eventType))
+	}
+	if s.blocks {
+		channels = append(channels, BlockChannel)
+	}
+	for _, channel := range channels {
+		_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Listening has started, so events committed from now on are notified.
+	// Earlier events are loaded from the outbox
+	err = s.catchUp(ctx, conn)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		err = s.handle(ctx, conn, notification)
+		if err != nil {
+			return true, err
+		}
+	}
+}
+
+// catchUp delivers the events after the last delivered event of each chain.
+// On the first connection the subscriber starts at the current events
+func (s *Subscriber) catchUp(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, "SELECT chain_id FROM status")
+	if err != nil {
+		return err
+	}
+	chainIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	for _, chainID := range chainIDs {
+		lastEventID, ok := s.lastEventIDs[chainID]
+		if !ok {
+			err = conn.QueryRow(ctx, "SELECT COALESCE(MAX(id), 0) FROM event_outbox WHERE chain_id = $1", chainID).Scan(&lastEventID)
+			if err != nil {
+				return err
+			}
+			s.lastEventIDs[chainID] = lastEventID
+			continue
+		}
+
+		rows, err := conn.Query(ctx, `SELECT id, event_type, chain_id, height, transaction_hash, data, date_created
+			FROM event_outbox WHERE chain_id = $1 AND id > $2 AND event_type = ANY($3) ORDER BY id`, chainID, lastEventID, s.eventTypes)
+		if err != nil {
+			return err
+		}
+		events, err := pgx.CollectRows(rows, scanEvent)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			err = s.deliverEvent(ctx, event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handle delivers a notification
+func (s *Subscriber) handle(ctx context.Context, conn *pgx.Conn, notification *pgconn.Notification) error {
+	if notification.Channel == BlockChannel {
+		var block Block
+		err := json.Unmarshal([]byte(notification.Payload), &block)
+		if err != nil {
+			return fmt.Errorf("unable to decode block notification: %w", err)
+		}
+		select {
+		case s.blockEvents <- block:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var event Event
+	err := json.Unmarshal([]byte(notification.Payload), &event)
+	if err != nil {
+		return fmt.Errorf("unable to decode event notification: %w", err)
+	}
+	if event.Truncated {
+		err = conn.QueryRow(ctx, "SELECT data FROM event_outbox WHERE id = $1", event.ID).Scan(&event.Data)
+		if err != nil {
+			return fmt.Errorf("unable to load data of event %d: %w", event.ID, err)
+		}
+		event.Truncated = false
+	}
+	return s.deliverEvent(ctx, event)
+}
+
+// deliverEvent sends event to the stream unless it was delivered before
+func (s *Subscriber) deliverEvent(ctx context.Context, event Event) error {
+	if event.ID <= s.lastEventIDs[event.ChainID] {
+		return nil
+	}
+	select {
+	case s.events <- event:
+		s.lastEventIDs[event.ChainID] = event.ID
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// scanEvent scans an event_outbox row
+func scanEvent(row pgx.CollectableRow) (Event, error) {
+	var event Event
+	err := row.Scan(&event.ID, &event.Type, &event.ChainID, &event.Height, &event.TransactionHash, &event.Data, &event.DateCreated)
+	return event, err
+}
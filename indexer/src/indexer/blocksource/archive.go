@@ -0,0 +1,150 @@
+package blocksource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+)
+
+const (
+	// blockFilePrefix is the file name prefix of archived LCD blocks
+	blockFilePrefix = "block-"
+	// blockResultsFilePrefix is the file name prefix of archived RPC block
+	// results
+	blockResultsFilePrefix = "block_results-"
+	// archiveScanInterval limits how often the archive directory is scanned
+	// for new heights
+	archiveScanInterval = 5 * time.Second
+)
+
+// ArchiveSource reads blocks from a directory of archived JSON responses.
+// Each height has the LCD block response stored as block-<height>.json and
+// the RPC block_results response stored as block_results-<height>.json
+type ArchiveSource struct {
+	directory string
+
+	lock           sync.Mutex
+	earliestHeight uint64
+	latestHeight   uint64
+	scanTime       time.Time
+}
+
+// NewArchiveSource returns a new block source reading from directory
+func NewArchiveSource(directory string) (*ArchiveSource, error) {
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("block archive '%s' is not a directory", directory)
+	}
+
+	return &ArchiveSource{
+		directory: directory,
+	}, nil
+}
+
+// StartHeight returns the earliest archived height
+func (source *ArchiveSource) StartHeight(ctx context.Context) (uint64, error) {
+	err := source.scan()
+	if err != nil {
+		return 0, err
+	}
+
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	return source.earliestHeight, nil
+}
+
+// LatestHeight returns the height after the latest archived height so that
+// all archived blocks are indexed
+func (source *ArchiveSource) LatestHeight(ctx context.Context) (uint64, error) {
+	err := source.scan()
+	if err != nil {
+		return 0, err
+	}
+
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	return source.latestHeight + 1, nil
+}
+
+// Block reads the archived LCD block at height
+func (source *ArchiveSource) Block(ctx context.Context, height uint64) (types.LCDBlock, error) {
+	var block types.LCDBlock
+	err := source.read(ctx, blockFilePrefix, height, &block)
+	return block, err
+}
+
+// BlockResults reads the archived RPC block results at height
+func (source *ArchiveSource) BlockResults(ctx context.Context, height uint64) (types.RPCBlockResult, error) {
+	var blockResults types.RPCBlockResult
+	err := source.read(ctx, blockResultsFilePrefix, height, &blockResults)
+	return blockResults, err
+}
+
+// read decodes the archived JSON file for prefix and height into out
+func (source *ArchiveSource) read(ctx context.Context, prefix string, height uint64, out interface{}) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	file, err := os.Open(filepath.Join(source.directory, fmt.Sprintf("%s%d.json", prefix, height)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewDecoder(file).Decode(out)
+}
+
+// scan finds the earliest and latest archived heights. The directory is only
+// scanned again once archiveScanInterval has passed so that new blocks can be
+// added to the archive while the indexer is running
+func (source *ArchiveSource) scan() error {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+
+	if !source.scanTime.IsZero() && time.Since(source.scanTime) < archiveScanInterval {
+		return nil
+	}
+
+	entries, err := os.ReadDir(source.directory)
+	if err != nil {
+		return err
+	}
+
+	var earliestHeight, latestHeight uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, blockFilePrefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		height, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, blockFilePrefix), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if earliestHeight == 0 || height < earliestHeight {
+			earliestHeight = height
+		}
+		if height > latestHeight {
+			latestHeight = height
+		}
+	}
+	if latestHeight == 0 {
+		return fmt.Errorf("no blocks found in archive '%s'", source.directory)
+	}
+
+	source.earliestHeight = earliestHeight
+	source.latestHeight = latestHeight
+	source.scanTime = time.Now()
+	return nil
+}
@@ -0,0 +1,38 @@
+package blocksource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveSourceHeights(t *testing.T) {
+	source, err := NewArchiveSource("testdata")
+	assert.NoError(t, err)
+
+	startHeight, err := source.StartHeight(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), startHeight, "start height should be the earliest archived height")
+
+	latestHeight, err := source.LatestHeight(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(102), latestHeight, "latest height should be after the last archived height")
+}
+
+func TestArchiveSourceBlock(t *testing.T) {
+	source, err := NewArchiveSource("testdata")
+	assert.NoError(t, err)
+
+	block, err := source.Block(context.Background(), 101)
+	assert.NoError(t, err)
+	assert.Equal(t, "101", block.Block.Header.Height)
+	assert.Equal(t, "gaialocal-1", block.Block.Header.ChainID)
+
+	blockResults, err := source.BlockResults(context.Background(), 101)
+	assert.NoError(t, err)
+	assert.Equal(t, "101", blockResults.Result.Height)
+
+	_, err = source.Block(context.Background(), 102)
+	assert.Error(t, err, "missing height should return an error")
+}
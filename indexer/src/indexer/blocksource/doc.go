@@ -0,0 +1,3 @@
+// Package blocksource provides the blocks and block results the indexer
+// processes, either from the chain or from a local archive
+package blocksource
@@ -0,0 +1,67 @@
+package blocksource
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/endpoints"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+)
+
+// HTTPSource fetches blocks from the LCD and block results from the RPC
+// endpoints of the chain
+type HTTPSource struct {
+	lcdPool *endpoints.Pool
+	rpcPool *endpoints.Pool
+}
+
+// NewHTTPSource returns a new block source using the LCD and RPC pools
+func NewHTTPSource(lcdPool *endpoints.Pool, rpcPool *endpoints.Pool) *HTTPSource {
+	return &HTTPSource{
+		lcdPool: lcdPool,
+		rpcPool: rpcPool,
+	}
+}
+
+// StartHeight returns the current height of the chain
+func (source *HTTPSource) StartHeight(ctx context.Context) (uint64, error) {
+	return source.LatestHeight(ctx)
+}
+
+// LatestHeight fetches the current height from the chain by using the LCD
+// latest block endpoint
+func (source *HTTPSource) LatestHeight(ctx context.Context) (uint64, error) {
+	var block types.LCDBlock
+	err := source.lcdPool.GetJSON(ctx, "/cosmos/base/tendermint/v1beta1/blocks/latest", 0, nil, &block)
+	if err != nil {
+		return 0, err
+	}
+
+	if block.Code != 0 {
+		return 0, fmt.Errorf("error fetching current height: %s", block.Message)
+	}
+	return strconv.ParseUint(block.Block.Header.Height, 10, 64)
+}
+
+// Block fetches the block at height from an LCD endpoint that has it
+func (source *HTTPSource) Block(ctx context.Context, height uint64) (types.LCDBlock, error) {
+	var block types.LCDBlock
+	err := source.lcdPool.GetJSON(ctx, fmt.Sprintf("/cosmos/base/tendermint/v1beta1/blocks/%d", height), height, nil, &block)
+	if err != nil {
+		return block, err
+	}
+
+	if block.Code != 0 {
+		return block, fmt.Errorf("error fetching block: %s", block.Message)
+	}
+	return block, nil
+}
+
+// BlockResults fetches the block results at height from an RPC endpoint
+// that has it
+func (source *HTTPSource) BlockResults(ctx context.Context, height uint64) (types.RPCBlockResult, error) {
+	var blockResults types.RPCBlockResult
+	err := source.rpcPool.GetJSON(ctx, fmt.Sprintf("/block_results?height=%d", height), height, nil, &blockResults)
+	return blockResults, err
+}
@@ -0,0 +1,20 @@
+package blocksource
+
+import (
+	"context"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+)
+
+// BlockSource provides blocks and their results by height
+type BlockSource interface {
+	// StartHeight returns the height to start indexing from when nothing
+	// has been indexed yet
+	StartHeight(ctx context.Context) (uint64, error)
+	// LatestHeight returns the latest height of the chain. Blocks are
+	// indexed up to, but not including, the latest height
+	LatestHeight(ctx context.Context) (uint64, error)
+	// Block returns the LCD block at height
+	Block(ctx context.Context, height uint64) (types.LCDBlock, error)
+	// BlockResults returns the RPC block results at height
+	BlockResults(ctx context.Context, height uint64) (types.RPCBlockResult, error)
+}
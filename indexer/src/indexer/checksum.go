@@ -0,0 +1,442 @@
+package indexer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// checksumBatchSize is the number of checksums read at a time when
+// comparing databases
+const checksumBatchSize = 10000
+
+// stateIDColumns are the primary key columns of the tables in stateQueries,
+// used to load the state of the rows changed in a block
+var stateIDColumns = map[string]string{
+	"token_holder":               "th.id",
+	"inscription":                "i.id",
+	"marketplace_listing":        "ml.id",
+	"launchpad_mint_reservation": "r.id",
+}
+
+// stateChangesKey is the context key of the stateChanges of a block
+type stateChangesKey struct{}
+
+// stateValue is the state of a row before the block changed it
+type stateValue struct {
+	entry  stateEntry
+	exists bool
+}
+
+// stateChanges tracks the state rows written while processing a block. The
+// value before the first write is kept so that rows that end up unchanged,
+// ie by a rolled back operation, are not part of the checksum
+type stateChanges struct {
+	lock   sync.Mutex
+	before map[string]map[uint64]stateValue
+}
+
+// stateChange is a state entry that changed in a block
+type stateChange struct {
+	Table   string
+	Key     string
+	Value   string
+	Removed bool
+}
+
+// newStateChanges returns an empty change set
+func newStateChanges() *stateChanges {
+	return &stateChanges{
+		before: make(map[string]map[uint64]stateValue),
+	}
+}
+
+// withStateChanges returns a context that records the state changes made by
+// database statements executed with it
+func withStateChanges(ctx context.Context, changes *stateChanges) context.Context {
+	return context.WithValue(ctx, stateChangesKey{}, changes)
+}
+
+// registerStateCallbacks adds gorm callbacks to db that record writes to the
+// state tables for statements with a stateChanges context
+func registerStateCallbacks(db *gorm.DB) error {
+	err := db.Callback().Create().After("gorm:create").Register("indexer:state_create", trackStateCreate)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Update().Before("gorm:update").Register("indexer:state_update", trackStateWrite)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("gorm:delete").Register("indexer:state_delete", trackStateWrite)
+}
+
+// trackStateCreate records rows created in a state table, these didn't
+// exist before the block
+func trackStateCreate(db *gorm.DB) {
+	changes, table, ids := stateStatement(db)
+	if changes == nil || db.Error != nil {
+		return
+	}
+
+	changes.lock.Lock()
+	defer changes.lock.Unlock()
+	for _, id := range ids {
+		if _, ok := changes.before[table][id]; !ok {
+			changes.add(table, id, stateValue{})
+		}
+	}
+}
+
+// trackStateWrite records the current value of rows in a state table before
+// they are updated or deleted
+func trackStateWrite(db *gorm.DB) {
+	changes, table, ids := stateStatement(db)
+	if changes == nil || db.Error != nil {
+		return
+	}
+
+	changes.lock.Lock()
+	defer changes.lock.Unlock()
+	var newIDs []uint64
+	for _, id := range ids {
+		if _, ok := changes.before[table][id]; !ok {
+			newIDs = append(newIDs, id)
+		}
+	}
+	if len(newIDs) == 0 {
+		return
+	}
+
+	entries, err := loadStateEntries(db.Session(&gorm.Session{NewDB: true}), table, newIDs)
+	if err != nil {
+		db.AddError(fmt.Errorf("unable to load state before write: %w", err))
+		return
+	}
+	for _, id := range newIDs {
+		entry, exists := entries[id]
+		changes.add(table, id, stateValue{entry: entry, exists: exists})
+	}
+}
+
+// add records the value of a row before the block, the lock must be held
+func (changes *stateChanges) add(table string, id uint64, value stateValue) {
+	if changes.before[table] == nil {
+		changes.before[table] = make(map[uint64]stateValue)
+	}
+	changes.before[table][id] = value
+}
+
+// stateStatement returns the change set, state table and primary keys of
+// the rows written by the statement. A nil change set is returned when the
+// statement doesn't need to be tracked
+func stateStatement(db *gorm.DB) (*stateChanges, string, []uint64) {
+	statement := db.Statement
+	if statement.Context == nil || statement.Schema == nil || statement.Schema.PrioritizedPrimaryField == nil {
+		return nil, "", nil
+	}
+	changes, ok := statement.Context.Value(stateChangesKey{}).(*stateChanges)
+	if !ok {
+		return nil, "", nil
+	}
+	if _, ok := stateIDColumns[statement.Table]; !ok {
+		return nil, "", nil
+	}
+
+	var ids []uint64
+	addID := func(value reflect.Value) {
+		id, zero := statement.Schema.PrioritizedPrimaryField.ValueOf(statement.Context, value)
+		if !zero {
+			if id, ok := id.(uint64); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	value := reflect.Indirect(statement.ReflectValue)
+	switch value.Kind() {
+	case reflect.Struct:
+		addID(value)
+	case reflect.Slice, reflect.Array:
+		for index := 0; index < value.Len(); index++ {
+			addID(reflect.Indirect(value.Index(index)))
+		}
+	}
+	return changes, statement.Table, ids
+}
+
+// loadStateEntries returns the state entries of the rows with ids in table
+func loadStateEntries(db *gorm.DB, table string, ids []uint64) (map[uint64]stateEntry, error) {
+	var entries []stateEntry
+	err := db.Raw(stateQueries[table]+" WHERE "+stateIDColumns[table]+" IN ?", ids).Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	entriesByID := make(map[uint64]stateEntry, len(entries))
+	for _, entry := range entries {
+		entriesByID[entry.ID] = entry
+	}
+	return entriesByID, nil
+}
+
+// changed compares the recorded rows with their current state and returns
+// the entries that changed
+func (changes *stateChanges) changed(db *gorm.DB) ([]stateChange, error) {
+	changes.lock.Lock()
+	defer changes.lock.Unlock()
+
+	var changed []stateChange
+	for table, before := range changes.before {
+		ids := make([]uint64, 0, len(before))
+		for id := range before {
+			ids = append(ids, id)
+		}
+		current, err := loadStateEntries(db, table, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for id, previous := range before {
+			entry, exists := current[id]
+			switch {
+			case exists && (!previous.exists || previous.entry != entry):
+				changed = append(changed, stateChange{Table: table, Key: entry.Key, Value: entry.Value})
+			case !exists && previous.exists:
+				changed = append(changed, stateChange{Table: table, Key: previous.entry.Key, Removed: true})
+			}
+		}
+	}
+	return changed, nil
+}
+
+// blockChecksum chains the changes of a block onto the previous checksum.
+// The changes are sorted by table and key and hashed as "table\tkey\tvalue\n",
+// or "table\tkey\n" when removed, after the previous checksum and a newline.
+// Blocks without changes keep the previous checksum
+func blockChecksum(previous string, changes []stateChange) string {
+	if len(changes) == 0 {
+		return previous
+	}
+
+	sort.Slice(changes, func(a, b int) bool {
+		if changes[a].Table != changes[b].Table {
+			return changes[a].Table < changes[b].Table
+		}
+		return changes[a].Key < changes[b].Key
+	})
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n", previous)
+	for _, change := range changes {
+		if change.Removed {
+			fmt.Fprintf(hash, "%s\t%s\n", change.Table, change.Key)
+			continue
+		}
+		fmt.Fprintf(hash, "%s\t%s\t%s\n", change.Table, change.Key, change.Value)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// commitChecksum calculates the checksum of the block at height from the
+// recorded changes and stores it when the state changed. The new checksum
+// is returned
+func (i *Indexer) commitChecksum(db *gorm.DB, changes *stateChanges, height uint64, blockTime time.Time, previous string) (string, error) {
+	changed, err := changes.changed(db)
+	if err != nil {
+		return "", fmt.Errorf("unable to load changed state: %w", err)
+	}
+	checksum := blockChecksum(previous, changed)
+	if len(changed) == 0 {
+		return checksum, nil
+	}
+
+	// A block that is applied again must arrive at the checksum stored the
+	// first time, the stored checksum is kept
+	var stored models.BlockChecksum
+	result := db.Where("chain_id = ? AND height = ?", i.chainID, height).Limit(1).Find(&stored)
+	if result.Error != nil {
+		return "", fmt.Errorf("unable to load checksum: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		if stored.Checksum != checksum {
+			return "", fmt.Errorf("checksum %s of height %d does not match the stored checksum %s", checksum, height, stored.Checksum)
+		}
+		return checksum, nil
+	}
+
+	checksumModel := models.BlockChecksum{
+		ChainID:     i.chainID,
+		Height:      height,
+		Checksum:    checksum,
+		Changes:     uint64(len(changed)),
+		DateCreated: blockTime,
+	}
+	err = db.Create(&checksumModel).Error
+	if err != nil {
+		return "", fmt.Errorf("unable to store checksum: %w", err)
+	}
+	return checksum, nil
+}
+
+// ChecksumComparison is the result of comparing the checksums of a chain
+// between two databases
+type ChecksumComparison struct {
+	ChainID string `json:"chain_id"`
+	// Height is the last height processed by both databases
+	Height uint64 `json:"height"`
+	// DivergedHeight is the first height where the checksums differ, 0 if
+	// they agree up to Height
+	DivergedHeight uint64 `json:"diverged_height,omitempty"`
+	// Checksum and OtherChecksum are the checksums at DivergedHeight, or at
+	// Height when the databases agree
+	Checksum      string `json:"checksum"`
+	OtherChecksum string `json:"other_checksum"`
+}
+
+// CompareChecksums compares the state checksums of every configured chain
+// with the database at otherDSN up to the last height both have processed
+func (s *Service) CompareChecksums(ctx context.Context, otherDSN string) ([]ChecksumComparison, error) {
+	otherDB, err := gorm.Open(postgres.Open(otherDSN), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var comparisons []ChecksumComparison
+	for _, indexer := range s.indexers {
+		comparison, err := compareChainChecksums(s.db.WithContext(ctx), otherDB.WithContext(ctx), indexer.chainID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compare chain '%s': %w", indexer.chainID, err)
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	return comparisons, nil
+}
+
+// compareChainChecksums compares the checksums of chainID in db and otherDB
+func compareChainChecksums(db *gorm.DB, otherDB *gorm.DB, chainID string) (ChecksumComparison, error) {
+	comparison := ChecksumComparison{
+		ChainID: chainID,
+	}
+
+	var status, otherStatus models.Status
+	err := db.Where("chain_id = ?", chainID).First(&status).Error
+	if err != nil {
+		return comparison, err
+	}
+	err = otherDB.Where("chain_id = ?", chainID).First(&otherStatus).Error
+	if err != nil {
+		return comparison, err
+	}
+	comparison.Height = status.LastProcessedHeight
+	if otherStatus.LastProcessedHeight < comparison.Height {
+		comparison.Height = otherStatus.LastProcessedHeight
+	}
+
+	comparison.DivergedHeight, comparison.Checksum, comparison.OtherChecksum, err = firstDivergence(
+		newChecksumReader(db, chainID, comparison.Height).next,
+		newChecksumReader(otherDB, chainID, comparison.Height).next,
+	)
+	return comparison, err
+}
+
+// checksumReader reads the stored checksums of a chain in height order
+type checksumReader struct {
+	db        *gorm.DB
+	chainID   string
+	maxHeight uint64
+	after     uint64
+	started   bool
+	done      bool
+	batch     []models.BlockChecksum
+}
+
+// newChecksumReader returns a reader for the checksums of chainID up to and
+// including maxHeight
+func newChecksumReader(db *gorm.DB, chainID string, maxHeight uint64) *checksumReader {
+	return &checksumReader{
+		db:        db,
+		chainID:   chainID,
+		maxHeight: maxHeight,
+	}
+}
+
+// next returns the next checksum, false is returned when there are none left
+func (reader *checksumReader) next() (models.BlockChecksum, bool, error) {
+	if len(reader.batch) == 0 && !reader.done {
+		query := reader.db.Where("chain_id = ? AND height <= ?", reader.chainID, reader.maxHeight)
+		if reader.started {
+			query = query.Where("height > ?", reader.after)
+		}
+		err := query.Order("height").Limit(checksumBatchSize).Find(&reader.batch).Error
+		if err != nil {
+			return models.BlockChecksum{}, false, err
+		}
+		reader.started = true
+		reader.done = len(reader.batch) < checksumBatchSize
+	}
+	if len(reader.batch) == 0 {
+		return models.BlockChecksum{}, false, nil
+	}
+
+	checksum := reader.batch[0]
+	reader.batch = reader.batch[1:]
+	reader.after = checksum.Height
+	return checksum, true, nil
+}
+
+// firstDivergence walks two checksum sequences in height order and returns
+// the first height where the checksums in effect differ with both checksums.
+// A height of 0 is returned with the final checksums when they never differ
+func firstDivergence(next func() (models.BlockChecksum, bool, error), otherNext func() (models.BlockChecksum, bool, error)) (uint64, string, string, error) {
+	var current, otherCurrent string
+	checksum, ok, err := next()
+	if err != nil {
+		return 0, "", "", err
+	}
+	otherChecksum, otherOK, err := otherNext()
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	for ok || otherOK {
+		var height uint64
+		switch {
+		case !otherOK || (ok && checksum.Height < otherChecksum.Height):
+			height = checksum.Height
+		default:
+			height = otherChecksum.Height
+		}
+
+		if ok && checksum.Height == height {
+			current = checksum.Checksum
+			checksum, ok, err = next()
+			if err != nil {
+				return 0, "", "", err
+			}
+		}
+		if otherOK && otherChecksum.Height == height {
+			otherCurrent = otherChecksum.Checksum
+			otherChecksum, otherOK, err = otherNext()
+			if err != nil {
+				return 0, "", "", err
+			}
+		}
+
+		if current != otherCurrent {
+			return height, current, otherCurrent, nil
+		}
+	}
+	return 0, current, otherCurrent, nil
+}
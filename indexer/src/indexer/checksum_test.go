@@ -0,0 +1,91 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockChecksum(t *testing.T) {
+	changes := []stateChange{
+		{Table: "token_holder", Key: "ROIDS/cosmos1b", Value: "10"},
+		{Table: "inscription", Key: "ABC", Value: "cosmos1a"},
+		{Table: "token_holder", Key: "ROIDS/cosmos1a", Value: "5"},
+	}
+	reordered := []stateChange{changes[2], changes[0], changes[1]}
+
+	checksum := blockChecksum("", changes)
+	assert.Len(t, checksum, 64)
+	assert.Equal(t, checksum, blockChecksum("", reordered), "the order of changes should not matter")
+	assert.NotEqual(t, checksum, blockChecksum("previous", changes), "checksums should be chained")
+	assert.Equal(t, "previous", blockChecksum("previous", nil), "blocks without changes keep the checksum")
+
+	removed := []stateChange{{Table: "inscription", Key: "ABC", Removed: true}}
+	assert.NotEqual(t, blockChecksum("", []stateChange{{Table: "inscription", Key: "ABC"}}), blockChecksum("", removed))
+}
+
+// checksumSequence returns a reader over checksums
+func checksumSequence(checksums ...models.BlockChecksum) func() (models.BlockChecksum, bool, error) {
+	return func() (models.BlockChecksum, bool, error) {
+		if len(checksums) == 0 {
+			return models.BlockChecksum{}, false, nil
+		}
+		checksum := checksums[0]
+		checksums = checksums[1:]
+		return checksum, true, nil
+	}
+}
+
+func TestFirstDivergence(t *testing.T) {
+	height, _, _, err := firstDivergence(
+		checksumSequence(models.BlockChecksum{Height: 1, Checksum: "a"}, models.BlockChecksum{Height: 5, Checksum: "b"}),
+		checksumSequence(models.BlockChecksum{Height: 1, Checksum: "a"}, models.BlockChecksum{Height: 5, Checksum: "b"}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), height)
+
+	height, checksum, otherChecksum, err := firstDivergence(
+		checksumSequence(models.BlockChecksum{Height: 1, Checksum: "a"}, models.BlockChecksum{Height: 5, Checksum: "b"}),
+		checksumSequence(models.BlockChecksum{Height: 1, Checksum: "a"}, models.BlockChecksum{Height: 5, Checksum: "c"}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), height)
+	assert.Equal(t, "b", checksum)
+	assert.Equal(t, "c", otherChecksum)
+
+	height, _, _, err = firstDivergence(
+		checksumSequence(models.BlockChecksum{Height: 1, Checksum: "a"}, models.BlockChecksum{Height: 3, Checksum: "b"}),
+		checksumSequence(models.BlockChecksum{Height: 1, Checksum: "a"}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), height, "a change missing from one database is a divergence")
+}
+
+func TestCommitChecksumReapplied(t *testing.T) {
+	db := newTestDB(t, &models.Transaction{}, &models.Inscription{}, &models.BlockChecksum{})
+	assert.NoError(t, db.Create(&models.Transaction{ID: 1, ChainID: "cosmoshub-4", Hash: "ABC"}).Error)
+	assert.NoError(t, db.Create(&models.Inscription{ID: 1, ChainID: "cosmoshub-4", TransactionID: 1, CurrentOwner: "cosmos1a"}).Error)
+	indexer := &Indexer{chainID: "cosmoshub-4"}
+
+	// The block created the inscription
+	commit := func(previous string) (string, error) {
+		changes := newStateChanges()
+		changes.add("inscription", 1, stateValue{})
+		return indexer.commitChecksum(db, changes, 10, time.Now(), previous)
+	}
+	checksum, err := commit("previous")
+	assert.NoError(t, err)
+
+	// Applying the block again after a restart keeps the stored checksum
+	reappliedChecksum, err := commit("previous")
+	assert.NoError(t, err)
+	assert.Equal(t, checksum, reappliedChecksum)
+	var count int64
+	assert.NoError(t, db.Model(&models.BlockChecksum{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count, "the checksum should be stored once")
+
+	_, err = commit(checksum)
+	assert.ErrorContains(t, err, "does not match the stored checksum", "chaining the block onto itself should fail")
+}
@@ -0,0 +1,6 @@
+// Package contentpolicy validates the content of inscriptions, token logos
+// and troll box posts. The type of the content is sniffed from its bytes
+// rather than taken from the declared mime type, and checked against the
+// allowed types, the maximum size and the handling of active content, ie
+// HTML or SVG with scripts
+package contentpolicy
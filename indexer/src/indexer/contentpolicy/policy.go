@@ -0,0 +1,125 @@
+package contentpolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ActiveContent is the handling of content that can run scripts
+type ActiveContent string
+
+const (
+	// ActiveContentAllow stores active content with its own type
+	ActiveContentAllow ActiveContent = "allow"
+	// ActiveContentSandbox stores active content as SandboxType so that it
+	// is never rendered from the content store, clients render it sandboxed
+	ActiveContentSandbox ActiveContent = "sandbox"
+	// ActiveContentReject rejects active content
+	ActiveContentReject ActiveContent = "reject"
+)
+
+// SandboxType is the type sandboxed content is stored with
+const SandboxType = "text/plain; charset=utf-8"
+
+// Violation is the reason content is not accepted by a policy
+type Violation string
+
+const (
+	ViolationNone           Violation = ""
+	ViolationTooLarge       Violation = "too_large"
+	ViolationTypeNotAllowed Violation = "type_not_allowed"
+	ViolationActiveContent  Violation = "active_content"
+)
+
+// Policy is the content accepted by a metaprotocol
+type Policy struct {
+	// AllowedTypes are media types, ie image/png, or type wildcards, ie
+	// image/*. All types are allowed when empty
+	AllowedTypes []string
+	// MaxBytes is the maximum content size, unlimited when 0
+	MaxBytes int
+	// ActiveContent is the handling of content that can run scripts
+	ActiveContent ActiveContent
+}
+
+// Result is the outcome of checking content against a policy
+type Result struct {
+	// DeclaredType is the media type given with the content
+	DeclaredType string
+	// DetectedType is the media type sniffed from the content
+	DetectedType string
+	// Active is set if the content can run scripts
+	Active bool
+	// StoreType is the type the content is stored and served with
+	StoreType string
+	// Violation is the reason the content is not accepted, ViolationNone if
+	// it is accepted
+	Violation Violation
+}
+
+// NewPolicy returns a policy, activeContent must be allow, sandbox or reject
+func NewPolicy(allowedTypes []string, maxBytes int, activeContent string) (Policy, error) {
+	policy := Policy{
+		MaxBytes:      maxBytes,
+		ActiveContent: ActiveContent(strings.ToLower(activeContent)),
+	}
+	switch policy.ActiveContent {
+	case ActiveContentAllow, ActiveContentSandbox, ActiveContentReject:
+	default:
+		return Policy{}, fmt.Errorf("unknown active content handling '%s', use allow, sandbox or reject", activeContent)
+	}
+	if maxBytes < 0 {
+		return Policy{}, fmt.Errorf("maximum content size must not be negative")
+	}
+	for _, allowedType := range allowedTypes {
+		allowedType = strings.ToLower(strings.TrimSpace(allowedType))
+		if allowedType == "" {
+			continue
+		}
+		if !strings.Contains(allowedType, "/") {
+			return Policy{}, fmt.Errorf("invalid allowed type '%s'", allowedType)
+		}
+		policy.AllowedTypes = append(policy.AllowedTypes, allowedType)
+	}
+	return policy, nil
+}
+
+// Check sniffs the type of content and checks it against the policy. The
+// result is returned for content that is not accepted too
+func (policy Policy) Check(declaredType string, content []byte) Result {
+	result := Result{
+		DeclaredType: MediaType(declaredType),
+		DetectedType: Detect(declaredType, content),
+	}
+	result.Active = IsActive(result.DetectedType, content)
+	result.StoreType = result.DetectedType
+	if result.Active && policy.ActiveContent != ActiveContentAllow {
+		result.StoreType = SandboxType
+	}
+
+	switch {
+	case policy.MaxBytes > 0 && len(content) > policy.MaxBytes:
+		result.Violation = ViolationTooLarge
+	case !policy.Allows(result.DetectedType):
+		result.Violation = ViolationTypeNotAllowed
+	case result.Active && policy.ActiveContent == ActiveContentReject:
+		result.Violation = ViolationActiveContent
+	}
+	return result
+}
+
+// Allows returns true if mediaType is one of the allowed types
+func (policy Policy) Allows(mediaType string) bool {
+	if len(policy.AllowedTypes) == 0 {
+		return true
+	}
+	for _, allowedType := range policy.AllowedTypes {
+		if allowedType == mediaType || allowedType == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowedType, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
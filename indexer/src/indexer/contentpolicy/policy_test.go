@@ -0,0 +1,57 @@
+package contentpolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pngContent = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+func TestDetect(t *testing.T) {
+	assert.Equal(t, "image/png", Detect("image/jpeg", pngContent), "the sniffed type should win over the declared type")
+	assert.Equal(t, "text/html", Detect("image/png", []byte("<!DOCTYPE html><html><body>hi</body></html>")))
+	assert.Equal(t, "image/svg+xml", Detect("image/png", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`)))
+	assert.Equal(t, "text/markdown", Detect("text/markdown; charset=utf-8", []byte("# Title")))
+	assert.Equal(t, "application/json", Detect("", []byte(`{"name": "test"}`)))
+	assert.Equal(t, "text/plain", Detect("text/html", []byte("plain text")), "HTML should only be detected from the content")
+	assert.Equal(t, "image/avif", Detect("image/avif", []byte("\x00\x00\x00\x1cftypavif")))
+	assert.Equal(t, "application/octet-stream", Detect("image/svg+xml", []byte("\x00\x01\x02")))
+}
+
+func TestIsActive(t *testing.T) {
+	assert.True(t, IsActive("image/svg+xml", []byte(`<svg><script>alert(1)</script></svg>`)))
+	assert.True(t, IsActive("image/svg+xml", []byte(`<svg onload="alert(1)"></svg>`)))
+	assert.True(t, IsActive("text/html", []byte(`<a href="javascript:alert(1)">x</a>`)))
+	assert.False(t, IsActive("image/svg+xml", []byte(`<svg><rect width="10" height="10"/></svg>`)))
+	assert.False(t, IsActive("text/plain", []byte(`<script>alert(1)</script>`)), "plain text is never rendered")
+}
+
+func TestCheck(t *testing.T) {
+	policy, err := NewPolicy([]string{"image/*", "text/plain"}, 32, "sandbox")
+	assert.NoError(t, err)
+
+	result := policy.Check("image/png", pngContent)
+	assert.Equal(t, ViolationNone, result.Violation)
+	assert.Equal(t, "image/png", result.StoreType)
+
+	result = policy.Check("image/png", []byte("<html><b>hi</b>"))
+	assert.Equal(t, ViolationTypeNotAllowed, result.Violation)
+	assert.Equal(t, "image/png", result.DeclaredType)
+	assert.Equal(t, "text/html", result.DetectedType)
+
+	result = policy.Check("image/png", append(pngContent, make([]byte, 32)...))
+	assert.Equal(t, ViolationTooLarge, result.Violation)
+
+	svg := []byte(`<svg onload="x()">`)
+	result = policy.Check("image/svg+xml", svg)
+	assert.Equal(t, ViolationNone, result.Violation)
+	assert.True(t, result.Active)
+	assert.Equal(t, SandboxType, result.StoreType)
+
+	policy.ActiveContent = ActiveContentReject
+	assert.Equal(t, ViolationActiveContent, policy.Check("image/svg+xml", svg).Violation)
+
+	_, err = NewPolicy(nil, 0, "ignore")
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package contentpolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// sniffLength is the number of bytes inspected for SVG markup, the same as
+// http.DetectContentType
+const sniffLength = 512
+
+// markupTypes can embed scripts
+var markupTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// scriptTypes are executed by browsers
+var scriptTypes = map[string]bool{
+	"text/javascript":        true,
+	"application/javascript": true,
+	"text/ecmascript":        true,
+	"application/ecmascript": true,
+}
+
+// svgPattern matches the root element of an SVG document, after an optional
+// XML declaration, doctype or comments
+var svgPattern = regexp.MustCompile(`(?is)^\s*(<\?xml[^>]*>\s*)?(<!--.*?-->\s*|<!doctype[^>]*>\s*)*<svg[\s>]`)
+
+// activePattern matches markup that runs scripts or embeds other documents
+var activePattern = regexp.MustCompile(`(?i)<script[\s>/]|<iframe[\s>/]|<object[\s>/]|<embed[\s>/]|<foreignobject[\s>/]|<meta[^>]+http-equiv\s*=\s*["']?refresh|\son[a-z]+\s*=|javascript:`)
+
+// MediaType returns the lowercase media type of mimeType without parameters,
+// or an empty string if it can't be parsed
+func MediaType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mediaType)
+}
+
+// Detect returns the media type of content. The declared type is only used
+// for content that can't be told apart by its bytes: text formats, ie
+// markdown and JSON, and binary formats that aren't sniffed, ie AVIF. HTML
+// and SVG are only detected from the content itself
+func Detect(declaredType string, content []byte) string {
+	declared := MediaType(declaredType)
+	detected := MediaType(http.DetectContentType(content))
+
+	switch detected {
+	case "text/plain", "text/xml":
+		if isSVG(content) {
+			return "image/svg+xml"
+		}
+		if isText(declared) && !markupTypes[declared] {
+			return declared
+		}
+		if json.Valid(content) {
+			return "application/json"
+		}
+	case "application/octet-stream":
+		// Binary content that isn't sniffed is trusted to be of its declared
+		// type, unless that type is sniffed and would have been detected
+		if declared != "" && !isText(declared) && !markupTypes[declared] {
+			return declared
+		}
+	}
+	return detected
+}
+
+// IsActive returns true if content of mediaType can run scripts when it is
+// opened in a browser
+func IsActive(mediaType string, content []byte) bool {
+	if scriptTypes[mediaType] {
+		return true
+	}
+	if !markupTypes[mediaType] {
+		return false
+	}
+	return activePattern.Match(content)
+}
+
+// isSVG returns true if content starts with an SVG document
+func isSVG(content []byte) bool {
+	if len(content) > sniffLength {
+		content = content[:sniffLength]
+	}
+	// Skip a UTF-8 byte order mark
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	return svgPattern.Match(content)
+}
+
+// isText returns true if mediaType is a text format
+func isText(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return true
+	case mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return scriptTypes[mediaType]
+}
@@ -0,0 +1,119 @@
+package contentstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"path"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// contentTables have a content_path column referencing the content store
+var contentTables = []string{
+	"token",
+	"collection",
+	"inscription",
+	"troll_post",
+}
+
+// BackfillResult counts the content paths handled by a backfill
+type BackfillResult struct {
+	Migrated int `json:"migrated"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// Backfill copies the content referenced by the content tables from source
+// to target and updates the content paths. Content already in target is
+// skipped, so an interrupted backfill can be run again. Content that can't
+// be copied is logged and left in source. With dryRun the content is copied
+// but the content paths are not updated
+func Backfill(ctx context.Context, db *gorm.DB, source ContentStore, target ContentStore, dryRun bool, logger *logrus.Entry) (BackfillResult, error) {
+	var result BackfillResult
+
+	query := ""
+	for index, table := range contentTables {
+		if index > 0 {
+			query += " UNION "
+		}
+		query += fmt.Sprintf("SELECT content_path FROM %s WHERE content_path <> ''", table)
+	}
+	var contentPaths []string
+	err := db.WithContext(ctx).Raw(query + " ORDER BY content_path").Scan(&contentPaths).Error
+	if err != nil {
+		return result, err
+	}
+
+	for _, contentPath := range contentPaths {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		newPath, err := migrateContent(ctx, source, target, contentPath)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"content_path": contentPath,
+				"err":          err,
+			}).Warn("Unable to migrate content")
+			result.Failed++
+			continue
+		}
+		if newPath == contentPath {
+			result.Skipped++
+			continue
+		}
+
+		if !dryRun {
+			err = db.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+				for _, table := range contentTables {
+					err := dbTx.Exec(fmt.Sprintf("UPDATE %s SET content_path = ? WHERE content_path = ?", table), newPath, contentPath).Error
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return result, err
+			}
+		}
+		logger.WithFields(logrus.Fields{
+			"content_path": contentPath,
+			"new_path":     newPath,
+		}).Debug("Migrated content")
+		result.Migrated++
+	}
+	return result, nil
+}
+
+// migrateContent copies the content at contentPath from source to target
+// under its content key and returns the new content path. contentPath is
+// returned unchanged if it is a content path of target
+func migrateContent(ctx context.Context, source ContentStore, target ContentStore, contentPath string) (string, error) {
+	key, err := KeyOf(contentPath)
+	if err != nil {
+		return "", err
+	}
+	if target.Path(key) == contentPath {
+		return contentPath, nil
+	}
+
+	content, err := source.Get(ctx, contentPath)
+	if err != nil {
+		return "", err
+	}
+
+	// The extension of the existing object is kept, objects stored by
+	// transaction hash are renamed to the hash of their content
+	extension := path.Ext(key)
+	mimeType := mime.TypeByExtension(extension)
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	hash := sha256.Sum256(content)
+	return target.Put(ctx, hex.EncodeToString(hash[:])+extension, mimeType, content)
+}
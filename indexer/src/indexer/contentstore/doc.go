@@ -0,0 +1,5 @@
+// Package contentstore stores the content of inscriptions, token logos and
+// troll box posts. Content is keyed by its hash, so identical content is
+// stored once, and the content path stored with the metaprotocol state is
+// the public URL or file path of the object
+package contentstore
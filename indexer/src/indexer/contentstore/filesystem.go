@@ -0,0 +1,81 @@
+package contentstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// FilesystemStore stores content as files in a local directory
+type FilesystemStore struct {
+	directory string
+	baseURL   string
+}
+
+// NewFilesystemStore returns a store writing to directory, which is created
+// if it doesn't exist. The content paths are the file paths, or URLs when
+// baseURL is set
+func NewFilesystemStore(directory string, baseURL string) (*FilesystemStore, error) {
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FilesystemStore{
+		directory: directory,
+		baseURL:   baseURL,
+	}, nil
+}
+
+// Put writes content to the file key unless it exists. The content is
+// written to a temporary file first so that a partial file is never read
+func (store *FilesystemStore) Put(ctx context.Context, key string, mimeType string, content []byte) (string, error) {
+	fileName := filepath.Join(store.directory, key)
+	_, err := os.Stat(fileName)
+	if err == nil {
+		return store.Path(key), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(store.directory, "."+key+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(content)
+	if err != nil {
+		file.Close()
+		return "", err
+	}
+	err = file.Close()
+	if err != nil {
+		return "", err
+	}
+	err = os.Chmod(file.Name(), 0644)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(file.Name(), fileName)
+	if err != nil {
+		return "", err
+	}
+	return store.Path(key), nil
+}
+
+// Get reads the file of contentPath from the directory
+func (store *FilesystemStore) Get(ctx context.Context, contentPath string) ([]byte, error) {
+	key, err := KeyOf(contentPath)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(store.directory, key))
+}
+
+// Path returns the URL of key if a base URL is set, else its file path
+func (store *FilesystemStore) Path(key string) string {
+	if store.baseURL != "" {
+		return joinURL(store.baseURL, key)
+	}
+	return filepath.Join(store.directory, key)
+}
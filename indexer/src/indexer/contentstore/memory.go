@@ -0,0 +1,54 @@
+package contentstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MemoryStore keeps content in memory, it is used in tests
+type MemoryStore struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	// Writes counts the objects written
+	Writes int
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string][]byte),
+	}
+}
+
+// Put stores content under key unless it is stored already
+func (store *MemoryStore) Put(ctx context.Context, key string, mimeType string, content []byte) (string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if _, ok := store.objects[key]; !ok {
+		store.objects[key] = append([]byte(nil), content...)
+		store.Writes++
+	}
+	return store.Path(key), nil
+}
+
+// Get returns the content at contentPath
+func (store *MemoryStore) Get(ctx context.Context, contentPath string) ([]byte, error) {
+	key, err := KeyOf(contentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	content, ok := store.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("content '%s' not found", key)
+	}
+	return content, nil
+}
+
+// Path returns the memory:// path of key
+func (store *MemoryStore) Path(key string) string {
+	return "memory://content/" + key
+}
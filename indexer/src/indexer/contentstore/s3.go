@@ -0,0 +1,104 @@
+package contentstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Store stores content as public objects in an S3 compatible bucket. The
+// session is shared by all requests
+type S3Store struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	baseURL  string
+}
+
+// NewS3Store returns a store for the bucket in config
+func NewS3Store(config Config) (*S3Store, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(config.S3Endpoint),
+		Region:      aws.String(config.S3Region),
+		Credentials: credentials.NewStaticCredentials(config.S3ID, config.S3Secret, config.S3Token),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Store{
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+		bucket:   config.S3Bucket,
+		baseURL:  config.BaseURL,
+	}, nil
+}
+
+// Put uploads content as key unless the object exists
+func (store *S3Store) Put(ctx context.Context, key string, mimeType string, content []byte) (string, error) {
+	_, err := store.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return store.Path(key), nil
+	}
+	if requestErr, ok := err.(awserr.RequestFailure); !ok || requestErr.StatusCode() != 404 {
+		return "", err
+	}
+
+	_, err = store.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		ACL:         aws.String("public-read"),
+		Bucket:      aws.String(store.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String(mimeType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return store.Path(key), nil
+}
+
+// Get downloads the object of contentPath from the bucket
+func (store *S3Store) Get(ctx context.Context, contentPath string) ([]byte, error) {
+	key, err := KeyOf(contentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := store.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+// Path returns the URL of key under the base URL, or the object URL of the
+// bucket as returned by an upload
+func (store *S3Store) Path(key string) string {
+	if store.baseURL != "" {
+		return joinURL(store.baseURL, key)
+	}
+
+	request, _ := store.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	err := request.Build()
+	if err != nil {
+		return ""
+	}
+	return request.HTTPRequest.URL.String()
+}
@@ -0,0 +1,114 @@
+package contentstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ContentStore stores content by key
+type ContentStore interface {
+	// Put stores content under key and returns its content path. Keys are
+	// content addressed, so content that is already stored is not written
+	// again
+	Put(ctx context.Context, key string, mimeType string, content []byte) (string, error)
+	// Get returns the content at a content path returned by Put. Paths of
+	// objects named by transaction hash, as stored before content was keyed
+	// by hash, are read by their file name
+	Get(ctx context.Context, contentPath string) ([]byte, error)
+	// Path returns the content path of key
+	Path(key string) string
+}
+
+// Config defines the environment variables of the content store
+type Config struct {
+	// Backend is s3, filesystem or none
+	Backend        string `envconfig:"CONTENT_STORE" default:"s3"`
+	S3Endpoint     string `envconfig:"S3_ENDPOINT"`
+	S3Region       string `envconfig:"S3_REGION"`
+	S3Bucket       string `envconfig:"S3_BUCKET"`
+	S3ID           string `envconfig:"S3_ID"`
+	S3Secret       string `envconfig:"S3_SECRET"`
+	S3Token        string `envconfig:"S3_TOKEN"`
+	S3StoreContent bool   `envconfig:"S3_STORE_CONTENT" default:"true"`
+	// Directory is the root of the filesystem backend
+	Directory string `envconfig:"CONTENT_DIRECTORY" default:"./data/content"`
+	// BaseURL is prefixed to the keys to form the content paths, ie a CDN
+	// in front of the bucket or a server for the directory
+	BaseURL string `envconfig:"CONTENT_BASE_URL"`
+}
+
+// New returns the content store configured by config. A nil store is
+// returned when storing content is disabled
+func New(config Config) (ContentStore, error) {
+	switch config.Backend {
+	case "s3":
+		if !config.S3StoreContent {
+			return nil, nil
+		}
+		if config.S3Endpoint == "" || config.S3Region == "" || config.S3Bucket == "" || config.S3ID == "" || config.S3Secret == "" {
+			return nil, fmt.Errorf("S3 store content is enabled but the required environment variables are not set")
+		}
+		return NewS3Store(config)
+	case "filesystem":
+		return NewFilesystemStore(config.Directory, config.BaseURL)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown content store '%s'", config.Backend)
+	}
+}
+
+// Store stores content under its content key and returns the content path.
+// A nil store doesn't store anything and returns an empty path
+func Store(ctx context.Context, store ContentStore, mimeType string, content []byte) (string, error) {
+	if store == nil {
+		return "", nil
+	}
+	return store.Put(ctx, Key(mimeType, content), mimeType, content)
+}
+
+// Key returns the content addressed key of content, the hex encoded SHA-256
+// of the content with the extension of mimeType
+func Key(mimeType string, content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:]) + Extension(mimeType)
+}
+
+// Extension returns the file extension of mimeType, .bin if it is unknown
+func Extension(mimeType string) string {
+	extensions, err := mime.ExtensionsByType(mimeType)
+	if err != nil || len(extensions) == 0 {
+		return ".bin"
+	}
+	// The mimetype gives us ".markdown" as extension when it should be .md
+	if extensions[0] == ".markdown" {
+		return ".md"
+	}
+	return extensions[0]
+}
+
+// KeyOf returns the key of a content path, the last element of the URL or
+// file path
+func KeyOf(contentPath string) (string, error) {
+	keyPath := contentPath
+	parsed, err := url.Parse(contentPath)
+	if err == nil && parsed.Scheme != "" {
+		keyPath = parsed.Path
+	}
+	key := path.Base(keyPath)
+	if key == "" || key == "." || key == ".." || key == "/" {
+		return "", fmt.Errorf("invalid content path '%s'", contentPath)
+	}
+	return key, nil
+}
+
+// joinURL returns key appended to baseURL
+func joinURL(baseURL string, key string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + key
+}
@@ -0,0 +1,98 @@
+package contentstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	key := Key("image/png", []byte("hello"))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824.png", key)
+	assert.Equal(t, ".md", Extension("text/markdown"))
+	assert.Equal(t, ".bin", Extension("application/unknown"))
+}
+
+func TestKeyOf(t *testing.T) {
+	key, err := KeyOf("https://inscriptions-mvp.ams3.digitaloceanspaces.com/ABCD.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "ABCD.png", key)
+
+	key, err = KeyOf("data/content/abcd.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "abcd.png", key)
+
+	_, err = KeyOf("https://example.com/")
+	assert.Error(t, err, "a path without a file name should be rejected")
+	_, err = KeyOf("data/..")
+	assert.Error(t, err, "a parent directory should be rejected")
+}
+
+func TestStoreDeduplicates(t *testing.T) {
+	store := NewMemoryStore()
+	first, err := Store(context.Background(), store, "image/png", []byte("image"))
+	assert.NoError(t, err)
+	second, err := Store(context.Background(), store, "image/png", []byte("image"))
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, store.Writes, "identical content should be stored once")
+
+	content, err := store.Get(context.Background(), first)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("image"), content)
+
+	path, err := Store(context.Background(), nil, "image/png", []byte("image"))
+	assert.NoError(t, err)
+	assert.Empty(t, path, "a nil store should not store content")
+}
+
+func TestFilesystemStore(t *testing.T) {
+	directory := t.TempDir()
+	store, err := NewFilesystemStore(directory, "")
+	assert.NoError(t, err)
+
+	path, err := Store(context.Background(), store, "image/png", []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(directory, Key("image/png", []byte("hello"))), path)
+
+	content, err := store.Get(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), content)
+
+	store, err = NewFilesystemStore(directory, "https://cdn.example.com/content/")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.com/content/abcd.txt", store.Path("abcd.txt"))
+}
+
+func TestS3StorePath(t *testing.T) {
+	store, err := NewS3Store(Config{
+		S3Endpoint: "ams3.digitaloceanspaces.com",
+		S3Region:   "ams3",
+		S3Bucket:   "inscriptions-mvp",
+		S3ID:       "id",
+		S3Secret:   "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://inscriptions-mvp.ams3.digitaloceanspaces.com/abcd.png", store.Path("abcd.png"))
+}
+
+func TestMigrateContent(t *testing.T) {
+	source := NewMemoryStore()
+	_, err := source.Put(context.Background(), "ABCD.png", "image/png", []byte("image"))
+	assert.NoError(t, err)
+	target := NewMemoryStore()
+
+	newPath, err := migrateContent(context.Background(), source, target, "https://bucket.example.com/ABCD.png")
+	assert.NoError(t, err)
+	assert.Equal(t, target.Path(Key("image/png", []byte("image"))), newPath, "content should be renamed to its hash")
+
+	skippedPath, err := migrateContent(context.Background(), source, target, newPath)
+	assert.NoError(t, err)
+	assert.Equal(t, newPath, skippedPath, "content in the target should be skipped")
+	assert.Equal(t, 1, target.Writes)
+
+	_, err = migrateContent(context.Background(), source, target, "https://bucket.example.com/missing.png")
+	assert.Error(t, err)
+}
@@ -1,11 +1,14 @@
 package decoder
 
 import (
+	"bytes"
 	"encoding/base64"
 
 	"github.com/cosmos/cosmos-sdk/codec"
 	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
 	authtx "github.com/cosmos/cosmos-sdk/x/auth/tx"
+	"github.com/gogo/protobuf/jsonpb"
 )
 
 type Decoder struct {
@@ -45,6 +48,33 @@ func (decoder *Decoder) Decode(txBytes []byte) (Tx, error) {
 	}, nil
 }
 
+// DecodeJSON decodes a transaction in the JSON encoding of the LCD. Fields
+// that are not part of the protobuf definition are rejected unless
+// allowUnknownFields is set
+func (decoder *Decoder) DecodeJSON(jsonBytes []byte, allowUnknownFields bool) (*txtypes.Tx, error) {
+	unmarshaler := jsonpb.Unmarshaler{
+		AllowUnknownFields: allowUnknownFields,
+		AnyResolver:        decoder.interfacesRegistry,
+	}
+
+	var tx txtypes.Tx
+	err := unmarshaler.Unmarshal(bytes.NewReader(jsonBytes), &tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = codectypes.UnpackInterfaces(&tx, decoder.interfacesRegistry)
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// EncodeJSON encodes the transaction in the JSON encoding of the LCD
+func (decoder *Decoder) EncodeJSON(tx *txtypes.Tx) ([]byte, error) {
+	return codec.ProtoMarshalJSON(tx, decoder.interfacesRegistry)
+}
+
 // NewDecoder creates a new decoder
 func NewDecoder() *Decoder {
 	interfaceRegistry := codectypes.NewInterfaceRegistry()
@@ -1,8 +1,11 @@
 package decoder
 
 import (
+	"fmt"
+
 	"github.com/cosmos/cosmos-sdk/codec"
 	cosmostypes "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
 	authtx "github.com/cosmos/cosmos-sdk/x/auth/tx"
 )
 
@@ -15,6 +18,16 @@ func (tx *Tx) MarshalToJSON() ([]byte, error) {
 	return authtx.DefaultJSONTxEncoder(tx.codec)(tx.Tx)
 }
 
+// ProtoTx returns the decoded protobuf transaction, the messages are
+// unpacked
+func (tx *Tx) ProtoTx() (*txtypes.Tx, error) {
+	provider, ok := tx.Tx.(interface{ GetProtoTx() *txtypes.Tx })
+	if !ok {
+		return nil, fmt.Errorf("unsupported transaction type %T", tx.Tx)
+	}
+	return provider.GetProtoTx(), nil
+}
+
 type CosmosTx struct {
 	Body       Body     `json:"body"`
 	AuthInfo   AuthInfo `json:"auth_info"`
@@ -0,0 +1,3 @@
+// Package endpoints implements a pool of LCD or RPC endpoints with health
+// checks, retries and failover
+package endpoints
@@ -0,0 +1,372 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/metrics"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNoEndpoint is returned when no healthy endpoint has the requested height
+var ErrNoEndpoint = errors.New("no healthy endpoint available")
+
+const (
+	// latencySmoothing is the weight of a new latency sample in the moving
+	// average
+	latencySmoothing = 0.2
+	// latencyBucket groups endpoints with similar latency together so that
+	// the load is spread between them
+	latencyBucket = 10 * time.Millisecond
+)
+
+type Config struct {
+	MaxRetries        int `envconfig:"ENDPOINT_MAX_RETRIES" default:"5"`
+	RequestTimeoutMS  int `envconfig:"ENDPOINT_REQUEST_TIMEOUT_MS" default:"10000"`
+	BackoffMS         int `envconfig:"ENDPOINT_BACKOFF_MS" default:"250"`
+	MaxBackoffMS      int `envconfig:"ENDPOINT_MAX_BACKOFF_MS" default:"10000"`
+	EjectFailures     int `envconfig:"ENDPOINT_EJECT_FAILURES" default:"3"`
+	EjectDurationMS   int `envconfig:"ENDPOINT_EJECT_DURATION_MS" default:"30000"`
+	HeightCacheTimeMS int `envconfig:"ENDPOINT_HEIGHT_CACHE_MS" default:"2000"`
+}
+
+// HeightProbe returns the latest height available on an endpoint. It is
+// used as the health check for the endpoints in a pool
+type HeightProbe func(ctx context.Context, client *http.Client, endpoint string, headers map[string]string) (uint64, error)
+
+// endpoint tracks the health of a single endpoint
+type endpoint struct {
+	url          string
+	label        string
+	latency      time.Duration
+	failures     int
+	ejectedUntil time.Time
+	height       uint64
+	heightTime   time.Time
+}
+
+// Pool selects healthy endpoints for requests. Endpoints that fail
+// repeatedly are ejected for a while and requests are retried on other
+// endpoints with exponential backoff
+type Pool struct {
+	name            string
+	endpoints       []*endpoint
+	headers         map[string]string
+	probe           HeightProbe
+	client          *http.Client
+	maxRetries      int
+	backoff         time.Duration
+	maxBackoff      time.Duration
+	ejectFailures   int
+	ejectDuration   time.Duration
+	heightCacheTime time.Duration
+	logger          *logrus.Entry
+	lock            sync.Mutex
+}
+
+// New returns a new endpoint pool for urls. The probe is used to check the
+// health and height of an endpoint
+func New(name string, urls []string, headers map[string]string, probe HeightProbe, logger *logrus.Entry) *Pool {
+	// Parse config environment variables for self
+	var config Config
+	err := envconfig.Process("", &config)
+	if err != nil {
+		log.Fatalf("Unable to process config: %s", err)
+	}
+
+	var endpoints []*endpoint
+	for _, endpointURL := range urls {
+		// Only the host is used in metrics, the path could contain keys
+		label := endpointURL
+		parsedURL, err := url.Parse(endpointURL)
+		if err == nil && parsedURL.Host != "" {
+			label = parsedURL.Host
+		}
+		endpoints = append(endpoints, &endpoint{
+			url:   endpointURL,
+			label: label,
+		})
+	}
+
+	return &Pool{
+		name:      name,
+		endpoints: endpoints,
+		headers:   headers,
+		probe:     probe,
+		client: &http.Client{
+			Timeout: time.Duration(config.RequestTimeoutMS) * time.Millisecond,
+		},
+		maxRetries:      config.MaxRetries,
+		backoff:         time.Duration(config.BackoffMS) * time.Millisecond,
+		maxBackoff:      time.Duration(config.MaxBackoffMS) * time.Millisecond,
+		ejectFailures:   config.EjectFailures,
+		ejectDuration:   time.Duration(config.EjectDurationMS) * time.Millisecond,
+		heightCacheTime: time.Duration(config.HeightCacheTimeMS) * time.Millisecond,
+		logger: logger.WithFields(logrus.Fields{
+			"pool": name,
+		}),
+	}
+}
+
+// Headers returns the custom headers to add to requests
+func (p *Pool) Headers() map[string]string {
+	return p.headers
+}
+
+// Endpoint returns a healthy endpoint that has at least minHeight
+func (p *Pool) Endpoint(ctx context.Context, minHeight uint64) (string, error) {
+	selected, err := p.selectEndpoint(ctx, minHeight, nil)
+	if err != nil {
+		return "", err
+	}
+	return selected.url, nil
+}
+
+// Do calls request with a healthy endpoint that has at least minHeight,
+// retrying on a different endpoint with exponential backoff if it fails.
+// The last error is returned if all retries fail or ctx is done
+func (p *Pool) Do(ctx context.Context, minHeight uint64, request func(client *http.Client, endpoint string) error) error {
+	var err error
+	backoff := p.backoff
+	tried := make(map[*endpoint]bool)
+	for attempt := 0; attempt <= p.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = backoff * 2
+			if backoff > p.maxBackoff {
+				backoff = p.maxBackoff
+			}
+		}
+
+		var selected *endpoint
+		selected, err = p.selectEndpoint(ctx, minHeight, tried)
+		if err != nil {
+			// All endpoints tried, start over
+			tried = make(map[*endpoint]bool)
+			p.logger.WithFields(logrus.Fields{
+				"attempt":    attempt,
+				"min_height": minHeight,
+				"err":        err,
+			}).Warn("No endpoint available, retrying")
+			continue
+		}
+		tried[selected] = true
+
+		start := time.Now()
+		err = request(p.client, selected.url)
+		if err == nil {
+			p.markSuccess(selected, time.Since(start))
+			return nil
+		}
+		// A cancelled request is not the fault of the endpoint
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.markFailure(selected)
+
+		p.logger.WithFields(logrus.Fields{
+			"endpoint": selected.url,
+			"attempt":  attempt,
+			"err":      err,
+		}).Warn("Endpoint request failed, retrying")
+	}
+	return fmt.Errorf("%s request failed after %d attempts: %w", p.name, p.maxRetries+1, err)
+}
+
+// GetJSON requests path from a healthy endpoint that has at least minHeight
+// and decodes the JSON response into out
+func (p *Pool) GetJSON(ctx context.Context, path string, minHeight uint64, headers map[string]string, out interface{}) error {
+	return p.Do(ctx, minHeight, func(client *http.Client, endpoint string) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint+path, nil)
+		if err != nil {
+			return err
+		}
+		// Add support for custom endpoint headers
+		for key, value := range p.headers {
+			req.Header.Add(key, value)
+		}
+		for key, value := range headers {
+			req.Header.Add(key, value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	})
+}
+
+// selectEndpoint returns the healthy endpoint with the lowest latency that
+// has at least minHeight, skipping the endpoints in exclude. Ejected
+// endpoints are probed again once their ejection period has passed
+func (p *Pool) selectEndpoint(ctx context.Context, minHeight uint64, exclude map[*endpoint]bool) (*endpoint, error) {
+	var candidates []*endpoint
+	for _, candidate := range p.healthyEndpoints(ctx) {
+		if exclude[candidate] {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	// Spread the load across endpoints with similar latency, but prefer the
+	// faster ones
+	rand.Shuffle(len(candidates), func(a, b int) {
+		candidates[a], candidates[b] = candidates[b], candidates[a]
+	})
+	p.lock.Lock()
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].latency/latencyBucket < candidates[b].latency/latencyBucket
+	})
+	p.lock.Unlock()
+
+	for _, candidate := range candidates {
+		if minHeight == 0 {
+			return candidate, nil
+		}
+		height, err := p.endpointHeight(ctx, candidate)
+		if err != nil {
+			continue
+		}
+		if height >= minHeight {
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("%w at height %d", ErrNoEndpoint, minHeight)
+}
+
+// healthyEndpoints returns the endpoints that are not ejected. Endpoints
+// whose ejection has passed are health checked before they are used again
+func (p *Pool) healthyEndpoints(ctx context.Context) []*endpoint {
+	var healthy []*endpoint
+	var readmit []*endpoint
+	p.lock.Lock()
+	now := time.Now()
+	for _, candidate := range p.endpoints {
+		if candidate.ejectedUntil.IsZero() {
+			healthy = append(healthy, candidate)
+		} else if now.After(candidate.ejectedUntil) {
+			readmit = append(readmit, candidate)
+		}
+	}
+	p.lock.Unlock()
+
+	for _, candidate := range readmit {
+		_, err := p.probeHeight(ctx, candidate)
+		if err != nil {
+			continue
+		}
+		p.lock.Lock()
+		candidate.ejectedUntil = time.Time{}
+		candidate.failures = 0
+		p.lock.Unlock()
+
+		p.logger.WithFields(logrus.Fields{
+			"endpoint": candidate.url,
+		}).Info("Endpoint healthy again")
+		healthy = append(healthy, candidate)
+	}
+	return healthy
+}
+
+// endpointHeight returns the height of an endpoint, probing it if the
+// cached height is out of date
+func (p *Pool) endpointHeight(ctx context.Context, candidate *endpoint) (uint64, error) {
+	p.lock.Lock()
+	height := candidate.height
+	fresh := time.Since(candidate.heightTime) < p.heightCacheTime
+	p.lock.Unlock()
+	if fresh {
+		return height, nil
+	}
+	return p.probeHeight(ctx, candidate)
+}
+
+// probeHeight checks the health of an endpoint by fetching its height
+func (p *Pool) probeHeight(ctx context.Context, candidate *endpoint) (uint64, error) {
+	start := time.Now()
+	height, err := p.probe(ctx, p.client, candidate.url, p.headers)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.markFailure(candidate)
+		}
+		return 0, err
+	}
+	p.markSuccess(candidate, time.Since(start))
+
+	p.lock.Lock()
+	candidate.height = height
+	candidate.heightTime = time.Now()
+	p.lock.Unlock()
+	return height, nil
+}
+
+// markSuccess records a successful request and its latency
+func (p *Pool) markSuccess(candidate *endpoint, latency time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	candidate.failures = 0
+	if candidate.latency == 0 {
+		candidate.latency = latency
+		return
+	}
+	candidate.latency = time.Duration((1-latencySmoothing)*float64(candidate.latency) + latencySmoothing*float64(latency))
+}
+
+// markFailure records a failed request and ejects the endpoint if it failed
+// too often. The last endpoint is never ejected
+func (p *Pool) markFailure(candidate *endpoint) {
+	metrics.EndpointErrors.WithLabelValues(p.name, candidate.label).Inc()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	candidate.failures++
+	if candidate.failures < p.ejectFailures || !candidate.ejectedUntil.IsZero() {
+		if !candidate.ejectedUntil.IsZero() {
+			// Failed the health check after ejection
+			candidate.ejectedUntil = time.Now().Add(p.ejectDuration)
+		}
+		return
+	}
+
+	healthy := 0
+	for _, other := range p.endpoints {
+		if other.ejectedUntil.IsZero() {
+			healthy++
+		}
+	}
+	if healthy <= 1 {
+		return
+	}
+
+	candidate.ejectedUntil = time.Now().Add(p.ejectDuration)
+	metrics.EndpointEjections.WithLabelValues(p.name, candidate.label).Inc()
+	p.logger.WithFields(logrus.Fields{
+		"endpoint": candidate.url,
+		"failures": candidate.failures,
+		"until":    candidate.ejectedUntil,
+	}).Warn("Ejecting unhealthy endpoint")
+}
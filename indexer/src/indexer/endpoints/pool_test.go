@@ -0,0 +1,111 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer returns a server that reports height and answers requests
+// with status
+func newTestServer(height uint64, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/height" {
+			fmt.Fprintf(w, "%d", height)
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"height": 1}`)
+	}))
+}
+
+// testProbe reads the height from the test server
+func testProbe(ctx context.Context, client *http.Client, endpoint string, headers map[string]string) (uint64, error) {
+	resp, err := client.Get(endpoint + "/height")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var height uint64
+	_, err = fmt.Fscan(resp.Body, &height)
+	return height, err
+}
+
+func newTestPool(urls ...string) *Pool {
+	pool := New("test", urls, nil, testProbe, logrus.NewEntry(logrus.New()))
+	pool.backoff = 0
+	pool.maxBackoff = 0
+	return pool
+}
+
+func TestPoolFailover(t *testing.T) {
+	failing := newTestServer(100, http.StatusInternalServerError)
+	defer failing.Close()
+	healthy := newTestServer(100, http.StatusOK)
+	defer healthy.Close()
+
+	pool := newTestPool(failing.URL, healthy.URL)
+	for request := 0; request < 10; request++ {
+		var response struct {
+			Height int `json:"height"`
+		}
+		err := pool.GetJSON(context.Background(), "/", 0, nil, &response)
+		assert.NoError(t, err, "request should fail over to the healthy endpoint")
+		assert.Equal(t, 1, response.Height)
+	}
+}
+
+func TestPoolEjectsFailingEndpoint(t *testing.T) {
+	failing := newTestServer(100, http.StatusInternalServerError)
+	healthy := newTestServer(100, http.StatusOK)
+	defer healthy.Close()
+
+	pool := newTestPool(failing.URL, healthy.URL)
+	// Close the failing server so the health check fails as well
+	failing.Close()
+	for request := 0; request < pool.ejectFailures; request++ {
+		pool.markFailure(pool.endpoints[0])
+	}
+
+	endpoint, err := pool.Endpoint(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, healthy.URL, endpoint, "ejected endpoint should not be used")
+	assert.False(t, pool.endpoints[0].ejectedUntil.IsZero(), "failing endpoint should be ejected")
+}
+
+func TestPoolKeepsLastEndpoint(t *testing.T) {
+	failing := newTestServer(100, http.StatusInternalServerError)
+	defer failing.Close()
+
+	pool := newTestPool(failing.URL)
+	for request := 0; request < pool.ejectFailures; request++ {
+		pool.markFailure(pool.endpoints[0])
+	}
+
+	assert.True(t, pool.endpoints[0].ejectedUntil.IsZero(), "last endpoint should not be ejected")
+	err := pool.GetJSON(context.Background(), "/", 0, nil, &struct{}{})
+	assert.Error(t, err, "request should fail after all retries")
+}
+
+func TestPoolRequiresHeight(t *testing.T) {
+	behind := newTestServer(90, http.StatusOK)
+	defer behind.Close()
+	current := newTestServer(100, http.StatusOK)
+	defer current.Close()
+
+	pool := newTestPool(behind.URL, current.URL)
+	for request := 0; request < 10; request++ {
+		endpoint, err := pool.Endpoint(context.Background(), 95)
+		assert.NoError(t, err)
+		assert.Equal(t, current.URL, endpoint, "endpoint without the height should not be used")
+	}
+
+	_, err := pool.Endpoint(context.Background(), 101)
+	assert.ErrorIs(t, err, ErrNoEndpoint)
+}
@@ -0,0 +1,60 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+)
+
+// LCDHeight returns the latest block height of an LCD endpoint
+func LCDHeight(ctx context.Context, client *http.Client, endpoint string, headers map[string]string) (uint64, error) {
+	var block types.LCDBlock
+	err := getJSON(ctx, client, fmt.Sprintf("%s/cosmos/base/tendermint/v1beta1/blocks/latest", endpoint), headers, &block)
+	if err != nil {
+		return 0, err
+	}
+	if block.Code != 0 {
+		return 0, fmt.Errorf("error fetching current height: %s", block.Message)
+	}
+	return strconv.ParseUint(block.Block.Header.Height, 10, 64)
+}
+
+// RPCHeight returns the latest block height of an RPC endpoint. Nodes that
+// are still catching up are considered unhealthy
+func RPCHeight(ctx context.Context, client *http.Client, endpoint string, headers map[string]string) (uint64, error) {
+	var status types.RPCStatus
+	err := getJSON(ctx, client, fmt.Sprintf("%s/status", endpoint), headers, &status)
+	if err != nil {
+		return 0, err
+	}
+	if status.Result.SyncInfo.CatchingUp {
+		return 0, fmt.Errorf("node is catching up")
+	}
+	return strconv.ParseUint(status.Result.SyncInfo.LatestBlockHeight, 10, 64)
+}
+
+// getJSON fetches url and decodes the JSON response into out
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	// Add support for custom endpoint headers
+	for key, value := range headers {
+		req.Header.Add(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
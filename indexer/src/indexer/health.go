@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/metrics"
+	"github.com/leodido/go-urn"
+)
+
+// markProgress records that the indexer processed a block or is caught up
+// with the chain
+func (i *Indexer) markProgress() {
+	i.lastProgress.Store(time.Now().Unix())
+}
+
+// updateHeights records the current and known heights for the metrics and
+// readiness check
+func (i *Indexer) updateHeights(currentHeight uint64, knownHeight uint64) {
+	metrics.SetHeights(i.chainID, currentHeight, knownHeight)
+	if knownHeight > currentHeight {
+		i.lag.Store(knownHeight - currentHeight)
+	} else {
+		i.lag.Store(0)
+	}
+}
+
+// observeOperation counts the result of a metaprotocol operation
+func (i *Indexer) observeOperation(protocolURN *urn.URN, err error) {
+	// Only registered operations are used as labels to keep the label
+	// cardinality bounded
+	operation := "invalid"
+	parsedURN, parseErr := metaprotocol.ParseProtocolString(protocolURN)
+	if parseErr == nil && i.router.HasOperation(protocolURN.ID, parsedURN.Operation) {
+		operation = parsedURN.Operation
+	}
+	metrics.ObserveOperation(i.chainID, protocolURN.ID, operation, err)
+}
+
+// checkDatabase returns an error if the database is unreachable
+func (s *Service) checkDatabase() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+}
+
+// checkStalled returns an error if the indexer hasn't processed a block or
+// seen that it is caught up within the stall timeout
+func (i *Indexer) checkStalled() error {
+	lastProgress := time.Unix(i.lastProgress.Load(), 0)
+	if time.Since(lastProgress) > i.stallTimeout {
+		return fmt.Errorf("no progress since %s", lastProgress.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkLag returns an error if the indexer is too far behind the chain
+func (i *Indexer) checkLag() error {
+	lag := i.lag.Load()
+	if lag > i.readyMaxLag {
+		return fmt.Errorf("%d blocks behind", lag)
+	}
+	return nil
+}
@@ -1,365 +1,690 @@
 package indexer
 
 import (
+	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/blocksource"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/decoder"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/endpoints"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/oracle"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/metrics"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/worker"
-	"github.com/kelseyhightower/envconfig"
 	"github.com/leodido/go-urn"
 	"github.com/sirupsen/logrus"
-	"gorm.io/driver/postgres"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-type Config struct {
+// maxStatusMessageLength is the size of the transaction.status_message column
+const maxStatusMessageLength = 255
+
+// catchUpReportInterval is how often indexing progress is logged
+const catchUpReportInterval = 10 * time.Second
+
+// ChainConfig defines the environment variables for a single chain. When
+// more than one chain is configured the variables are prefixed with the
+// chain name, ie NEUTRON_CHAIN_ID
+type ChainConfig struct {
 	ChainID                  string            `envconfig:"CHAIN_ID" required:"true"`
-	BaseTokenBinanceEndpoint string            `envconfig:"BASE_TOKEN_BINANCE_ENDPOINT" required:"true"`
-	DatabaseDSN              string            `envconfig:"DATABASE_DSN" required:"true"`
+	BaseTokenBinanceEndpoint string            `envconfig:"BASE_TOKEN_BINANCE_ENDPOINT"`
+	PriceSources             []string          `envconfig:"PRICE_SOURCES"`
+	PriceIntervalMS          int               `envconfig:"PRICE_INTERVAL_MS" default:"60000"`
+	PriceMaxAgeMS            int               `envconfig:"PRICE_MAX_AGE_MS" default:"300000"`
+	BaseDenom                string            `envconfig:"BASE_DENOM" default:"uatom"`
 	LCDEndpoints             []string          `envconfig:"LCD_ENDPOINTS" required:"true"`
 	RPCEndpoints             []string          `envconfig:"RPC_ENDPOINTS" required:"true"`
 	EndpointHeaders          map[string]string `envconfig:"ENDPOINT_HEADERS" required:"true"`
+	IBCEnabled               bool              `envconfig:"IBC_ENABLED" default:"true"`
+	FeeReceiver              string            `envconfig:"IBC_RECEIVER" default:"neutron1unc0549k2f0d7mjjyfm94fuz2x53wrx3px0pr55va27grdgmspcqgzfr8p"`
+	FeeChannel               string            `envconfig:"IBC_CHANNEL" default:"channel-569"`
 	BlockPollIntervalMS      int               `envconfig:"BLOCK_POLL_INTERVAL_MS" required:"true"`
+	BlockSubscription        bool              `envconfig:"BLOCK_SUBSCRIPTION" default:"false"`
+	BlockPrefetchWorkers     int               `envconfig:"BLOCK_PREFETCH_WORKERS" default:"1"`
+	BlockPrefetchWindow      int               `envconfig:"BLOCK_PREFETCH_WINDOW" default:"1"`
+	BlockSource              string            `envconfig:"BLOCK_SOURCE" default:"http"`
+	BlockArchiveDirectory    string            `envconfig:"BLOCK_ARCHIVE_DIRECTORY" default:"./data/blocks"`
+	ContentHashEnforceHeight uint64            `envconfig:"CONTENT_HASH_ENFORCE_HEIGHT" default:"0"`
+	ContentValidationHeight  uint64            `envconfig:"CONTENT_VALIDATION_HEIGHT" default:"0"`
+	MessageRulesHeight       uint64            `envconfig:"MESSAGE_RULES_HEIGHT" default:"0"`
 }
 
-// Indexer implements the reference indexer service
+// Indexer indexes a single chain, the Service runs an Indexer for every
+// configured chain
 type Indexer struct {
-	chainID                  string
-	baseTokenBinanceEndpoint string
-	lcdEndpoints             []string
-	rpcEndpoints             []string
-	endpointHeaders          map[string]string
-	blockPollIntervalMS      int
-	logger                   *logrus.Entry
-	metaprotocols            map[string]metaprotocol.Processor
-	stopChannel              chan bool
-	db                       *gorm.DB
-	workerClient             *worker.WorkerClient
-	wg                       sync.WaitGroup
+	chainID              string
+	baseDenom            string
+	priceOracle          *oracle.Oracle
+	priceInterval        time.Duration
+	rpcPool              *endpoints.Pool
+	blockSource          blocksource.BlockSource
+	blockPollIntervalMS  int
+	blockSubscription    bool
+	blockPrefetchWorkers int
+	blockPrefetchWindow  int
+	logger               *logrus.Entry
+	router               *metaprotocol.Router
+	preflightRouter      *metaprotocol.Router
+	db                   *gorm.DB
+	preflightDB          *gorm.DB
+	workerClient         *worker.WorkerClient
+	wg                   sync.WaitGroup
+	// notify sends the committed blocks and events to the feed channels
+	notify bool
+
+	stallTimeout time.Duration
+	readyMaxLag  uint64
+	lastProgress atomic.Int64
+	lag          atomic.Uint64
 }
 
-// New returns a new instance of the indexer service and returns an error if
-// there was a problem setting up the service
-func New(
-	log *logrus.Entry) (*Indexer, error) {
+// newIndexer returns an indexer for the chain in config that stores its
+// state in db
+func newIndexer(config ChainConfig, db *gorm.DB, workerClient *worker.WorkerClient, contentStore contentstore.ContentStore, stallTimeout time.Duration, readyMaxLag uint64, log *logrus.Entry) (*Indexer, error) {
+	log = log.WithFields(logrus.Fields{
+		"chain_id": config.ChainID,
+	})
 
-	// Parse config environment variables for self
-	var config Config
-	err := envconfig.Process("", &config)
-	if err != nil {
-		log.Fatalf("Unable to process config: %s", err)
+	lcdPool := endpoints.New(config.ChainID+"/lcd", config.LCDEndpoints, config.EndpointHeaders, endpoints.LCDHeight, log)
+	rpcPool := endpoints.New(config.ChainID+"/rpc", config.RPCEndpoints, config.EndpointHeaders, endpoints.RPCHeight, log)
+
+	// Blocks are fetched from the chain, or read from a local archive for
+	// offline backfills and tests
+	var err error
+	var blockSource blocksource.BlockSource
+	switch config.BlockSource {
+	case "http":
+		blockSource = blocksource.NewHTTPSource(lcdPool, rpcPool)
+	case "archive":
+		blockSource, err = blocksource.NewArchiveSource(config.BlockArchiveDirectory)
+		if err != nil {
+			return nil, err
+		}
+		// There are no new blocks to subscribe to
+		config.BlockSubscription = false
+	default:
+		return nil, fmt.Errorf("unknown block source '%s'", config.BlockSource)
 	}
 
-	db, err := gorm.Open(postgres.Open(config.DatabaseDSN), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
+	// BASE_TOKEN_BINANCE_ENDPOINT is kept as a source for existing
+	// deployments that don't configure PRICE_SOURCES
+	priceDefinitions := config.PriceSources
+	if len(priceDefinitions) == 0 && config.BaseTokenBinanceEndpoint != "" {
+		priceDefinitions = []string{"binance=" + config.BaseTokenBinanceEndpoint}
+	}
+	if len(priceDefinitions) == 0 {
+		return nil, fmt.Errorf("no base token price sources configured")
+	}
+	priceClient := &http.Client{Timeout: 10 * time.Second}
+	var priceSources []oracle.Source
+	for _, definition := range priceDefinitions {
+		source, err := oracle.NewSource(definition, priceClient)
+		if err != nil {
+			return nil, err
+		}
+		priceSources = append(priceSources, source)
+	}
+
+	chain := metaprotocol.Chain{
+		ID:                       config.ChainID,
+		BaseDenom:                config.BaseDenom,
+		IBCEnabled:               config.IBCEnabled,
+		FeeReceiver:              config.FeeReceiver,
+		FeeChannel:               config.FeeChannel,
+		ContentHashEnforceHeight: config.ContentHashEnforceHeight,
+		ContentValidationHeight:  config.ContentValidationHeight,
+		MessageRulesHeight:       config.MessageRulesHeight,
+		PriceMaxAge:              time.Duration(config.PriceMaxAgeMS) * time.Millisecond,
+	}
+	router, err := newRouter(chain, workerClient, contentStore, lcdPool)
 	if err != nil {
 		return nil, err
 	}
 
-	workerClient, err := worker.NewWorkerClient(log)
+	// Preflight simulations use their own processors without a worker
+	// client or content store, a simulation must not queue any jobs or
+	// store content
+	preflightRouter, err := newRouter(chain, nil, nil, lcdPool)
 	if err != nil {
 		return nil, err
 	}
 
-	metaprotocols := make(map[string]metaprotocol.Processor)
-	cft20 := metaprotocol.NewCFT20Processor(config.ChainID, db)
-	inscription := metaprotocol.NewInscriptionProcessor(config.ChainID, db, workerClient)
-	launchpad := metaprotocol.NewLaunchpadProcessor(config.ChainID, db, inscription)
-
-	metaprotocols["inscription"] = inscription
-	metaprotocols["cft20"] = cft20
-	metaprotocols["marketplace"] = metaprotocol.NewMarketplaceProcessor(config.ChainID, db, workerClient)
-	metaprotocols["bridge"] = metaprotocol.NewBridgeProcessor(config.ChainID, db, cft20)
-	metaprotocols["launchpad"] = launchpad
-	metaprotocols["trollbox"] = metaprotocol.NewTrollBoxProcessor(config.ChainID, db, inscription, launchpad)
-
 	return &Indexer{
-		chainID:                  config.ChainID,
-		baseTokenBinanceEndpoint: config.BaseTokenBinanceEndpoint,
-		lcdEndpoints:             config.LCDEndpoints,
-		rpcEndpoints:             config.RPCEndpoints,
-		endpointHeaders:          config.EndpointHeaders,
-		blockPollIntervalMS:      config.BlockPollIntervalMS,
-		metaprotocols:            metaprotocols,
-		logger:                   log,
-		stopChannel:              make(chan bool),
-		db:                       db,
-		workerClient:             workerClient,
+		chainID:              config.ChainID,
+		baseDenom:            config.BaseDenom,
+		priceOracle:          oracle.New(priceSources, time.Duration(config.PriceMaxAgeMS)*time.Millisecond, log),
+		priceInterval:        time.Duration(config.PriceIntervalMS) * time.Millisecond,
+		rpcPool:              rpcPool,
+		blockSource:          blockSource,
+		blockPollIntervalMS:  config.BlockPollIntervalMS,
+		blockSubscription:    config.BlockSubscription,
+		blockPrefetchWorkers: config.BlockPrefetchWorkers,
+		blockPrefetchWindow:  config.BlockPrefetchWindow,
+		router:               router,
+		preflightRouter:      preflightRouter,
+		logger:               log,
+		db:                   db,
+		workerClient:         workerClient,
+		stallTimeout:         stallTimeout,
+		readyMaxLag:          readyMaxLag,
 	}, nil
 }
 
-// Run the indexer service forever
-func (i *Indexer) Run() error {
+// newRouter returns a router with the processors of every metaprotocol
+// registered for chain
+func newRouter(chain metaprotocol.Chain, workerClient *worker.WorkerClient, contentStore contentstore.ContentStore, lcdPool *endpoints.Pool) (*metaprotocol.Router, error) {
+	cft20 := metaprotocol.NewCFT20Processor(chain, contentStore)
+	inscription := metaprotocol.NewInscriptionProcessor(chain, workerClient, contentStore)
+	launchpad := metaprotocol.NewLaunchpadProcessor(chain, inscription)
+
+	metaprotocols := map[string]metaprotocol.Processor{
+		"inscription": inscription,
+		"cft20":       cft20,
+		"marketplace": metaprotocol.NewMarketplaceProcessor(chain, workerClient, lcdPool),
+		"bridge":      metaprotocol.NewBridgeProcessor(chain.ID, cft20),
+		"launchpad":   launchpad,
+		"trollbox":    metaprotocol.NewTrollBoxProcessor(chain, workerClient, inscription, launchpad, contentStore),
+	}
+	router := metaprotocol.NewRouter(chain)
+	for id, processor := range metaprotocols {
+		err := router.Register(id, processor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// Operations returns the catalogue of supported metaprotocol operations
+func (i *Indexer) Operations() []metaprotocol.OperationInfo {
+	return i.router.Catalogue()
+}
+
+// Run the indexer until ctx is done. The block that is being processed when
+// ctx is done is completed before Run returns
+func (i *Indexer) Run(ctx context.Context) {
 	i.logger.Info("Starting indexer")
+
 	i.wg.Add(1)
-	go i.indexBlocks()
+	go i.indexBlocks(ctx)
 
 	i.wg.Add(1)
-	go i.updateBaseToken()
+	go i.updateBaseToken(ctx)
 
 	i.wg.Wait()
 
-	return nil
-}
-
-// Stop the indexer
-func (i *Indexer) Stop() error {
-	i.logger.Info("Stopping indexer")
-	i.stopChannel <- true
-	i.stopChannel <- true
-	return nil
+	i.logger.Info("Stopped indexer")
 }
 
 // indexBlocks fetches blocks from the chain, indexes them and stores a
 // record of the last processed block
-func (i *Indexer) indexBlocks() {
-	var err error
-	var currentHeight uint64
-	// Fetch the latest processed height from the database
+func (i *Indexer) indexBlocks(ctx context.Context) {
+	defer i.wg.Done()
+
 	var status models.Status
-	result := i.db.Where("chain_id = ?", i.chainID).First(&status)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			// if the record doesn't exist, find the current height from the chain
-			// and use that as the starting point for indexing
-			currentHeight, err = i.fetchCurrentHeight()
-			if err != nil {
-				i.logger.Fatalf("Unable to fetch current height: %v", err)
-			}
+	currentHeight, err := i.resumeHeight(ctx, &status)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
 		}
-	} else {
-		currentHeight = uint64(status.LastProcessedHeight)
+		i.logger.Fatalf("Unable to fetch start height: %v", err)
 	}
 
 	i.logger.WithFields(logrus.Fields{
 		"current_height": currentHeight,
 	}).Info("Starting to fetch blocks")
 
+	// When enabled, new heights are pushed by the RPC websocket and the LCD
+	// is only polled while the subscription is down
+	var subscription *blockSubscription
+	var newHeights <-chan uint64
+	if i.blockSubscription {
+		subscription = newBlockSubscription(i.rpcPool, i.logger)
+		newHeights = subscription.Heights()
+		go subscription.run(ctx)
+	}
+
+	// Blocks are fetched and decoded ahead of the current height when
+	// catching up, but are always applied in order
+	prefetcher := newBlockPrefetcher(ctx, i.fetchTransactions, i.blockPrefetchWorkers, i.blockPrefetchWindow)
+	defer prefetcher.Stop()
+
 	// Fetch blocks interval
 	ticker := time.NewTicker(time.Duration(i.blockPollIntervalMS) * time.Millisecond)
 	defer ticker.Stop()
 
+	var maxHeight uint64
+	var processedBlocks uint64
+	i.markProgress()
+	reportTime := time.Now()
 	for {
 		select {
-		case <-i.stopChannel:
+		case <-ctx.Done():
 			i.logger.Info("Stop fetching data")
-			i.wg.Done()
 			return
+		case height := <-newHeights:
+			if height > maxHeight {
+				maxHeight = height
+			}
+			i.updateHeights(currentHeight, maxHeight)
 		case <-ticker.C:
-
-			maxHeight, err := i.fetchCurrentHeight()
-			if err != nil {
-				i.logger.Fatalf("Unable to fetch current height: %v", err)
+			// The subscription pushes the new heights while connected, the
+			// ticker then only drives catching up
+			if subscription == nil || !subscription.Connected() {
+				latestHeight, err := i.fetchCurrentHeight(ctx)
+				if err != nil {
+					if ctx.Err() != nil {
+						continue
+					}
+					i.logger.WithFields(logrus.Fields{
+						"err": err,
+					}).Warn("Unable to fetch current height, retrying")
+					continue
+				}
+				maxHeight = latestHeight
+				i.updateHeights(currentHeight, maxHeight)
+				if currentHeight >= maxHeight {
+					// Nothing to do, but we are keeping up with the chain
+					i.markProgress()
+				}
 			}
+		}
 
-			if currentHeight >= maxHeight {
-				continue
+		for currentHeight < maxHeight {
+			// Blocks are processed back to back while catching up, check if
+			// we need to stop between blocks
+			if ctx.Err() != nil {
+				i.logger.Info("Stop fetching data")
+				return
 			}
 
 			i.logger.WithFields(logrus.Fields{
 				"current_height": currentHeight,
 				"max_height":     maxHeight,
 				"lag":            maxHeight - currentHeight,
-			}).Info("Fetching block")
+			}).Debug("Fetching block")
 
 			// Instead of fetching each transaction individually
 			// fetch the block and decode the protobuf contents
 			// All metaprotocols require a MsgSend transaction
-			block, transactions, err := i.fetchTransactions(currentHeight)
+			fetched := prefetcher.Get(currentHeight, maxHeight)
+			if fetched.err != nil {
+				if ctx.Err() != nil {
+					i.logger.Info("Stop fetching data")
+					return
+				}
+				// The block will be fetched again on the next tick
+				i.logger.WithFields(logrus.Fields{
+					"height": currentHeight,
+					"err":    fetched.err,
+				}).Warn("Unable to fetch transactions, retrying")
+				break
+			}
+
+			err = i.commitBlock(&status, currentHeight, maxHeight, fetched.block, fetched.transactions)
 			if err != nil {
-				i.logger.Fatalf("Unable to fetch transactions: %v", err)
+				i.logger.WithFields(logrus.Fields{
+					"height": currentHeight,
+					"err":    err,
+				}).Fatal("Unable to store block")
+			}
+			i.enqueueJobs(ctx)
+
+			currentHeight = currentHeight + 1
+			processedBlocks++
+			i.updateHeights(currentHeight, maxHeight)
+			i.markProgress()
+
+			if time.Since(reportTime) >= catchUpReportInterval {
+				i.logger.WithFields(logrus.Fields{
+					"current_height":    currentHeight,
+					"max_height":        maxHeight,
+					"lag":               maxHeight - currentHeight,
+					"blocks":            processedBlocks,
+					"blocks_per_second": float64(processedBlocks) / time.Since(reportTime).Seconds(),
+				}).Info("Indexing progress")
+				processedBlocks = 0
+				reportTime = time.Now()
 			}
+		}
+	}
+}
 
-			// Extract some commonly used values
-			height, err := strconv.ParseUint(block.Block.Header.Height, 10, 64)
+// resumeHeight loads the status of the chain into status and returns the
+// first height to index. The status is created for a new chain. The last
+// processed height is committed with the changes of its block, so indexing
+// resumes at the height after it
+func (i *Indexer) resumeHeight(ctx context.Context, status *models.Status) (uint64, error) {
+	result := i.db.WithContext(ctx).Where("chain_id = ?", i.chainID).Attrs(models.Status{
+		ChainID:     i.chainID,
+		BaseToken:   i.baseDenom,
+		DateUpdated: time.Now(),
+	}).FirstOrCreate(status)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if status.LastProcessedHeight == 0 {
+		// if nothing has been processed yet, find the start height from the
+		// block source and use that as the starting point for indexing
+		return i.blockSource.StartHeight(ctx)
+	}
+	return status.LastProcessedHeight + 1, nil
+}
+
+// commitBlock applies the transactions of a fetched block in a single
+// database transaction and stores the block as the last processed height.
+// If anything fails none of the changes in the block are kept and the block
+// will be processed again. The commit is deliberately not cancellable so
+// that a block that has started is completed during shutdown
+func (i *Indexer) commitBlock(status *models.Status, currentHeight uint64, maxHeight uint64, block types.LCDBlock, transactions []types.Transaction) error {
+	start := time.Now()
+	defer func() {
+		metrics.BlockDuration.WithLabelValues(i.chainID).Observe(time.Since(start).Seconds())
+	}()
+
+	// Extract some commonly used values
+	height, err := strconv.ParseUint(block.Block.Header.Height, 10, 64)
+	if err != nil {
+		return fmt.Errorf("unable to parse height: %w", err)
+	}
+
+	// The state written by the block is tracked to calculate its checksum
+	changes := newStateChanges()
+	var checksum string
+	err = i.db.WithContext(withStateChanges(context.Background(), changes)).Transaction(func(dbTx *gorm.DB) error {
+		for _, tx := range transactions {
+			err := i.processTransaction(dbTx, height, block.Block.Header.Time, tx)
 			if err != nil {
-				i.logger.Fatalf("Unable to parse height: %v", err)
+				return err
 			}
+		}
 
-			for _, tx := range transactions {
-				gasUsed, err := strconv.ParseUint(tx.AuthInfo.Fee.GasLimit, 10, 64)
-				if err != nil {
-					i.logger.Fatalf("Unable to parse gas used: %v", err)
-				}
+		checksum, err = i.commitChecksum(dbTx, changes, height, block.Block.Header.Time, status.StateChecksum)
+		if err != nil {
+			return err
+		}
 
-				fees, err := json.Marshal(tx.AuthInfo.Fee.Amount)
-				if err != nil {
-					i.logger.Fatalf("Unable to parse fees: %v", err)
-				}
+		// All good, save last processed height with the block
+		status.LastProcessedHeight = currentHeight
+		result := dbTx.Model(&models.Status{}).Where("chain_id = ?", i.chainID).UpdateColumns(map[string]interface{}{
+			"last_known_height":     maxHeight,
+			"last_processed_height": currentHeight,
+			"state_checksum":        checksum,
+			"date_updated":          time.Now(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return fmt.Errorf("unable to store the processed height, %d status rows updated for chain '%s'", result.RowsAffected, i.chainID)
+		}
+		if !i.notify {
+			return nil
+		}
+		return i.notifyBlock(dbTx, height, block.Block.Header.Time, len(transactions), checksum)
+	})
+	if err != nil {
+		return err
+	}
+	status.StateChecksum = checksum
 
-				contentLength := len(tx.ToJSON())
-
-				// Store the transaction
-				txModel := models.Transaction{
-					Hash:          tx.Hash,
-					Height:        height,
-					Content:       tx.ToJSON(),
-					GasUsed:       gasUsed,
-					Fees:          string(fees),
-					ContentLength: uint64(contentLength),
-					DateCreated:   block.Block.Header.Time,
-					StatusMessage: types.TransactionStatePending,
-				}
-				result := i.db.Save(&txModel)
-				if result.Error != nil {
-					// If the error is a duplicate key error, we ignore it
-					if result.Error != gorm.ErrDuplicatedKey && !strings.Contains(result.Error.Error(), "duplicate key value") {
-						i.logger.WithFields(logrus.Fields{
-							"hash": tx.Hash,
-							"err":  result.Error,
-						}).Fatal("Unable to store transaction")
-					}
-				}
+	i.logger.WithFields(logrus.Fields{
+		"height": height,
+		"txs":    len(transactions),
+	}).Info("Block processed")
+	return nil
+}
 
-				// Process metaprotocol memo
-				statusMessage := types.TransactionStateSuccess
-				err = i.processMetaprotocolMemo(txModel, tx)
-				if err != nil {
-					i.logger.WithFields(logrus.Fields{
-						"hash": tx.Hash,
-					}).Error(err)
-					statusMessage = fmt.Sprintf("%s: %s", types.TransactionStateError, err)
-				}
+// enqueueJobs moves the worker jobs written by committed blocks to the job
+// queue. Jobs that can't be queued stay in the outbox and are queued after
+// the next block
+func (i *Indexer) enqueueJobs(ctx context.Context) {
+	count, err := i.workerClient.EnqueueOutbox(ctx)
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Warn("Unable to queue jobs")
+		return
+	}
+	if count > 0 {
+		i.logger.WithFields(logrus.Fields{
+			"jobs": count,
+		}).Debug("Queued jobs")
+	}
+}
 
-				// If there is an error in processing the metaprotocol,
-				// store the error in the transaction for frontend feedback
-				txModel.StatusMessage = statusMessage
-				result = i.db.Save(&txModel)
-				if result.Error != nil {
-					i.logger.WithFields(logrus.Fields{
-						"hash": tx.Hash,
-						"err":  result.Error,
-					}).Warning("Unable to update transaction status")
-				}
+// processTransaction stores a transaction and applies its metaprotocol
+// operation. Metaprotocol changes are made in a nested database transaction
+// so that a failed operation is rolled back without affecting the rest of
+// the block. An error is only returned if the transaction can't be stored
+func (i *Indexer) processTransaction(db *gorm.DB, height uint64, blockTime time.Time, tx types.Transaction) error {
+	fees, err := json.Marshal(tx.Fees())
+	if err != nil {
+		return fmt.Errorf("unable to parse fees: %w", err)
+	}
 
-				i.logger.WithFields(logrus.Fields{
-					"hash": tx.Hash,
-				}).Info("Transaction processed")
-			}
+	content := tx.ToJSON()
+	contentLength := len(content)
+
+	// Store the transaction
+	txModel := models.Transaction{
+		ChainID:       i.chainID,
+		Hash:          tx.Hash,
+		Height:        height,
+		Content:       content,
+		GasUsed:       tx.GasLimit(),
+		Fees:          string(fees),
+		ContentLength: uint64(contentLength),
+		DateCreated:   blockTime,
+		StatusMessage: types.TransactionStatePending,
+	}
 
-			i.logger.WithFields(logrus.Fields{
-				"height": height,
-			}).Info("Block processed")
-
-			// All good, save last processed and increase height
-			status.LastProcessedHeight = currentHeight
-			i.db.Model(&status).Where("chain_id = ?", i.chainID).UpdateColumns(map[string]interface{}{
-				"last_known_height":     maxHeight,
-				"last_processed_height": currentHeight,
-				"date_updated":          time.Now(),
-			})
-			currentHeight = currentHeight + 1
+	// If the transaction has been stored before we update the existing record,
+	// a duplicate key error would abort the database transaction
+	var existingModel models.Transaction
+	result := db.Where("chain_id = ? AND hash = ?", i.chainID, tx.Hash).First(&existingModel)
+	if result.Error == nil {
+		txModel.ID = existingModel.ID
+	} else if result.Error != gorm.ErrRecordNotFound {
+		return result.Error
+	}
+
+	result = db.Save(&txModel)
+	if result.Error != nil {
+		return fmt.Errorf("unable to store transaction %s: %w", tx.Hash, result.Error)
+	}
+
+	// Process metaprotocol memo
+	err = db.Transaction(func(processTx *gorm.DB) error {
+		return i.processMetaprotocolMemo(processTx, i.router, txModel, tx)
+	})
+	if err != nil {
+		code, _ := metaprotocol.ErrorCodeOf(err)
+		i.logger.WithFields(logrus.Fields{
+			"hash": tx.Hash,
+			"code": code,
+		}).Error(err)
+	}
+
+	// If there is an error in processing the metaprotocol,
+	// store the error in the transaction for frontend feedback
+	err = setTransactionStatus(&txModel, err)
+	if err != nil {
+		return err
+	}
+	result = db.Save(&txModel)
+	if result.Error != nil {
+		return fmt.Errorf("unable to update transaction status %s: %w", tx.Hash, result.Error)
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"hash": tx.Hash,
+	}).Info("Transaction processed")
+
+	return nil
+}
+
+// setTransactionStatus sets the status message and error of txModel to the
+// result of processing its metaprotocol operation
+func setTransactionStatus(txModel *models.Transaction, processErr error) error {
+	txModel.StatusMessage = types.TransactionStateSuccess
+	txModel.ErrorCode = sql.NullString{}
+	txModel.ErrorDetails = nil
+	if processErr == nil {
+		return nil
+	}
+
+	code, details := metaprotocol.ErrorCodeOf(processErr)
+	txModel.StatusMessage = truncateStatusMessage(fmt.Sprintf("%s: %s", types.TransactionStateError, processErr))
+	txModel.ErrorCode = sql.NullString{String: string(code), Valid: true}
+	if len(details) > 0 {
+		detailsBytes, err := json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("unable to marshal error details %s: %w", txModel.Hash, err)
 		}
+		txModel.ErrorDetails = datatypes.JSON(detailsBytes)
 	}
+	return nil
 }
 
-// updateBaseToken updates the price of the base token every minute
-// via CoinGecko
-func (i *Indexer) updateBaseToken() {
-	// Fetch blocks interval
-	ticker := time.NewTicker(1 * time.Minute)
+// truncateStatusMessage limits the status message to the size of the
+// transaction.status_message column, which is counted in characters
+func truncateStatusMessage(statusMessage string) string {
+	characters := 0
+	for index := range statusMessage {
+		if characters == maxStatusMessageLength {
+			return statusMessage[:index]
+		}
+		characters++
+	}
+	return statusMessage
+}
+
+// updateBaseToken updates the price of the base token from the price
+// oracle and records it in the price history
+func (i *Indexer) updateBaseToken(ctx context.Context) {
+	defer i.wg.Done()
+
+	ticker := time.NewTicker(i.priceInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-i.stopChannel:
+		case <-ctx.Done():
 			i.logger.Info("Stop fetching price data")
-			i.wg.Done()
 			return
 		case <-ticker.C:
-			queryResult, err := http.Get(i.baseTokenBinanceEndpoint)
+			i.priceOracle.Update(ctx)
+			price, sources, err := i.priceOracle.Price()
 			if err != nil {
 				i.logger.Error(err)
+				continue
 			}
-			defer queryResult.Body.Close()
 
-			var response map[string]string
-			err = json.NewDecoder(queryResult.Body).Decode(&response)
-			if err != nil {
-				i.logger.Error(err)
-			}
+			now := time.Now().UTC()
+			err = i.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				priceModel := models.BaseTokenPrice{
+					ChainID:     i.chainID,
+					PriceUSD:    price,
+					Sources:     sources,
+					DateCreated: now,
+				}
+				result := tx.Create(&priceModel)
+				if result.Error != nil {
+					return result.Error
+				}
 
-			// Store the price
-			price, err := strconv.ParseFloat(response["price"], 64)
+				// The status keeps the latest price for consumers that
+				// don't need the history
+				result = tx.Model(&models.Status{}).Where("chain_id = ?", i.chainID).Update("base_token_usd", price)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected != 1 {
+					return fmt.Errorf("unable to store the base token price, %d status rows updated for chain '%s'", result.RowsAffected, i.chainID)
+				}
+				return nil
+			})
 			if err != nil {
 				i.logger.Error(err)
+				continue
 			}
 
-			var statusModel models.Status
-			result := i.db.Where("chain_id = ?", i.chainID).First(&statusModel)
-			if result.Error != nil {
-				i.logger.Error(result.Error)
-			}
-
-			result = i.db.Model(&statusModel).Where("chain_id = ?", i.chainID).Update("base_token_usd", price)
-			if result.Error != nil {
-				i.logger.Error(result.Error)
-			} else {
-				i.logger.WithFields(logrus.Fields{
-					"price": price,
-				}).Info("Updated base token price")
-			}
+			metrics.SetBaseTokenPriceUpdated(i.chainID, now)
+			i.logger.WithFields(logrus.Fields{
+				"price":   price,
+				"sources": sources,
+			}).Info("Updated base token price")
 		}
 	}
 }
 
-func (i *Indexer) parseMemoAndSource(rawTransaction types.RawTransaction) (string, string, error) {
-	urnMemo := rawTransaction.Body.Memo
+func (i *Indexer) parseMemoAndSource(rawTransaction types.Transaction) (string, string, error) {
+	urnMemo := rawTransaction.Memo()
 	sourceChannel := ""
 
 	// IBC transactions handled differently
-	for _, message := range rawTransaction.Body.Messages {
-		if message.Type == "/ibc.core.channel.v1.MsgRecvPacket" {
-			ibcData, err := message.Packet.GetPacketData()
-			if err != nil {
-				return "", "", err
-			}
-
-			sourceChannel = message.Packet.SourceChannel
-			urnMemo = ibcData.Memo
-			break
+	for _, message := range rawTransaction.RecvPackets() {
+		ibcData, err := types.GetPacketData(message.Packet)
+		if err != nil {
+			return "", "", metaprotocol.WrapError(metaprotocol.CodeInvalidTransaction, err)
 		}
+
+		sourceChannel = message.Packet.SourceChannel
+		urnMemo = ibcData.Memo
+		break
 	}
 
 	return urnMemo, sourceChannel, nil
 }
 
+// parseMetaprotocolURN returns the metaprotocol URN in the memo and the
+// IBC source channel of the transaction
+func (i *Indexer) parseMetaprotocolURN(rawTransaction types.Transaction) (*urn.URN, string, error) {
+	memo, sourceChannel, err := i.parseMemoAndSource(rawTransaction)
+	if err != nil {
+		return nil, "", err
+	}
+
+	metaprotocolURN, ok := urn.Parse([]byte(memo))
+	if !ok {
+		return nil, "", metaprotocol.NewError(metaprotocol.CodeInvalidURN, "invalid metaprotocol URN")
+	}
+	return metaprotocolURN, sourceChannel, nil
+}
+
 // processMetaprotocolMemo handles the processing of different metaprotocols
-func (i *Indexer) processMetaprotocolMemo(transactionModel models.Transaction, rawTransaction types.RawTransaction) error {
+// with the processors of router
+func (i *Indexer) processMetaprotocolMemo(db *gorm.DB, router *metaprotocol.Router, transactionModel models.Transaction, rawTransaction types.Transaction) error {
 	i.logger.WithFields(logrus.Fields{
 		"hash": rawTransaction.Hash,
 	}).Debug("Processing memo")
 
-	memo, sourceChannel, err := i.parseMemoAndSource(rawTransaction)
+	metaprotocolURN, sourceChannel, err := i.parseMetaprotocolURN(rawTransaction)
 	if err != nil {
 		return err
 	}
 
-	metaprotocolURN, ok := urn.Parse([]byte(memo))
-	if !ok {
-		return errors.New("invalid metaprotocol URN")
-	}
-
-	// Match the ID and send the SS to the correct processor with base64 data to decode
-	processor, ok := i.metaprotocols[metaprotocolURN.ID]
+	// Match the ID, the router validates the operation and calls the
+	// handler declared by the processor
+	processor, ok := router.Processor(metaprotocolURN.ID)
 	if !ok {
-		return fmt.Errorf("no processor for metaprotocol '%s'", metaprotocolURN.ID)
+		return metaprotocol.NewError(metaprotocol.CodeUnknownMetaprotocol, "%w '%s'", metaprotocol.ErrUnknownMetaprotocol, metaprotocolURN.ID).With("metaprotocol", metaprotocolURN.ID)
 	}
 
 	i.logger.WithFields(logrus.Fields{
@@ -367,7 +692,8 @@ func (i *Indexer) processMetaprotocolMemo(transactionModel models.Transaction, r
 		"hash":      rawTransaction.Hash,
 	}).Info("Processing metaprotocol")
 
-	err = processor.Process(transactionModel, metaprotocolURN, rawTransaction, sourceChannel)
+	err = router.Route(db, transactionModel, metaprotocolURN, rawTransaction, sourceChannel)
+	i.observeOperation(metaprotocolURN, err)
 	if err != nil {
 		i.logger.WithFields(logrus.Fields{
 			"metaprotocol": metaprotocolURN.ID,
@@ -380,111 +706,50 @@ func (i *Indexer) processMetaprotocolMemo(transactionModel models.Transaction, r
 	return nil
 }
 
-// fetchCurrentHeight fetches the current height from the chain by using the
-// RPC /status endpoint
-func (i *Indexer) fetchCurrentHeight() (uint64, error) {
-	endpoint := i.randomLCDEndpoint()
-
-	// Add support for custom endpoint headers
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/cosmos/base/tendermint/v1beta1/blocks/latest", endpoint), nil)
+// fetchCurrentHeight fetches the current height from the block source
+func (i *Indexer) fetchCurrentHeight(ctx context.Context) (uint64, error) {
+	height, err := i.blockSource.LatestHeight(ctx)
 	if err != nil {
 		return 0, err
 	}
-	for key, value := range i.endpointHeaders {
-		req.Header.Add(key, value)
-	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	var block types.LCDBlock
-	err = json.NewDecoder(resp.Body).Decode(&block)
-	if err != nil {
-		return 0, err
-	}
-
-	if block.Code != 0 {
-		return 0, fmt.Errorf("error fetching current height: %s", block.Message)
-	}
 
 	i.logger.WithFields(logrus.Fields{
-		"height":   block.Block.Header.Height,
-		"endpoint": endpoint,
+		"height": height,
 	}).Debug("Fetched current height")
-	return strconv.ParseUint(block.Block.Header.Height, 10, 64)
+	return height, nil
 }
 
 // fetchTransactions fetches all the transaction hashes in a block
-func (i *Indexer) fetchTransactions(height uint64) (types.LCDBlock, []types.RawTransaction, error) {
-	var transactions []types.RawTransaction
-	var lcdBlock types.LCDBlock
-
-	endpoint := i.randomLCDEndpoint()
-	// Add support for custom endpoint headers
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/cosmos/base/tendermint/v1beta1/blocks/%d", endpoint, height), nil)
-	if err != nil {
-		return lcdBlock, transactions, err
-	}
-	for key, value := range i.endpointHeaders {
-		req.Header.Add(key, value)
-	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return lcdBlock, transactions, err
-	}
+func (i *Indexer) fetchTransactions(ctx context.Context, height uint64) (types.LCDBlock, []types.Transaction, error) {
+	var transactions []types.Transaction
 
-	defer resp.Body.Close()
-
-	err = json.NewDecoder(resp.Body).Decode(&lcdBlock)
+	lcdBlock, err := i.blockSource.Block(ctx, height)
 	if err != nil {
 		return lcdBlock, transactions, err
 	}
 
-	if lcdBlock.Code != 0 {
-		return lcdBlock, transactions, fmt.Errorf("error fetching block: %s", lcdBlock.Message)
-	}
-
 	i.logger.WithFields(logrus.Fields{
-		"height":   height,
-		"txs":      len(lcdBlock.Block.Data.Txs),
-		"endpoint": endpoint,
+		"height": height,
+		"txs":    len(lcdBlock.Block.Data.Txs),
 	}).Debug("Fetched block")
 
 	// TODO: Fetch block results for this height as well to determine if the
 	// transaction was successful or not based on ID
-	rpcEndpoint := i.randomRPCEndpoint()
-
-	// Add support for custom endpoint headers
-	req, err = http.NewRequest("GET", fmt.Sprintf("%s/block_results?height=%d", rpcEndpoint, height), nil)
-	if err != nil {
-		return lcdBlock, transactions, err
-	}
-	for key, value := range i.endpointHeaders {
-		req.Header.Add(key, value)
-	}
-	client = &http.Client{}
-	rpcResp, err := client.Do(req)
-	if err != nil {
-		return lcdBlock, transactions, err
-	}
-
-	defer rpcResp.Body.Close()
-
-	var rpcBlock types.RPCBlockResult
-	err = json.NewDecoder(rpcResp.Body).Decode(&rpcBlock)
+	rpcBlock, err := i.blockSource.BlockResults(ctx, height)
 	if err != nil {
 		return lcdBlock, transactions, err
 	}
 	i.logger.WithFields(logrus.Fields{
-		"height":   height,
-		"txs":      len(rpcBlock.Result.TxsResults),
-		"endpoint": endpoint,
+		"height": height,
+		"txs":    len(rpcBlock.Result.TxsResults),
 	}).Debug("Fetched block results")
 
+	// A node without the results for the height returns an error instead,
+	// don't treat the transactions as successful
+	if len(rpcBlock.Result.TxsResults) != len(lcdBlock.Block.Data.Txs) {
+		return lcdBlock, transactions, fmt.Errorf("block results have %d transactions, expected %d", len(rpcBlock.Result.TxsResults), len(lcdBlock.Block.Data.Txs))
+	}
+
 	// The result of the transaction is stored in the block results in order
 	transactionResultIndex := make(map[int]types.TxResult)
 	for index, txResult := range rpcBlock.Result.TxsResults {
@@ -519,7 +784,7 @@ func (i *Indexer) fetchTransactions(height uint64) (types.LCDBlock, []types.RawT
 
 		// Decode the protobuf encoded transaction
 		decoder := decoder.DefaultDecoder
-		decodedTx, err := decoder.DecodeBase64(tx)
+		decodedTx, err := decoder.Decode(txBytes)
 		if err != nil {
 			// Unable to decode the protobuf, we'll need to skip
 			i.logger.WithFields(logrus.Fields{
@@ -530,67 +795,18 @@ func (i *Indexer) fetchTransactions(height uint64) (types.LCDBlock, []types.RawT
 			continue
 		}
 
-		// The rest of the indexer is looking for JSON. For now we'll continue
-		// with that and refactor at a later stage
-		// TODO: Refactor how transactions are handled internally
-		jsonTx, err := decodedTx.MarshalToJSON()
+		// Processors use the decoded transaction, it is only encoded as
+		// JSON when it is stored
+		rawTransaction, err := types.NewTransaction(txHash, decodedTx)
 		if err != nil {
-			// If we can't marshal to JSON, we can't use it
 			i.logger.WithFields(logrus.Fields{
 				"height": height,
 				"txs":    txHash,
 				"err":    err,
-			}).Warn("unable to JSON encode transaction")
+			}).Warn("unable to read protobuf transaction")
 			continue
 		}
-
-		// To RawTransaction as is expected
-		var rawTransaction types.RawTransaction
-		err = json.Unmarshal(jsonTx, &rawTransaction)
-		if err != nil {
-			// If we can't git it in the RawTransaction format, we can't use it
-			i.logger.WithFields(logrus.Fields{
-				"height": height,
-				"txs":    txHash,
-				"err":    err,
-			}).Warn("unable to JSON encode transaction")
-			continue
-		}
-
-		// Add the hash as it isn't there by default
-		rawTransaction.Hash = txHash
 		transactions = append(transactions, rawTransaction)
-
-		// TODO: Add hash somehow?
-
-		// // Get the transaction hash by converting the base64 to hex
-		// // This is the same as the transaction hash in the block explorer
-		// txBytes, err := base64.StdEncoding.DecodeString(tx)
-		// if err != nil {
-		// 	// If we can't marshal to JSON, we probably have invalid characters
-		// 	i.logger.Warn("Error encode transaction JSON:", err)
-		// 	continue
-		// }
-
-		// // Create transaction hash
-		// s := sha256.New()
-		// s.Write(txBytes)
-		// s.Sum(nil)
-		// txHash := strings.ToUpper(hex.EncodeToString(s.Sum(nil)))
-		// transactions = append(transactions, txHash)
-
 	}
 	return lcdBlock, transactions, nil
 }
-
-// randomEndpoint returns a random LCD endpoint to use
-// We do this to balance the load across multiple endpoints very naively
-func (i *Indexer) randomLCDEndpoint() string {
-	return i.lcdEndpoints[rand.Intn(len(i.lcdEndpoints))]
-}
-
-// randomEndpoint returns a random RPC endpoint to use
-// We do this to balance the load across multiple endpoints very naively
-func (i *Indexer) randomRPCEndpoint() string {
-	return i.rpcEndpoints[rand.Intn(len(i.rpcEndpoints))]
-}
@@ -0,0 +1,190 @@
+package indexer
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/blocksource"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a SQLite database with the tables of models
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "indexer.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(models...))
+	return db
+}
+
+// countingSource counts the blocks fetched from the archive
+type countingSource struct {
+	*blocksource.ArchiveSource
+	lock          sync.Mutex
+	blocks        map[uint64]int
+	latestFetches int
+}
+
+func (source *countingSource) Block(ctx context.Context, height uint64) (types.LCDBlock, error) {
+	source.lock.Lock()
+	source.blocks[height]++
+	source.lock.Unlock()
+	return source.ArchiveSource.Block(ctx, height)
+}
+
+// fetched returns the number of times each block was fetched
+func (source *countingSource) fetched() map[uint64]int {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	fetched := make(map[uint64]int, len(source.blocks))
+	for height, count := range source.blocks {
+		fetched[height] = count
+	}
+	return fetched
+}
+
+func (source *countingSource) LatestHeight(ctx context.Context) (uint64, error) {
+	source.lock.Lock()
+	source.latestFetches++
+	source.lock.Unlock()
+	return source.ArchiveSource.LatestHeight(ctx)
+}
+
+// runUntil runs indexBlocks until done returns true
+func runUntil(t *testing.T, indexer *Indexer, done func() bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	indexer.wg.Add(1)
+	go indexer.indexBlocks(ctx)
+	assert.Eventually(t, done, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	indexer.wg.Wait()
+}
+
+func TestIndexBlocksRestart(t *testing.T) {
+	db := newTestDB(t, &models.Status{}, &models.BlockChecksum{}, &models.Transaction{})
+	assert.NoError(t, db.Create(&models.Status{ChainID: "gaialocal-1"}).Error)
+
+	archive, err := blocksource.NewArchiveSource("blocksource/testdata")
+	assert.NoError(t, err)
+	source := &countingSource{ArchiveSource: archive, blocks: make(map[uint64]int)}
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	indexer := &Indexer{
+		chainID:             "gaialocal-1",
+		db:                  db,
+		blockSource:         source,
+		blockPollIntervalMS: 5,
+		logger:              logrus.NewEntry(log),
+	}
+
+	processedHeight := func() uint64 {
+		var status models.Status
+		assert.NoError(t, db.Where("chain_id = ?", "gaialocal-1").First(&status).Error)
+		return status.LastProcessedHeight
+	}
+	runUntil(t, indexer, func() bool {
+		return processedHeight() == 101
+	})
+	assert.Equal(t, map[uint64]int{100: 1, 101: 1}, source.fetched())
+
+	// After a restart the processed blocks are not fetched or applied again
+	source.lock.Lock()
+	latestFetches := source.latestFetches
+	source.lock.Unlock()
+	runUntil(t, indexer, func() bool {
+		source.lock.Lock()
+		defer source.lock.Unlock()
+		return source.latestFetches >= latestFetches+2
+	})
+	assert.Equal(t, map[uint64]int{100: 1, 101: 1}, source.blocks, "processed blocks should not be applied twice")
+	assert.Equal(t, uint64(101), processedHeight())
+}
+
+func TestIndexBlocksNewChain(t *testing.T) {
+	db := newTestDB(t, &models.Status{}, &models.BlockChecksum{}, &models.Transaction{})
+
+	archive, err := blocksource.NewArchiveSource("blocksource/testdata")
+	assert.NoError(t, err)
+	source := &countingSource{ArchiveSource: archive, blocks: make(map[uint64]int)}
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	indexer := &Indexer{
+		chainID:             "gaialocal-1",
+		baseDenom:           "uatom",
+		db:                  db,
+		blockSource:         source,
+		blockPollIntervalMS: 5,
+		logger:              logrus.NewEntry(log),
+	}
+
+	// The status is created for a chain without one and stores the progress
+	processedHeight := func() uint64 {
+		var status models.Status
+		err := db.Where("chain_id = ?", "gaialocal-1").First(&status).Error
+		if err != nil {
+			return 0
+		}
+		return status.LastProcessedHeight
+	}
+	runUntil(t, indexer, func() bool {
+		return processedHeight() == 101
+	})
+
+	var statuses []models.Status
+	assert.NoError(t, db.Find(&statuses).Error)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "uatom", statuses[0].BaseToken)
+
+	// A restart resumes after the stored height
+	source.lock.Lock()
+	latestFetches := source.latestFetches
+	source.lock.Unlock()
+	runUntil(t, indexer, func() bool {
+		source.lock.Lock()
+		defer source.lock.Unlock()
+		return source.latestFetches >= latestFetches+2
+	})
+	assert.Equal(t, map[uint64]int{100: 1, 101: 1}, source.fetched(), "processed blocks should not be applied twice")
+}
+
+func TestProcessTransactionOtherChain(t *testing.T) {
+	db := newTestDB(t, &models.Transaction{})
+	other := models.Transaction{ChainID: "neutron-1", Hash: "ABCDEF", Height: 10, Fees: "[]", StatusMessage: types.TransactionStateSuccess}
+	assert.NoError(t, db.Create(&other).Error)
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	indexer := &Indexer{chainID: "cosmoshub-4", logger: logrus.NewEntry(log)}
+	assert.NoError(t, indexer.processTransaction(db, 20, time.Now().UTC(), types.Transaction{Hash: "ABCDEF"}))
+
+	var stored models.Transaction
+	assert.NoError(t, db.Where("chain_id = ? AND hash = ?", "neutron-1", "ABCDEF").First(&stored).Error)
+	assert.Equal(t, uint64(10), stored.Height, "a transaction with the same hash on another chain should not be replaced")
+	assert.Equal(t, types.TransactionStateSuccess, stored.StatusMessage)
+
+	var processed models.Transaction
+	assert.NoError(t, db.Where("chain_id = ? AND hash = ?", "cosmoshub-4", "ABCDEF").First(&processed).Error)
+	assert.NotEqual(t, other.ID, processed.ID)
+	assert.Equal(t, uint64(20), processed.Height)
+}
+
+func TestTruncateStatusMessage(t *testing.T) {
+	message := strings.Repeat("a", maxStatusMessageLength-1) + "ééé"
+	truncated := truncateStatusMessage(message)
+	assert.True(t, utf8.ValidString(truncated), "multi-byte characters should not be split")
+	assert.Equal(t, maxStatusMessageLength, utf8.RuneCountInString(truncated))
+	assert.Equal(t, "short", truncateStatusMessage("short"))
+}
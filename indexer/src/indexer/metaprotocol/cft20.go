@@ -1,49 +1,36 @@
 package metaprotocol
 
 import (
-	"bytes"
 	"fmt"
 	"log"
 	"math"
-	"mime"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentpolicy"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/leodido/go-urn"
 	"gorm.io/gorm"
 )
 
 type CFT20Config struct {
-	S3Endpoint     string `envconfig:"S3_ENDPOINT"`
-	S3Region       string `envconfig:"S3_REGION"`
-	S3Bucket       string `envconfig:"S3_BUCKET"`
-	S3ID           string `envconfig:"S3_ID"`
-	S3Secret       string `envconfig:"S3_SECRET"`
-	S3Token        string `envconfig:"S3_TOKEN"`
-	S3StoreContent bool   `envconfig:"S3_STORE_CONTENT" default:"true"`
+	AllowedMimeTypes []string `envconfig:"CFT20_ALLOWED_MIME_TYPES"`
+	MaxContentBytes  int      `envconfig:"CFT20_MAX_CONTENT_BYTES" default:"0"`
+	ActiveContent    string   `envconfig:"CFT20_ACTIVE_CONTENT" default:"sandbox"`
 }
 
 type CFT20 struct {
-	chainID    string
-	db         *gorm.DB
-	s3Endpoint string
-	s3Region   string
-	s3Bucket   string
-	// s3ID is the S3 credentials ID
-	s3ID string
-	// s3Secret is the S3 credentials secret
-	s3Secret string
-	// s3Token is the S3 credentials token
-	s3Token string
+	chainID string
+	chain   Chain
+	// contentStore stores token logos, nil if content isn't stored
+	contentStore contentstore.ContentStore
+	// contentValidator checks token logos
+	contentValidator contentValidator
 	// Define protocol rules
 	nameMinLength          int
 	nameMaxLength          int
@@ -54,27 +41,24 @@ type CFT20 struct {
 	perWalletLimitMaxValue uint64
 }
 
-func NewCFT20Processor(chainID string, db *gorm.DB) *CFT20 {
+func NewCFT20Processor(chain Chain, contentStore contentstore.ContentStore) *CFT20 {
 	// Parse config environment variables for self
-	var config InscriptionConfig
+	var config CFT20Config
 	err := envconfig.Process("", &config)
 	if err != nil {
 		log.Fatalf("Unable to process config: %s", err)
 	}
 
-	if config.S3StoreContent && (config.S3Endpoint == "" || config.S3Region == "" || config.S3Bucket == "" || config.S3ID == "" || config.S3Secret == "") {
-		log.Fatalf("S3 store content is enabled but the required environment variables are not set")
+	contentValidator, err := newContentValidator(chain, config.AllowedMimeTypes, config.MaxContentBytes, config.ActiveContent)
+	if err != nil {
+		log.Fatalf("Unable to process token logo content policy: %s", err)
 	}
 
 	return &CFT20{
-		chainID:                chainID,
-		db:                     db,
-		s3Endpoint:             config.S3Endpoint,
-		s3Region:               config.S3Region,
-		s3Bucket:               config.S3Bucket,
-		s3ID:                   config.S3ID,
-		s3Secret:               config.S3Secret,
-		s3Token:                config.S3Token,
+		chainID:                chain.ID,
+		chain:                  chain,
+		contentStore:           contentStore,
+		contentValidator:       contentValidator,
 		nameMinLength:          1,
 		nameMaxLength:          32,
 		tickerMinLength:        1,
@@ -89,7 +73,7 @@ func (protocol *CFT20) Name() string {
 	return "cft20"
 }
 
-func (protocol *CFT20) Mint(transactionModel models.Transaction, tokenModel models.Token, parsedURN ProtocolURN, rawTransaction types.RawTransaction, sender string, mintAmount uint64) error {
+func (protocol *CFT20) Mint(db *gorm.DB, transactionModel models.Transaction, tokenModel models.Token, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string, mintAmount uint64) error {
 	// Add to tx history, we do this first so that if this tx has been processed
 	// we don't alter anything else
 	historyModel := models.TokenAddressHistory{
@@ -103,21 +87,21 @@ func (protocol *CFT20) Mint(transactionModel models.Transaction, tokenModel mode
 		Amount:        mintAmount,
 		DateCreated:   transactionModel.DateCreated,
 	}
-	result := protocol.db.Save(&historyModel)
+	result := db.Save(&historyModel)
 	if result.Error != nil {
 		return result.Error
 	}
 
 	// Update token circulating
 	tokenModel.CirculatingSupply = tokenModel.CirculatingSupply + mintAmount
-	result = protocol.db.Save(&tokenModel)
+	result = db.Save(&tokenModel)
 	if result.Error != nil {
 		return result.Error
 	}
 
 	// Update user balance
 	var holderModel models.TokenHolder
-	result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
 	if result.Error != nil {
 		if result.Error != gorm.ErrRecordNotFound {
 			return result.Error
@@ -130,765 +114,809 @@ func (protocol *CFT20) Mint(transactionModel models.Transaction, tokenModel mode
 	holderModel.Amount = holderModel.Amount + mintAmount
 	holderModel.DateUpdated = transactionModel.DateCreated
 
-	result = protocol.db.Save(&holderModel)
+	result = db.Save(&holderModel)
 	if result.Error != nil {
 		return result.Error
 	}
 
-	return nil
+	return emitEvent(db, transactionModel, EventCFT20Mint, EventData{
+		"ticker":   tokenModel.Ticker,
+		"receiver": sender,
+		"amount":   mintAmount,
+	})
 }
 
-func (protocol *CFT20) Process(transactionModel models.Transaction, protocolURN *urn.URN, rawTransaction types.RawTransaction, sourceChannel string) error {
-	sender, err := rawTransaction.GetSenderAddress()
+func (protocol *CFT20) Operations() []Operation {
+	return []Operation{
+		{
+			Name: "deploy",
+			// The open time is not declared, if it can't be parsed the token
+			// opens at the block time
+			Fields: []Field{
+				{Key: "nam", Type: FieldString},
+				{Key: "tic", Type: FieldString},
+				{Key: "sup", Type: FieldDecimal},
+				{Key: "dec", Type: FieldUint},
+				{Key: "lim", Type: FieldDecimal},
+				{Key: "pre", Type: FieldDecimal, Optional: true},
+			},
+			Handler: protocol.processDeploy,
+		},
+		{
+			Name:    "mint",
+			Fields:  []Field{{Key: "tic", Type: FieldString}},
+			Handler: protocol.processMint,
+		},
+		{
+			Name: "transfer",
+			Fields: []Field{
+				{Key: "tic", Type: FieldString},
+				{Key: "dst", Type: FieldString},
+				{Key: "amt", Type: FieldUint},
+			},
+			Handler: protocol.processTransfer,
+		},
+		{
+			Name: "burn",
+			Fields: []Field{
+				{Key: "tic", Type: FieldString},
+				{Key: "amt", Type: FieldDecimal},
+			},
+			Handler: protocol.processBurn,
+		},
+		{
+			Name: "list",
+			Fields: []Field{
+				{Key: "tic", Type: FieldString},
+				{Key: "amt", Type: FieldDecimal},
+				{Key: "ppt", Type: FieldDecimal},
+			},
+			Handler: protocol.processList,
+		},
+		{
+			Name: "buy",
+			Fields: []Field{
+				{Key: "tic", Type: FieldString},
+				{Key: "ord", Type: FieldUint},
+			},
+			Handler: protocol.processBuy,
+		},
+		{
+			Name: "delist",
+			Fields: []Field{
+				{Key: "tic", Type: FieldString},
+				{Key: "ord", Type: FieldUint},
+			},
+			Handler: protocol.processDelist,
+		},
+	}
+}
+
+// processDeploy handles the deploy operation
+func (protocol *CFT20) processDeploy(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	name, err := url.QueryUnescape(strings.TrimSpace(parsedURN.KeyValuePairs["nam"]))
 	if err != nil {
-		return err
+		return NewError(CodeInvalidToken, "unable to parse token name '%s'", err).With("field", "nam")
 	}
+	ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
+	ticker = strings.ToUpper(ticker)
 
-	// We need to parse the protocol specific string in SS, it contains
-	// {chainId}@{version};operation$h={unique hash of content}
-	// cosmoshub-4@v1beta;deploy$nam=The Name,tic=TICK,sup=21000000,dec=6,lim=1000
-	// cosmoshub-4@v1beta;deploy$nam=NewYearDay,tic=NYD,sup=28000000,dec=18,lim=50000,opn=1704059940
-	parsedURN, err := ParseProtocolString(protocolURN)
+	supplyFloat, err := strconv.ParseFloat(parsedURN.KeyValuePairs["sup"], 64)
 	if err != nil {
-		return err
+		return NewError(CodeInvalidToken, "unable to parse supply '%s'", err).With("field", "sup")
+	}
+	if supplyFloat <= 0 {
+		return NewError(CodeInvalidToken, "token supply must be greater than 0").With("field", "sup")
 	}
 
-	if parsedURN.ChainID != protocol.chainID {
-		return fmt.Errorf("chain ID in protocol string does not match transaction chain ID")
+	decimals, err := strconv.ParseUint(parsedURN.KeyValuePairs["dec"], 10, 64)
+	if err != nil {
+		return NewError(CodeInvalidToken, "unable to parse decimals '%s'", err).With("field", "dec")
+	}
+	limitFloat, err := strconv.ParseFloat(parsedURN.KeyValuePairs["lim"], 64)
+	if err != nil {
+		return NewError(CodeInvalidToken, "unable to parse limit '%s'", err).With("field", "lim")
+	}
+	if limitFloat <= 0 {
+		return NewError(CodeInvalidToken, "token supply must be greater than 0").With("field", "sup")
 	}
 
-	// TODO: Rework the operation handling
-	switch parsedURN.Operation {
-	case "deploy":
-		name, err := url.QueryUnescape(strings.TrimSpace(parsedURN.KeyValuePairs["nam"]))
-		if err != nil {
-			return fmt.Errorf("unable to parse token name '%s'", err)
-		}
-		ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
-		ticker = strings.ToUpper(ticker)
+	openTimestamp, err := strconv.ParseUint(parsedURN.KeyValuePairs["opn"], 10, 64)
+	if err != nil {
+		// If this fails, we set the open time to the block time
+		openTimestamp = uint64(transactionModel.DateCreated.Unix())
+	}
 
-		supplyFloat, err := strconv.ParseFloat(parsedURN.KeyValuePairs["sup"], 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse supply '%s'", err)
-		}
-		if supplyFloat <= 0 {
-			return fmt.Errorf("token supply must be greater than 0")
-		}
+	// Add the decimals to the supply and limit
+	supplyFloat = supplyFloat * math.Pow10(int(decimals))
+	supply := uint64(math.Round(supplyFloat))
 
-		decimals, err := strconv.ParseUint(parsedURN.KeyValuePairs["dec"], 10, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse decimals '%s'", err)
-		}
-		limitFloat, err := strconv.ParseFloat(parsedURN.KeyValuePairs["lim"], 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse limit '%s'", err)
-		}
-		if limitFloat <= 0 {
-			return fmt.Errorf("token supply must be greater than 0")
-		}
+	limitFloat = limitFloat * math.Pow10(int(decimals))
+	limit := uint64(math.Round(limitFloat))
+
+	// pre-mint if pre param exits
+	var preMintAmount uint64
+	preMintAmountString := strings.TrimSpace(parsedURN.KeyValuePairs["pre"])
+	if preMintAmountString != "" {
+		preMintAmountFloat, err := strconv.ParseFloat(preMintAmountString, 64)
 
-		openTimestamp, err := strconv.ParseUint(parsedURN.KeyValuePairs["opn"], 10, 64)
 		if err != nil {
-			// If this fails, we set the open time to the block time
-			openTimestamp = uint64(transactionModel.DateCreated.Unix())
+			return NewError(CodeInvalidToken, "unable to parse pre-mint amount '%s'", err).With("field", "pre")
 		}
 
-		// Add the decimals to the supply and limit
-		supplyFloat = supplyFloat * math.Pow10(int(decimals))
-		supply := uint64(math.Round(supplyFloat))
+		// Add the decimals to the pre-mint amount
+		preMintAmountFloat = preMintAmountFloat * math.Pow10(int(decimals))
+		preMintAmount = uint64(math.Round(preMintAmountFloat))
 
-		limitFloat = limitFloat * math.Pow10(int(decimals))
-		limit := uint64(math.Round(limitFloat))
+		if preMintAmount == 0 {
+			return NewError(CodeInvalidToken, "pre-mint amount must be greater than 0").With("field", "pre")
+		}
 
-		// pre-mint if pre param exits
-		var preMintAmount uint64
-		preMintAmountString := strings.TrimSpace(parsedURN.KeyValuePairs["pre"])
-		if preMintAmountString != "" {
-			preMintAmountFloat, err := strconv.ParseFloat(preMintAmountString, 64)
+		// check if pre-mint amount is less or equal than max supply
+		if preMintAmount > supply {
+			return NewError(CodeInvalidToken, "pre-mint amount must be less or equal than max supply").With("field", "pre")
+		}
+	}
 
-			if err != nil {
-				return fmt.Errorf("unable to parse pre-mint amount '%s'", err)
-			}
+	// TODO: Rework validation
+	// Validate some fields
+	if len(name) < protocol.nameMinLength || len(name) > protocol.nameMaxLength {
+		return NewError(CodeInvalidToken, "token name must be between %d and %d characters", protocol.nameMinLength, protocol.nameMaxLength).With("field", "nam").With("minimum", protocol.nameMinLength).With("maximum", protocol.nameMaxLength)
+	}
+	if len(ticker) < protocol.tickerMinLength || len(ticker) > protocol.tickerMaxLength {
+		return NewError(CodeInvalidToken, "token ticker must be between %d and %d characters", protocol.tickerMinLength, protocol.tickerMaxLength).With("field", "tic").With("minimum", protocol.tickerMinLength).With("maximum", protocol.tickerMaxLength)
+	}
+	if decimals > uint64(protocol.decimalsMaxValue) {
+		return NewError(CodeInvalidToken, "token decimals must be less than %d", protocol.decimalsMaxValue).With("field", "dec").With("maximum", protocol.decimalsMaxValue)
+	}
+	if supply > protocol.maxSupplyMaxValue {
+		return NewError(CodeInvalidToken, "token supply must be less than %d", protocol.maxSupplyMaxValue).With("field", "sup").With("maximum", protocol.maxSupplyMaxValue)
+	}
+	// Minting limit may be at most 1% of supply
+	maxMintLimit := supplyFloat * 0.01
+	if limitFloat > maxMintLimit {
+		return NewError(CodeInvalidToken, "the mint limit may not exceed 1%% of the total supply").With("field", "lim")
+	}
 
-			// Add the decimals to the pre-mint amount
-			preMintAmountFloat = preMintAmountFloat * math.Pow10(int(decimals))
-			preMintAmount = uint64(math.Round(preMintAmountFloat))
+	if limit > supply {
+		return NewError(CodeInvalidToken, "token per wallet limit must be less than supply of %d", protocol.maxSupplyMaxValue).With("field", "lim").With("maximum", protocol.maxSupplyMaxValue)
+	}
 
-			if preMintAmount == 0 {
-				return fmt.Errorf("pre-mint amount must be greater than 0")
-			}
+	// Check if this token has already been deployed
+	var tokenModel models.Token
+	result := db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
+	if result.Error == nil {
+		return NewError(CodeTickerExists, "token with ticker '%s' already exists", ticker).With("ticker", ticker)
+	}
 
-			// check if pre-mint amount is less or equal than max supply
-			if preMintAmount > supply {
-				return fmt.Errorf("pre-mint amount must be less or equal than max supply")
-			}
+	// TODO: Rework the content extraction
+	contentPath := ""
+	contentLength := 0
+	var contentCheck contentpolicy.Result
+	// If this token includes content, we need to store it and add to the record
+	if rawTransaction.ExtensionOptionCount() == 1 {
+		// Logo is stored in the non_critical_extension_options
+		// section of the transaction
+		msg, err := getExtensionMessage(rawTransaction)
+		if err != nil {
+			return err
 		}
 
-		// TODO: Rework validation
-		// Validate some fields
-		if len(name) < protocol.nameMinLength || len(name) > protocol.nameMaxLength {
-			return fmt.Errorf("token name must be between %d and %d characters", protocol.nameMinLength, protocol.nameMaxLength)
-		}
-		if len(ticker) < protocol.tickerMinLength || len(ticker) > protocol.tickerMaxLength {
-			return fmt.Errorf("token ticker must be between %d and %d characters", protocol.tickerMinLength, protocol.tickerMaxLength)
-		}
-		if decimals > uint64(protocol.decimalsMaxValue) {
-			return fmt.Errorf("token decimals must be less than %d", protocol.decimalsMaxValue)
-		}
-		if supply > protocol.maxSupplyMaxValue {
-			return fmt.Errorf("token supply must be less than %d", protocol.maxSupplyMaxValue)
-		}
-		// Minting limit may be at most 1% of supply
-		maxMintLimit := supplyFloat * 0.01
-		if limitFloat > maxMintLimit {
-			return fmt.Errorf("the mint limit may not exceed 1%% of the total supply")
+		var inscriptionMetadata types.InscriptionMetadata[types.Metadata]
+		_, err = msg.GetMetadata(&inscriptionMetadata)
+		if err != nil {
+			return err
 		}
 
-		if limit > supply {
-			return fmt.Errorf("token per wallet limit must be less than supply of %d", protocol.maxSupplyMaxValue)
+		content, err := msg.GetContent()
+		if err != nil {
+			return err
 		}
 
-		// Check if this token has already been deployed
-		var tokenModel models.Token
-		result := protocol.db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
-		if result.Error == nil {
-			return fmt.Errorf("token with ticker '%s' already exists", ticker)
+		// The logo type is sniffed rather than taken from the metadata
+		contentCheck, err = protocol.contentValidator.check(transactionModel.Height, inscriptionMetadata.Metadata.Mime, content)
+		if err != nil {
+			return err
 		}
 
-		// TODO: Rework the content extraction
-		contentPath := ""
-		contentLength := 0
-		// If this token includes content, we need to store it and add to the record
-		if len(rawTransaction.Body.NonCriticalExtensionOptions) == 1 {
-			// Logo is stored in the non_critical_extension_options
-			// section of the transaction
-			var msg types.ExtensionMsg
-			for _, extension := range rawTransaction.Body.NonCriticalExtensionOptions {
-				msg, err = extension.UnmarshalData()
-				if err != nil {
-					return fmt.Errorf("unable to unmarshal extension data '%s'", err)
-				}
-
-				// We only process the first extension option
-				break
-			}
+		// Store the content with the detected mime type
+		contentPath, err = contentstore.Store(db.Statement.Context, protocol.contentStore, contentCheck.StoreType, content)
+		if err != nil {
+			return NewError(CodeInternal, "unable to store content '%s'", err)
+		}
 
-			var inscriptionMetadata types.InscriptionMetadata[types.Metadata]
-			_, err = msg.GetMetadata(&inscriptionMetadata)
-			if err != nil {
-				return err
-			}
+		contentLength = len(content)
+	}
 
-			content, err := msg.GetContent()
-			if err != nil {
-				return err
-			}
+	// Create the token model
+	tokenModel = models.Token{
+		ChainID:           parsedURN.ChainID,
+		Height:            transactionModel.Height,
+		Version:           parsedURN.Version,
+		TransactionID:     transactionModel.ID,
+		Creator:           sender,
+		CurrentOwner:      sender,
+		Name:              name,
+		Ticker:            ticker,
+		Decimals:          decimals,
+		MaxSupply:         supply,
+		PerMintLimit:      limit,
+		LaunchTimestamp:   openTimestamp,
+		ContentPath:       contentPath,
+		ContentSizeBytes:  uint64(contentLength),
+		DeclaredMime:      nullString(contentCheck.DeclaredType),
+		DetectedMime:      nullString(contentCheck.DetectedType),
+		IsActiveContent:   contentCheck.Active,
+		DateCreated:       transactionModel.DateCreated,
+		CirculatingSupply: 0,
+		PreMint:           preMintAmount,
+	}
 
-			// Store the content with the correct mime type on DO
-			contentPath, err = protocol.storeContent(inscriptionMetadata.Metadata.Mime, rawTransaction.Hash, content)
-			if err != nil {
-				return fmt.Errorf("unable to store content '%s'", err)
-			}
+	result = db.Save(&tokenModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-			contentLength = len(content)
+	// mint the pre-mint amount if pre param exits
+	if preMintAmount != 0 {
+		err = protocol.Mint(db, transactionModel, tokenModel, parsedURN, rawTransaction, sender, preMintAmount)
+		if err != nil {
+			return err
 		}
+	}
 
-		// Create the token model
-		tokenModel = models.Token{
-			ChainID:           parsedURN.ChainID,
-			Height:            transactionModel.Height,
-			Version:           parsedURN.Version,
-			TransactionID:     transactionModel.ID,
-			Creator:           sender,
-			CurrentOwner:      sender,
-			Name:              name,
-			Ticker:            ticker,
-			Decimals:          decimals,
-			MaxSupply:         supply,
-			PerMintLimit:      limit,
-			LaunchTimestamp:   openTimestamp,
-			ContentPath:       contentPath,
-			ContentSizeBytes:  uint64(contentLength),
-			DateCreated:       transactionModel.DateCreated,
-			CirculatingSupply: 0,
-			PreMint:           preMintAmount,
-		}
+	return nil
+}
 
-		result = protocol.db.Save(&tokenModel)
-		if result.Error != nil {
-			return result.Error
-		}
+// processMint handles the mint operation
+func (protocol *CFT20) processMint(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
+	ticker = strings.ToUpper(ticker)
 
-		// mint the pre-mint amount if pre param exits
-		if preMintAmount != 0 {
-			err = protocol.Mint(transactionModel, tokenModel, parsedURN, rawTransaction, sender, preMintAmount)
-			if err != nil {
-				return err
-			}
-		}
+	// Check if the ticker exists
+	var tokenModel models.Token
+	result := db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
+	if result.Error != nil {
+		return NewError(CodeTokenNotFound, "token with ticker '%s' doesn't exist", ticker).With("ticker", ticker)
+	}
+	// Check if the minted <= max supply
+	if tokenModel.CirculatingSupply >= tokenModel.MaxSupply {
+		return NewError(CodeMintedOut, "token with ticker '%s' has reached max supply", ticker).With("ticker", ticker)
+	}
+	// Check if opn time < transaction time
+	if tokenModel.LaunchTimestamp > uint64(transactionModel.DateCreated.Unix()) {
+		return NewError(CodeMintNotOpen, "token with ticker '%s' is not yet open for minting", ticker).With("ticker", ticker)
+	}
 
-	case "mint":
-		ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
-		ticker = strings.ToUpper(ticker)
+	mintAmount := tokenModel.PerMintLimit
+	if tokenModel.CirculatingSupply+mintAmount > tokenModel.MaxSupply {
+		// Determine if there is anything left to mint
+		mintAmount = tokenModel.MaxSupply - tokenModel.CirculatingSupply
+	}
 
-		// Check if the ticker exists
-		var tokenModel models.Token
-		result := protocol.db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
-		if result.Error != nil {
-			return fmt.Errorf("token with ticker '%s' doesn't exist", ticker)
-		}
-		// Check if the minted <= max supply
-		if tokenModel.CirculatingSupply >= tokenModel.MaxSupply {
-			return fmt.Errorf("token with ticker '%s' has reached max supply", ticker)
-		}
-		// Check if opn time < transaction time
-		if tokenModel.LaunchTimestamp > uint64(transactionModel.DateCreated.Unix()) {
-			return fmt.Errorf("token with ticker '%s' is not yet open for minting", ticker)
-		}
+	return protocol.Mint(db, transactionModel, tokenModel, parsedURN, rawTransaction, sender, mintAmount)
+}
 
-		mintAmount := tokenModel.PerMintLimit
-		if tokenModel.CirculatingSupply+mintAmount > tokenModel.MaxSupply {
-			// Determine if there is anything left to mint
-			mintAmount = tokenModel.MaxSupply - tokenModel.CirculatingSupply
-		}
+// processTransfer handles the transfer operation
+func (protocol *CFT20) processTransfer(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
+	ticker = strings.ToUpper(ticker)
 
-		return protocol.Mint(transactionModel, tokenModel, parsedURN, rawTransaction, sender, mintAmount)
+	// Check if the ticker exists
+	var tokenModel models.Token
+	result := db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
+	if result.Error != nil {
+		return NewError(CodeTokenNotFound, "token with ticker '%s' doesn't exist", ticker).With("ticker", ticker)
+	}
 
-	case "transfer":
+	// Check required fields
+	destinationAddress := strings.TrimSpace(parsedURN.KeyValuePairs["dst"])
+	destinationAddress = strings.ToLower(destinationAddress)
+	if len(destinationAddress) != 45 {
+		return NewError(CodeInvalidAddress, "cosmos hub addresses must be 45 characters long")
+	}
+	if !strings.Contains(destinationAddress, "cosmos1") {
+		return NewError(CodeInvalidAddress, "destination address does not look like a valid address")
+	}
 
-		ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
-		ticker = strings.ToUpper(ticker)
+	amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
+	// Convert amount to have the correct number of decimals
+	amount, err := strconv.ParseUint(amountString, 10, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse amount '%s'", err).With("field", "amt")
+	}
+	if amount == 0 {
+		return NewError(CodeInvalidField, "amount must be greater than 0").With("field", "amt")
+	}
 
-		// Check if the ticker exists
-		var tokenModel models.Token
-		result := protocol.db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
-		if result.Error != nil {
-			return fmt.Errorf("token with ticker '%s' doesn't exist", ticker)
-		}
+	amount = amount * uint64(math.Pow10(int(tokenModel.Decimals)))
 
-		// Check required fields
-		destinationAddress := strings.TrimSpace(parsedURN.KeyValuePairs["dst"])
-		destinationAddress = strings.ToLower(destinationAddress)
-		if len(destinationAddress) != 45 {
-			return fmt.Errorf("cosmos hub addresses must be 45 characters long")
-		}
-		if !strings.Contains(destinationAddress, "cosmos1") {
-			return fmt.Errorf("destination address does not look like a valid address")
-		}
+	// Check that the user has enough tokens to transfer
+	var holderModel models.TokenHolder
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
+	if result.Error != nil {
+		return NewError(CodeInsufficientBalance, "sender does not have any tokens to transfer")
+	}
 
-		amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
-		// Convert amount to have the correct number of decimals
-		amount, err := strconv.ParseUint(amountString, 10, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse amount '%s'", err)
-		}
-		if amount == 0 {
-			return fmt.Errorf("amount must be greater than 0")
-		}
+	if holderModel.Amount < amount {
+		return NewError(CodeInsufficientBalance, "sender does not have enough tokens to transfer")
+	}
 
-		amount = amount * uint64(math.Pow10(int(tokenModel.Decimals)))
+	// At this point we know that the sender has enough tokens to transfer
+	// so update the sender's balance
+	holderModel.Amount = holderModel.Amount - amount
+	result = db.Save(&holderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update sender balance '%w'", result.Error)
+	}
 
-		// Check that the user has enough tokens to transfer
-		var holderModel models.TokenHolder
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
-		if result.Error != nil {
-			return fmt.Errorf("sender does not have any tokens to transfer")
+	// Check if the destination address has any tokens
+	var destinationHolderModel models.TokenHolder
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, destinationAddress).First(&destinationHolderModel)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return NewError(CodeInternal, "unable to check destination balance '%w'", result.Error)
 		}
+	}
 
-		if holderModel.Amount < amount {
-			return fmt.Errorf("sender does not have enough tokens to transfer")
-		}
+	// If the destination address has no tokens, we need to create a record
+	destinationHolderModel.ChainID = parsedURN.ChainID
+	destinationHolderModel.TokenID = tokenModel.ID
+	destinationHolderModel.Address = destinationAddress
+	destinationHolderModel.Amount = destinationHolderModel.Amount + amount
+	destinationHolderModel.DateUpdated = transactionModel.DateCreated
 
-		// At this point we know that the sender has enough tokens to transfer
-		// so update the sender's balance
-		holderModel.Amount = holderModel.Amount - amount
-		result = protocol.db.Save(&holderModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update sender balance '%s'", err)
-		}
+	result = db.Save(&destinationHolderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update receiver balance '%w'", result.Error)
+	}
 
-		// Check if the destination address has any tokens
-		var destinationHolderModel models.TokenHolder
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, destinationAddress).First(&destinationHolderModel)
-		if result.Error != nil {
-			if result.Error != gorm.ErrRecordNotFound {
-				return fmt.Errorf("unable to check destination balance '%s'", err)
-			}
-		}
+	// Record the transfer
+	historyModel := models.TokenAddressHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        transactionModel.Height,
+		TransactionID: transactionModel.ID,
+		TokenID:       tokenModel.ID,
+		Sender:        sender,
+		Receiver:      destinationAddress,
+		Action:        "transfer",
+		Amount:        amount,
+		DateCreated:   transactionModel.DateCreated,
+	}
+	result = db.Save(&historyModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-		// If the destination address has no tokens, we need to create a record
-		destinationHolderModel.ChainID = parsedURN.ChainID
-		destinationHolderModel.TokenID = tokenModel.ID
-		destinationHolderModel.Address = destinationAddress
-		destinationHolderModel.Amount = destinationHolderModel.Amount + amount
-		destinationHolderModel.DateUpdated = transactionModel.DateCreated
+	return emitEvent(db, transactionModel, EventCFT20Transfer, EventData{
+		"ticker":   tokenModel.Ticker,
+		"sender":   sender,
+		"receiver": destinationAddress,
+		"amount":   amount,
+	})
+}
 
-		result = protocol.db.Save(&destinationHolderModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update receiver balance '%s'", err)
-		}
+// processBurn handles the burn operation
+func (protocol *CFT20) processBurn(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
+	ticker = strings.ToUpper(ticker)
 
-		// Record the transfer
-		historyModel := models.TokenAddressHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        transactionModel.Height,
-			TransactionID: transactionModel.ID,
-			TokenID:       tokenModel.ID,
-			Sender:        sender,
-			Receiver:      destinationAddress,
-			Action:        "transfer",
-			Amount:        amount,
-			DateCreated:   transactionModel.DateCreated,
-		}
-		result = protocol.db.Save(&historyModel)
-		if result.Error != nil {
-			return result.Error
-		}
+	// Check if the ticker exists
+	var tokenModel models.Token
+	result := db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
+	if result.Error != nil {
+		return NewError(CodeTokenNotFound, "token with ticker '%s' doesn't exist", ticker).With("ticker", ticker)
+	}
 
-	case "burn":
+	// Check required fields
+	amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
+	// Convert amount to have the correct number of decimals
+	amountFloat, err := strconv.ParseFloat(amountString, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse amount '%s'", err).With("field", "amt")
+	}
+	if amountFloat == 0 {
+		return NewError(CodeInvalidField, "amount must be greater than 0").With("field", "amt")
+	}
 
-		ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
-		ticker = strings.ToUpper(ticker)
+	amount := uint64(math.Round(amountFloat * math.Pow10(int(tokenModel.Decimals))))
 
-		// Check if the ticker exists
-		var tokenModel models.Token
-		result := protocol.db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
-		if result.Error != nil {
-			return fmt.Errorf("token with ticker '%s' doesn't exist", ticker)
-		}
+	// Check that the user has enough tokens to burn
+	var holderModel models.TokenHolder
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
+	if result.Error != nil {
+		return NewError(CodeInsufficientBalance, "sender does not have any tokens to burn")
+	}
 
-		// Check required fields
-		amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
-		// Convert amount to have the correct number of decimals
-		amountFloat, err := strconv.ParseFloat(amountString, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse amount '%s'", err)
-		}
-		if amountFloat == 0 {
-			return fmt.Errorf("amount must be greater than 0")
-		}
+	if holderModel.Amount < amount {
+		return NewError(CodeInsufficientBalance, "sender does not have enough tokens to burn")
+	}
 
-		amount := uint64(math.Round(amountFloat * math.Pow10(int(tokenModel.Decimals))))
+	// At this point we know that the sender has enough tokens to burn
+	// so update the sender's balance
+	holderModel.Amount = holderModel.Amount - amount
+	result = db.Save(&holderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update sender balance '%w'", result.Error)
+	}
 
-		// Check that the user has enough tokens to burn
-		var holderModel models.TokenHolder
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
-		if result.Error != nil {
-			return fmt.Errorf("sender does not have any tokens to burn")
-		}
+	// update token circulating and total supply
+	tokenModel.CirculatingSupply = tokenModel.CirculatingSupply - amount
+	tokenModel.MaxSupply = tokenModel.MaxSupply - amount
+	result = db.Save(&tokenModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-		if holderModel.Amount < amount {
-			return fmt.Errorf("sender does not have enough tokens to burn")
-		}
+	// Record the burn
+	historyModel := models.TokenAddressHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        transactionModel.Height,
+		TransactionID: transactionModel.ID,
+		TokenID:       tokenModel.ID,
+		Sender:        sender,
+		Receiver:      "cosmos1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqnrql8a",
+		Action:        "burn",
+		Amount:        amount,
+		DateCreated:   transactionModel.DateCreated,
+	}
+	result = db.Save(&historyModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-		// At this point we know that the sender has enough tokens to burn
-		// so update the sender's balance
-		holderModel.Amount = holderModel.Amount - amount
-		result = protocol.db.Save(&holderModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update sender balance '%s'", err)
-		}
+	return emitEvent(db, transactionModel, EventCFT20Burn, EventData{
+		"ticker": tokenModel.Ticker,
+		"sender": sender,
+		"amount": amount,
+	})
+}
 
-		// update token circulating and total supply
-		tokenModel.CirculatingSupply = tokenModel.CirculatingSupply - amount
-		tokenModel.MaxSupply = tokenModel.MaxSupply - amount
-		result = protocol.db.Save(&tokenModel)
-		if result.Error != nil {
-			return result.Error
-		}
+// processList handles the list operation
+func (protocol *CFT20) processList(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
+	ticker = strings.ToUpper(ticker)
 
-		// Record the burn
-		historyModel := models.TokenAddressHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        transactionModel.Height,
-			TransactionID: transactionModel.ID,
-			TokenID:       tokenModel.ID,
-			Sender:        sender,
-			Receiver:      "cosmos1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqnrql8a",
-			Action:        "burn",
-			Amount:        amount,
-			DateCreated:   transactionModel.DateCreated,
-		}
-		result = protocol.db.Save(&historyModel)
-		if result.Error != nil {
-			return result.Error
-		}
+	// Check if the ticker exists
+	var tokenModel models.Token
+	result := db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
+	if result.Error != nil {
+		return NewError(CodeTokenNotFound, "token with ticker '%s' doesn't exist", ticker).With("ticker", ticker)
+	}
 
-	case "list":
+	// Set the destination address to the marketplace for transfer history
+	destinationAddress := "marketplace"
 
-		ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
-		ticker = strings.ToUpper(ticker)
+	// Check required fields
+	amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
+	// Convert amount to have the correct number of decimals
+	amount, err := strconv.ParseFloat(amountString, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse amount '%s'", err).With("field", "amt")
+	}
+	if amount <= 0 {
+		return NewError(CodeInvalidField, "amount must be greater than 0").With("field", "amt")
+	}
 
-		// Check if the ticker exists
-		var tokenModel models.Token
-		result := protocol.db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
-		if result.Error != nil {
-			return fmt.Errorf("token with ticker '%s' doesn't exist", ticker)
-		}
+	pptString := strings.TrimSpace(parsedURN.KeyValuePairs["ppt"])
+	// Convert amount to have the correct number of decimals
+	ppt, err := strconv.ParseFloat(pptString, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse ppt '%s'", err).With("field", "ppt")
+	}
+	if ppt <= 0 {
+		return NewError(CodeInvalidField, "price per token must be greater than 0").With("field", "ppt")
+	}
 
-		// Set the destination address to the marketplace for transfer history
-		destinationAddress := "marketplace"
+	totalBase := float64(amount) * ppt
 
-		// Check required fields
-		amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
-		// Convert amount to have the correct number of decimals
-		amount, err := strconv.ParseFloat(amountString, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse amount '%s'", err)
-		}
-		if amount <= 0 {
-			return fmt.Errorf("amount must be greater than 0")
-		}
+	// 6 is the amount of ATOM decimals
+	ppt = ppt * math.Pow10(6)
+	amount = amount * math.Pow10(int(tokenModel.Decimals))
+	totalBase = totalBase * math.Pow10(6)
 
-		pptString := strings.TrimSpace(parsedURN.KeyValuePairs["ppt"])
-		// Convert amount to have the correct number of decimals
-		ppt, err := strconv.ParseFloat(pptString, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse ppt '%s'", err)
-		}
-		if ppt <= 0 {
-			return fmt.Errorf("price per token must be greater than 0")
-		}
+	// Check that the user has enough tokens to sell
+	var holderModel models.TokenHolder
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
+	if result.Error != nil {
+		return NewError(CodeInsufficientBalance, "sender does not have any tokens to sell")
+	}
 
-		totalBase := float64(amount) * ppt
+	if holderModel.Amount < uint64(amount) {
+		return NewError(CodeInsufficientBalance, "sender does not have enough tokens to sell")
+	}
 
-		// 6 is the amount of ATOM decimals
-		ppt = ppt * math.Pow10(6)
-		amount = amount * math.Pow10(int(tokenModel.Decimals))
-		totalBase = totalBase * math.Pow10(6)
+	// At this point we know that the sender has enough tokens to sell
+	// so update the sender's balance
+	holderModel.Amount = holderModel.Amount - uint64(amount)
+	result = db.Save(&holderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update seller's balance '%w'", result.Error)
+	}
 
-		// Check that the user has enough tokens to sell
-		var holderModel models.TokenHolder
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
-		if result.Error != nil {
-			return fmt.Errorf("sender does not have any tokens to sell")
-		}
+	// Create a sell position
+	positionModel := models.TokenOpenPosition{
+		ChainID:       parsedURN.ChainID,
+		TransactionID: transactionModel.ID,
+		TokenID:       tokenModel.ID,
+		SellerAddress: sender,
+		Amount:        uint64(math.Round(amount)),
+		PPT:           uint64(math.Round(ppt)),
+		Total:         uint64(math.Round(totalBase)),
+		DateCreated:   transactionModel.DateCreated,
+	}
 
-		if holderModel.Amount < uint64(amount) {
-			return fmt.Errorf("sender does not have enough tokens to sell")
-		}
+	result = db.Save(&positionModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to create sell position '%s'", result.Error)
+	}
 
-		// At this point we know that the sender has enough tokens to sell
-		// so update the sender's balance
-		holderModel.Amount = holderModel.Amount - uint64(amount)
-		result = protocol.db.Save(&holderModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update seller's balance '%s'", err)
-		}
+	// Record the transfer
+	historyModel := models.TokenAddressHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        transactionModel.Height,
+		TransactionID: transactionModel.ID,
+		TokenID:       tokenModel.ID,
+		Sender:        sender,
+		Receiver:      destinationAddress,
+		Action:        "list",
+		Amount:        uint64(math.Round(amount)),
+		DateCreated:   transactionModel.DateCreated,
+	}
+	result = db.Save(&historyModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-		// Create a sell position
-		positionModel := models.TokenOpenPosition{
-			ChainID:       parsedURN.ChainID,
-			TransactionID: transactionModel.ID,
-			TokenID:       tokenModel.ID,
-			SellerAddress: sender,
-			Amount:        uint64(math.Round(amount)),
-			PPT:           uint64(math.Round(ppt)),
-			Total:         uint64(math.Round(totalBase)),
-			DateCreated:   transactionModel.DateCreated,
-		}
+	return nil
+}
 
-		result = protocol.db.Save(&positionModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to create sell position '%s'", result.Error)
-		}
+// processBuy handles the buy operation
+func (protocol *CFT20) processBuy(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
+	ticker = strings.ToUpper(ticker)
 
-		// Record the transfer
-		historyModel := models.TokenAddressHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        transactionModel.Height,
-			TransactionID: transactionModel.ID,
-			TokenID:       tokenModel.ID,
-			Sender:        sender,
-			Receiver:      destinationAddress,
-			Action:        "list",
-			Amount:        uint64(math.Round(amount)),
-			DateCreated:   transactionModel.DateCreated,
-		}
-		result = protocol.db.Save(&historyModel)
-		if result.Error != nil {
-			return result.Error
-		}
+	// Check if the ticker exists
+	var tokenModel models.Token
+	result := db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
+	if result.Error != nil {
+		return NewError(CodeTokenNotFound, "token with ticker '%s' doesn't exist", ticker).With("ticker", ticker)
+	}
 
-	case "buy":
+	orderNumber := strings.TrimSpace(parsedURN.KeyValuePairs["ord"])
 
-		ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
-		ticker = strings.ToUpper(ticker)
+	// Check if the order still exists
+	var openOrderModel models.TokenOpenPosition
+	result = db.Where("chain_id = ? AND token_id = ? AND id = ? AND is_filled = ? AND is_cancelled = ?", parsedURN.ChainID, tokenModel.ID, orderNumber, false, false).First(&openOrderModel)
+	if result.Error != nil {
+		return NewError(CodeOrderNotFound, "order by id '%s' doesn't exist", orderNumber).With("order_id", orderNumber)
+	}
 
-		// Check if the ticker exists
-		var tokenModel models.Token
-		result := protocol.db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
-		if result.Error != nil {
-			return fmt.Errorf("token with ticker '%s' doesn't exist", ticker)
+	if protocol.chain.messageRules(transactionModel.Height) {
+		// Check if the amount sent to the seller matches the order total
+		amountSent, err := GetBaseTokensSent(rawTransaction, protocol.chain, transactionModel.Height, openOrderModel.SellerAddress, Send)
+		if err != nil {
+			return err
 		}
-
-		orderNumber := strings.TrimSpace(parsedURN.KeyValuePairs["ord"])
-
-		// Check if the order still exists
-		var openOrderModel models.TokenOpenPosition
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND id = ? AND is_filled = ? AND is_cancelled = ?", parsedURN.ChainID, tokenModel.ID, orderNumber, false, false).First(&openOrderModel)
-		if result.Error != nil {
-			return fmt.Errorf("order by id '%s' doesn't exist", orderNumber)
+		if amountSent != openOrderModel.Total {
+			return NewError(CodeInsufficientPayment, "incorrect amount sent to buy tokens, got %d, expected %d", amountSent, openOrderModel.Total).With("amount", amountSent).With("expected_amount", openOrderModel.Total)
 		}
-
-		// Check if the amount sent >= amount required
-		for _, v := range rawTransaction.Body.Messages {
-			if v.Type == "/cosmos.bank.v1beta1.MsgSend" {
-				// The first send should hold the amount being used to buy the tokens with
-				if v.Amount[0].Amount != fmt.Sprintf("%d", openOrderModel.Total) {
-					return fmt.Errorf("incorrect amount sent to buy tokens, got %s, expected %d", v.Amount[0].Amount, openOrderModel.Total)
-				}
-				if v.Amount[0].Denom != "uatom" {
-					return fmt.Errorf("incorrect denom sent to buy tokens, got %s, expected uatom", v.Amount[0].Denom)
-				}
-				if v.ToAddress != openOrderModel.SellerAddress {
-					return fmt.Errorf("attempting to buy from incorrect seller")
-				}
-				break
+	} else {
+		// Before the message rules height only the first send is checked,
+		// it should hold the amount being used to buy the tokens with
+		for _, message := range rawTransaction.Messages() {
+			v, ok := message.(*banktypes.MsgSend)
+			if !ok {
+				continue
 			}
-		}
-
-		// Get current USD price of the base
-		var statusModel models.Status
-		result = protocol.db.Where("chain_id = ?", parsedURN.ChainID).First(&statusModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to get current base currency price '%s'", err)
-		}
-
-		// We no longer update the price from the previous market
-		// tokenModel.LastPriceBase = openOrderModel.PPT
-		// result = protocol.db.Save(&tokenModel)
-		// if result.Error != nil {
-		// 	return fmt.Errorf("unable to update token price '%s'", result.Error)
-		// }
-
-		// Everything checks out, so we can mark the order as filled and transfer the tokens
-		openOrderModel.IsFilled = true
-		openOrderModel.DateFilled = transactionModel.DateCreated
-		result = protocol.db.Save(&openOrderModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update order '%s'", result.Error)
-		}
-
-		// Update the buyer's balance
-		// Check if the destination address has any tokens
-		var destinationHolderModel models.TokenHolder
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&destinationHolderModel)
-		if result.Error != nil {
-			if result.Error != gorm.ErrRecordNotFound {
-				return fmt.Errorf("unable to check destination balance '%s'", result.Error)
+			if v.Amount[0].Amount.String() != fmt.Sprintf("%d", openOrderModel.Total) {
+				return NewError(CodeInsufficientPayment, "incorrect amount sent to buy tokens, got %s, expected %d", v.Amount[0].Amount, openOrderModel.Total).With("amount", v.Amount[0].Amount.String()).With("expected_amount", openOrderModel.Total)
+			}
+			if v.Amount[0].Denom != protocol.chain.BaseDenom {
+				return NewError(CodeInvalidDenom, "incorrect denom sent to buy tokens, got %s, expected %s", v.Amount[0].Denom, protocol.chain.BaseDenom).With("denom", v.Amount[0].Denom).With("expected_denom", protocol.chain.BaseDenom)
 			}
+			if v.ToAddress != openOrderModel.SellerAddress {
+				return NewError(CodeInvalidPayment, "attempting to buy from incorrect seller")
+			}
+			break
 		}
+	}
 
-		// If the destination address has no tokens, we need to create a record
-		destinationHolderModel.ChainID = parsedURN.ChainID
-		destinationHolderModel.TokenID = tokenModel.ID
-		destinationHolderModel.Address = sender
-		destinationHolderModel.Amount = destinationHolderModel.Amount + openOrderModel.Amount
-		destinationHolderModel.DateUpdated = transactionModel.DateCreated
+	// Get the USD value of the trade at the time of the trade
+	totalUSD, err := tradeValueUSD(db, protocol.chain, parsedURN.ChainID, transactionModel.DateCreated, openOrderModel.Total)
+	if err != nil {
+		return NewError(CodeInternal, "unable to get base currency price '%w'", err)
+	}
 
-		result = protocol.db.Save(&destinationHolderModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update receiver balance '%s'", err)
-		}
+	// We no longer update the price from the previous market
+	// tokenModel.LastPriceBase = openOrderModel.PPT
+	// result = db.Save(&tokenModel)
+	// if result.Error != nil {
+	// 	return fmt.Errorf("unable to update token price '%s'", result.Error)
+	// }
+
+	// Everything checks out, so we can mark the order as filled and transfer the tokens
+	openOrderModel.IsFilled = true
+	openOrderModel.DateFilled = transactionModel.DateCreated
+	result = db.Save(&openOrderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update order '%s'", result.Error)
+	}
 
-		// Record the transfer
-		historyModel := models.TokenAddressHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        transactionModel.Height,
-			TransactionID: transactionModel.ID,
-			TokenID:       tokenModel.ID,
-			Sender:        "marketplace",
-			Receiver:      sender,
-			Action:        "buy",
-			Amount:        openOrderModel.Amount,
-			DateCreated:   transactionModel.DateCreated,
-		}
-		result = protocol.db.Save(&historyModel)
-		if result.Error != nil {
-			return result.Error
+	// Update the buyer's balance
+	// Check if the destination address has any tokens
+	var destinationHolderModel models.TokenHolder
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&destinationHolderModel)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return NewError(CodeInternal, "unable to check destination balance '%s'", result.Error)
 		}
+	}
 
-		totalWithDecimals := float64(openOrderModel.Total) / math.Pow10(6)
-
-		// Capture the trade in the history for future charts
-		tradeHistory := models.TokenTradeHistory{
-			ChainID:       parsedURN.ChainID,
-			TransactionID: transactionModel.ID,
-			TokenID:       tokenModel.ID,
-			SellerAddress: openOrderModel.SellerAddress,
-			BuyerAddress:  sender,
-			AmountQuote:   openOrderModel.Total,  // ATOM
-			AmountBase:    openOrderModel.Amount, // CFT-20
-			Rate:          openOrderModel.PPT,
-			TotalUSD:      totalWithDecimals * statusModel.BaseTokenUSD,
-			DateCreated:   transactionModel.DateCreated,
-		}
-		result = protocol.db.Save(&tradeHistory)
-		if result.Error != nil {
-			return result.Error
-		}
+	// If the destination address has no tokens, we need to create a record
+	destinationHolderModel.ChainID = parsedURN.ChainID
+	destinationHolderModel.TokenID = tokenModel.ID
+	destinationHolderModel.Address = sender
+	destinationHolderModel.Amount = destinationHolderModel.Amount + openOrderModel.Amount
+	destinationHolderModel.DateUpdated = transactionModel.DateCreated
 
-		// Recalculate volume from filled trades for this token in past 24 hours
-		// SELECT sum(total_usd) from token_trade_history where date_Created >= now - 24 hours and token_id = this token id
-		var sum uint64
-		err = protocol.db.Model(&models.TokenTradeHistory{}).
-			Select("SUM(amount_quote)").
-			Where("date_created >= ?", time.Now().Add(-24*time.Hour)).
-			Where("token_id = ?", tokenModel.ID).
-			Find(&sum).Error
+	result = db.Save(&destinationHolderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update receiver balance '%s'", result.Error)
+	}
 
-		if err != nil {
-			// No need to alert the buyer
-			return nil
-		}
+	// Record the transfer
+	historyModel := models.TokenAddressHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        transactionModel.Height,
+		TransactionID: transactionModel.ID,
+		TokenID:       tokenModel.ID,
+		Sender:        "marketplace",
+		Receiver:      sender,
+		Action:        "buy",
+		Amount:        openOrderModel.Amount,
+		DateCreated:   transactionModel.DateCreated,
+	}
+	result = db.Save(&historyModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-		tokenModel.Volume24Base = sum
-		result = protocol.db.Save(&tokenModel)
-		if result.Error != nil {
-			// No need to alert the buyer
-			return nil
-		}
+	// Capture the trade in the history for future charts
+	tradeHistory := models.TokenTradeHistory{
+		ChainID:       parsedURN.ChainID,
+		TransactionID: transactionModel.ID,
+		TokenID:       tokenModel.ID,
+		SellerAddress: openOrderModel.SellerAddress,
+		BuyerAddress:  sender,
+		AmountQuote:   openOrderModel.Total,  // ATOM
+		AmountBase:    openOrderModel.Amount, // CFT-20
+		Rate:          openOrderModel.PPT,
+		TotalUSD:      totalUSD,
+		DateCreated:   transactionModel.DateCreated,
+	}
+	result = db.Save(&tradeHistory)
+	if result.Error != nil {
+		return result.Error
+	}
 
-	case "delist":
+	// Recalculate volume from filled trades for this token in past 24 hours
+	// SELECT sum(total_usd) from token_trade_history where date_Created >= now - 24 hours and token_id = this token id
+	var sum uint64
+	err = db.Model(&models.TokenTradeHistory{}).
+		Select("SUM(amount_quote)").
+		Where("date_created >= ?", time.Now().Add(-24*time.Hour)).
+		Where("token_id = ?", tokenModel.ID).
+		Find(&sum).Error
 
-		ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
-		ticker = strings.ToUpper(ticker)
+	if err != nil {
+		// No need to alert the buyer
+		return nil
+	}
 
-		// Check if the ticker exists
-		var tokenModel models.Token
-		result := protocol.db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
-		if result.Error != nil {
-			return fmt.Errorf("token with ticker '%s' doesn't exist", ticker)
-		}
+	tokenModel.Volume24Base = sum
+	result = db.Save(&tokenModel)
+	if result.Error != nil {
+		// No need to alert the buyer
+		return nil
+	}
 
-		orderNumber := strings.TrimSpace(parsedURN.KeyValuePairs["ord"])
+	return nil
+}
 
-		// Check if the order still exists
-		var openOrderModel models.TokenOpenPosition
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND id = ? AND is_filled = ? AND is_cancelled = ?", parsedURN.ChainID, tokenModel.ID, orderNumber, false, false).First(&openOrderModel)
-		if result.Error != nil {
-			return fmt.Errorf("order by id '%s' doesn't exist", orderNumber)
-		}
+// processDelist handles the delist operation
+func (protocol *CFT20) processDelist(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
+	ticker = strings.ToUpper(ticker)
 
-		// Check if the sender is the owner of the order
-		if openOrderModel.SellerAddress != sender {
-			return fmt.Errorf("only the seller can cancel an order")
-		}
+	// Check if the ticker exists
+	var tokenModel models.Token
+	result := db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
+	if result.Error != nil {
+		return NewError(CodeTokenNotFound, "token with ticker '%s' doesn't exist", ticker).With("ticker", ticker)
+	}
 
-		// Everything checks out, so we can mark the order as cancelled
-		openOrderModel.IsCancelled = true
-		result = protocol.db.Save(&openOrderModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update order '%s'", err)
-		}
+	orderNumber := strings.TrimSpace(parsedURN.KeyValuePairs["ord"])
 
-		// Return funds to seller
-		// Check if the destination address has any tokens
-		var destinationHolderModel models.TokenHolder
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&destinationHolderModel)
-		if result.Error != nil {
-			if result.Error != gorm.ErrRecordNotFound {
-				return fmt.Errorf("unable to check destination balance '%s'", err)
-			}
-		}
+	// Check if the order still exists
+	var openOrderModel models.TokenOpenPosition
+	result = db.Where("chain_id = ? AND token_id = ? AND id = ? AND is_filled = ? AND is_cancelled = ?", parsedURN.ChainID, tokenModel.ID, orderNumber, false, false).First(&openOrderModel)
+	if result.Error != nil {
+		return NewError(CodeOrderNotFound, "order by id '%s' doesn't exist", orderNumber).With("order_id", orderNumber)
+	}
 
-		// If the destination address has no tokens, we need to create a record
-		destinationHolderModel.ChainID = parsedURN.ChainID
-		destinationHolderModel.TokenID = tokenModel.ID
-		destinationHolderModel.Address = sender
-		destinationHolderModel.Amount = destinationHolderModel.Amount + openOrderModel.Amount
-		destinationHolderModel.DateUpdated = transactionModel.DateCreated
+	// Check if the sender is the owner of the order
+	if openOrderModel.SellerAddress != sender {
+		return NewError(CodeNotOwner, "only the seller can cancel an order")
+	}
 
-		result = protocol.db.Save(&destinationHolderModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update receiver balance '%s'", err)
-		}
+	// Everything checks out, so we can mark the order as cancelled
+	openOrderModel.IsCancelled = true
+	result = db.Save(&openOrderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update order '%s'", result.Error)
+	}
 
-		// Record the transfer
-		historyModel := models.TokenAddressHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        transactionModel.Height,
-			TransactionID: transactionModel.ID,
-			TokenID:       tokenModel.ID,
-			Sender:        "marketplace",
-			Receiver:      sender,
-			Action:        "delist",
-			Amount:        openOrderModel.Amount,
-			DateCreated:   transactionModel.DateCreated,
-		}
-		result = protocol.db.Save(&historyModel)
-		if result.Error != nil {
-			return result.Error
+	// Return funds to seller
+	// Check if the destination address has any tokens
+	var destinationHolderModel models.TokenHolder
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&destinationHolderModel)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return NewError(CodeInternal, "unable to check destination balance '%s'", result.Error)
 		}
 	}
 
-	return nil
-}
+	// If the destination address has no tokens, we need to create a record
+	destinationHolderModel.ChainID = parsedURN.ChainID
+	destinationHolderModel.TokenID = tokenModel.ID
+	destinationHolderModel.Address = sender
+	destinationHolderModel.Amount = destinationHolderModel.Amount + openOrderModel.Amount
+	destinationHolderModel.DateUpdated = transactionModel.DateCreated
 
-// TODO: This is reused, move to common helpers
-// storeContent stores the content in the S3 bucket
-func (protocol *CFT20) storeContent(mimeType string, txHash string, content []byte) (string, error) {
-	if protocol.s3Endpoint == "" {
-		return "", nil
+	result = db.Save(&destinationHolderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update receiver balance '%s'", result.Error)
 	}
 
-	ext, err := mime.ExtensionsByType(mimeType)
-	if err != nil {
-		// We could not find the mime type, so we default to .bin
-		ext = []string{".bin"}
-	}
-	if len(ext) == 0 {
-		// We could not find the mime type, so we default to .bin
-		ext = []string{".bin"}
-	}
-
-	endpoint := protocol.s3Endpoint
-	region := protocol.s3Region
-	sess := session.Must(session.NewSession(&aws.Config{
-		Endpoint:    &endpoint,
-		Region:      &region,
-		Credentials: credentials.NewStaticCredentials(protocol.s3ID, protocol.s3Secret, protocol.s3Token),
-	}))
-
-	// Create an uploader with the session and default options
-	uploader := s3manager.NewUploader(sess)
-
-	// Upload the file to an S3 compatible bucket
-	myBucket := protocol.s3Bucket
-	filename := txHash + ext[0]
-	uploadResult, err := uploader.Upload(&s3manager.UploadInput{
-		ACL:         aws.String("public-read"),
-		Bucket:      aws.String(myBucket),
-		Key:         aws.String(filename),
-		Body:        bytes.NewReader(content),
-		ContentType: aws.String(mimeType),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload file, %v", err)
+	// Record the transfer
+	historyModel := models.TokenAddressHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        transactionModel.Height,
+		TransactionID: transactionModel.ID,
+		TokenID:       tokenModel.ID,
+		Sender:        "marketplace",
+		Receiver:      sender,
+		Action:        "delist",
+		Amount:        openOrderModel.Amount,
+		DateCreated:   transactionModel.DateCreated,
+	}
+	result = db.Save(&historyModel)
+	if result.Error != nil {
+		return result.Error
 	}
 
-	return aws.StringValue(&uploadResult.Location), nil
+	return nil
 }
 
-func (protocol *CFT20) ParseTokenData(ticker string, amountString string) (models.Token, uint64, error) {
+func (protocol *CFT20) ParseTokenData(db *gorm.DB, ticker string, amountString string) (models.Token, uint64, error) {
 
 	// Check if the ticker exists
 	var tokenModel models.Token
-	result := protocol.db.Where("chain_id = ? AND ticker = ?", protocol.chainID, ticker).First(&tokenModel)
+	result := db.Where("chain_id = ? AND ticker = ?", protocol.chainID, ticker).First(&tokenModel)
 	if result.Error != nil {
-		return tokenModel, 0, fmt.Errorf("token with ticker '%s' doesn't exist", ticker)
+		return tokenModel, 0, NewError(CodeTokenNotFound, "token with ticker '%s' doesn't exist", ticker).With("ticker", ticker)
 	}
 
 	// Convert amount to have the correct number of decimals
 	amount, err := strconv.ParseUint(amountString, 10, 64)
 	if err != nil {
-		return tokenModel, 0, fmt.Errorf("unable to parse amount '%s'", err)
+		return tokenModel, 0, NewError(CodeInvalidField, "unable to parse amount '%s'", err).With("field", "amt")
 	}
 
 	// In case the input is less than 1 / 10 ** Decimals
 	if amount == 0 {
-		return tokenModel, 0, fmt.Errorf("amount must be greater than 0")
+		return tokenModel, 0, NewError(CodeInvalidField, "amount must be greater than 0").With("field", "amt")
 	}
 
 	return tokenModel, amount, nil
@@ -899,7 +927,7 @@ type CFT20TransferOptions struct {
 	ToVirtual   bool
 }
 
-func (protocol *CFT20) Transfer(transactionModel models.Transaction, from string, to string, tokenModel models.Token, amount uint64, action string, options ...CFT20TransferOptions) error {
+func (protocol *CFT20) Transfer(db *gorm.DB, transactionModel models.Transaction, from string, to string, tokenModel models.Token, amount uint64, action string, options ...CFT20TransferOptions) error {
 
 	var opts CFT20TransferOptions
 	if len(options) > 0 {
@@ -911,31 +939,31 @@ func (protocol *CFT20) Transfer(transactionModel models.Transaction, from string
 	if !opts.FromVirtual {
 		// Check that the user has enough tokens to send
 		var holderModel models.TokenHolder
-		result := protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", protocol.chainID, tokenModel.ID, from).First(&holderModel)
+		result := db.Where("chain_id = ? AND token_id = ? AND address = ?", protocol.chainID, tokenModel.ID, from).First(&holderModel)
 		if result.Error != nil {
-			return fmt.Errorf("sender does not have any tokens to send")
+			return NewError(CodeInsufficientBalance, "sender does not have any tokens to send")
 		}
 
 		if holderModel.Amount < amount {
-			return fmt.Errorf("sender does not have enough tokens to send")
+			return NewError(CodeInsufficientBalance, "sender does not have enough tokens to send")
 		}
 
 		// At this point we know that the sender has enough tokens to send
 		// so update the sender's balance
 		holderModel.Amount = holderModel.Amount - amount
-		result = protocol.db.Save(&holderModel)
+		result = db.Save(&holderModel)
 		if result.Error != nil {
-			return fmt.Errorf("unable to update seller's balance '%s'", result.Error)
+			return NewError(CodeInternal, "unable to update seller's balance '%s'", result.Error)
 		}
 	}
 
 	if !opts.ToVirtual {
 		// Check if the destination address has any tokens
 		var destinationHolderModel models.TokenHolder
-		result := protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", protocol.chainID, tokenModel.ID, to).First(&destinationHolderModel)
+		result := db.Where("chain_id = ? AND token_id = ? AND address = ?", protocol.chainID, tokenModel.ID, to).First(&destinationHolderModel)
 		if result.Error != nil {
 			if result.Error != gorm.ErrRecordNotFound {
-				return fmt.Errorf("unable to check destination balance '%s'", result.Error)
+				return NewError(CodeInternal, "unable to check destination balance '%s'", result.Error)
 			}
 		}
 
@@ -946,9 +974,9 @@ func (protocol *CFT20) Transfer(transactionModel models.Transaction, from string
 		destinationHolderModel.Amount = destinationHolderModel.Amount + amount
 		destinationHolderModel.DateUpdated = transactionModel.DateCreated
 
-		result = protocol.db.Save(&destinationHolderModel)
+		result = db.Save(&destinationHolderModel)
 		if result.Error != nil {
-			return fmt.Errorf("unable to update receiver balance '%s'", result.Error)
+			return NewError(CodeInternal, "unable to update receiver balance '%s'", result.Error)
 		}
 	}
 
@@ -964,7 +992,7 @@ func (protocol *CFT20) Transfer(transactionModel models.Transaction, from string
 		Amount:        amount,
 		DateCreated:   transactionModel.DateCreated,
 	}
-	result := protocol.db.Save(&historyModel)
+	result := db.Save(&historyModel)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -0,0 +1,36 @@
+package metaprotocol
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTransferBalanceUpdateError(t *testing.T) {
+	db := newTestDB(t, &models.Token{}, &models.TokenHolder{})
+	protocol := &CFT20{chainID: "cosmoshub-4"}
+
+	token := models.Token{ChainID: "cosmoshub-4", Ticker: "TEST"}
+	assert.NoError(t, db.Create(&token).Error)
+	assert.NoError(t, db.Create(&models.TokenHolder{ChainID: "cosmoshub-4", TokenID: token.ID, Address: "cosmos1sender", Amount: 10}).Error)
+
+	// Fail every balance update
+	errUpdate := errors.New("update failed")
+	err := db.Callback().Update().Before("gorm:update").Register("test:fail_update", func(tx *gorm.DB) {
+		if tx.Statement.Table == "token_holder" {
+			tx.AddError(errUpdate)
+		}
+	})
+	assert.NoError(t, err)
+
+	destination := "cosmos1destination000000000000000000000000000"
+	parsedURN := ProtocolURN{ChainID: "cosmoshub-4", KeyValuePairs: map[string]string{"tic": "test", "dst": destination, "amt": "1"}}
+	err = protocol.processTransfer(db, models.Transaction{ChainID: "cosmoshub-4"}, parsedURN, decodeTransaction(t, ""), "cosmos1sender")
+	code, _ := ErrorCodeOf(err)
+	assert.Equal(t, CodeInternal, code)
+	assert.ErrorIs(t, err, errUpdate, "the database error should be wrapped")
+	assert.Contains(t, err.Error(), "update failed")
+}
@@ -0,0 +1,38 @@
+package metaprotocol
+
+import "time"
+
+// Chain holds the chain specific settings used by the processors
+type Chain struct {
+	ID string
+	// BaseDenom is the denom of the base token that purchases and fees are
+	// paid in
+	BaseDenom string
+	// IBCEnabled allows fees to be paid with an IBC transfer to FeeReceiver
+	IBCEnabled bool
+	// FeeReceiver is the address on the remote chain that receives the fees
+	FeeReceiver string
+	// FeeChannel is the IBC channel fees must be sent over
+	FeeChannel string
+	// ContentHashEnforceHeight is the height from which inscriptions with a
+	// content hash that doesn't match their content are rejected, earlier
+	// inscriptions are flagged. Never enforced when 0
+	ContentHashEnforceHeight uint64
+	// ContentValidationHeight is the height from which content that isn't
+	// accepted by the content policy of a processor is rejected, the detected
+	// type of earlier content is recorded. Never enforced when 0
+	ContentValidationHeight uint64
+	// MessageRulesHeight is the height from which messages executed with
+	// authz are unwrapped, a transaction must have a single sender and
+	// payments may be split across several sends. Earlier transactions use
+	// the first sender and payment found. Never enforced when 0
+	MessageRulesHeight uint64
+	// PriceMaxAge is the maximum age of the base token price used to value
+	// trades, older prices are not used. Never expires when 0
+	PriceMaxAge time.Duration
+}
+
+// messageRules returns true if the message rules apply at height
+func (chain Chain) messageRules(height uint64) bool {
+	return chain.MessageRulesHeight != 0 && height >= chain.MessageRulesHeight
+}
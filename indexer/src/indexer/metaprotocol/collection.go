@@ -3,7 +3,7 @@ package metaprotocol
 import (
 	"encoding/csv"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"strings"
 )
@@ -14,19 +14,21 @@ type CollectionReservation struct {
 	Address string
 }
 
-func GetReservations(fileName string) (map[string]CollectionReservation, map[string]CollectionReservation) {
+// LoadReservations reads the collection name and ticker reservations from
+// the CSV file fileName and returns them by name and by ticker
+func LoadReservations(fileName string) (map[string]CollectionReservation, map[string]CollectionReservation, error) {
 	// open CSV file
-	fd, error := os.Open(fileName)
-	if error != nil {
-		fmt.Println(error)
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer fd.Close()
 
 	// read CSV file
 	reader := csv.NewReader(fd)
-	_, err := reader.Read() // skip header
+	_, err = reader.Read() // skip header
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, fmt.Errorf("unable to read reservations header: %w", err)
 	}
 
 	reservationsByName := make(map[string]CollectionReservation)
@@ -34,9 +36,16 @@ func GetReservations(fileName string) (map[string]CollectionReservation, map[str
 
 	for {
 		record, err := reader.Read()
-		if err != nil {
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read reservations: %w", err)
+		}
+		if len(record) < 4 {
+			line, _ := reader.FieldPos(0)
+			return nil, nil, fmt.Errorf("reservation on line %d has %d fields, expected at least 4", line, len(record))
+		}
 
 		project := CollectionReservation{
 			Name:    strings.TrimSpace(record[1]),
@@ -47,5 +56,5 @@ func GetReservations(fileName string) (map[string]CollectionReservation, map[str
 		reservationsByTicker[project.Ticker] = project
 	}
 
-	return reservationsByName, reservationsByTicker
+	return reservationsByName, reservationsByTicker, nil
 }
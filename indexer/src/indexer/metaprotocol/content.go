@@ -0,0 +1,60 @@
+package metaprotocol
+
+import (
+	"database/sql"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentpolicy"
+)
+
+// contentValidator checks the content of a processor against its content
+// policy
+type contentValidator struct {
+	policy contentpolicy.Policy
+	// height is the height from which content that isn't accepted by the
+	// policy is rejected, never when 0
+	height uint64
+}
+
+// newContentValidator returns a validator for the policy with allowedTypes,
+// maxBytes and activeContent, enforced from the content validation height
+// of chain
+func newContentValidator(chain Chain, allowedTypes []string, maxBytes int, activeContent string) (contentValidator, error) {
+	policy, err := contentpolicy.NewPolicy(allowedTypes, maxBytes, activeContent)
+	if err != nil {
+		return contentValidator{}, err
+	}
+	return contentValidator{
+		policy: policy,
+		height: chain.ContentValidationHeight,
+	}, nil
+}
+
+// check sniffs the type of content and checks it against the policy. Content
+// that isn't accepted is rejected at or after the validation height, before
+// it the result is returned without an error so the detected type is
+// recorded
+func (validator contentValidator) check(height uint64, declaredType string, content []byte) (contentpolicy.Result, error) {
+	result := validator.policy.Check(declaredType, content)
+	if result.Violation == contentpolicy.ViolationNone || validator.height == 0 || height < validator.height {
+		return result, nil
+	}
+
+	switch result.Violation {
+	case contentpolicy.ViolationTooLarge:
+		return result, NewError(CodeContentTooLarge, "content size of %d bytes exceeds the maximum of %d bytes", len(content), validator.policy.MaxBytes).
+			With("size", len(content)).
+			With("maximum", validator.policy.MaxBytes)
+	case contentpolicy.ViolationTypeNotAllowed:
+		return result, NewError(CodeContentTypeNotAllowed, "content type '%s' is not allowed", result.DetectedType).
+			With("declared_type", result.DeclaredType).
+			With("detected_type", result.DetectedType)
+	default:
+		return result, NewError(CodeActiveContent, "content of type '%s' contains scripts", result.DetectedType).
+			With("detected_type", result.DetectedType)
+	}
+}
+
+// nullString returns value as a nullable column, null if it is empty
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
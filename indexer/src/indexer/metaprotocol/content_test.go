@@ -0,0 +1,25 @@
+package metaprotocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentValidatorHeight(t *testing.T) {
+	validator, err := newContentValidator(Chain{ContentValidationHeight: 100}, []string{"image/*"}, 0, "sandbox")
+	assert.NoError(t, err)
+	html := []byte("<html><body>not an image</body></html>")
+
+	result, err := validator.check(99, "image/png", html)
+	assert.NoError(t, err, "content before the validation height should be accepted")
+	assert.Equal(t, "text/html", result.DetectedType, "the detected type should be recorded before the validation height")
+
+	_, err = validator.check(100, "image/png", html)
+	code, details := ErrorCodeOf(err)
+	assert.Equal(t, CodeContentTypeNotAllowed, code)
+	assert.Equal(t, "text/html", details["detected_type"])
+
+	_, err = newContentValidator(Chain{}, nil, 0, "render")
+	assert.Error(t, err)
+}
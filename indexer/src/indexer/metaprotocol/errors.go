@@ -0,0 +1,146 @@
+package metaprotocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode identifies why an operation failed. Codes are stable, unlike
+// the error messages, and are stored with the transaction
+type ErrorCode string
+
+const (
+	// CodeInternal is used for errors that are not caused by the transaction,
+	// ie database errors
+	CodeInternal ErrorCode = "INTERNAL_ERROR"
+
+	// Memo and transaction errors
+	CodeInvalidURN          ErrorCode = "INVALID_URN"
+	CodeInvalidTransaction  ErrorCode = "INVALID_TRANSACTION"
+	CodeInvalidChain        ErrorCode = "INVALID_CHAIN"
+	CodeUnknownMetaprotocol ErrorCode = "UNKNOWN_METAPROTOCOL"
+	CodeUnknownOperation    ErrorCode = "UNKNOWN_OPERATION"
+	CodeInvalidOperation    ErrorCode = "INVALID_OPERATION"
+	CodeUnsupportedVersion  ErrorCode = "UNSUPPORTED_VERSION"
+	CodeInvalidField        ErrorCode = "INVALID_FIELD"
+	CodeInvalidAddress      ErrorCode = "INVALID_ADDRESS"
+	CodeMissingExtension    ErrorCode = "MISSING_EXTENSION"
+	CodeInvalidExtension    ErrorCode = "INVALID_EXTENSION"
+
+	// Content errors
+	CodeContentTooLarge       ErrorCode = "CONTENT_TOO_LARGE"
+	CodeContentTypeNotAllowed ErrorCode = "CONTENT_TYPE_NOT_ALLOWED"
+	CodeActiveContent         ErrorCode = "ACTIVE_CONTENT"
+
+	// Payment errors
+	CodeInsufficientBalance ErrorCode = "INSUFFICIENT_BALANCE"
+	CodeInsufficientPayment ErrorCode = "INSUFFICIENT_PAYMENT"
+	CodeInvalidPayment      ErrorCode = "INVALID_PAYMENT"
+	CodeInvalidDenom        ErrorCode = "INVALID_DENOM"
+	CodeInvalidFee          ErrorCode = "INVALID_FEE"
+	CodeInvalidRoyalty      ErrorCode = "INVALID_ROYALTY"
+
+	// Permission errors
+	CodeNotAuthorized ErrorCode = "NOT_AUTHORIZED"
+	CodeNotOwner      ErrorCode = "NOT_OWNER"
+
+	// CFT-20 errors
+	CodeInvalidToken   ErrorCode = "INVALID_TOKEN"
+	CodeTickerExists   ErrorCode = "TICKER_EXISTS"
+	CodeTickerReserved ErrorCode = "TICKER_RESERVED"
+	CodeTokenNotFound  ErrorCode = "TOKEN_NOT_FOUND"
+	CodeOrderNotFound  ErrorCode = "ORDER_NOT_FOUND"
+
+	// Inscription and collection errors
+	CodeNameReserved        ErrorCode = "NAME_RESERVED"
+	CodeInscriptionNotFound ErrorCode = "INSCRIPTION_NOT_FOUND"
+	CodeCollectionNotFound  ErrorCode = "COLLECTION_NOT_FOUND"
+	CodeContentHashMismatch ErrorCode = "CONTENT_HASH_MISMATCH"
+	CodeUploadNotFound      ErrorCode = "UPLOAD_NOT_FOUND"
+	CodeUploadExists        ErrorCode = "UPLOAD_EXISTS"
+	CodeAlreadyInscribed    ErrorCode = "ALREADY_INSCRIBED"
+	CodeInvalidPart         ErrorCode = "INVALID_PART"
+	CodeCollectionNotEmpty  ErrorCode = "COLLECTION_NOT_EMPTY"
+	CodeAlreadyMigrated     ErrorCode = "ALREADY_MIGRATED"
+	CodePermissionExists    ErrorCode = "PERMISSION_EXISTS"
+	CodeTrollPostNotFound   ErrorCode = "POST_NOT_FOUND"
+	CodeRemoteChainNotFound ErrorCode = "REMOTE_CHAIN_NOT_FOUND"
+	CodeInvalidRemote       ErrorCode = "INVALID_REMOTE"
+	CodeBridgeNotEnabled    ErrorCode = "BRIDGE_NOT_ENABLED"
+	CodeLaunchpadExists     ErrorCode = "LAUNCHPAD_EXISTS"
+	CodeLaunchpadNotFound   ErrorCode = "LAUNCHPAD_NOT_FOUND"
+	CodeStageNotFound       ErrorCode = "STAGE_NOT_FOUND"
+	CodeMintNotOpen         ErrorCode = "MINT_NOT_OPEN"
+	CodeMintClosed          ErrorCode = "MINT_CLOSED"
+	CodeMintDisabled        ErrorCode = "MINT_DISABLED"
+	CodeMintedOut           ErrorCode = "MINTED_OUT"
+	CodeNotWhitelisted      ErrorCode = "NOT_WHITELISTED"
+	CodeMintLimitReached    ErrorCode = "MINT_LIMIT_REACHED"
+	CodeListingNotFound     ErrorCode = "LISTING_NOT_FOUND"
+	CodeListingDeposited    ErrorCode = "LISTING_DEPOSITED"
+	CodeListingNotDeposited ErrorCode = "LISTING_NOT_DEPOSITED"
+	CodeListingFilled       ErrorCode = "LISTING_FILLED"
+	CodeListingCancelled    ErrorCode = "LISTING_CANCELLED"
+	CodeNotDepositor        ErrorCode = "NOT_DEPOSITOR"
+	CodeDepositTooSmall     ErrorCode = "DEPOSIT_TOO_SMALL"
+	CodeTimeoutTooShort     ErrorCode = "TIMEOUT_TOO_SHORT"
+	CodeTradeTooSmall       ErrorCode = "TRADE_TOO_SMALL"
+)
+
+// Error is an operation error with a stable code and structured details.
+// The message is kept for humans and must not be parsed
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Details map[string]interface{}
+	cause   error
+}
+
+// NewError returns an error with code, the message is formatted like
+// fmt.Errorf and may wrap an error with %w
+func NewError(code ErrorCode, format string, args ...interface{}) *Error {
+	err := fmt.Errorf(format, args...)
+	return &Error{
+		Code:    code,
+		Message: err.Error(),
+		cause:   errors.Unwrap(err),
+	}
+}
+
+// WrapError returns err with code, the message is unchanged
+func WrapError(code ErrorCode, err error) *Error {
+	return &Error{
+		Code:    code,
+		Message: err.Error(),
+		cause:   err,
+	}
+}
+
+// With adds a detail to the error
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Error returns the human readable message
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the wrapped error, if any
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// ErrorCodeOf returns the code and details of the first Error in the chain
+// of err. Errors without a code are internal errors
+func ErrorCodeOf(err error) (ErrorCode, map[string]interface{}) {
+	var codedErr *Error
+	if errors.As(err, &codedErr) {
+		return codedErr.Code, codedErr.Details
+	}
+	return CodeInternal, nil
+}
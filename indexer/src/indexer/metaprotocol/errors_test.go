@@ -0,0 +1,54 @@
+package metaprotocol
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	err := NewError(CodeTickerExists, "token with ticker '%s' already exists", "ROIDS").With("ticker", "ROIDS")
+	assert.Equal(t, "token with ticker 'ROIDS' already exists", err.Error(), "the message should be unchanged")
+
+	code, details := ErrorCodeOf(fmt.Errorf("processing failed: %w", err))
+	assert.Equal(t, CodeTickerExists, code, "the code should be found in wrapped errors")
+	assert.Equal(t, map[string]interface{}{"ticker": "ROIDS"}, details)
+
+	code, details = ErrorCodeOf(errors.New("connection refused"))
+	assert.Equal(t, CodeInternal, code, "errors without a code are internal")
+	assert.Nil(t, details)
+}
+
+func TestErrorWrapping(t *testing.T) {
+	err := NewError(CodeInvalidOperation, "%w: missing required field '%s'", ErrInvalidOperation, "amt")
+	assert.ErrorIs(t, err, ErrInvalidOperation)
+	assert.Equal(t, "invalid operation: missing required field 'amt'", err.Error())
+
+	cause := errors.New("no sender address found")
+	wrapped := WrapError(CodeInvalidTransaction, cause)
+	assert.ErrorIs(t, wrapped, cause)
+	assert.Equal(t, cause.Error(), wrapped.Error())
+}
+
+func TestRouterErrorCodes(t *testing.T) {
+	router := NewRouter(Chain{ID: "cosmoshub-4"})
+	assert.NoError(t, router.Register("test", &testProcessor{}))
+
+	tests := []struct {
+		memo string
+		code ErrorCode
+	}{
+		{"urn:test:osmosis-1@v1;send$amt=10", CodeInvalidChain},
+		{"urn:other:cosmoshub-4@v1;send$amt=10", CodeUnknownMetaprotocol},
+		{"urn:test:cosmoshub-4@v1;recv$amt=10", CodeUnknownOperation},
+		{"urn:test:cosmoshub-4@v2;send$amt=10", CodeUnsupportedVersion},
+		{"urn:test:cosmoshub-4@v1;send$amt=1.5", CodeInvalidField},
+		{"urn:test:cosmoshub-4@v1;send$ppt=1", CodeInvalidOperation},
+	}
+	for _, test := range tests {
+		code, _ := ErrorCodeOf(routeMemo(t, router, test.memo))
+		assert.Equal(t, test.code, code, test.memo)
+	}
+}
@@ -0,0 +1,83 @@
+package metaprotocol
+
+import (
+	"encoding/json"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// EventType identifies a state change written to the event outbox
+type EventType string
+
+const (
+	EventCFT20Mint            EventType = "cft20.mint"
+	EventCFT20Transfer        EventType = "cft20.transfer"
+	EventCFT20Burn            EventType = "cft20.burn"
+	EventInscriptionInscribe  EventType = "inscription.inscribe"
+	EventInscriptionTransfer  EventType = "inscription.transfer"
+	EventListingCreated       EventType = "listing.created"
+	EventListingDeposited     EventType = "listing.deposited"
+	EventListingFilled        EventType = "listing.filled"
+	EventListingCancelled     EventType = "listing.cancelled"
+	EventLaunchpadReservation EventType = "launchpad.reservation"
+	EventBridgeSend           EventType = "bridge.send"
+	EventBridgeRecv           EventType = "bridge.recv"
+)
+
+// EventTypes lists every event type
+var EventTypes = []EventType{
+	EventCFT20Mint,
+	EventCFT20Transfer,
+	EventCFT20Burn,
+	EventInscriptionInscribe,
+	EventInscriptionTransfer,
+	EventListingCreated,
+	EventListingDeposited,
+	EventListingFilled,
+	EventListingCancelled,
+	EventLaunchpadReservation,
+	EventBridgeSend,
+	EventBridgeRecv,
+}
+
+// EventData is the payload of an event, the keys of each event type are
+// listed in the README
+type EventData map[string]interface{}
+
+// emitEvent writes an event to the outbox with db. The event is part of the
+// database transaction of the state change, so it is only delivered once the
+// change is committed
+func emitEvent(db *gorm.DB, transactionModel models.Transaction, eventType EventType, data EventData) error {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	event := models.EventOutbox{
+		ChainID:         transactionModel.ChainID,
+		Height:          transactionModel.Height,
+		TransactionID:   transactionModel.ID,
+		TransactionHash: transactionModel.Hash,
+		EventType:       string(eventType),
+		Data:            datatypes.JSON(dataBytes),
+		DateCreated:     transactionModel.DateCreated,
+	}
+	err = db.Create(&event).Error
+	if err != nil {
+		return NewError(CodeInternal, "unable to store event '%s'", err)
+	}
+	return nil
+}
+
+// listingEventData returns the event data of a marketplace listing
+func listingEventData(listing models.MarketplaceListing, hash string) EventData {
+	return EventData{
+		"listing_id":    listing.ID,
+		"listing_hash":  hash,
+		"seller":        listing.SellerAddress,
+		"total":         listing.Total,
+		"deposit_total": listing.DepositTotal,
+		"depositor":     listing.DepositorAddress,
+	}
+}
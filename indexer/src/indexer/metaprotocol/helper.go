@@ -1,10 +1,17 @@
 package metaprotocol
 
 import (
-	"fmt"
-	"strconv"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
 
+	cosmostypes "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	ibctransfertypes "github.com/cosmos/ibc-go/modules/apps/transfer/types"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/oracle"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"gorm.io/gorm"
 )
 
 type TokensTransferKind int
@@ -14,67 +21,193 @@ const (
 	IbcTransfer
 )
 
-// GetBaseTokensSent returns the amount of base tokens sent in a transaction
-func GetBaseTokensSent(rawTransaction types.RawTransaction, receiver string, kind TokensTransferKind, ibcEnabled bool) (uint64, error) {
-	if ibcEnabled && kind == IbcTransfer {
-		return GetBaseTokensSentIBC(rawTransaction, receiver)
+// GetSenderAddress returns the address that sent rawTransaction at height.
+// Before the message rules height the sender is the first sender found
+func GetSenderAddress(rawTransaction types.Transaction, chain Chain, height uint64) (string, error) {
+	if !chain.messageRules(height) {
+		return rawTransaction.FirstSenderAddress()
+	}
+	return rawTransaction.GetSenderAddress()
+}
+
+// GetBaseTokensSent returns the total amount of base tokens sent to receiver
+// in a transaction at height. Payments may be split across several sends and
+// may be executed with authz. Before the message rules height only the first
+// send or transfer is counted
+func GetBaseTokensSent(rawTransaction types.Transaction, chain Chain, height uint64, receiver string, kind TokensTransferKind) (uint64, error) {
+	if chain.IBCEnabled && kind == IbcTransfer {
+		if !chain.messageRules(height) {
+			return firstBaseTokensSentIBC(rawTransaction, chain, receiver)
+		}
+		return GetBaseTokensSentIBC(rawTransaction, chain, receiver)
+	}
+	if !chain.messageRules(height) {
+		return firstBaseTokensSent(rawTransaction, chain, receiver)
 	}
 
-	var err error
 	var amountSent uint64
 	validReceiver := false
+	invalidDenom := ""
+
+	for _, v := range rawTransaction.Sends() {
+		if v.ToAddress != receiver {
+			continue
+		}
+		validReceiver = true
 
-	for _, v := range rawTransaction.Body.Messages {
-		if v.Type == "/cosmos.bank.v1beta1.MsgSend" {
-			if v.ToAddress == receiver {
-				validReceiver = true
-			} else {
+		for _, coin := range v.Amount {
+			if coin.Denom != chain.BaseDenom {
+				invalidDenom = coin.Denom
 				continue
 			}
-
-			if v.Amount[0].Denom != "uatom" {
-				return 0, fmt.Errorf("incorrect denom sent, got %s, expected uatom", v.Amount[0].Denom)
+			amount, err := coinAmount(coin)
+			if err != nil {
+				return 0, err
 			}
-
-			amountSent, err = strconv.ParseUint(v.Amount[0].Amount, 10, 64)
+			amountSent, err = addAmount(amountSent, amount)
 			if err != nil {
 				return 0, err
 			}
-			break
 		}
 	}
 
 	if !validReceiver {
-		return 0, fmt.Errorf("invalid receiver, expected %s", receiver)
-
+		return 0, NewError(CodeInvalidPayment, "invalid receiver, expected %s", receiver).With("expected_receiver", receiver)
+	}
+	if amountSent == 0 && invalidDenom != "" {
+		return 0, NewError(CodeInvalidDenom, "incorrect denom sent, got %s, expected %s", invalidDenom, chain.BaseDenom).With("denom", invalidDenom).With("expected_denom", chain.BaseDenom)
 	}
 
 	return amountSent, nil
 }
 
-// GetBaseTokensSentIBC returns the amount of base tokens sent in a transaction
-// to be IBC'd
-func GetBaseTokensSentIBC(rawTransaction types.RawTransaction, receiver string) (uint64, error) {
-	var err error
+// GetBaseTokensSentIBC returns the total amount of base tokens sent to
+// receiver over the fee channel in a transaction to be IBC'd
+func GetBaseTokensSentIBC(rawTransaction types.Transaction, chain Chain, receiver string) (uint64, error) {
 	var amountSent uint64
-	for _, v := range rawTransaction.Body.Messages {
-		if v.Type == "/ibc.applications.transfer.v1.MsgTransfer" {
-			if v.Token.Denom != "uatom" {
-				return 0, fmt.Errorf("incorrect denom sent, got %s, expected uatom", v.Amount[0].Denom)
+	validTransfer := false
+	// The error of the first transfer that doesn't match is returned if no
+	// transfer matches
+	var transferErr error
+
+	for _, v := range rawTransaction.Transfers() {
+		if v.Token.Denom != chain.BaseDenom {
+			if transferErr == nil {
+				transferErr = NewError(CodeInvalidDenom, "incorrect denom sent, got %s, expected %s", v.Token.Denom, chain.BaseDenom).With("denom", v.Token.Denom).With("expected_denom", chain.BaseDenom)
 			}
-			if v.SourceChannel != "channel-569" {
-				return 0, fmt.Errorf("incorrect IBC channel, got %s, expected channel-569", v.SourceChannel)
+			continue
+		}
+		if v.SourceChannel != chain.FeeChannel {
+			if transferErr == nil {
+				transferErr = NewError(CodeInvalidFee, "incorrect IBC channel, got %s, expected %s", v.SourceChannel, chain.FeeChannel).With("channel", v.SourceChannel).With("expected_channel", chain.FeeChannel)
 			}
-			if v.Receiver != receiver {
-				return 0, fmt.Errorf("incorrect IBC receiver, got %s, expected %s", v.Receiver, receiver)
+			continue
+		}
+		if v.Receiver != receiver {
+			if transferErr == nil {
+				transferErr = NewError(CodeInvalidFee, "incorrect IBC receiver, got %s, expected %s", v.Receiver, receiver).With("receiver", v.Receiver).With("expected_receiver", receiver)
 			}
+			continue
+		}
+		validTransfer = true
 
-			amountSent, err = strconv.ParseUint(v.Token.Amount, 10, 64)
-			if err != nil {
-				return 0, err
-			}
-			return amountSent, nil
+		amount, err := coinAmount(v.Token)
+		if err != nil {
+			return 0, err
+		}
+		amountSent, err = addAmount(amountSent, amount)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if !validTransfer {
+		if transferErr != nil {
+			return 0, transferErr
+		}
+		return 0, NewError(CodeInvalidFee, "invalid fee attached to transaction")
+	}
+	return amountSent, nil
+}
+
+// firstBaseTokensSent returns the amount of the first coin of the first send
+// to receiver, sends executed with authz are ignored
+func firstBaseTokensSent(rawTransaction types.Transaction, chain Chain, receiver string) (uint64, error) {
+	for _, message := range rawTransaction.Messages() {
+		v, ok := message.(*banktypes.MsgSend)
+		if !ok || v.ToAddress != receiver {
+			continue
+		}
+
+		if v.Amount[0].Denom != chain.BaseDenom {
+			return 0, NewError(CodeInvalidDenom, "incorrect denom sent, got %s, expected %s", v.Amount[0].Denom, chain.BaseDenom).With("denom", v.Amount[0].Denom).With("expected_denom", chain.BaseDenom)
+		}
+		return coinAmount(v.Amount[0])
+	}
+	return 0, NewError(CodeInvalidPayment, "invalid receiver, expected %s", receiver).With("expected_receiver", receiver)
+}
+
+// firstBaseTokensSentIBC returns the amount of the first transfer, which
+// must be sent to receiver over the fee channel. Transfers executed with
+// authz are ignored
+func firstBaseTokensSentIBC(rawTransaction types.Transaction, chain Chain, receiver string) (uint64, error) {
+	for _, message := range rawTransaction.Messages() {
+		v, ok := message.(*ibctransfertypes.MsgTransfer)
+		if !ok {
+			continue
+		}
+		if v.Token.Denom != chain.BaseDenom {
+			return 0, NewError(CodeInvalidDenom, "incorrect denom sent, got %s, expected %s", v.Token.Denom, chain.BaseDenom).With("denom", v.Token.Denom).With("expected_denom", chain.BaseDenom)
+		}
+		if v.SourceChannel != chain.FeeChannel {
+			return 0, NewError(CodeInvalidFee, "incorrect IBC channel, got %s, expected %s", v.SourceChannel, chain.FeeChannel).With("channel", v.SourceChannel).With("expected_channel", chain.FeeChannel)
+		}
+		if v.Receiver != receiver {
+			return 0, NewError(CodeInvalidFee, "incorrect IBC receiver, got %s, expected %s", v.Receiver, receiver).With("receiver", v.Receiver).With("expected_receiver", receiver)
+		}
+		return coinAmount(v.Token)
+	}
+	return 0, NewError(CodeInvalidFee, "invalid fee attached to transaction")
+}
+
+// coinAmount returns the amount of coin as a uint64
+func coinAmount(coin cosmostypes.Coin) (uint64, error) {
+	if coin.Amount.IsNil() || !coin.Amount.IsUint64() {
+		return 0, NewError(CodeInvalidPayment, "invalid amount sent '%s'", coin)
+	}
+	return coin.Amount.Uint64(), nil
+}
+
+// addAmount returns the sum of a and b, payments that overflow are invalid
+func addAmount(a uint64, b uint64) (uint64, error) {
+	if a > math.MaxUint64-b {
+		return 0, NewError(CodeInvalidPayment, "amount sent overflows")
+	}
+	return a + b, nil
+}
+
+// getExtensionMessage returns the first extension message of the
+// transaction, metaprotocols only use the first extension option
+func getExtensionMessage(rawTransaction types.Transaction) (types.ExtensionMsg, error) {
+	msg, err := rawTransaction.ExtensionMessage()
+	if errors.Is(err, types.ErrNoExtensionMessage) {
+		return nil, WrapError(CodeMissingExtension, err)
+	}
+	if err != nil {
+		return nil, WrapError(CodeInvalidExtension, err)
+	}
+	return msg, nil
+}
+
+// tradeValueUSD returns the USD value of amount base tokens at time at. The
+// value is NULL when there is no fresh base token price for that time
+func tradeValueUSD(db *gorm.DB, chain Chain, chainID string, at time.Time, amount uint64) (sql.NullFloat64, error) {
+	baseTokenUSD, err := oracle.PriceAt(db, chainID, at, chain.PriceMaxAge)
+	if err != nil {
+		if errors.Is(err, oracle.ErrNoPrice) {
+			return sql.NullFloat64{}, nil
 		}
+		return sql.NullFloat64{}, err
 	}
-	return 0, fmt.Errorf("invalid fee attached to transaction")
+	return sql.NullFloat64{Float64: float64(amount) / math.Pow10(6) * baseTokenUSD, Valid: true}, nil
 }
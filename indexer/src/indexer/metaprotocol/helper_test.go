@@ -0,0 +1,152 @@
+package metaprotocol
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a SQLite database with the tables of models
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "metaprotocol.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(models...))
+	return db
+}
+
+// decodeTransaction decodes a transaction in the JSON encoding of the LCD
+func decodeTransaction(t *testing.T, messages string) types.Transaction {
+	var rawTransaction types.Transaction
+	err := json.Unmarshal([]byte(`{"body": {"messages": [`+messages+`]}}`), &rawTransaction)
+	assert.NoError(t, err)
+	return rawTransaction
+}
+
+func TestGetBaseTokensSent(t *testing.T) {
+	chain := Chain{BaseDenom: "uatom", MessageRulesHeight: 100}
+
+	// The payment is split across a send and a send executed with authz
+	rawTransaction := decodeTransaction(t, `
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1buyer", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "600"}]},
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1buyer", "to_address": "cosmos1fee", "amount": [{"denom": "uatom", "amount": "15"}]},
+		{"@type": "/cosmos.authz.v1beta1.MsgExec", "grantee": "cosmos1bot", "msgs": [
+			{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1buyer", "to_address": "cosmos1seller", "amount": [{"denom": "ibc/ABC", "amount": "5"}, {"denom": "uatom", "amount": "400"}]}
+		]}`)
+
+	amount, err := GetBaseTokensSent(rawTransaction, chain, 100, "cosmos1seller", Send)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000), amount, "all sends to the receiver should be summed")
+
+	amount, err = GetBaseTokensSent(rawTransaction, chain, 100, "cosmos1fee", Send)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(15), amount)
+
+	_, err = GetBaseTokensSent(rawTransaction, chain, 100, "cosmos1other", Send)
+	code, _ := ErrorCodeOf(err)
+	assert.Equal(t, CodeInvalidPayment, code)
+
+	rawTransaction = decodeTransaction(t, `{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1buyer", "to_address": "cosmos1seller", "amount": [{"denom": "uosmo", "amount": "600"}]}`)
+	_, err = GetBaseTokensSent(rawTransaction, chain, 100, "cosmos1seller", Send)
+	code, _ = ErrorCodeOf(err)
+	assert.Equal(t, CodeInvalidDenom, code)
+}
+
+func TestGetBaseTokensSentIBC(t *testing.T) {
+	chain := Chain{BaseDenom: "uatom", IBCEnabled: true, FeeReceiver: "osmo1fee", FeeChannel: "channel-141", MessageRulesHeight: 100}
+
+	rawTransaction := decodeTransaction(t, `
+		{"@type": "/ibc.applications.transfer.v1.MsgTransfer", "source_port": "transfer", "source_channel": "channel-0", "sender": "cosmos1buyer", "receiver": "osmo1fee", "token": {"denom": "uatom", "amount": "5"}},
+		{"@type": "/ibc.applications.transfer.v1.MsgTransfer", "source_port": "transfer", "source_channel": "channel-141", "sender": "cosmos1buyer", "receiver": "osmo1fee", "token": {"denom": "uatom", "amount": "10"}},
+		{"@type": "/ibc.applications.transfer.v1.MsgTransfer", "source_port": "transfer", "source_channel": "channel-141", "sender": "cosmos1buyer", "receiver": "osmo1fee", "token": {"denom": "uatom", "amount": "5"}}`)
+	amount, err := GetBaseTokensSent(rawTransaction, chain, 100, chain.FeeReceiver, IbcTransfer)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(15), amount, "transfers over other channels should be ignored")
+
+	rawTransaction = decodeTransaction(t, `{"@type": "/ibc.applications.transfer.v1.MsgTransfer", "source_port": "transfer", "source_channel": "channel-0", "sender": "cosmos1buyer", "receiver": "osmo1fee", "token": {"denom": "uatom", "amount": "5"}}`)
+	_, err = GetBaseTokensSent(rawTransaction, chain, 100, chain.FeeReceiver, IbcTransfer)
+	assert.EqualError(t, err, "incorrect IBC channel, got channel-0, expected channel-141")
+}
+
+func TestGetBaseTokensSentBeforeMessageRules(t *testing.T) {
+	chain := Chain{BaseDenom: "uatom", IBCEnabled: true, FeeReceiver: "osmo1fee", FeeChannel: "channel-141", MessageRulesHeight: 100}
+
+	// Only the first send to the receiver counts, sends executed with authz
+	// are ignored
+	rawTransaction := decodeTransaction(t, `
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1buyer", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "600"}]},
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1buyer", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "300"}]},
+		{"@type": "/cosmos.authz.v1beta1.MsgExec", "grantee": "cosmos1bot", "msgs": [
+			{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1buyer", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "400"}]}
+		]}`)
+	amount, err := GetBaseTokensSent(rawTransaction, chain, 99, "cosmos1seller", Send)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(600), amount)
+
+	amount, err = GetBaseTokensSent(rawTransaction, Chain{BaseDenom: "uatom"}, 1000, "cosmos1seller", Send)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(600), amount, "the rules should never apply when the height is 0")
+
+	// The first transfer must be sent over the fee channel
+	rawTransaction = decodeTransaction(t, `
+		{"@type": "/ibc.applications.transfer.v1.MsgTransfer", "source_port": "transfer", "source_channel": "channel-0", "sender": "cosmos1buyer", "receiver": "osmo1fee", "token": {"denom": "uatom", "amount": "5"}},
+		{"@type": "/ibc.applications.transfer.v1.MsgTransfer", "source_port": "transfer", "source_channel": "channel-141", "sender": "cosmos1buyer", "receiver": "osmo1fee", "token": {"denom": "uatom", "amount": "10"}}`)
+	_, err = GetBaseTokensSent(rawTransaction, chain, 99, chain.FeeReceiver, IbcTransfer)
+	assert.EqualError(t, err, "incorrect IBC channel, got channel-0, expected channel-141")
+	amount, err = GetBaseTokensSent(rawTransaction, chain, 100, chain.FeeReceiver, IbcTransfer)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), amount)
+}
+
+func TestGetSenderAddress(t *testing.T) {
+	chain := Chain{MessageRulesHeight: 100}
+
+	// Before the message rules height the first sender is used, from it
+	// every message must have the same sender
+	rawTransaction := decodeTransaction(t, `
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1first", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "1"}]},
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1second", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "1"}]}`)
+	sender, err := GetSenderAddress(rawTransaction, chain, 99)
+	assert.NoError(t, err)
+	assert.Equal(t, "cosmos1first", sender)
+	_, err = GetSenderAddress(rawTransaction, chain, 100)
+	assert.Error(t, err)
+
+	// Messages executed with authz are sent by the granter from the message
+	// rules height
+	rawTransaction = decodeTransaction(t, `
+		{"@type": "/cosmos.authz.v1beta1.MsgExec", "grantee": "cosmos1bot", "msgs": [
+			{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1granter", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "1"}]}
+		]}`)
+	for _, height := range []uint64{99, 100} {
+		sender, err = GetSenderAddress(rawTransaction, chain, height)
+		assert.NoError(t, err)
+		assert.Equal(t, "cosmos1granter", sender)
+	}
+}
+
+func TestTradeValueUSD(t *testing.T) {
+	db := newTestDB(t, &models.BaseTokenPrice{})
+	chain := Chain{ID: "cosmoshub-4", PriceMaxAge: 5 * time.Minute}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, db.Create(&models.BaseTokenPrice{ChainID: "cosmoshub-4", PriceUSD: 10, DateCreated: now}).Error)
+
+	value, err := tradeValueUSD(db, chain, "cosmoshub-4", now.Add(time.Minute), 2500000)
+	assert.NoError(t, err)
+	assert.True(t, value.Valid)
+	assert.Equal(t, 25.0, value.Float64)
+
+	// Trades without a fresh price have no value instead of a stale one
+	value, err = tradeValueUSD(db, chain, "cosmoshub-4", now.Add(time.Hour), 2500000)
+	assert.NoError(t, err)
+	assert.False(t, value.Valid, "a stale price should not be used")
+}
@@ -1,58 +1,61 @@
 package metaprotocol
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
-	"mime"
 	"strings"
+	"sync"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentpolicy"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/worker"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/leodido/go-urn"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type InscriptionConfig struct {
-	S3Endpoint       string `envconfig:"S3_ENDPOINT"`
-	S3Region         string `envconfig:"S3_REGION"`
-	S3Bucket         string `envconfig:"S3_BUCKET"`
-	S3ID             string `envconfig:"S3_ID"`
-	S3Secret         string `envconfig:"S3_SECRET"`
-	S3Token          string `envconfig:"S3_TOKEN"`
-	ReservationsFile string `envconfig:"RESERVATIONS_FILE" required:"true"`
-	S3StoreContent   bool   `envconfig:"S3_STORE_CONTENT" default:"true"`
-	MinterBotAddress string `envconfig:"MINTER_BOT_ADDRESS" required:"true"`
+	ReservationsFile string   `envconfig:"RESERVATIONS_FILE" required:"true"`
+	MinterBotAddress string   `envconfig:"MINTER_BOT_ADDRESS" required:"true"`
+	AllowedMimeTypes []string `envconfig:"INSCRIPTION_ALLOWED_MIME_TYPES"`
+	MaxContentBytes  int      `envconfig:"INSCRIPTION_MAX_CONTENT_BYTES" default:"0"`
+	ActiveContent    string   `envconfig:"INSCRIPTION_ACTIVE_CONTENT" default:"sandbox"`
+	// MultipartMaxParts is the maximum number of parts of a multipart
+	// inscription
+	MultipartMaxParts uint `envconfig:"INSCRIPTION_MULTIPART_MAX_PARTS" default:"64"`
+	// MultipartExpiryBlocks is the number of blocks after the first part
+	// in which an upload must be completed
+	MultipartExpiryBlocks uint64 `envconfig:"INSCRIPTION_MULTIPART_EXPIRY_BLOCKS" default:"14400"`
 }
 
 type Inscription struct {
 	chainID      string
-	db           *gorm.DB
+	chain        Chain
 	workerClient *worker.WorkerClient
-	s3Endpoint   string
-	s3Region     string
-	s3Bucket     string
-	// s3ID is the S3 credentials ID
-	s3ID string
-	// s3Secret is the S3 credentials secret
-	s3Secret string
-	// s3Token is the S3 credentials token
-	s3Token              string
+	// contentHashEnforceHeight is the height from which content hash
+	// mismatches are rejected
+	contentHashEnforceHeight uint64
+	// contentStore stores the inscription content, nil if content isn't
+	// stored
+	contentStore contentstore.ContentStore
+	// contentValidator checks the inscribed content
+	contentValidator contentValidator
+	// multipartMaxParts and multipartExpiryBlocks limit multipart uploads
+	multipartMaxParts     uint
+	multipartExpiryBlocks uint64
+	reservationsFile      string
+	// reservationsLock guards the reservations, they are replaced on reload
+	reservationsLock     sync.RWMutex
 	reservationsByName   map[string]CollectionReservation
 	reservationsByTicker map[string]CollectionReservation
 	MinterBotAddress     string
 }
 
-func NewInscriptionProcessor(chainID string, db *gorm.DB, workerClient *worker.WorkerClient) *Inscription {
+func NewInscriptionProcessor(chain Chain, workerClient *worker.WorkerClient, contentStore contentstore.ContentStore) *Inscription {
 	// Parse config environment variables for self
 	var config InscriptionConfig
 	err := envconfig.Process("", &config)
@@ -60,26 +63,30 @@ func NewInscriptionProcessor(chainID string, db *gorm.DB, workerClient *worker.W
 		log.Fatalf("Unable to process config: %s", err)
 	}
 
-	if config.S3StoreContent && (config.S3Endpoint == "" || config.S3Region == "" || config.S3Bucket == "" || config.S3ID == "" || config.S3Secret == "") {
-		log.Fatalf("S3 store content is enabled but the required environment variables are not set")
+	// load reservations
+	reservationsByName, reservationsByTicker, err := LoadReservations(config.ReservationsFile)
+	if err != nil {
+		log.Fatalf("Unable to load reservations: %s", err)
 	}
 
-	// load reservations
-	reservationsByName, reservationsByTicker := GetReservations(config.ReservationsFile)
+	contentValidator, err := newContentValidator(chain, config.AllowedMimeTypes, config.MaxContentBytes, config.ActiveContent)
+	if err != nil {
+		log.Fatalf("Unable to process inscription content policy: %s", err)
+	}
 
 	return &Inscription{
-		chainID:              chainID,
-		db:                   db,
-		s3Endpoint:           config.S3Endpoint,
-		s3Region:             config.S3Region,
-		s3Bucket:             config.S3Bucket,
-		s3ID:                 config.S3ID,
-		s3Secret:             config.S3Secret,
-		s3Token:              config.S3Token,
-		reservationsByName:   reservationsByName,
-		reservationsByTicker: reservationsByTicker,
-		workerClient:         workerClient,
-		MinterBotAddress:     config.MinterBotAddress,
+		chainID:                  chain.ID,
+		chain:                    chain,
+		contentHashEnforceHeight: chain.ContentHashEnforceHeight,
+		contentValidator:         contentValidator,
+		multipartMaxParts:        config.MultipartMaxParts,
+		multipartExpiryBlocks:    config.MultipartExpiryBlocks,
+		contentStore:             contentStore,
+		reservationsFile:         config.ReservationsFile,
+		reservationsByName:       reservationsByName,
+		reservationsByTicker:     reservationsByTicker,
+		workerClient:             workerClient,
+		MinterBotAddress:         config.MinterBotAddress,
 	}
 }
 
@@ -87,10 +94,51 @@ func (protocol *Inscription) Name() string {
 	return "Inscription"
 }
 
-func (protocol *Inscription) GetCollection(collectionHash string, sender string, checkSenderIsOwner bool) (*models.Collection, error) {
+// contentHashEnforced returns true if content hash mismatches are rejected
+// at height
+func (protocol *Inscription) contentHashEnforced(height uint64) bool {
+	return protocol.contentHashEnforceHeight != 0 && height >= protocol.contentHashEnforceHeight
+}
+
+// executedByMinterBot returns true if rawTransaction was executed by the
+// minter bot with authz. Before the message rules height only the grantee of
+// the first MsgExec is checked
+func (protocol *Inscription) executedByMinterBot(rawTransaction types.Transaction, height uint64) bool {
+	if !protocol.chain.messageRules(height) {
+		execs := rawTransaction.Execs()
+		return len(execs) > 0 && execs[0].Grantee == protocol.MinterBotAddress
+	}
+	return rawTransaction.ExecutedBy(protocol.MinterBotAddress)
+}
+
+// Reload reads the reservations file again. The current reservations are
+// kept if the file can't be loaded
+func (protocol *Inscription) Reload() error {
+	reservationsByName, reservationsByTicker, err := LoadReservations(protocol.reservationsFile)
+	if err != nil {
+		return err
+	}
+
+	protocol.reservationsLock.Lock()
+	defer protocol.reservationsLock.Unlock()
+	protocol.reservationsByName = reservationsByName
+	protocol.reservationsByTicker = reservationsByTicker
+	return nil
+}
+
+// getReservations returns the reservation of the ticker and of the name
+func (protocol *Inscription) getReservations(ticker string, name string) (tickerReservation CollectionReservation, tickerReserved bool, nameReservation CollectionReservation, nameReserved bool) {
+	protocol.reservationsLock.RLock()
+	defer protocol.reservationsLock.RUnlock()
+	tickerReservation, tickerReserved = protocol.reservationsByTicker[ticker]
+	nameReservation, nameReserved = protocol.reservationsByName[name]
+	return tickerReservation, tickerReserved, nameReservation, nameReserved
+}
+
+func (protocol *Inscription) GetCollection(db *gorm.DB, collectionHash string, sender string, checkSenderIsOwner bool) (*models.Collection, error) {
 	// Fetch transaction from database with the given hash
 	var transaction models.Transaction
-	result := protocol.db.Where("hash = ?", collectionHash).First(&transaction)
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chainID, collectionHash).First(&transaction)
 	if result.Error != nil {
 		// Invalid hash
 		return nil, result.Error
@@ -98,7 +146,7 @@ func (protocol *Inscription) GetCollection(collectionHash string, sender string,
 
 	// Fetch the collection for this transaction ID
 	var collection models.Collection
-	result = protocol.db.Where("transaction_id = ?", transaction.ID).First(&collection)
+	result = db.Where("transaction_id = ?", transaction.ID).First(&collection)
 	if result.Error != nil {
 		// Invalid transaction ID
 		return nil, result.Error
@@ -106,16 +154,16 @@ func (protocol *Inscription) GetCollection(collectionHash string, sender string,
 
 	// Check that the sender is the collection owner
 	if checkSenderIsOwner && collection.Creator != sender {
-		return nil, fmt.Errorf("invalid sender, must be collection owner")
+		return nil, NewError(CodeNotOwner, "invalid sender, must be collection owner")
 	}
 
 	return &collection, nil
 }
 
-func (protocol *Inscription) GetInscriptionFromHash(inscriptionHash string) (*models.Inscription, error) {
+func (protocol *Inscription) GetInscriptionFromHash(db *gorm.DB, inscriptionHash string) (*models.Inscription, error) {
 	// Fetch transaction from database with the given hash
 	var transaction models.Transaction
-	result := protocol.db.Where("hash = ?", inscriptionHash).First(&transaction)
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chainID, inscriptionHash).First(&transaction)
 	if result.Error != nil {
 		// Invalid hash
 		return nil, result.Error
@@ -123,7 +171,7 @@ func (protocol *Inscription) GetInscriptionFromHash(inscriptionHash string) (*mo
 
 	// Fetch the inscription for this transaction ID
 	var inscription models.Inscription
-	result = protocol.db.Where("transaction_id = ?", transaction.ID).First(&inscription)
+	result = db.Where("transaction_id = ?", transaction.ID).First(&inscription)
 	if result.Error != nil {
 		// Invalid transaction ID
 		return nil, result.Error
@@ -132,37 +180,37 @@ func (protocol *Inscription) GetInscriptionFromHash(inscriptionHash string) (*mo
 	return &inscription, nil
 }
 
-func (protocol *Inscription) GetInscription(inscriptionHash string, sender string) (*models.Inscription, error) {
-	inscription, err := protocol.GetInscriptionFromHash(inscriptionHash)
+func (protocol *Inscription) GetInscription(db *gorm.DB, inscriptionHash string, sender string) (*models.Inscription, error) {
+	inscription, err := protocol.GetInscriptionFromHash(db, inscriptionHash)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check that the sender is the current owner
 	if inscription.CurrentOwner != sender {
-		return nil, fmt.Errorf("invalid sender, must be current owner")
+		return nil, NewError(CodeNotOwner, "invalid sender, must be current owner")
 	}
 
 	return inscription, nil
 }
 
-func (protocol *Inscription) GrantMigrationPermission(transactionModel models.Transaction, inscriptionHash string, grantee string, granter string) error {
+func (protocol *Inscription) GrantMigrationPermission(db *gorm.DB, transactionModel models.Transaction, inscriptionHash string, grantee string, granter string) error {
 	// Fetch the inscription for this transaction ID
-	inscription, err := protocol.GetInscriptionFromHash(inscriptionHash)
+	inscription, err := protocol.GetInscriptionFromHash(db, inscriptionHash)
 	if err != nil {
 		return err
 	}
 
 	// Check that the sender is the inscription creator
 	if inscription.Creator != granter {
-		return fmt.Errorf("invalid granter, must be inscription creator")
+		return NewError(CodeNotAuthorized, "invalid granter, must be inscription creator")
 	}
 
 	// Check if the grantee has already been granted migration permission
 	var migrationPermissionGrant models.MigrationPermissionGrant
-	result := protocol.db.Where("inscription_id = ? AND grantee = ?", inscription.ID, grantee).First(&migrationPermissionGrant)
+	result := db.Where("inscription_id = ? AND grantee = ?", inscription.ID, grantee).First(&migrationPermissionGrant)
 	if result.Error == nil {
-		return fmt.Errorf("migration permission already granted")
+		return NewError(CodePermissionExists, "migration permission already granted")
 	}
 
 	// Grant migration permission
@@ -172,7 +220,7 @@ func (protocol *Inscription) GrantMigrationPermission(transactionModel models.Tr
 		Grantee:       grantee,
 		DateCreated:   transactionModel.DateCreated,
 	}
-	result = protocol.db.Save(&migrationPermissionGrant)
+	result = db.Save(&migrationPermissionGrant)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -180,22 +228,22 @@ func (protocol *Inscription) GrantMigrationPermission(transactionModel models.Tr
 	return nil
 }
 
-func (protocol *Inscription) UpdateCollection(parsedURN ProtocolURN, rawTransaction types.RawTransaction, sender string) error {
+func (protocol *Inscription) UpdateCollection(db *gorm.DB, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
 	// validate collection hash
 	if parsedURN.KeyValuePairs["h"] == "" {
-		return fmt.Errorf("missing collection hash")
+		return NewError(CodeInvalidField, "missing collection hash").With("field", "collection")
 	}
 
 	collectionHash := parsedURN.KeyValuePairs["h"]
 
 	// get collection
-	collection, err := protocol.GetCollection(collectionHash, sender, true)
+	collection, err := protocol.GetCollection(db, collectionHash, sender, true)
 	if err != nil {
 		return err
 	}
 
 	// get collection metadata from non_critical_extension_options
-	msg, err := rawTransaction.Body.GetExtensionMessage()
+	msg, err := getExtensionMessage(rawTransaction)
 	if err != nil {
 		return err
 	}
@@ -208,7 +256,7 @@ func (protocol *Inscription) UpdateCollection(parsedURN ProtocolURN, rawTransact
 
 	err = json.Unmarshal(jsonBytes, &updateMetadata)
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal metadata '%s'", err)
+		return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
 	}
 
 	// update collection metadata
@@ -216,7 +264,7 @@ func (protocol *Inscription) UpdateCollection(parsedURN ProtocolURN, rawTransact
 	err = json.Unmarshal(collection.Metadata, &currentMetadata)
 
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal metadata '%s'", err)
+		return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
 	}
 
 	if updateMetadata.RoyaltyPercentage != 0 {
@@ -255,31 +303,20 @@ func (protocol *Inscription) UpdateCollection(parsedURN ProtocolURN, rawTransact
 
 	metadataBytes, err := json.Marshal(currentMetadata)
 	if err != nil {
-		return fmt.Errorf("unable to marshal collection metadata '%s'", err)
+		return NewError(CodeInternal, "unable to marshal collection metadata '%s'", err)
 	}
 
 	collection.Metadata = datatypes.JSON(metadataBytes)
-	protocol.db.Save(&collection)
+	db.Save(&collection)
 
 	return nil
 }
 
-func (protocol *Inscription) Migrate(rawTransaction types.RawTransaction, sender string) error {
+func (protocol *Inscription) Migrate(db *gorm.DB, rawTransaction types.Transaction, sender string) error {
 	// get migration data from non_critical_extension_options
-	var msg types.ExtensionMsg
-	var err error
-	for _, extension := range rawTransaction.Body.NonCriticalExtensionOptions {
-		msg, err = extension.UnmarshalData()
-		if err != nil {
-			return fmt.Errorf("unable to unmarshal extension data '%s'", err)
-		}
-
-		// We only process the first extension option
-		break
-	}
-
-	if msg == nil {
-		return fmt.Errorf("no extension options found")
+	msg, err := getExtensionMessage(rawTransaction)
+	if err != nil {
+		return err
 	}
 
 	var migrationData types.InscriptionMigrationData
@@ -290,13 +327,13 @@ func (protocol *Inscription) Migrate(rawTransaction types.RawTransaction, sender
 
 	err = json.Unmarshal(jsonBytes, &migrationData)
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal metadata '%s'", err)
+		return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
 	}
 
 	// get collection
 	var collection *models.Collection
 	if migrationData.Collection != "" {
-		collection, err = protocol.GetCollection(migrationData.Collection, sender, true)
+		collection, err = protocol.GetCollection(db, migrationData.Collection, sender, true)
 		if err != nil {
 			return err
 		}
@@ -306,11 +343,11 @@ func (protocol *Inscription) Migrate(rawTransaction types.RawTransaction, sender
 	// verify that the sender is the inscription owner
 	attributeNames := migrationData.Header[1:]
 
-	err = protocol.db.Transaction(func(tx *gorm.DB) error {
+	err = db.Transaction(func(tx *gorm.DB) error {
 		for _, row := range migrationData.Rows {
 			// get the inscription
 			inscriptionHash := row[0]
-			inscription, err := protocol.GetInscriptionFromHash(inscriptionHash)
+			inscription, err := protocol.GetInscriptionFromHash(tx, inscriptionHash)
 			if err != nil {
 				return err
 			}
@@ -319,17 +356,17 @@ func (protocol *Inscription) Migrate(rawTransaction types.RawTransaction, sender
 			if inscription.Creator != sender {
 				// Check if the sender has migration permissions
 				var migrationPermissionGrant models.MigrationPermissionGrant
-				result := protocol.db.Where("inscription_id = ? AND grantee = ?", inscription.ID, sender).First(&migrationPermissionGrant)
+				result := tx.Where("inscription_id = ? AND grantee = ?", inscription.ID, sender).First(&migrationPermissionGrant)
 				if result.Error != nil {
 					// Invalid migration permission
-					return fmt.Errorf("invalid sender, must be creator or have migration permissions")
+					return NewError(CodeNotAuthorized, "invalid sender, must be creator or have migration permissions")
 				}
 				inscription.Creator = sender
 			}
 
 			// check if the inscription is already migrated
 			if inscription.CollectionID.Valid || (inscription.Version != "v1" && collection == nil) {
-				return fmt.Errorf("inscription already migrated")
+				return NewError(CodeAlreadyMigrated, "inscription already migrated")
 			}
 
 			// update inscription metadata
@@ -337,12 +374,12 @@ func (protocol *Inscription) Migrate(rawTransaction types.RawTransaction, sender
 			var metadata types.InscriptionNftMetadata
 			err = json.Unmarshal(inscription.Metadata, &metadata)
 			if err != nil {
-				return fmt.Errorf("unable to unmarshal metadata '%s'", err)
+				return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
 			}
 			metadata.Metadata.Attributes = traits
 			metadataBytes, err := json.Marshal(metadata)
 			if err != nil {
-				return fmt.Errorf("unable to marshal metadata '%s'", err)
+				return NewError(CodeInternal, "unable to marshal metadata '%s'", err)
 			}
 
 			inscription.Metadata = datatypes.JSON(metadataBytes)
@@ -370,8 +407,14 @@ func (protocol *Inscription) Migrate(rawTransaction types.RawTransaction, sender
 
 	// update collection stats and traits
 	if collection != nil {
-		protocol.workerClient.UpdateCollectionStats(collection.ID)
-		protocol.workerClient.UpdateCollectionTraits(collection.ID)
+		err = protocol.workerClient.UpdateCollectionStats(db, collection.ID)
+		if err != nil {
+			return err
+		}
+		err = protocol.workerClient.UpdateCollectionTraits(db, collection.ID)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -379,392 +422,433 @@ func (protocol *Inscription) Migrate(rawTransaction types.RawTransaction, sender
 
 func (protocol *Inscription) RequiresV2(version string) error {
 	if version != "v2" {
-		return fmt.Errorf("requires v2 version of the inscription protocol")
+		return NewError(CodeUnsupportedVersion, "requires v2 version of the inscription protocol")
 	}
 	return nil
 
 }
 
-func (protocol *Inscription) Process(transactionModel models.Transaction, protocolURN *urn.URN, rawTransaction types.RawTransaction, sourceChannel string) error {
-	sender, err := rawTransaction.GetSenderAddress()
+func (protocol *Inscription) Operations() []Operation {
+	return []Operation{
+		{
+			Name:    "inscribe",
+			Fields:  []Field{{Key: "h", Type: FieldString}},
+			Handler: protocol.processInscribe,
+		},
+		{
+			Name:     "inscribe-part",
+			Versions: []string{"v2"},
+			Fields:   []Field{{Key: "h", Type: FieldString}},
+			Handler:  protocol.processInscribePart,
+		},
+		{
+			Name: "transfer",
+			Fields: []Field{
+				{Key: "h", Type: FieldString},
+				{Key: "dst", Type: FieldString},
+			},
+			Handler: protocol.processTransfer,
+		},
+		{
+			Name:     "migrate",
+			Versions: []string{"v2"},
+			Handler:  protocol.processMigrate,
+		},
+		{
+			Name:     "update-collection",
+			Versions: []string{"v2"},
+			Fields:   []Field{{Key: "h", Type: FieldString}},
+			Handler:  protocol.processUpdateCollection,
+		},
+		{
+			Name:     "grant-migration-permission",
+			Versions: []string{"v2"},
+			Fields: []Field{
+				{Key: "h", Type: FieldString},
+				{Key: "grantee", Type: FieldString},
+			},
+			Handler: protocol.processGrantMigrationPermission,
+		},
+	}
+}
+
+// processInscribe handles the inscribe operation
+func (protocol *Inscription) processInscribe(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	// Inscription metadata is stored in the non_critical_extension_options
+	// section of the transaction
+	msg, err := getExtensionMessage(rawTransaction)
 	if err != nil {
 		return err
 	}
+	return protocol.inscribe(db, transactionModel, parsedURN, rawTransaction, sender, parsedURN.KeyValuePairs["h"], msg)
+}
 
-	// We need to parse the protocol specific string in SS, it contains
-	// {chainId}@{version};operation$h={unique hash of content}
-	// cosmoshub-4@v1beta;inscribe$h=c4749f95902411d1a45a033d8a6b3e6aa0de0a0028fe8737f66fed6834dce8bf
-	parsedURN, err := ParseProtocolString(protocolURN)
+// inscribe creates the collection or inscription with the metadata and
+// content of msg, declared to have contentHash
+func (protocol *Inscription) inscribe(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string, contentHash string, msg types.ExtensionMsg) error {
+	var inscriptionMetadata types.InscriptionMetadata[types.NftMetadata]
+	jsonBytes, err := msg.GetMetadata(&inscriptionMetadata)
 	if err != nil {
 		return err
 	}
 
-	// TODO: Rework validation
-	if parsedURN.ChainID != protocol.chainID {
-		return fmt.Errorf("invalid chain ID '%s'", parsedURN.ChainID)
+	// If inscription has attributes require v2
+	if len(inscriptionMetadata.Metadata.Attributes) > 0 {
+		if err := protocol.RequiresV2(parsedURN.Version); err != nil {
+			return err
+		}
 	}
 
-	switch parsedURN.Operation {
-	case "inscribe":
-		if parsedURN.KeyValuePairs["h"] == "" {
-			return fmt.Errorf("missing content hash")
-		}
+	var collectionMetadata types.InscriptionMetadata[types.CollectionMetadata]
+	err = json.Unmarshal(jsonBytes, &collectionMetadata)
+	if err != nil {
+		return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
+	}
 
-		contentHash := parsedURN.KeyValuePairs["h"]
+	content, err := msg.GetContent()
+	if err != nil {
+		return err
+	}
 
-		// Inscription metadata is stored in the non_critical_extension_options
-		// section of the transaction
-		var msg types.ExtensionMsg
-		for _, extension := range rawTransaction.Body.NonCriticalExtensionOptions {
-			msg, err = extension.UnmarshalData()
-			if err != nil {
-				return fmt.Errorf("unable to unmarshal extension data '%s'", err)
-			}
+	// The declared content hash must match the content, mismatches are
+	// flagged before the enforcement height
+	computedHash := types.ContentHash(content)
+	hashMismatch := !types.ContentHashMatches(contentHash, content)
+	if hashMismatch && protocol.contentHashEnforced(transactionModel.Height) {
+		return NewError(CodeContentHashMismatch, "content hash '%s' does not match the content, expected '%s'", contentHash, computedHash).
+			With("content_hash", contentHash).
+			With("computed_hash", computedHash)
+	}
 
-			// We only process the first extension option
-			break
-		}
+	// The content type is sniffed rather than taken from the metadata
+	contentCheck, err := protocol.contentValidator.check(transactionModel.Height, inscriptionMetadata.Metadata.Mime, content)
+	if err != nil {
+		return err
+	}
 
-		var inscriptionMetadata types.InscriptionMetadata[types.NftMetadata]
-		jsonBytes, err := msg.GetMetadata(&inscriptionMetadata)
-		if err != nil {
+	// Check if the content is already in the database. Content is matched on
+	// the computed hash, the declared hash only matches rows indexed before
+	// the hashes were computed and hashes that are taken by other content
+	var contentAlreadyExists bool = false
+	var inscription models.Inscription
+	result := db.Where("chain_id = ? AND (computed_hash = ? OR content_hash = ?)", protocol.chainID, computedHash, contentHash).First(&inscription)
+	if result.Error == nil {
+		// Content already exists
+		contentAlreadyExists = true
+	} else if result.Error != gorm.ErrRecordNotFound {
+		// Error fetching content hash
+		return result.Error
+	}
+
+	// Check if the inscription is a Collection
+	if collectionMetadata.Metadata.Symbol != "" {
+		if err := protocol.RequiresV2(parsedURN.Version); err != nil {
 			return err
 		}
 
-		// If inscription has attributes require v2
-		if len(inscriptionMetadata.Metadata.Attributes) > 0 {
-			if err := protocol.RequiresV2(parsedURN.Version); err != nil {
-				return err
+		symbol := strings.ToUpper(collectionMetadata.Metadata.Symbol)
+		tickerReservation, tickerReserved, nameReservation, nameReserved := protocol.getReservations(symbol, collectionMetadata.Metadata.Name)
+
+		// check if symbol is reserved
+		if tickerReserved {
+			if tickerReservation.Address != sender {
+				return NewError(CodeTickerReserved, "ticker '%s' is reserved", symbol).With("ticker", symbol)
 			}
 		}
 
-		var collectionMetadata types.InscriptionMetadata[types.CollectionMetadata]
-		err = json.Unmarshal(jsonBytes, &collectionMetadata)
-		if err != nil {
-			return fmt.Errorf("unable to unmarshal metadata '%s'", err)
+		// check if name is reserved
+		if nameReserved {
+			if nameReservation.Address != sender {
+				return NewError(CodeNameReserved, "name '%s' is reserved", collectionMetadata.Metadata.Name).With("name", collectionMetadata.Metadata.Name)
+			}
 		}
 
-		content, err := msg.GetContent()
+		contentPath, err := protocol.storeContent(db, contentCheck, content)
 		if err != nil {
 			return err
 		}
 
-		// Check if the content hash is already in the database
-		var contentPath string
-		var contentAlreadyExists bool = false
-		var inscription models.Inscription
-		result := protocol.db.Where("content_hash = ?", contentHash).First(&inscription)
-		if result.Error == nil {
-			// Content hash already exists
-			contentPath = inscription.ContentPath
-			contentAlreadyExists = true
-		} else if result.Error != gorm.ErrRecordNotFound {
-			// Error fetching content hash
-			return result.Error
-		} else {
-			// Store the content with the correct mime type on DO
-			contentPath, err = protocol.StoreContent(inscriptionMetadata.Metadata.Mime, rawTransaction.Hash, content)
-			if err != nil {
-				return fmt.Errorf("unable to store content '%s'", err)
-			}
+		collectionModel := models.Collection{
+			ChainID:          parsedURN.ChainID,
+			Height:           transactionModel.Height,
+			Version:          parsedURN.Version,
+			TransactionID:    transactionModel.ID,
+			ContentHash:      contentHash,
+			ComputedHash:     sql.NullString{String: computedHash, Valid: true},
+			IsHashMismatch:   hashMismatch,
+			Creator:          sender,
+			Name:             collectionMetadata.Metadata.Name,
+			Symbol:           symbol,
+			Metadata:         datatypes.JSON(jsonBytes),
+			ContentPath:      contentPath,
+			ContentSizeBytes: uint64(len(content)),
+			DeclaredMime:     nullString(contentCheck.DeclaredType),
+			DetectedMime:     nullString(contentCheck.DetectedType),
+			IsActiveContent:  contentCheck.Active,
+			DateCreated:      transactionModel.DateCreated,
 		}
 
-		// Check if the inscription is a Collection
-		if collectionMetadata.Metadata.Symbol != "" {
-			if err := protocol.RequiresV2(parsedURN.Version); err != nil {
-				return err
-			}
-
-			symbol := strings.ToUpper(collectionMetadata.Metadata.Symbol)
-
-			// check if symbol is reserved
-			if reservation, ok := protocol.reservationsByTicker[symbol]; ok {
-				if reservation.Address != sender {
-					return fmt.Errorf("ticker '%s' is reserved", symbol)
-				}
-			}
-
-			// check if name is reserved
-			if reservation, ok := protocol.reservationsByName[collectionMetadata.Metadata.Name]; ok {
-				if reservation.Address != sender {
-					return fmt.Errorf("name '%s' is reserved", collectionMetadata.Metadata.Name)
-				}
-			}
-
-			collectionModel := models.Collection{
-				ChainID:          parsedURN.ChainID,
-				Height:           transactionModel.Height,
-				Version:          parsedURN.Version,
-				TransactionID:    transactionModel.ID,
-				ContentHash:      contentHash,
-				Creator:          sender,
-				Name:             collectionMetadata.Metadata.Name,
-				Symbol:           symbol,
-				Metadata:         datatypes.JSON(jsonBytes),
-				ContentPath:      contentPath,
-				ContentSizeBytes: uint64(len(content)),
-				DateCreated:      transactionModel.DateCreated,
-			}
+		if collectionMetadata.Metadata.Minter != "" {
+			collectionModel.Minter = sql.NullString{String: collectionMetadata.Metadata.Minter, Valid: true}
+		}
+		if collectionMetadata.Metadata.RoyaltyPercentage != 0 {
+			collectionModel.RoyaltyPercentage = sql.NullFloat64{Float64: float64(collectionMetadata.Metadata.RoyaltyPercentage), Valid: true}
+		}
+		if collectionMetadata.Metadata.PaymentAddress != "" {
+			collectionModel.PaymentAddress = sql.NullString{String: collectionMetadata.Metadata.PaymentAddress, Valid: true}
+		}
 
-			if collectionMetadata.Metadata.Minter != "" {
-				collectionModel.Minter = sql.NullString{String: collectionMetadata.Metadata.Minter, Valid: true}
-			}
-			if collectionMetadata.Metadata.RoyaltyPercentage != 0 {
-				collectionModel.RoyaltyPercentage = sql.NullFloat64{Float64: float64(collectionMetadata.Metadata.RoyaltyPercentage), Valid: true}
-			}
-			if collectionMetadata.Metadata.PaymentAddress != "" {
-				collectionModel.PaymentAddress = sql.NullString{String: collectionMetadata.Metadata.PaymentAddress, Valid: true}
-			}
+		result := db.Save(&collectionModel)
+		if result.Error != nil {
+			return result.Error
+		}
 
-			result := protocol.db.Save(&collectionModel)
-			if result.Error != nil {
-				return result.Error
+		if contentPath != "" {
+			err = protocol.workerClient.GeneratePreview(db, "collection", collectionModel.ID)
+			if err != nil {
+				return err
 			}
-			return nil
 		}
+		return nil
+	}
 
-		// Get the max inscription number
-		var maxInscriptionNumber uint64
-		err = protocol.db.Model(&models.Inscription{}).Select("MAX(inscription_number)").Scan(&maxInscriptionNumber).Error
-		if err != nil {
+	// Get the max inscription number
+	var maxInscriptionNumber uint64
+	err = db.Model(&models.Inscription{}).Where("chain_id = ?", protocol.chainID).Select("COALESCE(MAX(inscription_number), 0)").Scan(&maxInscriptionNumber).Error
+	if err != nil {
+		return err
+	}
+	inscriptionNumber := maxInscriptionNumber + 1
+
+	inscriptionModel := models.Inscription{
+		InscriptionNumber: inscriptionNumber,
+		ChainID:           parsedURN.ChainID,
+		Height:            transactionModel.Height,
+		Version:           parsedURN.Version,
+		TransactionID:     transactionModel.ID,
+		ContentHash:       contentHash,
+		ComputedHash:      sql.NullString{String: computedHash, Valid: true},
+		IsHashMismatch:    hashMismatch,
+		Creator:           sender,
+		CurrentOwner:      sender,
+		Type:              "content",
+		Metadata:          datatypes.JSON(jsonBytes),
+		ContentSizeBytes:  uint64(len(content)),
+		DeclaredMime:      nullString(contentCheck.DeclaredType),
+		DetectedMime:      nullString(contentCheck.DetectedType),
+		IsActiveContent:   contentCheck.Active,
+		DateCreated:       transactionModel.DateCreated,
+	}
+
+	// Check if inscription is part of a Collection
+	if inscriptionMetadata.Parent.Type == "/collection" {
+		if err := protocol.RequiresV2(parsedURN.Version); err != nil {
 			return err
 		}
-		inscriptionNumber := maxInscriptionNumber + 1
-
-		inscriptionModel := models.Inscription{
-			InscriptionNumber: inscriptionNumber,
-			ChainID:           parsedURN.ChainID,
-			Height:            transactionModel.Height,
-			Version:           parsedURN.Version,
-			TransactionID:     transactionModel.ID,
-			ContentHash:       contentHash,
-			Creator:           sender,
-			CurrentOwner:      sender,
-			Type:              "content",
-			Metadata:          datatypes.JSON(jsonBytes),
-			ContentPath:       contentPath,
-			ContentSizeBytes:  uint64(len(content)),
-			DateCreated:       transactionModel.DateCreated,
+
+		collection, err := protocol.GetCollection(db, inscriptionMetadata.Parent.Identifier, sender, false)
+		if err != nil {
+			return NewError(CodeCollectionNotFound, "error getting collection with identifier '%s': %w", inscriptionMetadata.Parent.Identifier, err).With("collection", inscriptionMetadata.Parent.Identifier)
 		}
 
-		// Check if inscription is part of a Collection
-		if inscriptionMetadata.Parent.Type == "/collection" {
-			if err := protocol.RequiresV2(parsedURN.Version); err != nil {
-				return err
+		// check sender has launchpad mint reservation or is collection owner
+		var launchpad models.Launchpad
+		result := db.Where("collection_id = ?", collection.ID).First(&launchpad)
+		if result.Error != nil {
+			if result.Error != gorm.ErrRecordNotFound {
+				return result.Error
 			}
 
-			collection, err := protocol.GetCollection(inscriptionMetadata.Parent.Identifier, sender, false)
-
-			// check sender has launchpad mint reservation or is collection owner
-			var launchpad models.Launchpad
-			result := protocol.db.Where("collection_id = ?", collection.ID).First(&launchpad)
-			if result.Error != nil {
-				if result.Error != gorm.ErrRecordNotFound {
+			if collection.Creator != sender {
+				return NewError(CodeNotAuthorized, "invalid sender, must have launchpad mint reservation or be collection owner")
+			}
+		} else {
+			// if sender is creator and launchpad is not launched yet, allow to pre-mint
+			if collection.Creator == sender && launchpad.StartDate.Valid && launchpad.StartDate.Time.After(transactionModel.DateCreated) {
+				// update minted supply
+				launchpad.MintedSupply += 1
+				result = db.Save(&launchpad)
+				if result.Error != nil {
 					return result.Error
 				}
-
-				if collection.Creator != sender {
-					return fmt.Errorf("invalid sender, must have launchpad mint reservation or be collection owner")
-				}
 			} else {
-				// if sender is creator and launchpad is not launched yet, allow to pre-mint
-				if collection.Creator == sender && launchpad.StartDate.Valid && launchpad.StartDate.Time.After(transactionModel.DateCreated) {
-					// update minted supply
-					launchpad.MintedSupply += 1
-					result = protocol.db.Save(&launchpad)
-					if result.Error != nil {
-						return result.Error
-					}
-				} else {
-					var reservation models.LaunchpadMintReservation
-					result := protocol.db.Where("collection_id = ? and address = ? and is_minted = ?", collection.ID, sender, false).First(&reservation)
-					if result.Error != nil {
-						return fmt.Errorf("invalid sender, must have launchpad mint reservation or be collection owner")
-					}
-
-					// check inscribe tx was executed by minter bot
-					if rawTransaction.Body.Messages[0].Grantee != protocol.MinterBotAddress {
-						return fmt.Errorf("invalid sender, must be minter bot")
-					}
-
-					// mark reservation as minted
-					reservation.IsMinted = true
-
-					result = protocol.db.Save(&reservation)
-					if result.Error != nil {
-						return result.Error
-					}
+				var reservation models.LaunchpadMintReservation
+				result := db.Where("collection_id = ? and address = ? and is_minted = ?", collection.ID, sender, false).First(&reservation)
+				if result.Error != nil {
+					return NewError(CodeNotAuthorized, "invalid sender, must have launchpad mint reservation or be collection owner")
 				}
 
-				// set token_id to inscription
-				inscriptionModel.TokenID = sql.NullInt64{Int64: int64(inscriptionMetadata.Metadata.TokenID), Valid: true}
-
-				// allow multiple inscriptions with the same content hash
-				if contentAlreadyExists {
-					inscriptionModel.ContentHash = fmt.Sprintf("%s-%d", contentHash, inscriptionMetadata.Metadata.TokenID)
+				// check inscribe tx was executed by minter bot
+				if !protocol.executedByMinterBot(rawTransaction, transactionModel.Height) {
+					return NewError(CodeNotAuthorized, "invalid sender, must be minter bot")
 				}
 
-			}
+				// mark reservation as minted
+				reservation.IsMinted = true
 
-			if err != nil {
-				return fmt.Errorf("error getting collection with identifier '%s': %w", inscriptionMetadata.Parent.Identifier, err)
+				result = db.Save(&reservation)
+				if result.Error != nil {
+					return result.Error
+				}
 			}
 
-			// set collection id to the inscription
-			inscriptionModel.CollectionID = sql.NullInt64{Int64: int64(collection.ID), Valid: true}
-			inscriptionModel.Creator = collection.Creator
-		}
-
-		// insert inscription to DB
-		result = protocol.db.Save(&inscriptionModel)
-		if result.Error != nil {
-			return result.Error
-		}
+			// set token_id to inscription
+			inscriptionModel.TokenID = sql.NullInt64{Int64: int64(inscriptionMetadata.Metadata.TokenID), Valid: true}
 
-		inscriptionHistory := models.InscriptionHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        transactionModel.Height,
-			TransactionID: transactionModel.ID,
-			InscriptionID: inscriptionModel.ID,
-			Sender:        "asteroids",
-			Receiver:      sender,
-			Action:        "inscribe",
-			DateCreated:   transactionModel.DateCreated,
-		}
-		// If we fail to save history, that's fine
-		protocol.db.Save(&inscriptionHistory)
-
-		if inscriptionModel.CollectionID.Valid {
-			protocol.workerClient.UpdateCollectionStats(uint64(inscriptionModel.CollectionID.Int64))
-			protocol.workerClient.UpdateCollectionTraits(uint64(inscriptionModel.CollectionID.Int64))
-		}
+			// allow multiple inscriptions with the same content hash
+			if contentAlreadyExists {
+				inscriptionModel.ContentHash = fmt.Sprintf("%s-%d", contentHash, inscriptionMetadata.Metadata.TokenID)
+			}
 
-	case "transfer":
-		if parsedURN.KeyValuePairs["h"] == "" {
-			return fmt.Errorf("missing content hash")
 		}
 
-		txHash := parsedURN.KeyValuePairs["h"]
+		// set collection id to the inscription
+		inscriptionModel.CollectionID = sql.NullInt64{Int64: int64(collection.ID), Valid: true}
+		inscriptionModel.Creator = collection.Creator
+	}
 
-		// Fetch transaction from database with the given hash
-		var transaction models.Transaction
-		result := protocol.db.Where("hash = ?", txHash).First(&transaction)
-		if result.Error != nil {
-			// Invalid hash
-			return result.Error
-		}
+	contentPath, err := protocol.storeContent(db, contentCheck, content)
+	if err != nil {
+		return err
+	}
+	inscriptionModel.ContentPath = contentPath
 
-		// Fetch the inscription for this transaction ID
-		var inscription models.Inscription
-		result = protocol.db.Where("transaction_id = ?", transaction.ID).First(&inscription)
-		if result.Error != nil {
-			// Invalid transaction ID
-			return result.Error
-		}
+	// insert inscription to DB
+	result = db.Save(&inscriptionModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-		// Check that the sender is the current owner
-		if inscription.CurrentOwner != sender {
-			return fmt.Errorf("invalid sender, must be current owner")
-		}
+	inscriptionHistory := models.InscriptionHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        transactionModel.Height,
+		TransactionID: transactionModel.ID,
+		InscriptionID: inscriptionModel.ID,
+		Sender:        "asteroids",
+		Receiver:      sender,
+		Action:        "inscribe",
+		DateCreated:   transactionModel.DateCreated,
+	}
+	// If we fail to save history, that's fine
+	db.Save(&inscriptionHistory)
 
-		// All good, transfer
-		destinationAddress := strings.TrimSpace(parsedURN.KeyValuePairs["dst"])
-		destinationAddress = strings.ToLower(destinationAddress)
-		inscription.CurrentOwner = destinationAddress
-		result = protocol.db.Save(&inscription)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update inscription owner '%s'", result.Error)
-		}
+	eventData := EventData{
+		"inscription_id":   inscriptionModel.ID,
+		"inscription_hash": transactionModel.Hash,
+		"content_hash":     inscriptionModel.ContentHash,
+		"creator":          inscriptionModel.Creator,
+		"owner":            inscriptionModel.CurrentOwner,
+	}
+	if inscriptionModel.CollectionID.Valid {
+		eventData["collection_id"] = inscriptionModel.CollectionID.Int64
+	}
+	err = emitEvent(db, transactionModel, EventInscriptionInscribe, eventData)
+	if err != nil {
+		return err
+	}
 
-		inscriptionHistory := models.InscriptionHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        transactionModel.Height,
-			TransactionID: transactionModel.ID,
-			InscriptionID: inscription.ID,
-			Sender:        sender,
-			Receiver:      destinationAddress,
-			Action:        "transfer",
-			DateCreated:   transactionModel.DateCreated,
-		}
-		// If we fail to save history, that's fine
-		protocol.db.Save(&inscriptionHistory)
-	case "migrate":
-		if err := protocol.RequiresV2(parsedURN.Version); err != nil {
+	if contentPath != "" {
+		err = protocol.workerClient.GeneratePreview(db, "inscription", inscriptionModel.ID)
+		if err != nil {
 			return err
 		}
-
-		return protocol.Migrate(rawTransaction, sender)
-	case "update-collection":
-		if err := protocol.RequiresV2(parsedURN.Version); err != nil {
+	}
+	if inscriptionModel.CollectionID.Valid {
+		err = protocol.workerClient.UpdateCollectionStats(db, uint64(inscriptionModel.CollectionID.Int64))
+		if err != nil {
 			return err
 		}
-
-		return protocol.UpdateCollection(parsedURN, rawTransaction, sender)
-	case "grant-migration-permission":
-		if err := protocol.RequiresV2(parsedURN.Version); err != nil {
+		err = protocol.workerClient.UpdateCollectionTraits(db, uint64(inscriptionModel.CollectionID.Int64))
+		if err != nil {
 			return err
 		}
+	}
 
-		if parsedURN.KeyValuePairs["h"] == "" {
-			return fmt.Errorf("missing inscription hash")
-		}
+	return nil
+}
 
-		if parsedURN.KeyValuePairs["grantee"] == "" {
-			return fmt.Errorf("missing grantee")
-		}
+// storeContent stores content with its detected mime type once the
+// inscription is known to be valid, so rejected inscriptions leave no content
+// behind. The store is keyed by the content itself, so identical content is
+// only stored once and a claimed hash never shares the content of another
+// inscription
+func (protocol *Inscription) storeContent(db *gorm.DB, contentCheck contentpolicy.Result, content []byte) (string, error) {
+	contentPath, err := contentstore.Store(db.Statement.Context, protocol.contentStore, contentCheck.StoreType, content)
+	if err != nil {
+		return "", NewError(CodeInternal, "unable to store content '%s'", err)
+	}
+	return contentPath, nil
+}
 
-		inscriptionHash := parsedURN.KeyValuePairs["h"]
-		grantee := strings.TrimSpace(parsedURN.KeyValuePairs["grantee"])
+// processTransfer handles the transfer operation
+func (protocol *Inscription) processTransfer(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	txHash := parsedURN.KeyValuePairs["h"]
 
-		return protocol.GrantMigrationPermission(transactionModel, inscriptionHash, grantee, sender)
+	// Fetch transaction from database with the given hash
+	var transaction models.Transaction
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chainID, txHash).First(&transaction)
+	if result.Error != nil {
+		// Invalid hash
+		return result.Error
 	}
-	return nil
-}
 
-// storeContent stores the content in the S3 bucket
-func (protocol *Inscription) StoreContent(mimeType string, txHash string, content []byte) (string, error) {
-	if protocol.s3Endpoint == "" {
-		return "", nil
+	// Fetch the inscription for this transaction ID
+	var inscription models.Inscription
+	result = db.Where("transaction_id = ?", transaction.ID).First(&inscription)
+	if result.Error != nil {
+		// Invalid transaction ID
+		return result.Error
 	}
 
-	ext, err := mime.ExtensionsByType(mimeType)
-	if err != nil {
-		// We could not find the mime type, so we default to .bin
-		ext = []string{".bin"}
-	}
-	if len(ext) == 0 {
-		// We could not find the mime type, so we default to .bin
-		ext = []string{".bin"}
-	}
-	// The mimetype gives us ".markdown" as extension when it should be .md
-	if ext[0] == ".markdown" {
-		ext[0] = ".md"
-	}
-
-	endpoint := protocol.s3Endpoint
-	region := protocol.s3Region
-	sess := session.Must(session.NewSession(&aws.Config{
-		Endpoint:    &endpoint,
-		Region:      &region,
-		Credentials: credentials.NewStaticCredentials(protocol.s3ID, protocol.s3Secret, protocol.s3Token),
-	}))
-
-	// Create an uploader with the session and default options
-	uploader := s3manager.NewUploader(sess)
-
-	// Upload the file to an S3 compatible bucket
-	myBucket := protocol.s3Bucket
-	filename := txHash + ext[0]
-	uploadResult, err := uploader.Upload(&s3manager.UploadInput{
-		ACL:         aws.String("public-read"),
-		Bucket:      aws.String(myBucket),
-		Key:         aws.String(filename),
-		Body:        bytes.NewReader(content),
-		ContentType: aws.String(mimeType),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload file, %v", err)
+	// Check that the sender is the current owner
+	if inscription.CurrentOwner != sender {
+		return NewError(CodeNotOwner, "invalid sender, must be current owner")
+	}
+
+	// All good, transfer
+	destinationAddress := strings.TrimSpace(parsedURN.KeyValuePairs["dst"])
+	destinationAddress = strings.ToLower(destinationAddress)
+	inscription.CurrentOwner = destinationAddress
+	result = db.Save(&inscription)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update inscription owner '%s'", result.Error)
 	}
 
-	return aws.StringValue(&uploadResult.Location), nil
+	inscriptionHistory := models.InscriptionHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        transactionModel.Height,
+		TransactionID: transactionModel.ID,
+		InscriptionID: inscription.ID,
+		Sender:        sender,
+		Receiver:      destinationAddress,
+		Action:        "transfer",
+		DateCreated:   transactionModel.DateCreated,
+	}
+	// If we fail to save history, that's fine
+	db.Save(&inscriptionHistory)
+
+	return emitEvent(db, transactionModel, EventInscriptionTransfer, EventData{
+		"inscription_id":   inscription.ID,
+		"inscription_hash": txHash,
+		"sender":           sender,
+		"receiver":         destinationAddress,
+	})
+}
+
+// processMigrate handles the migrate operation
+func (protocol *Inscription) processMigrate(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	return protocol.Migrate(db, rawTransaction, sender)
+}
+
+// processUpdateCollection handles the update-collection operation
+func (protocol *Inscription) processUpdateCollection(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	return protocol.UpdateCollection(db, parsedURN, rawTransaction, sender)
+}
+
+// processGrantMigrationPermission handles the grant-migration-permission operation
+func (protocol *Inscription) processGrantMigrationPermission(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	inscriptionHash := parsedURN.KeyValuePairs["h"]
+	grantee := strings.TrimSpace(parsedURN.KeyValuePairs["grantee"])
+
+	return protocol.GrantMigrationPermission(db, transactionModel, inscriptionHash, grantee, sender)
 }
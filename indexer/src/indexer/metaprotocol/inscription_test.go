@@ -0,0 +1,87 @@
+package metaprotocol
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInscribeContentHash(t *testing.T) {
+	db := newTestDB(t, &models.Transaction{}, &models.Collection{}, &models.Launchpad{}, &models.Inscription{}, &models.InscriptionHistory{}, &models.EventOutbox{})
+	store := contentstore.NewMemoryStore()
+	protocol := &Inscription{chainID: "cosmoshub-4", contentHashEnforceHeight: 100, contentStore: store}
+	content := "content"
+	wrongHash := types.ContentHash([]byte("other content"))
+	parsedURN := ProtocolURN{ChainID: "cosmoshub-4", Version: "v2", KeyValuePairs: map[string]string{"h": wrongHash}}
+
+	// Mismatches are rejected from the enforcement height, before the content
+	// is stored
+	rawTransaction := decodePartTransaction(t, `{"metadata": {"mime": "text/plain"}}`, content)
+	err := protocol.processInscribe(db, models.Transaction{ChainID: "cosmoshub-4", Height: 100}, parsedURN, rawTransaction, "cosmos1sender")
+	code, details := ErrorCodeOf(err)
+	assert.Equal(t, CodeContentHashMismatch, code)
+	assert.Equal(t, types.ContentHash([]byte(content)), details["computed_hash"])
+	assert.Zero(t, store.Writes, "rejected content should not be stored")
+
+	// Before the enforcement height the mismatch is flagged
+	err = protocol.processInscribe(db, models.Transaction{ID: 1, ChainID: "cosmoshub-4", Height: 99}, parsedURN, rawTransaction, "cosmos1sender")
+	assert.NoError(t, err)
+	var inscription models.Inscription
+	assert.NoError(t, db.Where("transaction_id = ?", 1).First(&inscription).Error)
+	assert.True(t, inscription.IsHashMismatch)
+	assert.Equal(t, types.ContentHash([]byte(content)), inscription.ComputedHash.String)
+	assert.Equal(t, 1, store.Writes)
+}
+
+func TestInscribeDuplicateContent(t *testing.T) {
+	db := newTestDB(t, &models.Transaction{}, &models.Collection{}, &models.Launchpad{}, &models.LaunchpadMintReservation{}, &models.Inscription{}, &models.InscriptionHistory{}, &models.EventOutbox{})
+	store := contentstore.NewMemoryStore()
+	protocol := &Inscription{chainID: "cosmoshub-4", contentHashEnforceHeight: 100, contentStore: store}
+
+	collectionTransaction := models.Transaction{ChainID: "cosmoshub-4", Hash: "COLLECTION"}
+	assert.NoError(t, db.Create(&collectionTransaction).Error)
+	collection := models.Collection{ChainID: "cosmoshub-4", TransactionID: collectionTransaction.ID, ContentHash: "collection", Creator: "cosmos1creator"}
+	assert.NoError(t, db.Create(&collection).Error)
+	// The creator may mint before the launch
+	assert.NoError(t, db.Create(&models.Launchpad{CollectionID: collection.ID, StartDate: sql.NullTime{Time: time.Now(), Valid: true}}).Error)
+	contentHash := types.ContentHash([]byte("content"))
+	assert.NoError(t, db.Create(&models.Inscription{ChainID: "cosmoshub-4", TransactionID: 100, ContentHash: contentHash}).Error)
+
+	// Content that is inscribed again under another declared hash is matched
+	// on its computed hash
+	parsedURN := ProtocolURN{ChainID: "cosmoshub-4", Version: "v2", KeyValuePairs: map[string]string{"h": "declared"}}
+	rawTransaction := decodePartTransaction(t, `{"parent": {"type": "/collection", "identifier": "COLLECTION"}, "metadata": {"mime": "text/plain", "token_id": 7}}`, "content")
+	assert.NoError(t, db.Model(&models.Inscription{}).Where("transaction_id = ?", 100).Update("computed_hash", contentHash).Error)
+	err := protocol.processInscribe(db, models.Transaction{ID: 2, ChainID: "cosmoshub-4", Height: 99}, parsedURN, rawTransaction, "cosmos1creator")
+	assert.NoError(t, err)
+
+	var inscription models.Inscription
+	assert.NoError(t, db.Where("transaction_id = ?", 2).First(&inscription).Error)
+	assert.Equal(t, "declared-7", inscription.ContentHash, "duplicate content in a collection should get the token ID appended")
+
+	// Unauthorized inscriptions don't store their content
+	writes := store.Writes
+	rawTransaction = decodePartTransaction(t, `{"parent": {"type": "/collection", "identifier": "COLLECTION"}, "metadata": {"mime": "text/plain"}}`, "new content")
+	parsedURN.KeyValuePairs["h"] = types.ContentHash([]byte("new content"))
+	err = protocol.processInscribe(db, models.Transaction{ID: 3, ChainID: "cosmoshub-4", Height: 100}, parsedURN, rawTransaction, "cosmos1other")
+	code, _ := ErrorCodeOf(err)
+	assert.Equal(t, CodeNotAuthorized, code)
+	assert.Equal(t, writes, store.Writes, "content of unauthorized inscriptions should not be stored")
+}
+
+func TestInscribeUnknownCollection(t *testing.T) {
+	db := newTestDB(t, &models.Transaction{}, &models.Collection{}, &models.Launchpad{}, &models.Inscription{}, &models.InscriptionHistory{}, &models.EventOutbox{})
+	protocol := &Inscription{chainID: "cosmoshub-4", contentStore: contentstore.NewMemoryStore()}
+
+	parsedURN := ProtocolURN{ChainID: "cosmoshub-4", Version: "v2", KeyValuePairs: map[string]string{"h": types.ContentHash([]byte("content"))}}
+	rawTransaction := decodePartTransaction(t, `{"parent": {"type": "/collection", "identifier": "MISSING"}, "metadata": {"mime": "text/plain"}}`, "content")
+	err := protocol.processInscribe(db, models.Transaction{ID: 1, ChainID: "cosmoshub-4", Height: 100}, parsedURN, rawTransaction, "cosmos1sender")
+	code, details := ErrorCodeOf(err)
+	assert.Equal(t, CodeCollectionNotFound, code, "an unknown parent collection should be rejected")
+	assert.Equal(t, "MISSING", details["collection"])
+}
@@ -3,8 +3,8 @@ package metaprotocol
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
@@ -12,14 +12,13 @@ import (
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/leodido/go-urn"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type Launchpad struct {
 	chainID        string
-	db             *gorm.DB
+	chain          Chain
 	inscription    *Inscription
 	Allowlist      []string
 	MintingEnabled bool
@@ -30,7 +29,7 @@ type LaunchpadConfig struct {
 	MintingEnabled bool     `envconfig:"LAUNCHPAD_MINTING_ENABLED" default:"false"`
 }
 
-func NewLaunchpadProcessor(chainID string, db *gorm.DB, inscription *Inscription) *Launchpad {
+func NewLaunchpadProcessor(chain Chain, inscription *Inscription) *Launchpad {
 	// Parse config environment variables for self
 	var config LaunchpadConfig
 	err := envconfig.Process("", &config)
@@ -39,8 +38,8 @@ func NewLaunchpadProcessor(chainID string, db *gorm.DB, inscription *Inscription
 	}
 
 	return &Launchpad{
-		chainID:        chainID,
-		db:             db,
+		chainID:        chain.ID,
+		chain:          chain,
 		inscription:    inscription,
 		Allowlist:      config.Allowlist,
 		MintingEnabled: config.MintingEnabled,
@@ -51,54 +50,49 @@ func (protocol *Launchpad) Name() string {
 	return "Launchpad"
 }
 
-func (protocol *Launchpad) Process(transactionModel models.Transaction, protocolURN *urn.URN, rawTransaction types.RawTransaction, sourceChannel string) error {
-	sender, err := rawTransaction.GetSenderAddress()
-	if err != nil {
-		return err
-	}
-
-	// We need to parse the protocol specific string in SS, it contains
-	// {chainId}@{version};operation$h={unique hash of content}
-	// cosmoshub-4@v1beta;inscribe$h=c4749f95902411d1a45a033d8a6b3e6aa0de0a0028fe8737f66fed6834dce8bf
-	parsedURN, err := ParseProtocolString(protocolURN)
-	if err != nil {
-		return err
-	}
-
-	if parsedURN.ChainID != protocol.chainID {
-		return fmt.Errorf("invalid chain ID '%s'", parsedURN.ChainID)
+func (protocol *Launchpad) Operations() []Operation {
+	return []Operation{
+		{
+			Name:    "launch",
+			Fields:  []Field{{Key: "h", Type: FieldString}},
+			Handler: protocol.LaunchCollection,
+		},
+		{
+			Name: "reserve",
+			Fields: []Field{
+				{Key: "h", Type: FieldString},
+				{Key: "stg", Type: FieldUint},
+				{Key: "amt", Type: FieldUint},
+			},
+			Handler: protocol.ReserveInscription,
+		},
+		{
+			Name:    "update",
+			Fields:  []Field{{Key: "h", Type: FieldString}},
+			Handler: protocol.UpdateLaunch,
+		},
 	}
-
-	switch parsedURN.Operation {
-	case "launch":
-		return protocol.LaunchCollection(transactionModel, parsedURN, rawTransaction, sender)
-	case "reserve":
-		return protocol.ReserveInscription(transactionModel, parsedURN, rawTransaction, sender)
-	case "update":
-		return protocol.UpdateLaunch(transactionModel, parsedURN, rawTransaction, sender)
-	}
-	return nil
 }
 
-func (protocol *Launchpad) ReserveInscriptionInternal(transactionModel models.Transaction, rawTransaction types.RawTransaction, sender string, launchpad models.Launchpad, stageID uint64, amount uint64, isRandom bool) error {
+func (protocol *Launchpad) ReserveInscriptionInternal(db *gorm.DB, transactionModel models.Transaction, rawTransaction types.Transaction, sender string, launchpad models.Launchpad, stageID uint64, amount uint64, isRandom bool) error {
 
 	// get stage
 	var stage models.LaunchpadStage
 	var result *gorm.DB
 	if stageID == 0 {
 		// get first stage
-		result = protocol.db.Where("launchpad_id = ?", launchpad.ID).First(&stage)
+		result = db.Where("launchpad_id = ?", launchpad.ID).First(&stage)
 	} else {
-		result = protocol.db.Where("launchpad_id = ? AND id = ?", launchpad.ID, stageID).First(&stage)
+		result = db.Where("launchpad_id = ? AND id = ?", launchpad.ID, stageID).First(&stage)
 
 	}
 	if result.Error != nil {
-		return fmt.Errorf("stage not found")
+		return NewError(CodeStageNotFound, "stage not found")
 	}
 
 	// check supply
 	if launchpad.MaxSupply > 0 && launchpad.MintedSupply >= launchpad.MaxSupply {
-		return fmt.Errorf("launchpad minted out")
+		return NewError(CodeMintedOut, "launchpad minted out")
 	}
 	var amountToMint uint64
 	if launchpad.MaxSupply > 0 {
@@ -109,44 +103,47 @@ func (protocol *Launchpad) ReserveInscriptionInternal(transactionModel models.Tr
 
 	// check if stage is active
 	if stage.StartDate.Valid && stage.StartDate.Time.After(transactionModel.DateCreated) {
-		return fmt.Errorf("stage not active yet")
+		return NewError(CodeMintNotOpen, "stage not active yet")
 	}
 
 	if stage.FinishDate.Valid && stage.FinishDate.Time.Before(transactionModel.DateCreated) {
-		return fmt.Errorf("stage already finished")
+		return NewError(CodeMintClosed, "stage already finished")
 	}
 
 	// check if user is whitelisted
 	if stage.HasWhitelist {
 		var count int64
-		protocol.db.Model(&models.LaunchpadWhitelist{}).Where("launchpad_id = ? AND stage_id = ? AND address = ?", launchpad.ID, stage.ID, sender).Count(&count)
+		db.Model(&models.LaunchpadWhitelist{}).Where("launchpad_id = ? AND stage_id = ? AND address = ?", launchpad.ID, stage.ID, sender).Count(&count)
 		if count == 0 {
-			return fmt.Errorf("user not whitelisted")
+			return NewError(CodeNotWhitelisted, "user not whitelisted")
 		}
 	}
 
 	// check per user limit
 	if stage.PerUserLimit > 0 {
 		var count int64
-		protocol.db.Model(&models.LaunchpadMintReservation{}).Where("launchpad_id = ? AND stage_id = ? AND address = ?", launchpad.ID, stage.ID, sender).Count(&count)
+		db.Model(&models.LaunchpadMintReservation{}).Where("launchpad_id = ? AND stage_id = ? AND address = ?", launchpad.ID, stage.ID, sender).Count(&count)
 		if count >= stage.PerUserLimit {
-			return fmt.Errorf("user reached per user limit")
+			return NewError(CodeMintLimitReached, "user reached per user limit")
 		}
 		amountToMint = min(amountToMint, uint64(stage.PerUserLimit)-uint64(count))
 	}
 
-	// @todo check user send enough funds to pay for mint and fee
+	err := protocol.checkStagePayment(db, transactionModel, rawTransaction, launchpad, stage, amountToMint)
+	if err != nil {
+		return err
+	}
 
 	// get token id
 	var maxTokenId uint64
-	err := protocol.db.Model(&models.LaunchpadMintReservation{}).Select("COALESCE(MAX(token_id), 0)").Where("launchpad_id = ?", launchpad.ID).Scan(&maxTokenId).Error
+	err = db.Model(&models.LaunchpadMintReservation{}).Select("COALESCE(MAX(token_id), 0)").Where("launchpad_id = ?", launchpad.ID).Scan(&maxTokenId).Error
 	if err != nil {
 		return err
 	}
 
 	// get metadata
 	// get launch metadata from non_critical_extension_options
-	msg, err := rawTransaction.Body.GetExtensionMessage()
+	msg, err := getExtensionMessage(rawTransaction)
 	var metadataBytes []byte
 	if err == nil {
 		metadataBytes, err = msg.GetMetadataBytes()
@@ -156,7 +153,7 @@ func (protocol *Launchpad) ReserveInscriptionInternal(transactionModel models.Tr
 	}
 
 	if amountToMint < 1 {
-		return fmt.Errorf("nothing to mint")
+		return NewError(CodeInvalidField, "nothing to mint").With("field", "amt")
 	}
 
 	for i := uint64(0); i < amountToMint; i++ {
@@ -176,15 +173,26 @@ func (protocol *Launchpad) ReserveInscriptionInternal(transactionModel models.Tr
 			reservation.Metadata = datatypes.JSON(metadataBytes)
 		}
 
-		result = protocol.db.Save(&reservation)
+		result = db.Save(&reservation)
 
 		if result.Error != nil {
 			return result.Error
 		}
 
+		err = emitEvent(db, transactionModel, EventLaunchpadReservation, EventData{
+			"launchpad_id":  launchpad.ID,
+			"collection_id": launchpad.CollectionID,
+			"stage_id":      stage.ID,
+			"address":       sender,
+			"token_id":      tokenId,
+		})
+		if err != nil {
+			return err
+		}
+
 		// update minted supply
 		launchpad.MintedSupply += 1
-		result = protocol.db.Save(&launchpad)
+		result = db.Save(&launchpad)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -194,25 +202,58 @@ func (protocol *Launchpad) ReserveInscriptionInternal(transactionModel models.Tr
 	return nil
 }
 
-func (protocol *Launchpad) ReserveInscription(transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.RawTransaction, sender string) error {
+// checkStagePayment checks that the price of amount reservations in a fixed
+// price stage was paid to the collection. Payments are only checked from the
+// message rules height, linear stages are created by the troll box without a
+// price formula and are not checked
+func (protocol *Launchpad) checkStagePayment(db *gorm.DB, transactionModel models.Transaction, rawTransaction types.Transaction, launchpad models.Launchpad, stage models.LaunchpadStage, amount uint64) error {
+	if !protocol.chain.messageRules(transactionModel.Height) || stage.PriceCurve != models.Fixed || stage.Price == 0 || amount == 0 {
+		return nil
+	}
+	if amount > math.MaxUint64/stage.Price {
+		return NewError(CodeInvalidField, "price of %d reservations overflows", amount).With("field", "amt")
+	}
+	expectedAmount := stage.Price * amount
+
+	var collection models.Collection
+	result := db.Where("id = ?", launchpad.CollectionID).First(&collection)
+	if result.Error != nil {
+		return NewError(CodeCollectionNotFound, "collection not found")
+	}
+	receiver := collection.Creator
+	if collection.PaymentAddress.Valid && collection.PaymentAddress.String != "" {
+		receiver = collection.PaymentAddress.String
+	}
+
+	amountSent, err := GetBaseTokensSent(rawTransaction, protocol.chain, transactionModel.Height, receiver, Send)
+	if err != nil {
+		return err
+	}
+	if amountSent < expectedAmount {
+		return NewError(CodeInsufficientPayment, "sender did not send enough tokens, amount sent: %d, amount expected %d", amountSent, expectedAmount).With("amount", amountSent).With("expected_amount", expectedAmount)
+	}
+	return nil
+}
+
+func (protocol *Launchpad) ReserveInscription(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
 	if !protocol.MintingEnabled {
-		return fmt.Errorf("minting is disabled")
+		return NewError(CodeMintDisabled, "minting is disabled")
 	}
 
 	// validate launchpad hash
 	launchpadHash := parsedURN.KeyValuePairs["h"]
 	if launchpadHash == "" {
-		return fmt.Errorf("missing launchpad hash")
+		return NewError(CodeInvalidField, "missing launchpad hash").With("field", "launchpad")
 	}
 
 	// validate stage id
 	stageIDString := parsedURN.KeyValuePairs["stg"]
 	if parsedURN.KeyValuePairs["stg"] == "" {
-		return fmt.Errorf("missing stage id")
+		return NewError(CodeInvalidField, "missing stage id").With("field", "stage")
 	}
 	stageID, err := strconv.ParseUint(stageIDString, 10, 64)
 	if err != nil {
-		return fmt.Errorf("unable to parse stage id '%s'", err)
+		return NewError(CodeInvalidField, "unable to parse stage id '%s'", err).With("field", "stage")
 	}
 
 	// Check required fields
@@ -220,7 +261,7 @@ func (protocol *Launchpad) ReserveInscription(transactionModel models.Transactio
 	// Convert amount to have the correct number of decimals
 	amount, err := strconv.ParseUint(amountString, 10, 64)
 	if err != nil {
-		return fmt.Errorf("unable to parse amount '%s'", err)
+		return NewError(CodeInvalidField, "unable to parse amount '%s'", err).With("field", "amt")
 	}
 	if amount <= 0 {
 		amount = 1
@@ -231,48 +272,48 @@ func (protocol *Launchpad) ReserveInscription(transactionModel models.Transactio
 	// get launchpad
 	// Fetch transaction from database with the given hash
 	var transaction models.Transaction
-	result := protocol.db.Where("hash = ?", launchpadHash).First(&transaction)
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chainID, launchpadHash).First(&transaction)
 	if result.Error != nil {
 		// Invalid hash
 		return result.Error
 	}
 
 	var launchpad models.Launchpad
-	result = protocol.db.Where("transaction_id = ?", transaction.ID).First(&launchpad)
+	result = db.Where("transaction_id = ?", transaction.ID).First(&launchpad)
 	if result.Error != nil {
-		return fmt.Errorf("launchpad not found")
+		return NewError(CodeLaunchpadNotFound, "launchpad not found")
 	}
 
-	return protocol.ReserveInscriptionInternal(transactionModel, rawTransaction, sender, launchpad, stageID, amount, launchpad.MaxSupply > 0)
+	return protocol.ReserveInscriptionInternal(db, transactionModel, rawTransaction, sender, launchpad, stageID, amount, launchpad.MaxSupply > 0)
 }
 
-func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.RawTransaction, sender string) error {
+func (protocol *Launchpad) UpdateLaunch(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
 	// check if sender is allowed to update
 	if !protocol.MintingEnabled && !slices.Contains(protocol.Allowlist, sender) {
-		return fmt.Errorf("sender not allowed to update")
+		return NewError(CodeNotAuthorized, "sender not allowed to update")
 	}
 
 	// validate collection hash
 	collectionHash := parsedURN.KeyValuePairs["h"]
 	if collectionHash == "" {
-		return fmt.Errorf("missing collection hash")
+		return NewError(CodeInvalidField, "missing collection hash").With("field", "collection")
 	}
 
 	// get collection
-	collection, err := protocol.inscription.GetCollection(collectionHash, sender, true)
+	collection, err := protocol.inscription.GetCollection(db, collectionHash, sender, true)
 	if err != nil {
 		return err
 	}
 
 	// get launchpad
 	var launchpad models.Launchpad
-	result := protocol.db.Where("collection_id = ?", collection.ID).First(&launchpad)
+	result := db.Where("collection_id = ?", collection.ID).First(&launchpad)
 	if result.Error != nil {
-		return fmt.Errorf("launchpad not found")
+		return NewError(CodeLaunchpadNotFound, "launchpad not found")
 	}
 
 	// get launch metadata from non_critical_extension_options
-	msg, err := rawTransaction.Body.GetExtensionMessage()
+	msg, err := getExtensionMessage(rawTransaction)
 	if err != nil {
 		return err
 	}
@@ -285,7 +326,7 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 
 	err = json.Unmarshal(jsonBytes, &launchMetadata)
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal metadata '%s'", err)
+		return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
 	}
 
 	// get start and finish launchpad dates from stages
@@ -301,7 +342,7 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 		launchpad.RevealDate = sql.NullTime{Time: launchMetadata.RevealDate, Valid: true}
 	}
 
-	result = protocol.db.Save(&launchpad)
+	result = db.Save(&launchpad)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -317,9 +358,9 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 				PriceCurve:   models.Fixed,
 			}
 		} else {
-			result := protocol.db.Where("launchpad_id = ? AND id = ?", launchpad.ID, stage.ID).First(&launchpadStage)
+			result := db.Where("launchpad_id = ? AND id = ?", launchpad.ID, stage.ID).First(&launchpadStage)
 			if result.Error != nil {
-				return fmt.Errorf("stage not found")
+				return NewError(CodeStageNotFound, "stage not found")
 			}
 		}
 
@@ -347,7 +388,7 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 			launchpadStage.FinishDate = sql.NullTime{Time: stage.Finish, Valid: true}
 		}
 
-		result = protocol.db.Save(&launchpadStage)
+		result = db.Save(&launchpadStage)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -356,7 +397,7 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 
 		// update whitelists
 		// delete all existing whitelists
-		result = protocol.db.Where("launchpad_id = ? AND stage_id = ?", launchpad.ID, launchpadStage.ID).Delete(&models.LaunchpadWhitelist{})
+		result = db.Where("launchpad_id = ? AND stage_id = ?", launchpad.ID, launchpadStage.ID).Delete(&models.LaunchpadWhitelist{})
 		if result.Error != nil {
 			return result.Error
 		}
@@ -370,7 +411,7 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 				Address:      whitelist,
 			}
 
-			result := protocol.db.Save(&launchpadWhitelist)
+			result := db.Save(&launchpadWhitelist)
 			if result.Error != nil {
 				return result.Error
 			}
@@ -379,7 +420,7 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 
 	// delete stage if not in metadata
 	var stages []models.LaunchpadStage
-	result = protocol.db.Where("launchpad_id = ?", launchpad.ID).Find(&stages)
+	result = db.Where("launchpad_id = ?", launchpad.ID).Find(&stages)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -394,7 +435,7 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 		}
 
 		if !found {
-			result = protocol.db.Delete(&stage)
+			result = db.Delete(&stage)
 			if result.Error != nil {
 				return result.Error
 			}
@@ -404,40 +445,40 @@ func (protocol *Launchpad) UpdateLaunch(transactionModel models.Transaction, par
 	return nil
 }
 
-func (protocol *Launchpad) LaunchCollection(transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.RawTransaction, sender string) error {
+func (protocol *Launchpad) LaunchCollection(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
 	// check if sender is allowed to launch
 	if !protocol.MintingEnabled && !slices.Contains(protocol.Allowlist, sender) {
-		return fmt.Errorf("sender not allowed to launch")
+		return NewError(CodeNotAuthorized, "sender not allowed to launch")
 	}
 
 	// validate collection hash
 	if parsedURN.KeyValuePairs["h"] == "" {
-		return fmt.Errorf("missing collection hash")
+		return NewError(CodeInvalidField, "missing collection hash").With("field", "collection")
 	}
 
 	collectionHash := parsedURN.KeyValuePairs["h"]
 
 	// get collection
-	collection, err := protocol.inscription.GetCollection(collectionHash, sender, true)
+	collection, err := protocol.inscription.GetCollection(db, collectionHash, sender, true)
 	if err != nil {
 		return err
 	}
 
 	// check if collection doesn't already have a launchpad or inscriptions
 	var launchpad models.Launchpad
-	result := protocol.db.Where("collection_id = ?", collection.ID).First(&launchpad)
+	result := db.Where("collection_id = ?", collection.ID).First(&launchpad)
 	if result.Error == nil {
-		return fmt.Errorf("collection already has a launchpad")
+		return NewError(CodeLaunchpadExists, "collection already has a launchpad")
 	}
 
 	var count int64
-	protocol.db.Model(&models.Inscription{}).Where("collection_id = ?", collection.ID).Count(&count)
+	db.Model(&models.Inscription{}).Where("collection_id = ?", collection.ID).Count(&count)
 	if count > 0 {
-		return fmt.Errorf("collection already has inscriptions")
+		return NewError(CodeCollectionNotEmpty, "collection already has inscriptions")
 	}
 
 	// get launch metadata from non_critical_extension_options
-	msg, err := rawTransaction.Body.GetExtensionMessage()
+	msg, err := getExtensionMessage(rawTransaction)
 	if err != nil {
 		return err
 	}
@@ -450,7 +491,7 @@ func (protocol *Launchpad) LaunchCollection(transactionModel models.Transaction,
 
 	err = json.Unmarshal(jsonBytes, &launchMetadata)
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal metadata '%s'", err)
+		return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
 	}
 
 	// get start and finish launchpad dates from stages
@@ -475,7 +516,7 @@ func (protocol *Launchpad) LaunchCollection(transactionModel models.Transaction,
 		launchpad.RevealDate = sql.NullTime{Time: launchMetadata.RevealDate, Valid: true}
 	}
 
-	result = protocol.db.Save(&launchpad)
+	result = db.Save(&launchpad)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -507,7 +548,7 @@ func (protocol *Launchpad) LaunchCollection(transactionModel models.Transaction,
 			launchpadStage.FinishDate = sql.NullTime{Time: stage.Finish, Valid: true}
 		}
 
-		result := protocol.db.Save(&launchpadStage)
+		result := db.Save(&launchpadStage)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -521,7 +562,7 @@ func (protocol *Launchpad) LaunchCollection(transactionModel models.Transaction,
 				Address:      whitelist,
 			}
 
-			result := protocol.db.Save(&launchpadWhitelist)
+			result := db.Save(&launchpadWhitelist)
 			if result.Error != nil {
 				return result.Error
 			}
@@ -0,0 +1,42 @@
+package metaprotocol
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStagePayment(t *testing.T) {
+	db := newTestDB(t, &models.Collection{})
+	collection := models.Collection{Creator: "cosmos1creator", PaymentAddress: sql.NullString{String: "cosmos1payment", Valid: true}}
+	assert.NoError(t, db.Create(&collection).Error)
+
+	protocol := &Launchpad{chain: Chain{BaseDenom: "uatom", MessageRulesHeight: 100}}
+	launchpad := models.Launchpad{CollectionID: collection.ID}
+	stage := models.LaunchpadStage{Price: 100, PriceCurve: models.Fixed}
+
+	// The payment may be split across several sends to the payment address
+	rawTransaction := decodeTransaction(t, `
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1minter", "to_address": "cosmos1payment", "amount": [{"denom": "uatom", "amount": "120"}]},
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1minter", "to_address": "cosmos1payment", "amount": [{"denom": "uatom", "amount": "80"}]}`)
+	assert.NoError(t, protocol.checkStagePayment(db, models.Transaction{Height: 100}, rawTransaction, launchpad, stage, 2))
+
+	err := protocol.checkStagePayment(db, models.Transaction{Height: 100}, rawTransaction, launchpad, stage, 3)
+	code, details := ErrorCodeOf(err)
+	assert.Equal(t, CodeInsufficientPayment, code)
+	assert.Equal(t, uint64(300), details["expected_amount"])
+
+	// Payments to the creator don't count when a payment address is set
+	rawTransaction = decodeTransaction(t, `{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1minter", "to_address": "cosmos1creator", "amount": [{"denom": "uatom", "amount": "100"}]}`)
+	err = protocol.checkStagePayment(db, models.Transaction{Height: 100}, rawTransaction, launchpad, stage, 1)
+	code, _ = ErrorCodeOf(err)
+	assert.Equal(t, CodeInvalidPayment, code)
+
+	// Reservations before the message rules height, in free stages and in
+	// linear stages are not paid
+	assert.NoError(t, protocol.checkStagePayment(db, models.Transaction{Height: 99}, rawTransaction, launchpad, stage, 1))
+	assert.NoError(t, protocol.checkStagePayment(db, models.Transaction{Height: 100}, rawTransaction, launchpad, models.LaunchpadStage{PriceCurve: models.Fixed}, 1))
+	assert.NoError(t, protocol.checkStagePayment(db, models.Transaction{Height: 100}, rawTransaction, launchpad, models.LaunchpadStage{Price: 1000, PriceCurve: models.Linear}, 1))
+}
@@ -2,18 +2,17 @@ package metaprotocol
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"math"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/endpoints"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/worker"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/leodido/go-urn"
 	"gorm.io/gorm"
 )
 
@@ -22,31 +21,21 @@ type MarketplaceConfig struct {
 	MinimumDeposit       float64 `envconfig:"MARKET_MIN_DEPOSIT" required:"true"`
 	MinimumTradeSize     float64 `envconfig:"MARKET_MIN_TRADE" required:"true"`
 	TradeFee             float64 `envconfig:"MARKET_TRADE_FEE" required:"true"`
-
-	LCDEndpoints    []string          `envconfig:"LCD_ENDPOINTS" required:"true"`
-	EndpointHeaders map[string]string `envconfig:"ENDPOINT_HEADERS" required:"true"`
-	IbcEnabled      bool              `envconfig:"IBC_ENABLED" default:"true"`
-	IbcReceiver     string            `envconfig:"IBC_RECEIVER" default:"neutron1unc0549k2f0d7mjjyfm94fuz2x53wrx3px0pr55va27grdgmspcqgzfr8p"`
 }
 
 type Marketplace struct {
-	chainID              string
 	version              string
 	virtualAddress       string
 	minimumTimeoutBlocks uint64
 	minimumDeposit       float64
 	minimumTradeSize     float64
 	tradeFee             float64
-	ibcEnabled           bool
-	ibcReceiver          string
-	db                   *gorm.DB
+	chain                Chain
 	workerClient         *worker.WorkerClient
-
-	lcdEndpoints    []string
-	endpointHeaders map[string]string
+	lcdPool              *endpoints.Pool
 }
 
-func NewMarketplaceProcessor(chainID string, db *gorm.DB, workerClient *worker.WorkerClient) *Marketplace {
+func NewMarketplaceProcessor(chain Chain, workerClient *worker.WorkerClient, lcdPool *endpoints.Pool) *Marketplace {
 	// Parse config environment variables for self
 	var config MarketplaceConfig
 	err := envconfig.Process("", &config)
@@ -55,19 +44,15 @@ func NewMarketplaceProcessor(chainID string, db *gorm.DB, workerClient *worker.W
 	}
 
 	return &Marketplace{
-		chainID:              chainID,
 		version:              "v1",
 		virtualAddress:       "marketplace-v2",
 		minimumTimeoutBlocks: config.MinimumTimeoutBlocks,
 		minimumDeposit:       config.MinimumDeposit,
 		minimumTradeSize:     config.MinimumTradeSize,
 		tradeFee:             config.TradeFee,
-		ibcEnabled:           config.IbcEnabled,
-		ibcReceiver:          config.IbcReceiver,
-		db:                   db,
+		chain:                chain,
 		workerClient:         workerClient,
-		lcdEndpoints:         config.LCDEndpoints,
-		endpointHeaders:      config.EndpointHeaders,
+		lcdPool:              lcdPool,
 	}
 }
 
@@ -75,22 +60,11 @@ func (protocol *Marketplace) Name() string {
 	return "marketplace"
 }
 
-func (protocol *Marketplace) GetListingHashesFromExt(rawTransaction types.RawTransaction) ([]string, error) {
+func (protocol *Marketplace) GetListingHashesFromExt(rawTransaction types.Transaction) ([]string, error) {
 	// get listing hashes from non_critical_extension_options
-	var msg types.ExtensionMsg
-	var err error
-	for _, extension := range rawTransaction.Body.NonCriticalExtensionOptions {
-		msg, err = extension.UnmarshalData()
-		if err != nil {
-			return nil, fmt.Errorf("unable to unmarshal extension data '%s'", err)
-		}
-
-		// We only process the first extension option
-		break
-	}
-
-	if msg == nil {
-		return nil, fmt.Errorf("no extension options found")
+	msg, err := getExtensionMessage(rawTransaction)
+	if err != nil {
+		return nil, err
 	}
 
 	var listingHashes []string
@@ -101,56 +75,60 @@ func (protocol *Marketplace) GetListingHashesFromExt(rawTransaction types.RawTra
 
 	err = json.Unmarshal(jsonBytes, &listingHashes)
 	if err != nil {
-		return nil, fmt.Errorf("unable to unmarshal metadata '%s'", err)
+		return nil, NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
 	}
 
 	return listingHashes, nil
 }
 
-func (protocol *Marketplace) Deposit(chainID string, sender string, rawTransaction types.RawTransaction, currentTransaction models.Transaction, hash string) error {
+func (protocol *Marketplace) Deposit(db *gorm.DB, chainID string, sender string, rawTransaction types.Transaction, currentTransaction models.Transaction, hash string) error {
 	action := "deposit"
 	currentHeight := currentTransaction.Height
 
 	// Deposits are based on the listing transaction hash, find the transaction
 	// and matching listing
 	var transactionModel models.Transaction
-	result := protocol.db.Where("hash = ?", hash).First(&transactionModel)
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chain.ID, hash).First(&transactionModel)
 	if result.Error != nil {
-		return fmt.Errorf("no listing transaction with hash '%s'", hash)
+		return NewError(CodeListingNotFound, "no listing transaction with hash '%s'", hash).With("hash", hash)
 	}
 
 	// Fetch listing based on hash
 	var listingModel models.MarketplaceListing
-	result = protocol.db.Where("chain_id = ? AND transaction_id = ?", chainID, transactionModel.ID).First(&listingModel)
+	result = db.Where("chain_id = ? AND transaction_id = ?", chainID, transactionModel.ID).First(&listingModel)
 	if result.Error != nil {
-		return fmt.Errorf("no listing with hash '%s'", hash)
+		return NewError(CodeListingNotFound, "no listing with hash '%s'", hash).With("hash", hash)
 	}
 
 	if listingModel.IsDeposited {
 		if listingModel.DepositorTimeoutBlock > currentHeight {
-			return fmt.Errorf("listing already has a deposit")
+			return NewError(CodeListingDeposited, "listing already has a deposit")
 		}
 		// Has deposit, but expired, so we continue
 		action = "deposit after expiry"
 	}
 
 	// Check if sender has enough ATOM to buy the listing
-	balance := QueryAddressBalance(protocol.lcdEndpoints, protocol.endpointHeaders, sender, "uatom", currentHeight)
+	// The query is cancelled with the database transaction
+	balance, err := QueryAddressBalance(db.Statement.Context, protocol.lcdPool, sender, protocol.chain.BaseDenom, currentHeight)
+	if err != nil {
+		return NewError(CodeInternal, "unable to query balance '%s'", err)
+	}
 
 	if listingModel.Total >= listingModel.DepositTotal {
 		if balance < listingModel.Total-listingModel.DepositTotal {
-			return fmt.Errorf("sender does not have enough ATOM to complete the purchase after deposit")
+			return NewError(CodeInsufficientBalance, "sender does not have enough ATOM to complete the purchase after deposit")
 		}
 	}
 
 	// Check that the correct amount was sent with the deposit
-	amountSent, err := GetBaseTokensSent(rawTransaction, listingModel.SellerAddress, Send, protocol.ibcEnabled)
+	amountSent, err := GetBaseTokensSent(rawTransaction, protocol.chain, currentTransaction.Height, listingModel.SellerAddress, Send)
 	if err != nil {
-		return fmt.Errorf("invalid tokens sent '%s'", err)
+		return err
 	}
 
 	if amountSent < listingModel.DepositTotal {
-		return fmt.Errorf("sender did not send enough tokens to cover the deposit")
+		return NewError(CodeInsufficientPayment, "sender did not send enough tokens to cover the deposit")
 	}
 
 	// Everything checks out, add this as the depositor
@@ -160,11 +138,18 @@ func (protocol *Marketplace) Deposit(chainID string, sender string, rawTransacti
 	// Timed-out block is the first block after the expiry period when the
 	// listing is deemed expired
 	listingModel.DepositorTimeoutBlock = currentHeight + listingModel.DepositTimeout + 1
-	result = protocol.db.Save(&listingModel)
+	result = db.Save(&listingModel)
 	if result.Error != nil {
 		return result.Error
 	}
 
+	eventData := listingEventData(listingModel, hash)
+	eventData["timeout_block"] = listingModel.DepositorTimeoutBlock
+	err = emitEvent(db, currentTransaction, EventListingDeposited, eventData)
+	if err != nil {
+		return err
+	}
+
 	// Record the listing history
 	listingHistory := models.MarketplaceListingHistory{
 		ListingID:     listingModel.ID,
@@ -173,56 +158,56 @@ func (protocol *Marketplace) Deposit(chainID string, sender string, rawTransacti
 		Action:        action,
 		DateCreated:   currentTransaction.DateCreated,
 	}
-	result = protocol.db.Save(&listingHistory)
+	result = db.Save(&listingHistory)
 	// no error, If we can't store the history, that is fine, we shouldn't fail
 
 	return nil
 }
 
-func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransaction types.RawTransaction, currentTransaction models.Transaction, hash string) error {
+func (protocol *Marketplace) BuyCFT20(db *gorm.DB, chainID string, sender string, rawTransaction types.Transaction, currentTransaction models.Transaction, hash string) error {
 	action := "buy"
 
 	// Buys are based on the listing transaction hash, find the transaction
 	// and matching listing
 	var transactionModel models.Transaction
-	result := protocol.db.Where("hash = ?", hash).First(&transactionModel)
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chain.ID, hash).First(&transactionModel)
 	if result.Error != nil {
-		return fmt.Errorf("no listing transaction with hash '%s'", hash)
+		return NewError(CodeListingNotFound, "no listing transaction with hash '%s'", hash).With("hash", hash)
 	}
 
 	// Fetch listing based on hash
 	var listingModel models.MarketplaceListing
-	result = protocol.db.Where("chain_id = ? AND transaction_id = ?", chainID, transactionModel.ID).First(&listingModel)
+	result = db.Where("chain_id = ? AND transaction_id = ?", chainID, transactionModel.ID).First(&listingModel)
 	if result.Error != nil {
-		return fmt.Errorf("no listing with hash '%s'", hash)
+		return NewError(CodeListingNotFound, "no listing with hash '%s'", hash).With("hash", hash)
 	}
 
 	// Fetch CFT-20 listing detail
 	var listingDetailModel models.MarketplaceCFT20Detail
-	result = protocol.db.Where("listing_id = ?", listingModel.ID).First(&listingDetailModel)
+	result = db.Where("listing_id = ?", listingModel.ID).First(&listingDetailModel)
 	if result.Error != nil {
-		return fmt.Errorf("no CFT-20 listing with hash '%s'", hash)
+		return NewError(CodeListingNotFound, "no CFT-20 listing with hash '%s'", hash).With("hash", hash)
 	}
 
 	if listingModel.IsDeposited {
 		if listingModel.DepositorAddress != sender {
-			return fmt.Errorf("sender is not the depositor of the listing, buyer must deposit first")
+			return NewError(CodeNotDepositor, "sender is not the depositor of the listing, buyer must deposit first")
 		}
 	} else {
-		return fmt.Errorf("listing has not been deposited, buyer must deposit first")
+		return NewError(CodeListingNotDeposited, "listing has not been deposited, buyer must deposit first")
 	}
 
 	// Check the amount still owed after deposit
 	amountOwed := listingModel.Total - listingModel.DepositTotal
 
 	// Check that the correct amount was sent with the buy
-	amountSent, err := GetBaseTokensSent(rawTransaction, listingModel.SellerAddress, Send, protocol.ibcEnabled)
+	amountSent, err := GetBaseTokensSent(rawTransaction, protocol.chain, currentTransaction.Height, listingModel.SellerAddress, Send)
 	if err != nil {
-		return fmt.Errorf("invalid tokens sent '%s'", err)
+		return err
 	}
 
 	if amountSent < amountOwed {
-		return fmt.Errorf("sender did not send enough tokens to complete the buy")
+		return NewError(CodeInsufficientPayment, "sender did not send enough tokens to complete the buy")
 	}
 
 	// Verify that the sender sent enough to cover the feee
@@ -235,25 +220,34 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 	}
 
 	// Verify that the sender has sent enough tokens to cover the fee
-	amountSent, err = GetBaseTokensSent(rawTransaction, protocol.ibcReceiver, IbcTransfer, protocol.ibcEnabled)
+	amountSent, err = GetBaseTokensSent(rawTransaction, protocol.chain, currentTransaction.Height, protocol.chain.FeeReceiver, IbcTransfer)
 	if err != nil {
-		return fmt.Errorf("invalid tokens sent '%s'", err)
+		return err
 	}
 	if amountSent < uint64(math.Floor(requiredFeeAbsolute)) {
-		return fmt.Errorf("sender did not send enough tokens to cover the purchase fee")
+		return NewError(CodeInsufficientPayment, "sender did not send enough tokens to cover the purchase fee")
 	}
 
 	// Everything checks out, complete the buy and transfer the tokens to the buyer
 	listingModel.IsFilled = true
 	listingModel.DateUpdated = currentTransaction.DateCreated
-	result = protocol.db.Save(&listingModel)
+	result = db.Save(&listingModel)
 	if result.Error != nil {
 		return result.Error
 	}
 
+	eventData := listingEventData(listingModel, hash)
+	eventData["buyer"] = sender
+	eventData["token_id"] = listingDetailModel.TokenID
+	eventData["amount"] = listingDetailModel.Amount
+	err = emitEvent(db, currentTransaction, EventListingFilled, eventData)
+	if err != nil {
+		return err
+	}
+
 	// Check if the receiver has any tokens already, if not, add
 	var holderModel models.TokenHolder
-	result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", chainID, listingDetailModel.TokenID, sender).First(&holderModel)
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", chainID, listingDetailModel.TokenID, sender).First(&holderModel)
 	if result.Error != nil {
 		// Just means this buyer doesn't have the tokens in their wallet yet
 		_ = result
@@ -264,9 +258,9 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 	holderModel.Address = sender
 	holderModel.Amount = holderModel.Amount + listingDetailModel.Amount
 	holderModel.DateUpdated = currentTransaction.DateCreated
-	result = protocol.db.Save(&holderModel)
+	result = db.Save(&holderModel)
 	if result.Error != nil {
-		return fmt.Errorf("unable to update buyer's balance '%s'", err)
+		return NewError(CodeInternal, "unable to update buyer's balance '%w'", result.Error)
 	}
 
 	// Record the listing history
@@ -277,7 +271,7 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 		Action:        action,
 		DateCreated:   currentTransaction.DateCreated,
 	}
-	result = protocol.db.Save(&listingHistory)
+	result = db.Save(&listingHistory)
 	if result.Error != nil {
 		// If we can't store the history, that is fine, we shouldn't fail
 		return nil
@@ -295,7 +289,7 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 		Amount:        listingDetailModel.Amount,
 		DateCreated:   currentTransaction.DateCreated,
 	}
-	result = protocol.db.Save(&historyModel)
+	result = db.Save(&historyModel)
 	if result.Error != nil {
 		// If we can't store the history, that fine, we shouldn't fail
 		_ = result
@@ -313,22 +307,20 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 		Amount:        listingDetailModel.Amount,
 		DateCreated:   currentTransaction.DateCreated,
 	}
-	result = protocol.db.Save(&historyModel)
+	result = db.Save(&historyModel)
 	if result.Error != nil {
 		// If we can't store the history, that fine, we shouldn't fail
 		_ = result
 	}
 
-	// Get current USD price of the base
-	var statusModel models.Status
-	result = protocol.db.Where("chain_id = ?", chainID).First(&statusModel)
-	if result.Error != nil {
+	// Get the USD value of the trade at the time of the trade
+	totalUSD, err := tradeValueUSD(db, protocol.chain, chainID, currentTransaction.DateCreated, listingModel.Total)
+	if err != nil {
 		// If this fails we just don't update the history
 		return nil
 	}
 
 	// Capture the trade in the history for future charts
-	totalWithDecimals := float64(listingModel.Total) / math.Pow10(6)
 	tradeHistory := models.TokenTradeHistory{
 		ChainID:       chainID,
 		TransactionID: currentTransaction.ID,
@@ -338,10 +330,10 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 		AmountQuote:   listingModel.Total,        // ATOM
 		AmountBase:    listingDetailModel.Amount, // CFT-20
 		Rate:          listingDetailModel.PPT,
-		TotalUSD:      totalWithDecimals * statusModel.BaseTokenUSD,
+		TotalUSD:      totalUSD,
 		DateCreated:   currentTransaction.DateCreated,
 	}
-	result = protocol.db.Save(&tradeHistory)
+	result = db.Save(&tradeHistory)
 	if result.Error != nil {
 		// Continue, this is not critical
 		_ = result
@@ -349,14 +341,14 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 
 	// Check if the ticker exists
 	var tokenModel models.Token
-	result = protocol.db.Where("id = ?", listingDetailModel.TokenID).First(&tokenModel)
+	result = db.Where("id = ?", listingDetailModel.TokenID).First(&tokenModel)
 	if result.Error != nil {
 		// This can fail silently as to not alarm the user
 		return nil
 	}
 
 	var avgPrice uint64
-	dberr := protocol.db.Raw(`
+	dberr := db.Raw(`
 	SELECT round(AVG(rate)) AS average_price 
 	FROM (
 		SELECT rate 
@@ -374,7 +366,7 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 	// Recalculate volume from filled trades for this token in past 24 hours
 	// SELECT sum(total_usd) from token_trade_history where date_Created >= now - 24 hours and token_id = this token id
 	var sum uint64
-	err = protocol.db.Model(&models.TokenTradeHistory{}).
+	err = db.Model(&models.TokenTradeHistory{}).
 		Select("SUM(amount_quote)").
 		Where("date_created >= ?", time.Now().Add(-24*time.Hour)).
 		Where("token_id = ?", tokenModel.ID).
@@ -387,188 +379,587 @@ func (protocol *Marketplace) BuyCFT20(chainID string, sender string, rawTransact
 
 	tokenModel.LastPriceBase = avgPrice
 	tokenModel.Volume24Base = sum
-	result = protocol.db.Save(&tokenModel)
+	result = db.Save(&tokenModel)
 	// no error, this can fail silently as to not alarm the user
 
 	return nil
 }
 
-func (protocol *Marketplace) Process(currentTransaction models.Transaction, protocolURN *urn.URN, rawTransaction types.RawTransaction, sourceChannel string) error {
-	sender, err := rawTransaction.GetSenderAddress()
+func (protocol *Marketplace) Operations() []Operation {
+	versions := []string{protocol.version}
+	return []Operation{
+		{
+			Name:     "list.cft20",
+			Versions: versions,
+			Fields: []Field{
+				{Key: "tic", Type: FieldString},
+				{Key: "amt", Type: FieldDecimal},
+				{Key: "ppt", Type: FieldDecimal},
+				{Key: "mindep", Type: FieldDecimal},
+				{Key: "to", Type: FieldUint},
+			},
+			Handler: protocol.processListCft20,
+		},
+		{
+			Name:     "list.inscription",
+			Versions: versions,
+			Fields: []Field{
+				{Key: "h", Type: FieldString},
+				{Key: "amt", Type: FieldDecimal},
+				{Key: "mindep", Type: FieldDecimal},
+				{Key: "to", Type: FieldUint},
+			},
+			Handler: protocol.processListInscription,
+		},
+		{
+			// The listing hashes are taken from the extension data if the
+			// hash is not set
+			Name:     "deposit",
+			Versions: versions,
+			Fields:   []Field{{Key: "h", Type: FieldString, Optional: true}},
+			Handler:  protocol.processDeposit,
+		},
+		{
+			Name:     "delist",
+			Versions: versions,
+			Fields:   []Field{{Key: "h", Type: FieldString}},
+			Handler:  protocol.processDelist,
+		},
+		{
+			Name:     "buy.cft20",
+			Versions: versions,
+			Fields:   []Field{{Key: "h", Type: FieldString, Optional: true}},
+			Handler:  protocol.processBuyCft20,
+		},
+		{
+			Name:     "buy.inscription",
+			Versions: versions,
+			Fields:   []Field{{Key: "h", Type: FieldString}},
+			Handler:  protocol.processBuyInscription,
+		},
+	}
+}
+
+// processListCft20 handles the list.cft20 operation
+func (protocol *Marketplace) processListCft20(db *gorm.DB, currentTransaction models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
+	ticker = strings.ToUpper(ticker)
+
+	// Check if the ticker exists
+	var tokenModel models.Token
+	result := db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
+	if result.Error != nil {
+		return NewError(CodeTokenNotFound, "token with ticker '%s' doesn't exist", ticker).With("ticker", ticker)
+	}
+
+	// We will actually be sending the tokens to the marketplace address
+	destinationAddress := protocol.virtualAddress
+
+	// Check required fields
+	amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
+	// Convert amount to have the correct number of decimals
+	amount, err := strconv.ParseFloat(amountString, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse amount '%s'", err).With("field", "amt")
+	}
+	if amount <= 0 {
+		return NewError(CodeInvalidField, "amount must be greater than 0").With("field", "amt")
+	}
+
+	pptString := strings.TrimSpace(parsedURN.KeyValuePairs["ppt"])
+	// Convert amount to have the correct number of decimals
+	ppt, err := strconv.ParseFloat(pptString, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse ppt '%s'", err).With("field", "ppt")
+	}
+	if ppt <= 0 {
+		return NewError(CodeInvalidField, "price per token must be greater than 0").With("field", "ppt")
+	}
+	totalBase := float64(amount) * ppt
+	if totalBase < protocol.minimumTradeSize {
+		return NewError(CodeTradeTooSmall, "total trade size must be greater than %.6f", protocol.minimumTradeSize).With("minimum", protocol.minimumTradeSize)
+	}
+
+	// 6 is the amount of ATOM decimals
+	ppt = ppt * math.Pow10(6)
+	amount = amount * math.Pow10(int(tokenModel.Decimals))
+	totalBase = totalBase * math.Pow10(6)
+
+	// Get the minimum deposit
+	minDepositString := strings.TrimSpace(parsedURN.KeyValuePairs["mindep"])
+	// Convert amount to have the correct number of decimals
+	minDeposit, err := strconv.ParseFloat(minDepositString, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse ppt '%s'", err).With("field", "ppt")
+	}
+	if minDeposit <= 0 {
+		return NewError(CodeInvalidField, "minimum deposit must be greater than 0").With("field", "mindep")
+	}
+	if minDeposit < protocol.minimumDeposit {
+		return NewError(CodeDepositTooSmall, "minimum deposit percentage too small")
+	}
+
+	// Calculate the ATOM amount of the minimum deposit by checking against
+	// totalBase
+	minDepositBase := minDeposit * totalBase
+	if minDepositBase < 1 {
+		minDepositBase = 1
+	}
+
+	// Get the listing timeout
+	timeoutString := strings.TrimSpace(parsedURN.KeyValuePairs["to"])
+	timeout, err := strconv.ParseUint(timeoutString, 10, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse to '%s'", err).With("field", "to")
+	}
+	if timeout < protocol.minimumTimeoutBlocks {
+		return NewError(CodeTimeoutTooShort, "timeout must be greater than the minimum of %d", protocol.minimumTimeoutBlocks).With("minimum", protocol.minimumTimeoutBlocks)
+	}
+
+	// Verify that the sender has sent enough tokens to cover the listing fee
+	amountSent, err := GetBaseTokensSent(rawTransaction, protocol.chain, currentTransaction.Height, protocol.chain.FeeReceiver, IbcTransfer)
 	if err != nil {
 		return err
 	}
+	if amountSent < uint64(math.Floor(minDepositBase)) {
+		return NewError(CodeInsufficientPayment, "sender did not send enough tokens to cover the listing fee")
+	}
+
+	// Check that the user has enough tokens to sell
+	var holderModel models.TokenHolder
+	result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
+	if result.Error != nil {
+		return NewError(CodeInsufficientBalance, "sender does not have any tokens to sell")
+	}
+
+	if holderModel.Amount < uint64(amount) {
+		return NewError(CodeInsufficientBalance, "sender does not have enough tokens to sell")
+	}
+
+	// At this point we know that the sender has enough tokens to sell
+	// so decrease the senders balance
+	holderModel.Amount = holderModel.Amount - uint64(amount)
+	result = db.Save(&holderModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update seller's balance '%w'", result.Error)
+	}
+
+	// Create a listing position
+	listing := models.MarketplaceListing{
+		ChainID:          parsedURN.ChainID,
+		TransactionID:    currentTransaction.ID,
+		SellerAddress:    sender,
+		Total:            uint64(math.Round(totalBase)),
+		DepositTotal:     uint64(math.Round(minDepositBase)),
+		DepositorAddress: "",
+		DepositTimeout:   timeout,
+		IsDeposited:      false,
+		IsFilled:         false,
+		IsCancelled:      false,
+		DateUpdated:      currentTransaction.DateCreated,
+		DateCreated:      currentTransaction.DateCreated,
+	}
+	result = db.Save(&listing)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to create listing '%s'", result.Error)
+	}
+
+	listingDetail := models.MarketplaceCFT20Detail{
+		ListingID:   listing.ID,
+		TokenID:     tokenModel.ID,
+		Amount:      uint64(math.Round(amount)),
+		PPT:         uint64(math.Round(ppt)),
+		DateCreated: currentTransaction.DateCreated,
+	}
+	result = db.Save(&listingDetail)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to create token listing '%s'", result.Error)
+	}
 
-	// We need to parse the protocol specific string in SS, it contains
-	// {chainId}@{version};operation$h={unique hash of content}
-	// cosmoshub-4@v1beta;deploy$nam=The Name,tic=TICK,sup=21000000,dec=6,lim=1000
-	// cosmoshub-4@v1beta;deploy$nam=NewYearDay,tic=NYD,sup=28000000,dec=18,lim=50000,opn=1704059940
-	parsedURN, err := ParseProtocolString(protocolURN)
+	eventData := listingEventData(listing, currentTransaction.Hash)
+	eventData["ticker"] = tokenModel.Ticker
+	eventData["amount"] = listingDetail.Amount
+	eventData["ppt"] = listingDetail.PPT
+	err = emitEvent(db, currentTransaction, EventListingCreated, eventData)
 	if err != nil {
 		return err
 	}
 
-	if parsedURN.ChainID != protocol.chainID {
-		return fmt.Errorf("chain ID in protocol string does not match transaction chain ID")
+	// Record the transfer
+	historyModel := models.TokenAddressHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        currentTransaction.Height,
+		TransactionID: currentTransaction.ID,
+		TokenID:       tokenModel.ID,
+		Sender:        sender,
+		Receiver:      destinationAddress,
+		Action:        "list",
+		Amount:        uint64(math.Round(amount)),
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&historyModel)
+	if result.Error != nil {
+		// If we can't store the history, that fine, we shouldn't fail
+		_ = result
 	}
 
-	if parsedURN.Version != protocol.version {
-		return fmt.Errorf("version in protocol string does not match transaction version")
+	// Record the listing history
+	listingHistory := models.MarketplaceListingHistory{
+		ListingID:     listing.ID,
+		TransactionID: currentTransaction.ID,
+		SenderAddress: sender,
+		Action:        "list",
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&listingHistory)
+	if result.Error != nil {
+		// If we can't store the history, that is fine, we shouldn't fail
+		return nil
 	}
 
-	currentHeight := currentTransaction.Height
+	return nil
+}
+
+// processListInscription handles the list.inscription operation
+func (protocol *Marketplace) processListInscription(db *gorm.DB, currentTransaction models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	hash := strings.TrimSpace(parsedURN.KeyValuePairs["h"])
+
+	// Check if the inscription exists
+	// Inscriptions are stored by their transaction hash
+	var transactionModel models.Transaction
+	result := db.Debug().Where("chain_id = ? AND hash = ?", protocol.chain.ID, hash).First(&transactionModel)
+	if result.Error != nil {
+		return NewError(CodeInscriptionNotFound, "inscription with hash '%s' doesn't exist", hash).With("hash", hash)
+	}
 
-	// TODO: Rework the operation handling
-	switch parsedURN.Operation {
-	case "list.cft20":
+	var inscriptionModel models.Inscription
+	result = db.Where("transaction_id = ?", transactionModel.ID).First(&inscriptionModel)
+	if result.Error != nil {
+		return NewError(CodeInscriptionNotFound, "inscription with hash '%s' couldn't be found", hash).With("hash", hash)
+	}
 
-		ticker := strings.TrimSpace(parsedURN.KeyValuePairs["tic"])
-		ticker = strings.ToUpper(ticker)
+	// Verify the address creating the listing is the owner of the inscription
+	if inscriptionModel.CurrentOwner != sender {
+		return NewError(CodeNotOwner, "sender is not the owner of the inscription")
+	}
 
-		// Check if the ticker exists
-		var tokenModel models.Token
-		result := protocol.db.Where("chain_id = ? AND ticker = ?", parsedURN.ChainID, ticker).First(&tokenModel)
-		if result.Error != nil {
-			return fmt.Errorf("token with ticker '%s' doesn't exist", ticker)
-		}
+	// We will actually be sending the inscription to the marketplace address
+	destinationAddress := protocol.virtualAddress
 
-		// We will actually be sending the tokens to the marketplace address
-		destinationAddress := protocol.virtualAddress
+	// Check required fields
+	amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
+	// Convert amount to have the correct number of decimals
+	amount, err := strconv.ParseFloat(amountString, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse amount '%s'", err).With("field", "amt")
+	}
+	if amount <= 0 {
+		return NewError(CodeInvalidField, "amount must be greater than 0").With("field", "amt")
+	}
 
-		// Check required fields
-		amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
-		// Convert amount to have the correct number of decimals
-		amount, err := strconv.ParseFloat(amountString, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse amount '%s'", err)
-		}
-		if amount <= 0 {
-			return fmt.Errorf("amount must be greater than 0")
-		}
+	// 6 is the amount of ATOM decimals
+	totalBase := amount * math.Pow10(6)
 
-		pptString := strings.TrimSpace(parsedURN.KeyValuePairs["ppt"])
-		// Convert amount to have the correct number of decimals
-		ppt, err := strconv.ParseFloat(pptString, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse ppt '%s'", err)
-		}
-		if ppt <= 0 {
-			return fmt.Errorf("price per token must be greater than 0")
-		}
-		totalBase := float64(amount) * ppt
-		if totalBase < protocol.minimumTradeSize {
-			return fmt.Errorf("total trade size must be greater than %.6f", protocol.minimumTradeSize)
-		}
+	// Get the minimum deposit
+	minDepositString := strings.TrimSpace(parsedURN.KeyValuePairs["mindep"])
+	// Convert amount to have the correct number of decimals
+	minDeposit, err := strconv.ParseFloat(minDepositString, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse mindep '%s'", err).With("field", "mindep")
+	}
+	if minDeposit <= 0 {
+		return NewError(CodeInvalidField, "minimum deposit must be greater than 0").With("field", "mindep")
+	}
+	// TODO: Move 0.00001 (0.001%) to config as the minimum deposit percent
+	if minDeposit < 0.00001 {
+		return NewError(CodeDepositTooSmall, "minimum deposit percentage too small")
+	}
+
+	// Calculate the ATOM amount of the minimum deposit by checking against
+	// totalBase
+	minDepositBase := minDeposit * totalBase
+	if minDepositBase < 1 {
+		minDepositBase = 1
+	}
+
+	// Get the listing timeout
+	timeoutString := strings.TrimSpace(parsedURN.KeyValuePairs["to"])
+	timeout, err := strconv.ParseUint(timeoutString, 10, 64)
+	if err != nil {
+		return NewError(CodeInvalidField, "unable to parse to '%s'", err).With("field", "to")
+	}
+	if timeout < protocol.minimumTimeoutBlocks {
+		return NewError(CodeTimeoutTooShort, "timeout must be greater than the minimum of %d", protocol.minimumTimeoutBlocks).With("minimum", protocol.minimumTimeoutBlocks)
+	}
+
+	// Check that the correct amount was sent with the buy
+	amountSent, err := GetBaseTokensSent(rawTransaction, protocol.chain, currentTransaction.Height, protocol.chain.FeeReceiver, IbcTransfer)
+	if err != nil {
+		return err
+	}
+
+	amountExpected := uint64(math.Floor(minDepositBase))
+	if amountSent < amountExpected {
+		return NewError(CodeInsufficientPayment, "sender did not send enough tokens to cover the listing fee, amount sent: %d, amount expected %d", amountSent, amountExpected).With("amount", amountSent).With("expected_amount", amountExpected)
+	}
+
+	// At this point we know that the sender has the inscription and everything
+	// checks out, transfer the inscription to the market
+	inscriptionModel.CurrentOwner = destinationAddress
+	result = db.Save(&inscriptionModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to transfer to marketplace '%w'", result.Error)
+	}
+
+	// Create a listing position
+	listing := models.MarketplaceListing{
+		ChainID:          parsedURN.ChainID,
+		TransactionID:    currentTransaction.ID,
+		SellerAddress:    sender,
+		Total:            uint64(math.Round(totalBase)),
+		DepositTotal:     uint64(math.Round(minDepositBase)),
+		DepositorAddress: "",
+		DepositTimeout:   timeout,
+		IsDeposited:      false,
+		IsFilled:         false,
+		IsCancelled:      false,
+		DateUpdated:      currentTransaction.DateCreated,
+		DateCreated:      currentTransaction.DateCreated,
+	}
+	result = db.Save(&listing)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to create listing '%s'", result.Error)
+	}
+
+	listingDetail := models.MarketplaceInscriptionDetail{
+		ListingID:     listing.ID,
+		InscriptionID: inscriptionModel.ID,
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&listingDetail)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to create token listing '%s'", result.Error)
+	}
+
+	eventData := listingEventData(listing, currentTransaction.Hash)
+	eventData["inscription_id"] = inscriptionModel.ID
+	eventData["inscription_hash"] = hash
+	err = emitEvent(db, currentTransaction, EventListingCreated, eventData)
+	if err != nil {
+		return err
+	}
+
+	// Record the transfer
+	historyModel := models.InscriptionHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        currentTransaction.Height,
+		TransactionID: currentTransaction.ID,
+		InscriptionID: inscriptionModel.ID,
+		Sender:        sender,
+		Receiver:      destinationAddress,
+		Action:        "list",
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&historyModel)
+	if result.Error != nil {
+		// If we can't store the history, that fine, we shouldn't fail
+		_ = result
+	}
 
-		// 6 is the amount of ATOM decimals
-		ppt = ppt * math.Pow10(6)
-		amount = amount * math.Pow10(int(tokenModel.Decimals))
-		totalBase = totalBase * math.Pow10(6)
+	// Record the listing history
+	listingHistory := models.MarketplaceListingHistory{
+		ListingID:     listing.ID,
+		TransactionID: currentTransaction.ID,
+		SenderAddress: sender,
+		Action:        "list",
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&listingHistory)
+	if result.Error != nil {
+		// If we can't store the history, that is fine, we shouldn't fail
+		return nil
+	}
 
-		// Get the minimum deposit
-		minDepositString := strings.TrimSpace(parsedURN.KeyValuePairs["mindep"])
-		// Convert amount to have the correct number of decimals
-		minDeposit, err := strconv.ParseFloat(minDepositString, 64)
+	if inscriptionModel.CollectionID.Valid {
+		err = protocol.workerClient.UpdateCollectionStats(db, uint64(inscriptionModel.CollectionID.Int64))
 		if err != nil {
-			return fmt.Errorf("unable to parse ppt '%s'", err)
-		}
-		if minDeposit <= 0 {
-			return fmt.Errorf("minimum deposit must be greater than 0")
-		}
-		if minDeposit < protocol.minimumDeposit {
-			return fmt.Errorf("minimum deposit percentage too small")
+			return err
 		}
+	}
 
-		// Calculate the ATOM amount of the minimum deposit by checking against
-		// totalBase
-		minDepositBase := minDeposit * totalBase
-		if minDepositBase < 1 {
-			minDepositBase = 1
-		}
+	return nil
+}
 
-		// Get the listing timeout
-		timeoutString := strings.TrimSpace(parsedURN.KeyValuePairs["to"])
-		timeout, err := strconv.ParseUint(timeoutString, 10, 64)
+// processDeposit handles the deposit operation
+func (protocol *Marketplace) processDeposit(db *gorm.DB, currentTransaction models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	var err error
+	var hashes []string
+	if parsedURN.KeyValuePairs == nil {
+		hashes, err = protocol.GetListingHashesFromExt(rawTransaction)
 		if err != nil {
-			return fmt.Errorf("unable to parse to '%s'", err)
-		}
-		if timeout < protocol.minimumTimeoutBlocks {
-			return fmt.Errorf("timeout must be greater than the minimum of %d", protocol.minimumTimeoutBlocks)
+			return err
 		}
+	} else {
+		hashes = strings.Split(strings.TrimSpace(parsedURN.KeyValuePairs["h"]), ",")
+	}
 
-		// Verify that the sender has sent enough tokens to cover the listing fee
-		amountSent, err := GetBaseTokensSent(rawTransaction, protocol.ibcReceiver, IbcTransfer, protocol.ibcEnabled)
-		if err != nil {
-			return fmt.Errorf("invalid tokens sent '%s'", err)
+	success := false
+
+	for _, hash := range hashes {
+		// Process deposit for each hash, a failed deposit must not leave
+		// partial changes behind when other hashes succeed
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return protocol.Deposit(tx, parsedURN.ChainID, sender, rawTransaction, currentTransaction, hash)
+		})
+		if err == nil {
+			success = true
 		}
-		if amountSent < uint64(math.Floor(minDepositBase)) {
-			return fmt.Errorf("sender did not send enough tokens to cover the listing fee")
+	}
+
+	if !success {
+		return err
+	}
+
+	return nil
+}
+
+// processDelist handles the delist operation
+func (protocol *Marketplace) processDelist(db *gorm.DB, currentTransaction models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	action := "delist"
+	hash := strings.TrimSpace(parsedURN.KeyValuePairs["h"])
+
+	// Deposits are based on the listing transaction hash, find the transaction
+	// and matching listing
+	var transactionModel models.Transaction
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chain.ID, hash).First(&transactionModel)
+	if result.Error != nil {
+		return NewError(CodeListingNotFound, "no listing transaction with hash '%s'", hash).With("hash", hash)
+	}
+
+	// Fetch listing based on hash
+	var listingModel models.MarketplaceListing
+	result = db.Where("chain_id = ? AND transaction_id = ?", parsedURN.ChainID, transactionModel.ID).First(&listingModel)
+	if result.Error != nil {
+		return NewError(CodeListingNotFound, "no listing with hash '%s'", hash).With("hash", hash)
+	}
+
+	if listingModel.SellerAddress != sender {
+		return NewError(CodeNotOwner, "sender is not the seller of the listing")
+	}
+
+	if listingModel.IsDeposited {
+		if listingModel.DepositorTimeoutBlock > currentTransaction.Height {
+			return NewError(CodeListingDeposited, "listing already has a deposit, cannot be cancelled until expiry")
 		}
+		// Has deposit, but expired, so we continue
+		action = "delist after expiry"
+	}
+
+	if listingModel.IsFilled {
+		return NewError(CodeListingFilled, "listing has already been filled, cannot be cancelled")
+	}
+	if listingModel.IsCancelled {
+		return NewError(CodeListingCancelled, "listing has already been cancelled")
+	}
+
+	listingModel.IsDeposited = false
+	listingModel.DepositorAddress = ""
+	listingModel.DepositorTimeoutBlock = 0
+	listingModel.IsCancelled = true
+	listingModel.DateUpdated = currentTransaction.DateCreated
+	result = db.Save(&listingModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to cancel listing: %s", result.Error)
+	}
+
+	err := emitEvent(db, currentTransaction, EventListingCancelled, listingEventData(listingModel, hash))
+	if err != nil {
+		return err
+	}
+
+	// Update listing history
+	listingHistory := models.MarketplaceListingHistory{
+		ListingID:     listingModel.ID,
+		TransactionID: currentTransaction.ID,
+		SenderAddress: sender,
+		Action:        action,
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&listingHistory)
+	if result.Error != nil {
+		// If we can't store the history, that is fine, we shouldn't fail
+		return nil
+	}
 
-		// Check that the user has enough tokens to sell
+	// Check if this is a CFT-20 token listing
+	var listingDetailModel models.MarketplaceCFT20Detail
+	result = db.Where("listing_id = ?", listingModel.ID).First(&listingDetailModel)
+	if result.Error == nil {
+		// This is CFT-20 listing, continue by returning funds
 		var holderModel models.TokenHolder
-		result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, tokenModel.ID, sender).First(&holderModel)
+		result = db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, listingDetailModel.TokenID, sender).First(&holderModel)
 		if result.Error != nil {
-			return fmt.Errorf("sender does not have any tokens to sell")
-		}
-
-		if holderModel.Amount < uint64(amount) {
-			return fmt.Errorf("sender does not have enough tokens to sell")
+			return NewError(CodeInsufficientBalance, "sender never had tokens to sell")
 		}
 
-		// At this point we know that the sender has enough tokens to sell
-		// so decrease the senders balance
-		holderModel.Amount = holderModel.Amount - uint64(amount)
-		result = protocol.db.Save(&holderModel)
+		holderModel.Amount = holderModel.Amount + listingDetailModel.Amount
+		result = db.Save(&holderModel)
 		if result.Error != nil {
-			return fmt.Errorf("unable to update seller's balance '%s'", err)
+			return NewError(CodeInternal, "unable to update seller's balance '%s'", result.Error)
 		}
 
-		// Create a listing position
-		listing := models.MarketplaceListing{
-			ChainID:          parsedURN.ChainID,
-			TransactionID:    currentTransaction.ID,
-			SellerAddress:    sender,
-			Total:            uint64(math.Round(totalBase)),
-			DepositTotal:     uint64(math.Round(minDepositBase)),
-			DepositorAddress: "",
-			DepositTimeout:   timeout,
-			IsDeposited:      false,
-			IsFilled:         false,
-			IsCancelled:      false,
-			DateUpdated:      currentTransaction.DateCreated,
-			DateCreated:      currentTransaction.DateCreated,
+		// Log history
+
+		// Record the transfer
+		historyModel := models.TokenAddressHistory{
+			ChainID:       parsedURN.ChainID,
+			Height:        currentTransaction.Height,
+			TransactionID: currentTransaction.ID,
+			TokenID:       listingDetailModel.TokenID,
+			Sender:        protocol.virtualAddress,
+			Receiver:      sender,
+			Action:        action,
+			Amount:        uint64(listingDetailModel.Amount),
+			DateCreated:   currentTransaction.DateCreated,
 		}
-		result = protocol.db.Save(&listing)
+		result = db.Save(&historyModel)
 		if result.Error != nil {
-			return fmt.Errorf("unable to create listing '%s'", result.Error)
+			// If we can't store the history, that fine, we shouldn't fail
+			return nil
 		}
+		return nil
 
-		listingDetail := models.MarketplaceCFT20Detail{
-			ListingID:   listing.ID,
-			TokenID:     tokenModel.ID,
-			Amount:      uint64(math.Round(amount)),
-			PPT:         uint64(math.Round(ppt)),
-			DateCreated: currentTransaction.DateCreated,
+	}
+
+	var inscriptionListingDetailModel models.MarketplaceInscriptionDetail
+	result = db.Where("listing_id = ?", listingModel.ID).First(&inscriptionListingDetailModel)
+	if result.Error == nil {
+		// This is an inscription listing, continue by returning the inscription
+		var inscriptionModel models.Inscription
+		result = db.Where("chain_id = ? AND id = ?", parsedURN.ChainID, inscriptionListingDetailModel.InscriptionID).First(&inscriptionModel)
+		if result.Error != nil {
+			return NewError(CodeNotOwner, "sender never had this inscription to sell")
 		}
-		result = protocol.db.Save(&listingDetail)
+
+		inscriptionModel.CurrentOwner = sender
+		result = db.Save(&inscriptionModel)
 		if result.Error != nil {
-			return fmt.Errorf("unable to create token listing '%s'", result.Error)
+			return NewError(CodeInternal, "unable to update inscription's owner '%s'", result.Error)
 		}
 
+		// Log history
 		// Record the transfer
-		historyModel := models.TokenAddressHistory{
+		historyModel := models.InscriptionHistory{
 			ChainID:       parsedURN.ChainID,
 			Height:        currentTransaction.Height,
 			TransactionID: currentTransaction.ID,
-			TokenID:       tokenModel.ID,
-			Sender:        sender,
-			Receiver:      destinationAddress,
-			Action:        "list",
-			Amount:        uint64(math.Round(amount)),
+			InscriptionID: inscriptionModel.ID,
+			Sender:        protocol.virtualAddress,
+			Receiver:      sender,
+			Action:        "delist",
 			DateCreated:   currentTransaction.DateCreated,
 		}
-		result = protocol.db.Save(&historyModel)
+		result = db.Save(&historyModel)
 		if result.Error != nil {
 			// If we can't store the history, that fine, we shouldn't fail
 			_ = result
@@ -576,570 +967,259 @@ func (protocol *Marketplace) Process(currentTransaction models.Transaction, prot
 
 		// Record the listing history
 		listingHistory := models.MarketplaceListingHistory{
-			ListingID:     listing.ID,
+			ListingID:     listingModel.ID,
 			TransactionID: currentTransaction.ID,
 			SenderAddress: sender,
-			Action:        "list",
+			Action:        "delist",
 			DateCreated:   currentTransaction.DateCreated,
 		}
-		result = protocol.db.Save(&listingHistory)
+		result = db.Save(&listingHistory)
 		if result.Error != nil {
 			// If we can't store the history, that is fine, we shouldn't fail
-			return nil
-		}
-
-	case "list.inscription":
-
-		hash := strings.TrimSpace(parsedURN.KeyValuePairs["h"])
-
-		// Check if the inscription exists
-		// Inscriptions are stored by their transaction hash
-		var transactionModel models.Transaction
-		result := protocol.db.Debug().Where("hash = ?", hash).First(&transactionModel)
-		if result.Error != nil {
-			return fmt.Errorf("inscription with hash '%s' doesn't exist", hash)
-		}
-
-		var inscriptionModel models.Inscription
-		result = protocol.db.Where("transaction_id = ?", transactionModel.ID).First(&inscriptionModel)
-		if result.Error != nil {
-			return fmt.Errorf("inscription with hash '%s' couldn't be found", hash)
-		}
-
-		// Verify the address creating the listing is the owner of the inscription
-		if inscriptionModel.CurrentOwner != sender {
-			return fmt.Errorf("sender is not the owner of the inscription")
-		}
-
-		// We will actually be sending the inscription to the marketplace address
-		destinationAddress := protocol.virtualAddress
-
-		// Check required fields
-		amountString := strings.TrimSpace(parsedURN.KeyValuePairs["amt"])
-		// Convert amount to have the correct number of decimals
-		amount, err := strconv.ParseFloat(amountString, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse amount '%s'", err)
-		}
-		if amount <= 0 {
-			return fmt.Errorf("amount must be greater than 0")
-		}
-
-		// 6 is the amount of ATOM decimals
-		totalBase := amount * math.Pow10(6)
-
-		// Get the minimum deposit
-		minDepositString := strings.TrimSpace(parsedURN.KeyValuePairs["mindep"])
-		// Convert amount to have the correct number of decimals
-		minDeposit, err := strconv.ParseFloat(minDepositString, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse mindep '%s'", err)
-		}
-		if minDeposit <= 0 {
-			return fmt.Errorf("minimum deposit must be greater than 0")
-		}
-		// TODO: Move 0.00001 (0.001%) to config as the minimum deposit percent
-		if minDeposit < 0.00001 {
-			return fmt.Errorf("minimum deposit percentage too small")
-		}
-
-		// Calculate the ATOM amount of the minimum deposit by checking against
-		// totalBase
-		minDepositBase := minDeposit * totalBase
-		if minDepositBase < 1 {
-			minDepositBase = 1
-		}
-
-		// Get the listing timeout
-		timeoutString := strings.TrimSpace(parsedURN.KeyValuePairs["to"])
-		timeout, err := strconv.ParseUint(timeoutString, 10, 64)
-		if err != nil {
-			return fmt.Errorf("unable to parse to '%s'", err)
-		}
-		if timeout < protocol.minimumTimeoutBlocks {
-			return fmt.Errorf("timeout must be greater than the minimum of %d", protocol.minimumTimeoutBlocks)
-		}
-
-		// Check that the correct amount was sent with the buy
-		amountSent, err := GetBaseTokensSent(rawTransaction, protocol.ibcReceiver, IbcTransfer, protocol.ibcEnabled)
-		if err != nil {
-			return fmt.Errorf("invalid tokens sent '%s'", err)
-		}
-
-		amountExpected := uint64(math.Floor(minDepositBase))
-		if amountSent < amountExpected {
-			return fmt.Errorf("sender did not send enough tokens to cover the listing fee, amount sent: %d, amount expected %d", amountSent, amountExpected)
-		}
-
-		// At this point we know that the sender has the inscription and everything
-		// checks out, transfer the inscription to the market
-		inscriptionModel.CurrentOwner = destinationAddress
-		result = protocol.db.Save(&inscriptionModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to transfer to marketplace '%s'", err)
-		}
-
-		// Create a listing position
-		listing := models.MarketplaceListing{
-			ChainID:          parsedURN.ChainID,
-			TransactionID:    currentTransaction.ID,
-			SellerAddress:    sender,
-			Total:            uint64(math.Round(totalBase)),
-			DepositTotal:     uint64(math.Round(minDepositBase)),
-			DepositorAddress: "",
-			DepositTimeout:   timeout,
-			IsDeposited:      false,
-			IsFilled:         false,
-			IsCancelled:      false,
-			DateUpdated:      currentTransaction.DateCreated,
-			DateCreated:      currentTransaction.DateCreated,
-		}
-		result = protocol.db.Save(&listing)
-		if result.Error != nil {
-			return fmt.Errorf("unable to create listing '%s'", result.Error)
-		}
-
-		listingDetail := models.MarketplaceInscriptionDetail{
-			ListingID:     listing.ID,
-			InscriptionID: inscriptionModel.ID,
-			DateCreated:   currentTransaction.DateCreated,
-		}
-		result = protocol.db.Save(&listingDetail)
-		if result.Error != nil {
-			return fmt.Errorf("unable to create token listing '%s'", result.Error)
-		}
-
-		// Record the transfer
-		historyModel := models.InscriptionHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        currentTransaction.Height,
-			TransactionID: currentTransaction.ID,
-			InscriptionID: inscriptionModel.ID,
-			Sender:        sender,
-			Receiver:      destinationAddress,
-			Action:        "list",
-			DateCreated:   currentTransaction.DateCreated,
-		}
-		result = protocol.db.Save(&historyModel)
-		if result.Error != nil {
-			// If we can't store the history, that fine, we shouldn't fail
 			_ = result
 		}
 
-		// Record the listing history
-		listingHistory := models.MarketplaceListingHistory{
-			ListingID:     listing.ID,
-			TransactionID: currentTransaction.ID,
-			SenderAddress: sender,
-			Action:        "list",
-			DateCreated:   currentTransaction.DateCreated,
-		}
-		result = protocol.db.Save(&listingHistory)
-		if result.Error != nil {
-			// If we can't store the history, that is fine, we shouldn't fail
-			return nil
-		}
-
 		if inscriptionModel.CollectionID.Valid {
-			protocol.workerClient.UpdateCollectionStats(uint64(inscriptionModel.CollectionID.Int64))
-		}
-
-	case "deposit":
-		var hashes []string
-		if parsedURN.KeyValuePairs == nil {
-			hashes, err = protocol.GetListingHashesFromExt(rawTransaction)
+			err = protocol.workerClient.UpdateCollectionStats(db, uint64(inscriptionModel.CollectionID.Int64))
 			if err != nil {
 				return err
 			}
-		} else {
-			hashes = strings.Split(strings.TrimSpace(parsedURN.KeyValuePairs["h"]), ",")
 		}
 
-		var err error
-		success := false
+	}
 
-		for _, hash := range hashes {
-			// Process deposit for each hash
-			err = protocol.Deposit(parsedURN.ChainID, sender, rawTransaction, currentTransaction, hash)
-			if err == nil {
-				success = true
-			}
-		}
+	return nil
+}
 
-		if !success {
+// processBuyCft20 handles the buy.cft20 operation
+func (protocol *Marketplace) processBuyCft20(db *gorm.DB, currentTransaction models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	var err error
+	var hashes []string
+	if parsedURN.KeyValuePairs == nil {
+		hashes, err = protocol.GetListingHashesFromExt(rawTransaction)
+		if err != nil {
 			return err
 		}
+	} else {
+		hashes = strings.Split(strings.TrimSpace(parsedURN.KeyValuePairs["h"]), ",")
+	}
 
-		return nil
-
-	case "delist":
-		action := "delist"
-		hash := strings.TrimSpace(parsedURN.KeyValuePairs["h"])
-
-		// Deposits are based on the listing transaction hash, find the transaction
-		// and matching listing
-		var transactionModel models.Transaction
-		result := protocol.db.Where("hash = ?", hash).First(&transactionModel)
-		if result.Error != nil {
-			return fmt.Errorf("no listing transaction with hash '%s'", hash)
-		}
-
-		// Fetch listing based on hash
-		var listingModel models.MarketplaceListing
-		result = protocol.db.Where("chain_id = ? AND transaction_id = ?", parsedURN.ChainID, transactionModel.ID).First(&listingModel)
-		if result.Error != nil {
-			return fmt.Errorf("no listing with hash '%s'", hash)
-		}
-
-		if listingModel.SellerAddress != sender {
-			return fmt.Errorf("sender is not the seller of the listing")
-		}
-
-		if listingModel.IsDeposited {
-			if listingModel.DepositorTimeoutBlock > currentHeight {
-				return fmt.Errorf("listing already has a deposit, cannot be cancelled until expiry")
-			}
-			// Has deposit, but expired, so we continue
-			action = "delist after expiry"
-		}
-
-		if listingModel.IsFilled {
-			return fmt.Errorf("listing has already been filled, cannot be cancelled")
-		}
-		if listingModel.IsCancelled {
-			return fmt.Errorf("listing has already been cancelled")
-		}
-
-		listingModel.IsDeposited = false
-		listingModel.DepositorAddress = ""
-		listingModel.DepositorTimeoutBlock = 0
-		listingModel.IsCancelled = true
-		listingModel.DateUpdated = currentTransaction.DateCreated
-		result = protocol.db.Save(&listingModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to cancel listing: %s", result.Error)
-		}
-
-		// Update listing history
-		listingHistory := models.MarketplaceListingHistory{
-			ListingID:     listingModel.ID,
-			TransactionID: currentTransaction.ID,
-			SenderAddress: sender,
-			Action:        action,
-			DateCreated:   currentTransaction.DateCreated,
-		}
-		result = protocol.db.Save(&listingHistory)
-		if result.Error != nil {
-			// If we can't store the history, that is fine, we shouldn't fail
-			return nil
-		}
-
-		// Check if this is a CFT-20 token listing
-		var listingDetailModel models.MarketplaceCFT20Detail
-		result = protocol.db.Where("listing_id = ?", listingModel.ID).First(&listingDetailModel)
-		if result.Error == nil {
-			// This is CFT-20 listing, continue by returning funds
-			var holderModel models.TokenHolder
-			result = protocol.db.Where("chain_id = ? AND token_id = ? AND address = ?", parsedURN.ChainID, listingDetailModel.TokenID, sender).First(&holderModel)
-			if result.Error != nil {
-				return fmt.Errorf("sender never had tokens to sell")
-			}
-
-			holderModel.Amount = holderModel.Amount + listingDetailModel.Amount
-			result = protocol.db.Save(&holderModel)
-			if result.Error != nil {
-				return fmt.Errorf("unable to update seller's balance '%s'", err)
-			}
-
-			// Log history
-
-			// Record the transfer
-			historyModel := models.TokenAddressHistory{
-				ChainID:       parsedURN.ChainID,
-				Height:        currentTransaction.Height,
-				TransactionID: currentTransaction.ID,
-				TokenID:       listingDetailModel.TokenID,
-				Sender:        protocol.virtualAddress,
-				Receiver:      sender,
-				Action:        action,
-				Amount:        uint64(listingDetailModel.Amount),
-				DateCreated:   currentTransaction.DateCreated,
-			}
-			result = protocol.db.Save(&historyModel)
-			if result.Error != nil {
-				// If we can't store the history, that fine, we shouldn't fail
-				return nil
-			}
-			return nil
-
-		}
-
-		var inscriptionListingDetailModel models.MarketplaceInscriptionDetail
-		result = protocol.db.Where("listing_id = ?", listingModel.ID).First(&inscriptionListingDetailModel)
-		if result.Error == nil {
-			// This is an inscription listing, continue by returning the inscription
-			var inscriptionModel models.Inscription
-			result = protocol.db.Where("chain_id = ? AND id = ?", parsedURN.ChainID, inscriptionListingDetailModel.InscriptionID).First(&inscriptionModel)
-			if result.Error != nil {
-				return fmt.Errorf("sender never had this inscription to sell")
-			}
-
-			inscriptionModel.CurrentOwner = sender
-			result = protocol.db.Save(&inscriptionModel)
-			if result.Error != nil {
-				return fmt.Errorf("unable to update inscription's owner '%s'", err)
-			}
-
-			// Log history
-			// Record the transfer
-			historyModel := models.InscriptionHistory{
-				ChainID:       parsedURN.ChainID,
-				Height:        currentTransaction.Height,
-				TransactionID: currentTransaction.ID,
-				InscriptionID: inscriptionModel.ID,
-				Sender:        protocol.virtualAddress,
-				Receiver:      sender,
-				Action:        "delist",
-				DateCreated:   currentTransaction.DateCreated,
-			}
-			result = protocol.db.Save(&historyModel)
-			if result.Error != nil {
-				// If we can't store the history, that fine, we shouldn't fail
-				_ = result
-			}
-
-			// Record the listing history
-			listingHistory := models.MarketplaceListingHistory{
-				ListingID:     listingModel.ID,
-				TransactionID: currentTransaction.ID,
-				SenderAddress: sender,
-				Action:        "delist",
-				DateCreated:   currentTransaction.DateCreated,
-			}
-			result = protocol.db.Save(&listingHistory)
-			if result.Error != nil {
-				// If we can't store the history, that is fine, we shouldn't fail
-				_ = result
-			}
-
-			if inscriptionModel.CollectionID.Valid {
-				protocol.workerClient.UpdateCollectionStats(uint64(inscriptionModel.CollectionID.Int64))
-			}
+	success := false
 
+	for _, hash := range hashes {
+		// Process buy for each hash, a failed buy must not leave partial
+		// changes behind when other hashes succeed
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return protocol.BuyCFT20(tx, parsedURN.ChainID, sender, rawTransaction, currentTransaction, hash)
+		})
+		if err == nil {
+			success = true
 		}
+	}
 
-	case "buy.cft20":
-		var hashes []string
-		if parsedURN.KeyValuePairs == nil {
-			hashes, err = protocol.GetListingHashesFromExt(rawTransaction)
-			if err != nil {
-				return err
-			}
-		} else {
-			hashes = strings.Split(strings.TrimSpace(parsedURN.KeyValuePairs["h"]), ",")
-		}
+	if !success {
+		return err
+	}
 
-		var err error
-		success := false
+	return nil
+}
 
-		for _, hash := range hashes {
-			// Process deposit for each hash
-			err = protocol.BuyCFT20(parsedURN.ChainID, sender, rawTransaction, currentTransaction, hash)
-			if err == nil {
-				success = true
-			}
-		}
+// processBuyInscription handles the buy.inscription operation
+func (protocol *Marketplace) processBuyInscription(db *gorm.DB, currentTransaction models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	action := "buy"
+	hash := strings.TrimSpace(parsedURN.KeyValuePairs["h"])
 
-		if !success {
-			return err
-		}
+	// Buys are based on the listing transaction hash, find the transaction
+	// and matching listing
+	var transactionModel models.Transaction
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chain.ID, hash).First(&transactionModel)
+	if result.Error != nil {
+		return NewError(CodeListingNotFound, "no listing transaction with hash '%s'", hash).With("hash", hash)
+	}
 
-		return nil
+	// Fetch listing based on hash
+	var listingModel models.MarketplaceListing
+	result = db.Where("chain_id = ? AND transaction_id = ?", parsedURN.ChainID, transactionModel.ID).First(&listingModel)
+	if result.Error != nil {
+		return NewError(CodeListingNotFound, "no listing with hash '%s'", hash).With("hash", hash)
+	}
 
-	case "buy.inscription":
-		action := "buy"
-		hash := strings.TrimSpace(parsedURN.KeyValuePairs["h"])
+	// Check if listing is filled or cancelled
+	if listingModel.IsFilled {
+		return NewError(CodeListingFilled, "listing has already been filled")
+	}
+	if listingModel.IsCancelled {
+		return NewError(CodeListingCancelled, "listing has already been cancelled")
+	}
 
-		// Buys are based on the listing transaction hash, find the transaction
-		// and matching listing
-		var transactionModel models.Transaction
-		result := protocol.db.Where("hash = ?", hash).First(&transactionModel)
-		if result.Error != nil {
-			return fmt.Errorf("no listing transaction with hash '%s'", hash)
-		}
+	// Fetch inscription listing detail
+	var listingDetailModel models.MarketplaceInscriptionDetail
+	result = db.Where("listing_id = ?", listingModel.ID).First(&listingDetailModel)
+	if result.Error != nil {
+		return NewError(CodeListingNotFound, "no inscription listing with hash '%s'", hash).With("hash", hash)
+	}
 
-		// Fetch listing based on hash
-		var listingModel models.MarketplaceListing
-		result = protocol.db.Where("chain_id = ? AND transaction_id = ?", parsedURN.ChainID, transactionModel.ID).First(&listingModel)
-		if result.Error != nil {
-			return fmt.Errorf("no listing with hash '%s'", hash)
+	if listingModel.IsDeposited {
+		if listingModel.DepositorAddress != sender {
+			return NewError(CodeNotDepositor, "sender is not the depositor of the listing, buyer must deposit first")
 		}
+	} else {
+		return NewError(CodeListingNotDeposited, "listing has not been deposited, buyer must deposit first")
+	}
 
-		// Check if listing is filled or cancelled
-		if listingModel.IsFilled {
-			return fmt.Errorf("listing has already been filled")
-		}
-		if listingModel.IsCancelled {
-			return fmt.Errorf("listing has already been cancelled")
-		}
+	// Check the amount still owed after deposit
+	amountOwed := listingModel.Total - listingModel.DepositTotal
 
-		// Fetch inscription listing detail
-		var listingDetailModel models.MarketplaceInscriptionDetail
-		result = protocol.db.Where("listing_id = ?", listingModel.ID).First(&listingDetailModel)
+	// Check royalty
+	var inscriptionModel models.Inscription
+	result = db.Where("chain_id = ? AND id = ?", parsedURN.ChainID, listingDetailModel.InscriptionID).First(&inscriptionModel)
+	if result.Error != nil {
+		return NewError(CodeInscriptionNotFound, "inscription with id '%d' doesn't exist", listingDetailModel.InscriptionID).With("inscription_id", listingDetailModel.InscriptionID)
+	}
+	if inscriptionModel.CollectionID.Valid {
+		var collectionModel models.Collection
+		result = db.Where("id = ?", inscriptionModel.CollectionID).First(&collectionModel)
 		if result.Error != nil {
-			return fmt.Errorf("no inscription listing with hash '%s'", hash)
+			return NewError(CodeCollectionNotFound, "collection with id '%d' doesn't exist", inscriptionModel.CollectionID.Int64).With("collection_id", inscriptionModel.CollectionID.Int64)
 		}
 
-		if listingModel.IsDeposited {
-			if listingModel.DepositorAddress != sender {
-				return fmt.Errorf("sender is not the depositor of the listing, buyer must deposit first")
-			}
-		} else {
-			return fmt.Errorf("listing has not been deposited, buyer must deposit first")
-		}
-
-		// Check the amount still owed after deposit
-		amountOwed := listingModel.Total - listingModel.DepositTotal
-
-		// Check royalty
-		var inscriptionModel models.Inscription
-		result = protocol.db.Where("chain_id = ? AND id = ?", parsedURN.ChainID, listingDetailModel.InscriptionID).First(&inscriptionModel)
-		if result.Error != nil {
-			return fmt.Errorf("inscription with id '%d' doesn't exist", listingDetailModel.InscriptionID)
-		}
-		if inscriptionModel.CollectionID.Valid {
-			var collectionModel models.Collection
-			result = protocol.db.Where("id = ?", inscriptionModel.CollectionID).First(&collectionModel)
-			if result.Error != nil {
-				return fmt.Errorf("collection with id '%d' doesn't exist", inscriptionModel.CollectionID.Int64)
+		if collectionModel.RoyaltyPercentage.Valid && collectionModel.RoyaltyPercentage.Float64 > 0 {
+			royaltyAddress := collectionModel.Creator
+			if collectionModel.PaymentAddress.Valid {
+				royaltyAddress = collectionModel.PaymentAddress.String
 			}
 
-			if collectionModel.RoyaltyPercentage.Valid && collectionModel.RoyaltyPercentage.Float64 > 0 {
-				royaltyAddress := collectionModel.Creator
-				if collectionModel.PaymentAddress.Valid {
-					royaltyAddress = collectionModel.PaymentAddress.String
+			if royaltyAddress != listingModel.SellerAddress {
+				expectedRoyalty := uint64(float64(listingModel.Total) * collectionModel.RoyaltyPercentage.Float64)
+				royaltySent, err := GetBaseTokensSent(rawTransaction, protocol.chain, currentTransaction.Height, royaltyAddress, Send)
+				if err != nil {
+					return NewError(CodeInvalidRoyalty, "invalid royalty tokens sent '%s'", err)
 				}
 
-				if royaltyAddress != listingModel.SellerAddress {
-					expectedRoyalty := uint64(float64(listingModel.Total) * collectionModel.RoyaltyPercentage.Float64)
-					royaltySent, err := GetBaseTokensSent(rawTransaction, royaltyAddress, Send, protocol.ibcEnabled)
-					if err != nil {
-						return fmt.Errorf("invalid royalty tokens sent '%s'", err)
-					}
-
-					if royaltySent < expectedRoyalty {
-						return fmt.Errorf("sender did not send enough tokens to complete the buy")
-					}
-
-					amountOwed -= expectedRoyalty
+				if royaltySent < expectedRoyalty {
+					return NewError(CodeInvalidRoyalty, "sender did not send enough royalty tokens, amount sent: %d, amount expected %d", royaltySent, expectedRoyalty).
+						With("amount", royaltySent).
+						With("expected_amount", expectedRoyalty).
+						With("royalty_address", royaltyAddress)
 				}
+
+				amountOwed -= expectedRoyalty
 			}
 		}
+	}
 
-		// Check that the correct amount was sent with the buy
-		amountSent, err := GetBaseTokensSent(rawTransaction, listingModel.SellerAddress, Send, protocol.ibcEnabled)
-		if err != nil {
-			return fmt.Errorf("invalid tokens sent '%s'", err)
-		}
+	// Check that the correct amount was sent with the buy
+	amountSent, err := GetBaseTokensSent(rawTransaction, protocol.chain, currentTransaction.Height, listingModel.SellerAddress, Send)
+	if err != nil {
+		return err
+	}
 
-		if amountSent < amountOwed {
-			return fmt.Errorf("sender did not send enough tokens to complete the buy")
-		}
+	if amountSent < amountOwed {
+		return NewError(CodeInsufficientPayment, "sender did not send enough tokens to complete the buy")
+	}
 
-		// Verify that the sender sent enough to cover the feee
-		// Get amount owed with decimals
-		amountOwedWithDecimals := float64(amountOwed) / math.Pow10(6)
-		requiredFee := amountOwedWithDecimals * protocol.tradeFee
-		requiredFeeAbsolute := requiredFee * math.Pow10(6)
-		if requiredFeeAbsolute < 1 {
-			requiredFeeAbsolute = 1
-		}
+	// Verify that the sender sent enough to cover the feee
+	// Get amount owed with decimals
+	amountOwedWithDecimals := float64(amountOwed) / math.Pow10(6)
+	requiredFee := amountOwedWithDecimals * protocol.tradeFee
+	requiredFeeAbsolute := requiredFee * math.Pow10(6)
+	if requiredFeeAbsolute < 1 {
+		requiredFeeAbsolute = 1
+	}
 
-		// Check that the correct amount was sent with the buy
-		amountSent, err = GetBaseTokensSent(rawTransaction, protocol.ibcReceiver, IbcTransfer, protocol.ibcEnabled)
-		if err != nil {
-			return fmt.Errorf("invalid tokens sent '%s'", err)
-		}
-		if amountSent < uint64(math.Floor(requiredFeeAbsolute)) {
-			return fmt.Errorf("sender did not send enough tokens to cover the purchase fee")
-		}
+	// Check that the correct amount was sent with the buy
+	amountSent, err = GetBaseTokensSent(rawTransaction, protocol.chain, currentTransaction.Height, protocol.chain.FeeReceiver, IbcTransfer)
+	if err != nil {
+		return err
+	}
+	if amountSent < uint64(math.Floor(requiredFeeAbsolute)) {
+		return NewError(CodeInsufficientPayment, "sender did not send enough tokens to cover the purchase fee")
+	}
 
-		// Everything checks out, complete the buy and transfer the tokens to the buyer
-		listingModel.IsFilled = true
-		listingModel.DateUpdated = currentTransaction.DateCreated
-		result = protocol.db.Save(&listingModel)
-		if result.Error != nil {
-			return result.Error
-		}
+	// Everything checks out, complete the buy and transfer the tokens to the buyer
+	listingModel.IsFilled = true
+	listingModel.DateUpdated = currentTransaction.DateCreated
+	result = db.Save(&listingModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-		// Set the sender as the new owner of the inscription
-		inscriptionModel.CurrentOwner = sender
-		result = protocol.db.Save(&inscriptionModel)
-		if result.Error != nil {
-			return fmt.Errorf("unable to update owner '%s'", err)
-		}
+	eventData := listingEventData(listingModel, hash)
+	eventData["buyer"] = sender
+	eventData["inscription_id"] = inscriptionModel.ID
+	err = emitEvent(db, currentTransaction, EventListingFilled, eventData)
+	if err != nil {
+		return err
+	}
 
-		// Record the listing history
-		listingHistory := models.MarketplaceListingHistory{
-			ListingID:     listingModel.ID,
-			TransactionID: currentTransaction.ID,
-			SenderAddress: sender,
-			Action:        action,
-			DateCreated:   currentTransaction.DateCreated,
-		}
-		result = protocol.db.Save(&listingHistory)
-		if result.Error != nil {
-			// If we can't store the history, that is fine, we shouldn't fail
-			return nil
-		}
+	// Set the sender as the new owner of the inscription
+	inscriptionModel.CurrentOwner = sender
+	result = db.Save(&inscriptionModel)
+	if result.Error != nil {
+		return NewError(CodeInternal, "unable to update owner '%w'", result.Error)
+	}
 
-		// Record the transfer from marketplace to buyer
-		historyModel := models.InscriptionHistory{
-			ChainID:       parsedURN.ChainID,
-			Height:        currentTransaction.Height,
-			TransactionID: currentTransaction.ID,
-			InscriptionID: inscriptionModel.ID,
-			Sender:        protocol.virtualAddress,
-			Receiver:      sender,
-			Action:        action,
-			DateCreated:   currentTransaction.DateCreated,
-		}
-		result = protocol.db.Save(&historyModel)
-		if result.Error != nil {
-			// If we can't store the history, that fine, we shouldn't fail
-			_ = result
-		}
+	// Record the listing history
+	listingHistory := models.MarketplaceListingHistory{
+		ListingID:     listingModel.ID,
+		TransactionID: currentTransaction.ID,
+		SenderAddress: sender,
+		Action:        action,
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&listingHistory)
+	if result.Error != nil {
+		// If we can't store the history, that is fine, we shouldn't fail
+		return nil
+	}
 
-		// CAPTURE TRADE HISTORY FOR VOLUME
+	// Record the transfer from marketplace to buyer
+	historyModel := models.InscriptionHistory{
+		ChainID:       parsedURN.ChainID,
+		Height:        currentTransaction.Height,
+		TransactionID: currentTransaction.ID,
+		InscriptionID: inscriptionModel.ID,
+		Sender:        protocol.virtualAddress,
+		Receiver:      sender,
+		Action:        action,
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&historyModel)
+	if result.Error != nil {
+		// If we can't store the history, that fine, we shouldn't fail
+		_ = result
+	}
 
-		// Get current USD price of the base
-		var statusModel models.Status
-		result = protocol.db.Where("chain_id = ?", parsedURN.ChainID).First(&statusModel)
-		if result.Error != nil {
-			// If this fails we just don't update the history
-			return nil
-		}
+	// CAPTURE TRADE HISTORY FOR VOLUME
 
-		// Capture the trade in the history for future charts
-		totalWithDecimals := float64(listingModel.Total) / math.Pow10(6)
-		tradeHistory := models.InscriptionTradeHistory{
-			ChainID:       parsedURN.ChainID,
-			TransactionID: currentTransaction.ID,
-			InscriptionID: inscriptionModel.ID,
-			SellerAddress: listingModel.SellerAddress,
-			BuyerAddress:  sender,
-			AmountQuote:   listingModel.Total, // ATOM
-			TotalUSD:      totalWithDecimals * statusModel.BaseTokenUSD,
-			DateCreated:   currentTransaction.DateCreated,
-		}
-		result = protocol.db.Save(&tradeHistory)
-		if result.Error != nil {
-			// Continue, this is not critical
-			_ = result
-		}
+	// Get the USD value of the trade at the time of the trade
+	totalUSD, err := tradeValueUSD(db, protocol.chain, parsedURN.ChainID, currentTransaction.DateCreated, listingModel.Total)
+	if err != nil {
+		// If this fails we just don't update the history
+		return nil
+	}
 
-		if inscriptionModel.CollectionID.Valid {
-			protocol.workerClient.UpdateCollectionStats(uint64(inscriptionModel.CollectionID.Int64))
+	// Capture the trade in the history for future charts
+	tradeHistory := models.InscriptionTradeHistory{
+		ChainID:       parsedURN.ChainID,
+		TransactionID: currentTransaction.ID,
+		InscriptionID: inscriptionModel.ID,
+		SellerAddress: listingModel.SellerAddress,
+		BuyerAddress:  sender,
+		AmountQuote:   listingModel.Total, // ATOM
+		TotalUSD:      totalUSD,
+		DateCreated:   currentTransaction.DateCreated,
+	}
+	result = db.Save(&tradeHistory)
+	if result.Error != nil {
+		// Continue, this is not critical
+		_ = result
+	}
+
+	if inscriptionModel.CollectionID.Valid {
+		err = protocol.workerClient.UpdateCollectionStats(db, uint64(inscriptionModel.CollectionID.Int64))
+		if err != nil {
+			return err
 		}
 	}
 
@@ -81,6 +81,10 @@ func TestMetadataMigrationWithEmptyTrait(t *testing.T) {
 }
 
 func TestReservations(t *testing.T) {
-	reservationsByName, _ := GetReservations("../../../data/collection-reservations.csv")
+	reservationsByName, _, err := LoadReservations("../../../data/collection-reservations.csv")
+	assert.NoError(t, err)
 	assert.NotEmpty(t, reservationsByName, "reservationsByName should not be empty")
+
+	_, _, err = LoadReservations("testdata/missing-reservations.csv")
+	assert.Error(t, err, "a missing reservations file should fail to load")
 }
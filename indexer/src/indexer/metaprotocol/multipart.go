@@ -0,0 +1,208 @@
+package metaprotocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// assembledMessage is the metadata and content of a completed multipart
+// upload, inscribed like the extension message of a single transaction
+type assembledMessage struct {
+	metadata []byte
+	content  []byte
+}
+
+func (msg assembledMessage) GetMetadata(v any) ([]byte, error) {
+	err := json.Unmarshal(msg.metadata, v)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal metadata '%s'", err)
+	}
+	return msg.metadata, nil
+}
+
+func (msg assembledMessage) GetMetadataBytes() ([]byte, error) {
+	return msg.metadata, nil
+}
+
+func (msg assembledMessage) GetContent() ([]byte, error) {
+	return msg.content, nil
+}
+
+// processInscribePart handles the inscribe-part operation. The parts of an
+// upload are identified by the sender and the content hash of the combined
+// content, and must be sent in order. The first part carries the inscription
+// metadata, the inscription is created when the last part arrives
+func (protocol *Inscription) processInscribePart(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	contentHash := parsedURN.KeyValuePairs["h"]
+
+	msg, err := getExtensionMessage(rawTransaction)
+	if err != nil {
+		return err
+	}
+	var partMetadata types.InscriptionPartMetadata
+	jsonBytes, err := msg.GetMetadata(&partMetadata)
+	if err != nil {
+		return WrapError(CodeInvalidExtension, err)
+	}
+	part := partMetadata.Multipart
+	if part.Total < 1 || part.Total > protocol.multipartMaxParts {
+		return NewError(CodeInvalidPart, "part total must be between 1 and %d", protocol.multipartMaxParts).
+			With("total", part.Total).
+			With("maximum", protocol.multipartMaxParts)
+	}
+	if part.Index >= part.Total {
+		return NewError(CodeInvalidPart, "part index %d is out of range for %d parts", part.Index, part.Total).
+			With("index", part.Index).
+			With("total", part.Total)
+	}
+
+	content, err := msg.GetContent()
+	if err != nil {
+		return err
+	}
+
+	parts, err := protocol.getUploadParts(db, transactionModel.Height, sender, contentHash)
+	if err != nil {
+		return err
+	}
+
+	expiresHeight := transactionModel.Height + protocol.multipartExpiryBlocks
+	if part.Index == 0 {
+		if len(parts) > 0 {
+			return NewError(CodeUploadExists, "upload of content hash '%s' has already started", contentHash).With("content_hash", contentHash)
+		}
+		inscribed, err := protocol.contentInscribed(db, contentHash)
+		if err != nil {
+			return err
+		}
+		if inscribed {
+			return NewError(CodeAlreadyInscribed, "content hash '%s' is already inscribed", contentHash).With("content_hash", contentHash)
+		}
+		var inscriptionMetadata types.InscriptionMetadata[types.NftMetadata]
+		err = json.Unmarshal(jsonBytes, &inscriptionMetadata)
+		if err != nil {
+			return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
+		}
+	} else {
+		if len(parts) == 0 {
+			return protocol.uploadNotFound(db, transactionModel.Height, contentHash)
+		}
+		if part.Total != parts[0].PartTotal {
+			return NewError(CodeInvalidPart, "part total %d does not match the upload total of %d", part.Total, parts[0].PartTotal).
+				With("total", part.Total).
+				With("expected", parts[0].PartTotal)
+		}
+		if part.Index != uint(len(parts)) {
+			return NewError(CodeInvalidPart, "expected part %d, got part %d", len(parts), part.Index).
+				With("index", part.Index).
+				With("expected", len(parts))
+		}
+		expiresHeight = parts[0].ExpiresHeight
+	}
+
+	if part.Index < part.Total-1 {
+		partModel := models.InscriptionPart{
+			ChainID:       parsedURN.ChainID,
+			Height:        transactionModel.Height,
+			TransactionID: transactionModel.ID,
+			Creator:       sender,
+			ContentHash:   contentHash,
+			PartIndex:     part.Index,
+			PartTotal:     part.Total,
+			Content:       content,
+			ExpiresHeight: expiresHeight,
+			DateCreated:   transactionModel.DateCreated,
+		}
+		if part.Index == 0 {
+			partModel.Metadata = datatypes.JSON(jsonBytes)
+		}
+		return db.Create(&partModel).Error
+	}
+
+	// The last part completes the upload
+	metadata := jsonBytes
+	contents := make([][]byte, 0, len(parts)+1)
+	for _, uploaded := range parts {
+		contents = append(contents, uploaded.Content)
+	}
+	contents = append(contents, content)
+	if len(parts) > 0 {
+		metadata = parts[0].Metadata
+	}
+	combined := bytes.Join(contents, nil)
+
+	// Multipart inscriptions always require a matching content hash
+	if !types.ContentHashMatches(contentHash, combined) {
+		computedHash := types.ContentHash(combined)
+		return NewError(CodeContentHashMismatch, "content hash '%s' does not match the combined content, expected '%s'", contentHash, computedHash).
+			With("content_hash", contentHash).
+			With("computed_hash", computedHash)
+	}
+
+	err = db.Where("chain_id = ? AND creator = ? AND content_hash = ?", protocol.chainID, sender, contentHash).Delete(&models.InscriptionPart{}).Error
+	if err != nil {
+		return err
+	}
+	return protocol.inscribe(db, transactionModel, parsedURN, rawTransaction, sender, contentHash, assembledMessage{
+		metadata: metadata,
+		content:  combined,
+	})
+}
+
+// contentInscribed returns true if a collection or inscription was
+// inscribed with contentHash, uploads of inscribed content are rejected
+// before their parts are stored
+func (protocol *Inscription) contentInscribed(db *gorm.DB, contentHash string) (bool, error) {
+	for _, model := range []interface{}{&models.Collection{}, &models.Inscription{}} {
+		var count int64
+		err := db.Model(model).Where("chain_id = ? AND (content_hash = ? OR computed_hash = ?)", protocol.chainID, contentHash, contentHash).Count(&count).Error
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getUploadParts returns the parts of the upload of sender with contentHash
+// in order. The parts of an upload that expired before height are removed
+func (protocol *Inscription) getUploadParts(db *gorm.DB, height uint64, sender string, contentHash string) ([]models.InscriptionPart, error) {
+	var parts []models.InscriptionPart
+	err := db.Where("chain_id = ? AND creator = ? AND content_hash = ?", protocol.chainID, sender, contentHash).Order("part_index").Find(&parts).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 || parts[0].ExpiresHeight >= height {
+		return parts, nil
+	}
+
+	err = db.Where("chain_id = ? AND creator = ? AND content_hash = ?", protocol.chainID, sender, contentHash).Delete(&models.InscriptionPart{}).Error
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// uploadNotFound returns the error for a part without an upload of the
+// sender, parts can only be added to an upload by the sender that started it
+func (protocol *Inscription) uploadNotFound(db *gorm.DB, height uint64, contentHash string) error {
+	var firstPart models.InscriptionPart
+	result := db.Where("chain_id = ? AND content_hash = ? AND part_index = 0 AND expires_height >= ?", protocol.chainID, contentHash, height).First(&firstPart)
+	if result.Error == nil {
+		return NewError(CodeNotOwner, "upload of content hash '%s' was started by another sender", contentHash).
+			With("content_hash", contentHash).
+			With("creator", firstPart.Creator)
+	}
+	if result.Error != gorm.ErrRecordNotFound {
+		return result.Error
+	}
+	return NewError(CodeUploadNotFound, "no upload of content hash '%s' in progress", contentHash).With("content_hash", contentHash)
+}
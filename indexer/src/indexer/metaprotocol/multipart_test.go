@@ -0,0 +1,163 @@
+package metaprotocol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// decodePartTransaction returns a transaction with the metadata and content
+// of a part in its extension options
+func decodePartTransaction(t *testing.T, metadata string, content string) types.Transaction {
+	var rawTransaction types.Transaction
+	err := json.Unmarshal([]byte(fmt.Sprintf(`{"body": {"messages": [], "non_critical_extension_options": [{"@type": "/cosmos.authz.v1beta1.MsgRevoke", "granter": %q, "grantee": %q, "msg_type_url": "/cosmos.bank.v1beta1.MsgSend"}]}}`,
+		base64.StdEncoding.EncodeToString([]byte(metadata)),
+		base64.StdEncoding.EncodeToString([]byte(content)),
+	)), &rawTransaction)
+	assert.NoError(t, err)
+	return rawTransaction
+}
+
+func TestInscribePartValidation(t *testing.T) {
+	protocol := &Inscription{multipartMaxParts: 4}
+	parsedURN := ProtocolURN{KeyValuePairs: map[string]string{"h": types.ContentHash([]byte("content"))}}
+
+	// Parts are validated before any state is loaded
+	rawTransaction := decodePartTransaction(t, `{"multipart": {"index": 0, "total": 5}}`, "part")
+	err := protocol.processInscribePart(nil, models.Transaction{}, parsedURN, rawTransaction, "cosmos1sender")
+	code, details := ErrorCodeOf(err)
+	assert.Equal(t, CodeInvalidPart, code, "uploads may not have more than the maximum parts")
+	assert.Equal(t, uint(4), details["maximum"])
+
+	rawTransaction = decodePartTransaction(t, `{"multipart": {"index": 2, "total": 2}}`, "part")
+	err = protocol.processInscribePart(nil, models.Transaction{}, parsedURN, rawTransaction, "cosmos1sender")
+	code, _ = ErrorCodeOf(err)
+	assert.Equal(t, CodeInvalidPart, code, "the index must be less than the total")
+
+	rawTransaction = decodePartTransaction(t, `{"multipart": {"index": "first"}}`, "part")
+	err = protocol.processInscribePart(nil, models.Transaction{}, parsedURN, rawTransaction, "cosmos1sender")
+	code, _ = ErrorCodeOf(err)
+	assert.Equal(t, CodeInvalidExtension, code)
+}
+
+// newMultipartTest returns an inscription processor and a database for
+// multipart uploads that expire after 10 blocks
+func newMultipartTest(t *testing.T) (*Inscription, *gorm.DB) {
+	db := newTestDB(t, &models.Transaction{}, &models.Collection{}, &models.Inscription{}, &models.InscriptionHistory{}, &models.InscriptionPart{}, &models.EventOutbox{})
+	protocol := &Inscription{chainID: "cosmoshub-4", multipartMaxParts: 4, multipartExpiryBlocks: 10}
+	return protocol, db
+}
+
+// inscribePart sends part index of total parts with content at height
+func inscribePart(t *testing.T, protocol *Inscription, db *gorm.DB, height uint64, sender string, contentHash string, index int, total int, content string) error {
+	parsedURN := ProtocolURN{ChainID: "cosmoshub-4", Version: "v1", KeyValuePairs: map[string]string{"h": contentHash}}
+	metadata := fmt.Sprintf(`{"multipart": {"index": %d, "total": %d}, "metadata": {"name": "Upload", "mime": "text/plain"}}`, index, total)
+	transactionModel := models.Transaction{ID: height*10 + uint64(index), ChainID: "cosmoshub-4", Height: height}
+	return protocol.processInscribePart(db, transactionModel, parsedURN, decodePartTransaction(t, metadata, content), sender)
+}
+
+func TestInscribePartAssembly(t *testing.T) {
+	protocol, db := newMultipartTest(t)
+	contentHash := types.ContentHash([]byte("first second third"))
+
+	assert.NoError(t, inscribePart(t, protocol, db, 1, "cosmos1sender", contentHash, 0, 3, "first "))
+	assert.NoError(t, inscribePart(t, protocol, db, 2, "cosmos1sender", contentHash, 1, 3, "second "))
+	assert.NoError(t, inscribePart(t, protocol, db, 3, "cosmos1sender", contentHash, 2, 3, "third"))
+
+	var inscription models.Inscription
+	assert.NoError(t, db.Where("content_hash = ?", contentHash).First(&inscription).Error)
+	assert.Equal(t, uint64(len("first second third")), inscription.ContentSizeBytes)
+	assert.Equal(t, "cosmos1sender", inscription.CurrentOwner)
+	assert.False(t, inscription.IsHashMismatch)
+	assert.JSONEq(t, `{"multipart": {"index": 0, "total": 3}, "metadata": {"name": "Upload", "mime": "text/plain"}}`, string(inscription.Metadata), "the metadata of the first part should be inscribed")
+
+	var parts int64
+	assert.NoError(t, db.Model(&models.InscriptionPart{}).Count(&parts).Error)
+	assert.Zero(t, parts, "the parts should be removed once inscribed")
+
+	// Inscribed content can't be uploaded again
+	err := inscribePart(t, protocol, db, 4, "cosmos1other", contentHash, 0, 2, "first ")
+	code, _ := ErrorCodeOf(err)
+	assert.Equal(t, CodeAlreadyInscribed, code)
+}
+
+func TestInscribePartOrder(t *testing.T) {
+	protocol, db := newMultipartTest(t)
+	contentHash := types.ContentHash([]byte("first second third"))
+
+	err := inscribePart(t, protocol, db, 1, "cosmos1sender", contentHash, 1, 3, "second ")
+	code, _ := ErrorCodeOf(err)
+	assert.Equal(t, CodeUploadNotFound, code, "uploads should start with the first part")
+
+	assert.NoError(t, inscribePart(t, protocol, db, 1, "cosmos1sender", contentHash, 0, 3, "first "))
+	err = inscribePart(t, protocol, db, 2, "cosmos1sender", contentHash, 2, 3, "third")
+	code, details := ErrorCodeOf(err)
+	assert.Equal(t, CodeInvalidPart, code, "parts should be sent in order")
+	assert.Equal(t, 1, details["expected"])
+
+	err = inscribePart(t, protocol, db, 2, "cosmos1sender", contentHash, 0, 3, "first ")
+	code, _ = ErrorCodeOf(err)
+	assert.Equal(t, CodeUploadExists, code)
+
+	err = inscribePart(t, protocol, db, 2, "cosmos1sender", contentHash, 1, 4, "second ")
+	code, _ = ErrorCodeOf(err)
+	assert.Equal(t, CodeInvalidPart, code, "the total should match the first part")
+}
+
+func TestInscribePartOtherSender(t *testing.T) {
+	protocol, db := newMultipartTest(t)
+	contentHash := types.ContentHash([]byte("first second"))
+
+	assert.NoError(t, inscribePart(t, protocol, db, 1, "cosmos1sender", contentHash, 0, 2, "first "))
+	err := inscribePart(t, protocol, db, 2, "cosmos1other", contentHash, 1, 2, "second")
+	code, details := ErrorCodeOf(err)
+	assert.Equal(t, CodeNotOwner, code, "parts can only be added by the sender that started the upload")
+	assert.Equal(t, "cosmos1sender", details["creator"])
+
+	var inscriptions int64
+	assert.NoError(t, db.Model(&models.Inscription{}).Count(&inscriptions).Error)
+	assert.Zero(t, inscriptions)
+}
+
+func TestInscribePartExpiry(t *testing.T) {
+	protocol, db := newMultipartTest(t)
+	contentHash := types.ContentHash([]byte("first second"))
+
+	// The upload expires 10 blocks after the first part
+	assert.NoError(t, inscribePart(t, protocol, db, 1, "cosmos1sender", contentHash, 0, 2, "first "))
+	err := inscribePart(t, protocol, db, 12, "cosmos1other", contentHash, 1, 2, "second")
+	code, _ := ErrorCodeOf(err)
+	assert.Equal(t, CodeUploadNotFound, code, "expired uploads should not be reported as owned by another sender")
+
+	err = inscribePart(t, protocol, db, 12, "cosmos1sender", contentHash, 1, 2, "second")
+	code, _ = ErrorCodeOf(err)
+	assert.Equal(t, CodeUploadNotFound, code)
+	var parts int64
+	assert.NoError(t, db.Model(&models.InscriptionPart{}).Count(&parts).Error)
+	assert.Zero(t, parts, "the parts of an expired upload should be removed")
+
+	// The upload can be started again
+	assert.NoError(t, inscribePart(t, protocol, db, 12, "cosmos1sender", contentHash, 0, 2, "first "))
+	assert.NoError(t, inscribePart(t, protocol, db, 22, "cosmos1sender", contentHash, 1, 2, "second"))
+}
+
+func TestInscribePartHashMismatch(t *testing.T) {
+	protocol, db := newMultipartTest(t)
+	contentHash := types.ContentHash([]byte("first second"))
+
+	assert.NoError(t, inscribePart(t, protocol, db, 1, "cosmos1sender", contentHash, 0, 2, "first "))
+	err := inscribePart(t, protocol, db, 2, "cosmos1sender", contentHash, 1, 2, "other")
+	code, details := ErrorCodeOf(err)
+	assert.Equal(t, CodeContentHashMismatch, code, "the combined content should match the content hash")
+	assert.Equal(t, types.ContentHash([]byte("first other")), details["computed_hash"])
+
+	var inscriptions int64
+	assert.NoError(t, db.Model(&models.Inscription{}).Count(&inscriptions).Error)
+	assert.Zero(t, inscriptions)
+}
@@ -1,7 +1,6 @@
 package metaprotocol
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/leodido/go-urn"
@@ -12,6 +11,9 @@ type ProtocolURN struct {
 	Version       string
 	Operation     string
 	KeyValuePairs map[string]string
+	// SourceChannel is the IBC channel the memo was received on, it is empty
+	// for memos that were not sent over IBC
+	SourceChannel string
 }
 
 func ParseProtocolString(protocolURN *urn.URN) (ProtocolURN, error) {
@@ -21,13 +23,13 @@ func ParseProtocolString(protocolURN *urn.URN) (ProtocolURN, error) {
 	// cosmoshub-4@v1beta;inscribe$h=c4749f95902411d1a45a033d8a6b3e6aa0de0a0028fe8737f66fed6834dce8bf
 	sourceContent := strings.Split(protocolURN.SS, ";")
 	if len(sourceContent) != 2 {
-		return parsedProtocolURN, fmt.Errorf("invalid source/content split: %s", protocolURN.SS)
+		return parsedProtocolURN, NewError(CodeInvalidURN, "invalid source/content split: %s", protocolURN.SS)
 	}
 
 	// Parse cosmoshub-4@v1beta
 	sourceVersioning := strings.Split(sourceContent[0], "@")
 	if len(sourceVersioning) != 2 {
-		return parsedProtocolURN, fmt.Errorf("incorrect source versioning parts: %s", protocolURN.SS)
+		return parsedProtocolURN, NewError(CodeInvalidURN, "incorrect source versioning parts: %s", protocolURN.SS)
 	}
 	parsedProtocolURN.ChainID = sourceVersioning[0]
 	parsedProtocolURN.Version = sourceVersioning[1]
@@ -35,7 +37,7 @@ func ParseProtocolString(protocolURN *urn.URN) (ProtocolURN, error) {
 	// Parse inscribe$h=...contenthash...
 	opContent := strings.Split(sourceContent[1], "$")
 	if len(opContent) != 2 {
-		return parsedProtocolURN, fmt.Errorf("invalid op/content parts: %s", protocolURN.SS)
+		return parsedProtocolURN, NewError(CodeInvalidURN, "invalid op/content parts: %s", protocolURN.SS)
 	}
 	parsedProtocolURN.Operation = opContent[0]
 
@@ -57,7 +59,7 @@ func ParseProtocolString(protocolURN *urn.URN) (ProtocolURN, error) {
 				continue
 			}
 
-			return parsedProtocolURN, fmt.Errorf("invalid key/value pair: %s", protocolURN.SS)
+			return parsedProtocolURN, NewError(CodeInvalidURN, "invalid key/value pair: %s", protocolURN.SS)
 		}
 		keyValuePairs[keyValue[0]] = keyValue[1]
 		prevKey = keyValue[0]
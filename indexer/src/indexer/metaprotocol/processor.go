@@ -1,12 +1,9 @@
 package metaprotocol
 
-import (
-	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
-	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
-	"github.com/leodido/go-urn"
-)
-
 type Processor interface {
 	Name() string
-	Process(transactionModel models.Transaction, protocolURN *urn.URN, rawTransaction types.RawTransaction, sourceChannel string) error
+	// Operations declares the operations supported by the processor. The
+	// handlers receive the database transaction for the current indexer
+	// transaction, which is rolled back if an error is returned
+	Operations() []Operation
 }
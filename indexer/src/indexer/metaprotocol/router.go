@@ -0,0 +1,245 @@
+package metaprotocol
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/leodido/go-urn"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUnknownMetaprotocol is returned when no processor is registered for
+	// the metaprotocol in a memo
+	ErrUnknownMetaprotocol = errors.New("unknown metaprotocol")
+	// ErrUnknownOperation is returned when the processor does not support the
+	// operation in a memo
+	ErrUnknownOperation = errors.New("unknown operation")
+	// ErrInvalidOperation is returned when the operation version or fields
+	// don't match the operation declaration
+	ErrInvalidOperation = errors.New("invalid operation")
+)
+
+// FieldType is the type a key/value field of an operation must parse as
+type FieldType string
+
+const (
+	// FieldString accepts any non-empty value
+	FieldString FieldType = "string"
+	// FieldUint accepts unsigned integers
+	FieldUint FieldType = "uint"
+	// FieldDecimal accepts decimal numbers
+	FieldDecimal FieldType = "decimal"
+)
+
+// Field declares a key/value field of an operation
+type Field struct {
+	Key      string    `json:"key"`
+	Type     FieldType `json:"type"`
+	Optional bool      `json:"optional"`
+}
+
+// OperationHandler applies an operation that has passed validation
+type OperationHandler func(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error
+
+// Operation declares an operation supported by a processor
+type Operation struct {
+	Name string
+	// Versions the operation is valid for, any version is accepted if empty
+	Versions []string
+	// Fields are validated before the handler is called. Fields that are not
+	// declared are passed through to the handler unchecked
+	Fields  []Field
+	Handler OperationHandler
+}
+
+// OperationInfo describes a registered operation
+type OperationInfo struct {
+	Metaprotocol string   `json:"metaprotocol"`
+	Operation    string   `json:"operation"`
+	Versions     []string `json:"versions,omitempty"`
+	Fields       []Field  `json:"fields"`
+}
+
+// Router validates metaprotocol memos and routes them to the operation
+// handlers declared by the registered processors
+type Router struct {
+	chain      Chain
+	processors map[string]Processor
+	operations map[string]map[string]Operation
+}
+
+// NewRouter returns an empty router for chain
+func NewRouter(chain Chain) *Router {
+	return &Router{
+		chain:      chain,
+		processors: make(map[string]Processor),
+		operations: make(map[string]map[string]Operation),
+	}
+}
+
+// Register adds the operations of processor under the metaprotocol ID
+func (router *Router) Register(id string, processor Processor) error {
+	if _, ok := router.processors[id]; ok {
+		return fmt.Errorf("metaprotocol '%s' is already registered", id)
+	}
+
+	operations := make(map[string]Operation)
+	for _, operation := range processor.Operations() {
+		if _, ok := operations[operation.Name]; ok {
+			return fmt.Errorf("operation '%s' is declared twice by metaprotocol '%s'", operation.Name, id)
+		}
+		if operation.Handler == nil {
+			return fmt.Errorf("operation '%s' of metaprotocol '%s' has no handler", operation.Name, id)
+		}
+		operations[operation.Name] = operation
+	}
+
+	router.processors[id] = processor
+	router.operations[id] = operations
+	return nil
+}
+
+// Processor returns the processor registered for the metaprotocol ID
+func (router *Router) Processor(id string) (Processor, bool) {
+	processor, ok := router.processors[id]
+	return processor, ok
+}
+
+// HasOperation returns true if the operation is registered for the
+// metaprotocol ID
+func (router *Router) HasOperation(id string, operation string) bool {
+	_, ok := router.operations[id][operation]
+	return ok
+}
+
+// Reloader is implemented by processors with configuration that can be
+// reloaded while indexing
+type Reloader interface {
+	Reload() error
+}
+
+// Reload reloads the configuration of every processor that implements
+// Reloader
+func (router *Router) Reload() error {
+	for id, processor := range router.processors {
+		if reloader, ok := processor.(Reloader); ok {
+			err := reloader.Reload()
+			if err != nil {
+				return fmt.Errorf("unable to reload metaprotocol '%s': %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Catalogue returns all registered operations sorted by metaprotocol and
+// operation name
+func (router *Router) Catalogue() []OperationInfo {
+	var catalogue []OperationInfo
+	for id, operations := range router.operations {
+		for _, operation := range operations {
+			catalogue = append(catalogue, OperationInfo{
+				Metaprotocol: id,
+				Operation:    operation.Name,
+				Versions:     operation.Versions,
+				Fields:       operation.Fields,
+			})
+		}
+	}
+	sort.Slice(catalogue, func(a, b int) bool {
+		if catalogue[a].Metaprotocol != catalogue[b].Metaprotocol {
+			return catalogue[a].Metaprotocol < catalogue[b].Metaprotocol
+		}
+		return catalogue[a].Operation < catalogue[b].Operation
+	})
+	return catalogue
+}
+
+// Route parses and validates the protocol string in protocolURN and calls
+// the handler of the operation
+func (router *Router) Route(db *gorm.DB, transactionModel models.Transaction, protocolURN *urn.URN, rawTransaction types.Transaction, sourceChannel string) error {
+	operations, ok := router.operations[protocolURN.ID]
+	if !ok {
+		return NewError(CodeUnknownMetaprotocol, "%w '%s'", ErrUnknownMetaprotocol, protocolURN.ID).With("metaprotocol", protocolURN.ID)
+	}
+
+	// We need to parse the protocol specific string in SS, it contains
+	// {chainId}@{version};operation$key=value,key=value
+	parsedURN, err := ParseProtocolString(protocolURN)
+	if err != nil {
+		return err
+	}
+	parsedURN.SourceChannel = sourceChannel
+
+	if parsedURN.ChainID != router.chain.ID {
+		return NewError(CodeInvalidChain, "invalid chain ID '%s'", parsedURN.ChainID).With("chain_id", parsedURN.ChainID)
+	}
+
+	operation, ok := operations[parsedURN.Operation]
+	if !ok {
+		return NewError(CodeUnknownOperation, "%w '%s' for metaprotocol '%s'", ErrUnknownOperation, parsedURN.Operation, protocolURN.ID).With("operation", parsedURN.Operation)
+	}
+
+	err = validateOperation(operation, parsedURN)
+	if err != nil {
+		return err
+	}
+
+	sender, err := router.SenderAddress(rawTransaction, transactionModel.Height)
+	if err != nil {
+		return WrapError(CodeInvalidTransaction, err)
+	}
+
+	return operation.Handler(db, transactionModel, parsedURN, rawTransaction, sender)
+}
+
+// SenderAddress returns the sender of rawTransaction with the rules of the
+// chain at height
+func (router *Router) SenderAddress(rawTransaction types.Transaction, height uint64) (string, error) {
+	return GetSenderAddress(rawTransaction, router.chain, height)
+}
+
+// validateOperation checks the version and fields of parsedURN against the
+// operation declaration
+func validateOperation(operation Operation, parsedURN ProtocolURN) error {
+	if len(operation.Versions) > 0 {
+		supported := false
+		for _, version := range operation.Versions {
+			if parsedURN.Version == version {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return NewError(CodeUnsupportedVersion, "%w: '%s' requires version %s", ErrInvalidOperation, operation.Name, strings.Join(operation.Versions, " or ")).With("versions", operation.Versions)
+		}
+	}
+
+	for _, field := range operation.Fields {
+		value := strings.TrimSpace(parsedURN.KeyValuePairs[field.Key])
+		if value == "" {
+			if field.Optional {
+				continue
+			}
+			return NewError(CodeInvalidOperation, "%w: missing required field '%s'", ErrInvalidOperation, field.Key).With("field", field.Key)
+		}
+
+		var err error
+		switch field.Type {
+		case FieldUint:
+			_, err = strconv.ParseUint(value, 10, 64)
+		case FieldDecimal:
+			_, err = strconv.ParseFloat(value, 64)
+		}
+		if err != nil {
+			return NewError(CodeInvalidField, "%w: field '%s' must be a %s", ErrInvalidOperation, field.Key, field.Type).With("field", field.Key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package metaprotocol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/leodido/go-urn"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// testProcessor records the operations routed to it
+type testProcessor struct {
+	routed []ProtocolURN
+}
+
+func (protocol *testProcessor) Name() string {
+	return "test"
+}
+
+func (protocol *testProcessor) Operations() []Operation {
+	return []Operation{
+		{
+			Name:     "send",
+			Versions: []string{"v1"},
+			Fields: []Field{
+				{Key: "amt", Type: FieldUint},
+				{Key: "ppt", Type: FieldDecimal, Optional: true},
+			},
+			Handler: protocol.handle,
+		},
+	}
+}
+
+func (protocol *testProcessor) handle(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
+	protocol.routed = append(protocol.routed, parsedURN)
+	return nil
+}
+
+func routeMemo(t *testing.T, router *Router, memo string) error {
+	protocolURN, ok := urn.Parse([]byte(memo))
+	assert.True(t, ok, "memo should be a valid URN")
+
+	var rawTransaction types.Transaction
+	err := json.Unmarshal([]byte(`{"body": {"messages": [{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1sender"}]}}`), &rawTransaction)
+	assert.NoError(t, err)
+
+	return router.Route(nil, models.Transaction{}, protocolURN, rawTransaction, "channel-0")
+}
+
+func TestRouterRoute(t *testing.T) {
+	processor := &testProcessor{}
+	router := NewRouter(Chain{ID: "cosmoshub-4"})
+	assert.NoError(t, router.Register("test", processor))
+
+	err := routeMemo(t, router, "urn:test:cosmoshub-4@v1;send$amt=10,ppt=0.5")
+	assert.NoError(t, err)
+	assert.Len(t, processor.routed, 1)
+	assert.Equal(t, "channel-0", processor.routed[0].SourceChannel)
+
+	err = routeMemo(t, router, "urn:test:cosmoshub-4@v1;send$amt=10")
+	assert.NoError(t, err, "optional fields may be omitted")
+
+	err = routeMemo(t, router, "urn:test:cosmoshub-4@v1;recv$amt=10")
+	assert.ErrorIs(t, err, ErrUnknownOperation)
+
+	err = routeMemo(t, router, "urn:other:cosmoshub-4@v1;send$amt=10")
+	assert.ErrorIs(t, err, ErrUnknownMetaprotocol)
+
+	err = routeMemo(t, router, "urn:test:cosmoshub-4@v2;send$amt=10")
+	assert.ErrorIs(t, err, ErrInvalidOperation, "unsupported version should be rejected")
+
+	err = routeMemo(t, router, "urn:test:cosmoshub-4@v1;send$amt=1.5")
+	assert.ErrorIs(t, err, ErrInvalidOperation, "field types should be validated")
+
+	err = routeMemo(t, router, "urn:test:cosmoshub-4@v1;send$ppt=1")
+	assert.ErrorIs(t, err, ErrInvalidOperation, "required fields should be validated")
+
+	err = routeMemo(t, router, "urn:test:osmosis-1@v1;send$amt=10")
+	assert.Error(t, err, "other chains should be rejected")
+
+	assert.Len(t, processor.routed, 2, "invalid operations should not reach the handler")
+}
+
+func TestRouterCatalogue(t *testing.T) {
+	router := NewRouter(Chain{ID: "cosmoshub-4"})
+	assert.NoError(t, router.Register("test", &testProcessor{}))
+	assert.Error(t, router.Register("test", &testProcessor{}), "metaprotocols may only be registered once")
+
+	catalogue := router.Catalogue()
+	assert.Len(t, catalogue, 1)
+	assert.Equal(t, "test", catalogue[0].Metaprotocol)
+	assert.Equal(t, "send", catalogue[0].Operation)
+	assert.True(t, router.HasOperation("test", "send"))
+	assert.False(t, router.HasOperation("test", "recv"))
+}
@@ -6,25 +6,33 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/worker"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/leodido/go-urn"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type TrollBox struct {
-	chainID     string
-	db          *gorm.DB
-	inscription *Inscription
-	launchpad   *Launchpad
+	chainID      string
+	workerClient *worker.WorkerClient
+	inscription  *Inscription
+	launchpad    *Launchpad
+	// contentStore stores the post content, nil if content isn't stored
+	contentStore contentstore.ContentStore
+	// contentValidator checks the post content
+	contentValidator contentValidator
 }
 
 type TrollBoxConfig struct {
+	AllowedMimeTypes []string `envconfig:"TROLLBOX_ALLOWED_MIME_TYPES"`
+	MaxContentBytes  int      `envconfig:"TROLLBOX_MAX_CONTENT_BYTES" default:"0"`
+	ActiveContent    string   `envconfig:"TROLLBOX_ACTIVE_CONTENT" default:"sandbox"`
 }
 
-func NewTrollBoxProcessor(chainID string, db *gorm.DB, inscription *Inscription, launchpad *Launchpad) *TrollBox {
+func NewTrollBoxProcessor(chain Chain, workerClient *worker.WorkerClient, inscription *Inscription, launchpad *Launchpad, contentStore contentstore.ContentStore) *TrollBox {
 	// Parse config environment variables for self
 	var config TrollBoxConfig
 	err := envconfig.Process("", &config)
@@ -32,11 +40,18 @@ func NewTrollBoxProcessor(chainID string, db *gorm.DB, inscription *Inscription,
 		log.Fatalf("Unable to process config: %s", err)
 	}
 
+	contentValidator, err := newContentValidator(chain, config.AllowedMimeTypes, config.MaxContentBytes, config.ActiveContent)
+	if err != nil {
+		log.Fatalf("Unable to process troll box content policy: %s", err)
+	}
+
 	return &TrollBox{
-		chainID:     chainID,
-		db:          db,
-		inscription: inscription,
-		launchpad:   launchpad,
+		chainID:          chain.ID,
+		workerClient:     workerClient,
+		inscription:      inscription,
+		launchpad:        launchpad,
+		contentStore:     contentStore,
+		contentValidator: contentValidator,
 	}
 }
 
@@ -44,40 +59,31 @@ func (protocol *TrollBox) Name() string {
 	return "TrollBox"
 }
 
-func (protocol *TrollBox) Process(transactionModel models.Transaction, protocolURN *urn.URN, rawTransaction types.RawTransaction, sourceChannel string) error {
-	sender, err := rawTransaction.GetSenderAddress()
-	if err != nil {
-		return err
-	}
-
-	parsedURN, err := ParseProtocolString(protocolURN)
-	if err != nil {
-		return err
-	}
-
-	if parsedURN.ChainID != protocol.chainID {
-		return fmt.Errorf("invalid chain ID '%s'", parsedURN.ChainID)
-	}
-
-	switch parsedURN.Operation {
-	case "post":
-		return protocol.Post(transactionModel, parsedURN, rawTransaction, sender)
-	case "collect":
-		return protocol.Collect(transactionModel, parsedURN, rawTransaction, sender)
+func (protocol *TrollBox) Operations() []Operation {
+	return []Operation{
+		{
+			Name:    "post",
+			Fields:  []Field{{Key: "h", Type: FieldString}},
+			Handler: protocol.Post,
+		},
+		{
+			Name:    "collect",
+			Fields:  []Field{{Key: "h", Type: FieldString}},
+			Handler: protocol.Collect,
+		},
 	}
-	return nil
 }
 
-func (protocol *TrollBox) Collect(transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.RawTransaction, sender string) error {
+func (protocol *TrollBox) Collect(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
 	if parsedURN.KeyValuePairs["h"] == "" {
-		return fmt.Errorf("missing post hash")
+		return NewError(CodeInvalidField, "missing post hash").With("field", "h")
 	}
 
 	// find troll post for hash
 	postHash := parsedURN.KeyValuePairs["h"]
 
 	var transaction models.Transaction
-	result := protocol.db.Where("hash = ?", postHash).First(&transaction)
+	result := db.Where("chain_id = ? AND hash = ?", protocol.chainID, postHash).First(&transaction)
 	if result.Error != nil {
 		// Invalid hash
 		return result.Error
@@ -85,15 +91,15 @@ func (protocol *TrollBox) Collect(transactionModel models.Transaction, parsedURN
 
 	// get the troll post
 	var trollPost models.TrollPost
-	result = protocol.db.Where("transaction_id = ?", transaction.ID).First(&trollPost)
+	result = db.Where("transaction_id = ?", transaction.ID).First(&trollPost)
 	if result.Error != nil {
-		return fmt.Errorf("troll post not found")
+		return NewError(CodeTrollPostNotFound, "troll post not found")
 	}
 
 	// check if collection for this post already exists
 	symbol := fmt.Sprintf("TROLL:%d", trollPost.ID)
 	var launchpad models.Launchpad
-	result = protocol.db.Where("transaction_id = ?", trollPost.TransactionID).First(&launchpad)
+	result = db.Where("transaction_id = ?", trollPost.TransactionID).First(&launchpad)
 
 	if result.Error != nil {
 		if result.Error != gorm.ErrRecordNotFound {
@@ -116,7 +122,7 @@ func (protocol *TrollBox) Collect(transactionModel models.Transaction, parsedURN
 		// metadata to json
 		metadataBytes, err := json.Marshal(collectionMetadata)
 		if err != nil {
-			return fmt.Errorf("unable to marshal metadata '%s'", err)
+			return NewError(CodeInternal, "unable to marshal metadata '%s'", err)
 		}
 
 		// create collection
@@ -131,15 +137,29 @@ func (protocol *TrollBox) Collect(transactionModel models.Transaction, parsedURN
 			ContentHash:      trollPost.ContentHash,
 			ContentSizeBytes: trollPost.ContentSizeBytes,
 			ContentPath:      trollPost.ContentPath,
+			DeclaredMime:     trollPost.DeclaredMime,
+			DetectedMime:     trollPost.DetectedMime,
+			IsActiveContent:  trollPost.IsActiveContent,
+			PreviewPath:      trollPost.PreviewPath,
+			PreviewWidth:     trollPost.PreviewWidth,
+			PreviewHeight:    trollPost.PreviewHeight,
 			Metadata:         datatypes.JSON(metadataBytes),
 			DateCreated:      trollPost.DateCreated,
 		}
 
-		result = protocol.db.Save(&collection)
+		result = db.Save(&collection)
 		if result.Error != nil {
 			return result.Error
 		}
 
+		// The collection shares the preview of the post once it exists
+		if collection.ContentPath != "" && !collection.PreviewPath.Valid {
+			err = protocol.workerClient.GeneratePreview(db, "collection", collection.ID)
+			if err != nil {
+				return err
+			}
+		}
+
 		// create launchpad with one stage
 		launchpad = models.Launchpad{
 			ChainID:           parsedURN.ChainID,
@@ -153,7 +173,7 @@ func (protocol *TrollBox) Collect(transactionModel models.Transaction, parsedURN
 			RevealImmediately: true,
 		}
 
-		result = protocol.db.Save(&launchpad)
+		result = db.Save(&launchpad)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -164,7 +184,7 @@ func (protocol *TrollBox) Collect(transactionModel models.Transaction, parsedURN
 			Valid: true,
 		}
 
-		result = protocol.db.Save(&trollPost)
+		result = db.Save(&trollPost)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -178,25 +198,25 @@ func (protocol *TrollBox) Collect(transactionModel models.Transaction, parsedURN
 			HasWhitelist: false,
 		}
 
-		result = protocol.db.Save(&stage)
+		result = db.Save(&stage)
 		if result.Error != nil {
 			return result.Error
 		}
 	}
 
 	// create a mint reservation
-	return protocol.launchpad.ReserveInscriptionInternal(transactionModel, rawTransaction, sender, launchpad, 0, 1, false)
+	return protocol.launchpad.ReserveInscriptionInternal(db, transactionModel, rawTransaction, sender, launchpad, 0, 1, false)
 }
 
-func (protocol *TrollBox) Post(transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.RawTransaction, sender string) error {
+func (protocol *TrollBox) Post(db *gorm.DB, transactionModel models.Transaction, parsedURN ProtocolURN, rawTransaction types.Transaction, sender string) error {
 	if parsedURN.KeyValuePairs["h"] == "" {
-		return fmt.Errorf("missing content hash")
+		return NewError(CodeInvalidField, "missing content hash").With("field", "h")
 	}
 
 	contentHash := parsedURN.KeyValuePairs["h"]
 
 	// get trollbox metadata and data from non_critical_extension_options
-	msg, err := rawTransaction.Body.GetExtensionMessage()
+	msg, err := getExtensionMessage(rawTransaction)
 	if err != nil {
 		return err
 	}
@@ -209,24 +229,29 @@ func (protocol *TrollBox) Post(transactionModel models.Transaction, parsedURN Pr
 
 	err = json.Unmarshal(jsonBytes, &trollBoxMetadata)
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal metadata '%s'", err)
+		return NewError(CodeInvalidExtension, "unable to unmarshal metadata '%s'", err)
 	}
 
-	// store the content with the correct mime type on DO
+	// store the content with the detected mime type
 	content, err := msg.GetContent()
 	if err != nil {
 		return err
 	}
 
-	contentPath, err := protocol.inscription.StoreContent(trollBoxMetadata.Mime, rawTransaction.Hash, content)
+	contentCheck, err := protocol.contentValidator.check(transactionModel.Height, trollBoxMetadata.Mime, content)
+	if err != nil {
+		return err
+	}
+
+	contentPath, err := contentstore.Store(db.Statement.Context, protocol.contentStore, contentCheck.StoreType, content)
 	if err != nil {
-		return fmt.Errorf("unable to store content '%s'", err)
+		return NewError(CodeInternal, "unable to store content '%s'", err)
 	}
 
 	// Get the max id
 	var maxID uint64
 
-	result := protocol.db.Model(&models.TrollPost{}).Select("COALESCE(MAX(id), 0)")
+	result := db.Model(&models.TrollPost{}).Select("COALESCE(MAX(id), 0)")
 	if result.Error != nil {
 		if result.Error != gorm.ErrRecordNotFound {
 			return result.Error
@@ -253,13 +278,22 @@ func (protocol *TrollBox) Post(transactionModel models.Transaction, parsedURN Pr
 		Text:             trollBoxMetadata.Text,
 		ContentPath:      contentPath,
 		ContentSizeBytes: uint64(len(content)),
+		DeclaredMime:     nullString(contentCheck.DeclaredType),
+		DetectedMime:     nullString(contentCheck.DetectedType),
+		IsActiveContent:  contentCheck.Active,
 		DateCreated:      transactionModel.DateCreated,
 	}
 
-	result = protocol.db.Save(&trollPost)
+	result = db.Save(&trollPost)
 	if result.Error != nil {
 		return result.Error
 	}
 
+	if contentPath != "" {
+		err = protocol.workerClient.GeneratePreview(db, "troll_post", trollPost.ID)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -1,7 +1,6 @@
 package metaprotocol
 
 import (
-	"fmt"
 	"strings"
 
 	types "github.com/cosmos/cosmos-sdk/types"
@@ -9,10 +8,10 @@ import (
 
 func ValidateCosmosAddress(address string) error {
 	if len(address) != 45 {
-		return fmt.Errorf("cosmos hub addresses must be 45 characters long")
+		return NewError(CodeInvalidAddress, "cosmos hub addresses must be 45 characters long")
 	}
 	if !strings.Contains(address, "cosmos1") {
-		return fmt.Errorf("destination address does not look like a valid address")
+		return NewError(CodeInvalidAddress, "destination address does not look like a valid address")
 	}
 
 	_, err := types.AccAddressFromBech32(address)
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type BaseTokenPrice struct {
+	ID          uint64    `gorm:"primary_key"`
+	ChainID     string    `gorm:"column:chain_id"`
+	PriceUSD    float64   `gorm:"column:price_usd"`
+	Sources     int       `gorm:"column:sources"` // Number of sources in the median
+	DateCreated time.Time `gorm:"column:date_created"`
+}
+
+func (BaseTokenPrice) TableName() string {
+	return "base_token_price"
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type BlockChecksum struct {
+	ID          uint64    `gorm:"primary_key"`
+	ChainID     string    `gorm:"column:chain_id"`
+	Height      uint64    `gorm:"column:height"`
+	Checksum    string    `gorm:"column:checksum"` // Checksum of the state after the block
+	Changes     uint64    `gorm:"column:changes"`  // Number of state entries changed
+	DateCreated time.Time `gorm:"column:date_created"`
+}
+
+func (BlockChecksum) TableName() string {
+	return "block_checksum"
+}
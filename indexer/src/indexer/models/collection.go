@@ -14,6 +14,8 @@ type Collection struct {
 	Version           string          `gorm:"column:version"`
 	TransactionID     uint64          `gorm:"column:transaction_id"`
 	ContentHash       string          `gorm:"column:content_hash"`
+	ComputedHash      sql.NullString  `gorm:"column:computed_hash"`
+	IsHashMismatch    bool            `gorm:"column:is_hash_mismatch"`
 	Creator           string          `gorm:"column:creator"`
 	Minter            sql.NullString  `gorm:"column:minter"`
 	Name              string          `gorm:"column:name"`
@@ -23,6 +25,12 @@ type Collection struct {
 	Metadata          datatypes.JSON  `gorm:"column:metadata"`
 	ContentPath       string          `gorm:"column:content_path"`
 	ContentSizeBytes  uint64          `gorm:"column:content_size_bytes"`
+	DeclaredMime      sql.NullString  `gorm:"column:declared_mime"`
+	DetectedMime      sql.NullString  `gorm:"column:detected_mime"`
+	IsActiveContent   bool            `gorm:"column:is_active_content"`
+	PreviewPath       sql.NullString  `gorm:"column:preview_path"`
+	PreviewWidth      sql.NullInt32   `gorm:"column:preview_width"`
+	PreviewHeight     sql.NullInt32   `gorm:"column:preview_height"`
 	DateCreated       time.Time       `gorm:"column:date_created"`
 }
 
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+type EventOutbox struct {
+	ID              uint64         `gorm:"primary_key"`
+	ChainID         string         `gorm:"column:chain_id"`
+	Height          uint64         `gorm:"column:height"`
+	TransactionID   uint64         `gorm:"column:transaction_id"`
+	TransactionHash string         `gorm:"column:transaction_hash"`
+	EventType       string         `gorm:"column:event_type"`
+	Data            datatypes.JSON `gorm:"column:data"`
+	DateCreated     time.Time      `gorm:"column:date_created"` // Block time of the transaction
+}
+
+func (EventOutbox) TableName() string {
+	return "event_outbox"
+}
@@ -17,12 +17,20 @@ type Inscription struct {
 	CollectionID      sql.NullInt64  `gorm:"column:collection_id"`
 	TokenID           sql.NullInt64  `gorm:"column:token_id"`
 	ContentHash       string         `gorm:"column:content_hash"`
+	ComputedHash      sql.NullString `gorm:"column:computed_hash"`
+	IsHashMismatch    bool           `gorm:"column:is_hash_mismatch"`
 	Creator           string         `gorm:"column:creator"`
 	CurrentOwner      string         `gorm:"column:current_owner"`
 	Type              string         `gorm:"column:type"`
 	Metadata          datatypes.JSON `gorm:"column:metadata"`
 	ContentPath       string         `gorm:"column:content_path"`
 	ContentSizeBytes  uint64         `gorm:"column:content_size_bytes"`
+	DeclaredMime      sql.NullString `gorm:"column:declared_mime"`
+	DetectedMime      sql.NullString `gorm:"column:detected_mime"`
+	IsActiveContent   bool           `gorm:"column:is_active_content"`
+	PreviewPath       sql.NullString `gorm:"column:preview_path"`
+	PreviewWidth      sql.NullInt32  `gorm:"column:preview_width"`
+	PreviewHeight     sql.NullInt32  `gorm:"column:preview_height"`
 	DateCreated       time.Time      `gorm:"column:date_created"`
 }
 
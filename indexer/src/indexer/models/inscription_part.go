@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// InscriptionPart is a pending part of a multipart inscription. The parts
+// are removed when the inscription is created from them or the upload
+// expires
+type InscriptionPart struct {
+	ID            uint64         `gorm:"primary_key"`
+	ChainID       string         `gorm:"column:chain_id"`
+	Height        uint64         `gorm:"column:height"`
+	TransactionID uint64         `gorm:"column:transaction_id"`
+	Creator       string         `gorm:"column:creator"`
+	ContentHash   string         `gorm:"column:content_hash"`
+	PartIndex     uint           `gorm:"column:part_index"`
+	PartTotal     uint           `gorm:"column:part_total"`
+	Metadata      datatypes.JSON `gorm:"column:metadata"`
+	Content       []byte         `gorm:"column:content"`
+	ExpiresHeight uint64         `gorm:"column:expires_height"`
+	DateCreated   time.Time      `gorm:"column:date_created"`
+}
+
+func (InscriptionPart) TableName() string {
+	return "inscription_part"
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// JobOutbox is a worker job queued by a block. The jobs are written in the
+// block transaction and moved to the job queue after the block commits
+type JobOutbox struct {
+	ID          uint64         `gorm:"primary_key"`
+	Kind        string         `gorm:"column:kind"`
+	Args        datatypes.JSON `gorm:"column:args"`
+	ScheduledAt time.Time      `gorm:"column:scheduled_at"`
+	DateCreated time.Time      `gorm:"column:date_created"`
+}
+
+func (JobOutbox) TableName() string {
+	return "job_outbox"
+}
@@ -9,6 +9,7 @@ type Status struct {
 	LastProcessedHeight uint64    `gorm:"column:last_processed_height"`
 	BaseToken           string    `gorm:"column:base_token"`
 	BaseTokenUSD        float64   `gorm:"column:base_token_usd"`
+	StateChecksum       string    `gorm:"column:state_checksum"`
 	DateUpdated         time.Time `gorm:"column:date_updated"`
 }
 
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"database/sql"
 	"time"
 
 	"gorm.io/datatypes"
@@ -25,6 +26,9 @@ type Token struct {
 	Metadata          datatypes.JSON `gorm:"column:metadata"`
 	ContentPath       string         `gorm:"column:content_path"`
 	ContentSizeBytes  uint64         `gorm:"column:content_size_bytes"`
+	DeclaredMime      sql.NullString `gorm:"column:declared_mime"`
+	DetectedMime      sql.NullString `gorm:"column:detected_mime"`
+	IsActiveContent   bool           `gorm:"column:is_active_content"`
 	CirculatingSupply uint64         `gorm:"column:circulating_supply"`
 	LastPriceBase     uint64         `gorm:"column:last_price_base"`
 	Volume24Base      uint64         `gorm:"column:volume_24_base"`
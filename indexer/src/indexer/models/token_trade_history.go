@@ -1,19 +1,22 @@
 package models
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
 type TokenTradeHistory struct {
-	ID            uint64    `gorm:"primary_key"`
-	ChainID       string    `gorm:"column:chain_id"`
-	TransactionID uint64    `gorm:"column:transaction_id"`
-	TokenID       uint64    `gorm:"column:token_id"`
-	SellerAddress string    `gorm:"column:seller_address"`
-	BuyerAddress  string    `gorm:"column:buyer_address"`
-	AmountQuote   uint64    `gorm:"column:amount_quote"` // Amount of TokenID
-	AmountBase    uint64    `gorm:"column:amount_base"`  // Amount of ATOM
-	Rate          uint64    `gorm:"column:rate"`         // Amount of ATOM per TokenID
-	TotalUSD      float64   `gorm:"column:total_usd"`    // Amount of USD
-	DateCreated   time.Time `gorm:"column:date_created"`
+	ID            uint64          `gorm:"primary_key"`
+	ChainID       string          `gorm:"column:chain_id"`
+	TransactionID uint64          `gorm:"column:transaction_id"`
+	TokenID       uint64          `gorm:"column:token_id"`
+	SellerAddress string          `gorm:"column:seller_address"`
+	BuyerAddress  string          `gorm:"column:buyer_address"`
+	AmountQuote   uint64          `gorm:"column:amount_quote"` // Amount of TokenID
+	AmountBase    uint64          `gorm:"column:amount_base"`  // Amount of ATOM
+	Rate          uint64          `gorm:"column:rate"`         // Amount of ATOM per TokenID
+	TotalUSD      sql.NullFloat64 `gorm:"column:total_usd"`    // Amount of USD
+	DateCreated   time.Time       `gorm:"column:date_created"`
 }
 
 func (TokenTradeHistory) TableName() string {
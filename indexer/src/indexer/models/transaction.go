@@ -1,17 +1,25 @@
 package models
 
-import "time"
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/datatypes"
+)
 
 type Transaction struct {
-	ID            uint64    `gorm:"primary_key"`
-	Height        uint64    `gorm:"column:height"`
-	Hash          string    `gorm:"column:hash"`
-	Content       string    `gorm:"column:content"`
-	GasUsed       uint64    `gorm:"column:gas_used"`
-	Fees          string    `gorm:"column:fees"`
-	ContentLength uint64    `gorm:"column:content_length"`
-	DateCreated   time.Time `gorm:"column:date_created"`
-	StatusMessage string    `gorm:"column:status_message"`
+	ID            uint64         `gorm:"primary_key"`
+	ChainID       string         `gorm:"column:chain_id"`
+	Height        uint64         `gorm:"column:height"`
+	Hash          string         `gorm:"column:hash"`
+	Content       string         `gorm:"column:content"`
+	GasUsed       uint64         `gorm:"column:gas_used"`
+	Fees          string         `gorm:"column:fees"`
+	ContentLength uint64         `gorm:"column:content_length"`
+	DateCreated   time.Time      `gorm:"column:date_created"`
+	StatusMessage string         `gorm:"column:status_message"`
+	ErrorCode     sql.NullString `gorm:"column:error_code"`
+	ErrorDetails  datatypes.JSON `gorm:"column:error_details"`
 }
 
 func (Transaction) TableName() string {
@@ -6,18 +6,24 @@ import (
 )
 
 type TrollPost struct {
-	ID               uint64        `gorm:"primary_key"`
-	ChainID          string        `gorm:"column:chain_id"`
-	Height           uint64        `gorm:"column:height"`
-	Version          string        `gorm:"column:version"`
-	TransactionID    uint64        `gorm:"column:transaction_id"`
-	LaunchpadID      sql.NullInt64 `gorm:"column:launchpad_id"`
-	ContentHash      string        `gorm:"column:content_hash"`
-	Creator          string        `gorm:"column:creator"`
-	Text             string        `gorm:"column:text"`
-	ContentPath      string        `gorm:"column:content_path"`
-	ContentSizeBytes uint64        `gorm:"column:content_size_bytes"`
-	DateCreated      time.Time     `gorm:"column:date_created"`
+	ID               uint64         `gorm:"primary_key"`
+	ChainID          string         `gorm:"column:chain_id"`
+	Height           uint64         `gorm:"column:height"`
+	Version          string         `gorm:"column:version"`
+	TransactionID    uint64         `gorm:"column:transaction_id"`
+	LaunchpadID      sql.NullInt64  `gorm:"column:launchpad_id"`
+	ContentHash      string         `gorm:"column:content_hash"`
+	Creator          string         `gorm:"column:creator"`
+	Text             string         `gorm:"column:text"`
+	ContentPath      string         `gorm:"column:content_path"`
+	ContentSizeBytes uint64         `gorm:"column:content_size_bytes"`
+	DeclaredMime     sql.NullString `gorm:"column:declared_mime"`
+	DetectedMime     sql.NullString `gorm:"column:detected_mime"`
+	IsActiveContent  bool           `gorm:"column:is_active_content"`
+	PreviewPath      sql.NullString `gorm:"column:preview_path"`
+	PreviewWidth     sql.NullInt32  `gorm:"column:preview_width"`
+	PreviewHeight    sql.NullInt32  `gorm:"column:preview_height"`
+	DateCreated      time.Time      `gorm:"column:date_created"`
 }
 
 func (TrollPost) TableName() string {
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type WebhookSubscription struct {
+	ID           uint64       `gorm:"primary_key"`
+	ChainID      string       `gorm:"column:chain_id"`
+	URL          string       `gorm:"column:url"`
+	Secret       string       `gorm:"column:secret"`
+	EventTypes   string       `gorm:"column:event_types"`   // Comma separated, empty for all events
+	LastEventID  uint64       `gorm:"column:last_event_id"` // ID of the last delivered event
+	IsEnabled    bool         `gorm:"column:is_enabled"`
+	FailureCount uint64       `gorm:"column:failure_count"` // Consecutive failed deliveries
+	RetryAt      sql.NullTime `gorm:"column:retry_at"`
+	LastError    string       `gorm:"column:last_error"`
+	DateUpdated  time.Time    `gorm:"column:date_updated"`
+	DateCreated  time.Time    `gorm:"column:date_created"`
+}
+
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscription"
+}
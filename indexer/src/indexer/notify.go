@@ -0,0 +1,80 @@
+package indexer
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/feed"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"gorm.io/gorm"
+)
+
+// feedNotification is a single pg_notify call
+type feedNotification struct {
+	Channel string `json:"channel"`
+	Payload string `json:"payload"`
+}
+
+// notifyBlock notifies the feed channels of the events of the block at
+// height and of the block itself. Postgres delivers the notifications when the
+// transaction of db commits, so listeners never see uncommitted state
+func (i *Indexer) notifyBlock(db *gorm.DB, height uint64, blockTime time.Time, transactions int, checksum string) error {
+	var events []models.EventOutbox
+	err := db.Where("chain_id = ? AND height = ?", i.chainID, height).Order("id").Find(&events).Error
+	if err != nil {
+		return err
+	}
+
+	notifications, err := feedNotifications(events, feed.Block{
+		ChainID:       i.chainID,
+		Height:        height,
+		Transactions:  transactions,
+		Events:        len(events),
+		StateChecksum: checksum,
+		DateCreated:   blockTime,
+	})
+	if err != nil {
+		return err
+	}
+	notificationsJSON, err := json.Marshal(notifications)
+	if err != nil {
+		return err
+	}
+
+	// A single statement sends all notifications of the block
+	return db.Exec(`SELECT pg_notify(n->>'channel', n->>'payload') FROM json_array_elements(?::json) AS n`, string(notificationsJSON)).Error
+}
+
+// feedNotifications returns the notifications of the events in order,
+// followed by the block
+func feedNotifications(events []models.EventOutbox, block feed.Block) ([]feedNotification, error) {
+	notifications := make([]feedNotification, 0, len(events)+1)
+	for _, event := range events {
+		payload, err := feed.EncodeEvent(feed.Event{
+			ID:              event.ID,
+			Type:            event.EventType,
+			ChainID:         event.ChainID,
+			Height:          event.Height,
+			TransactionHash: event.TransactionHash,
+			Data:            json.RawMessage(event.Data),
+			DateCreated:     event.DateCreated,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, feedNotification{
+			Channel: feed.EventChannel(event.EventType),
+			Payload: payload,
+		})
+	}
+
+	payload, err := json.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+	notifications = append(notifications, feedNotification{
+		Channel: feed.BlockChannel,
+		Payload: string(payload),
+	})
+	return notifications, nil
+}
@@ -0,0 +1,33 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/feed"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func TestFeedEventTypes(t *testing.T) {
+	var eventTypes []string
+	for _, eventType := range metaprotocol.EventTypes {
+		eventTypes = append(eventTypes, string(eventType))
+	}
+	assert.Equal(t, eventTypes, feed.EventTypes, "subscribers should listen to every event type")
+}
+
+func TestFeedNotifications(t *testing.T) {
+	events := []models.EventOutbox{
+		{ID: 1, ChainID: "cosmoshub-4", Height: 10, EventType: "cft20.mint", Data: datatypes.JSON(`{"ticker":"ROIDS"}`)},
+		{ID: 2, ChainID: "cosmoshub-4", Height: 10, EventType: "listing.filled", Data: datatypes.JSON(`{"listing_id":3}`)},
+	}
+	notifications, err := feedNotifications(events, feed.Block{ChainID: "cosmoshub-4", Height: 10, Events: 2})
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 3)
+	assert.Equal(t, "indexer_event_cft20_mint", notifications[0].Channel)
+	assert.JSONEq(t, `{"id":1,"type":"cft20.mint","chain_id":"cosmoshub-4","height":10,"transaction_hash":"","data":{"ticker":"ROIDS"},"date_created":"0001-01-01T00:00:00Z"}`, notifications[0].Payload)
+	assert.Equal(t, "indexer_event_listing_filled", notifications[1].Channel)
+	assert.Equal(t, feed.BlockChannel, notifications[2].Channel, "the block is notified after its events")
+}
@@ -0,0 +1,3 @@
+// Package oracle aggregates the USD price of a chain's base token from
+// multiple price sources and looks up historic prices
+package oracle
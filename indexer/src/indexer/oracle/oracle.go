@@ -0,0 +1,115 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrNoPrice is returned when none of the sources have a fresh price
+var ErrNoPrice = errors.New("no fresh base token price")
+
+// quote is the last price returned by a source
+type quote struct {
+	price   float64
+	updated time.Time
+}
+
+// Oracle aggregates the prices of multiple sources. Prices older than
+// maxAge are ignored and the median of the remaining prices is used
+type Oracle struct {
+	sources []Source
+	maxAge  time.Duration
+	logger  *logrus.Entry
+
+	lock   sync.Mutex
+	quotes []quote
+	now    func() time.Time
+}
+
+// New returns an oracle for sources
+func New(sources []Source, maxAge time.Duration, log *logrus.Entry) *Oracle {
+	return &Oracle{
+		sources: sources,
+		maxAge:  maxAge,
+		logger:  log,
+		quotes:  make([]quote, len(sources)),
+		now:     time.Now,
+	}
+}
+
+// Update fetches the price from all sources concurrently. A source that
+// fails keeps its previous price until it becomes stale
+func (oracle *Oracle) Update(ctx context.Context) {
+	var wg sync.WaitGroup
+	for index, source := range oracle.sources {
+		wg.Add(1)
+		go func(index int, source Source) {
+			defer wg.Done()
+
+			price, err := source.Price(ctx)
+			if err != nil {
+				oracle.logger.WithFields(logrus.Fields{
+					"source": source.Name(),
+					"err":    err,
+				}).Warning("Unable to fetch base token price")
+				return
+			}
+
+			oracle.lock.Lock()
+			oracle.quotes[index] = quote{price: price, updated: oracle.now()}
+			oracle.lock.Unlock()
+		}(index, source)
+	}
+	wg.Wait()
+}
+
+// Price returns the median of the fresh source prices and the number of
+// sources it was calculated from
+func (oracle *Oracle) Price() (float64, int, error) {
+	oracle.lock.Lock()
+	defer oracle.lock.Unlock()
+
+	now := oracle.now()
+	var prices []float64
+	for _, quote := range oracle.quotes {
+		if quote.updated.IsZero() || now.Sub(quote.updated) > oracle.maxAge {
+			continue
+		}
+		prices = append(prices, quote.price)
+	}
+	if len(prices) == 0 {
+		return 0, 0, ErrNoPrice
+	}
+
+	sort.Float64s(prices)
+	middle := len(prices) / 2
+	if len(prices)%2 == 0 {
+		return (prices[middle-1] + prices[middle]) / 2, len(prices), nil
+	}
+	return prices[middle], len(prices), nil
+}
+
+// PriceAt returns the base token price of chainID at time at. The latest
+// recorded price at or before at is used, ErrNoPrice is returned when there
+// is none or it is older than maxAge. A maxAge of 0 never expires prices
+func PriceAt(db *gorm.DB, chainID string, at time.Time, maxAge time.Duration) (float64, error) {
+	var priceModel models.BaseTokenPrice
+	result := db.Where("chain_id = ? AND date_created <= ?", chainID, at).Order("date_created DESC").Limit(1).Find(&priceModel)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrNoPrice
+	}
+	if maxAge > 0 && at.Sub(priceModel.DateCreated) > maxAge {
+		return 0, ErrNoPrice
+	}
+	return priceModel.PriceUSD, nil
+}
@@ -0,0 +1,135 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// failingSource always fails to return a price
+type failingSource struct{}
+
+func (source *failingSource) Name() string {
+	return "failing"
+}
+
+func (source *failingSource) Price(ctx context.Context) (float64, error) {
+	return 0, errors.New("unavailable")
+}
+
+func TestOracleMedian(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	oracle := New([]Source{
+		&StaticSource{price: 10},
+		&StaticSource{price: 12},
+		&StaticSource{price: 100},
+		&failingSource{},
+	}, time.Minute, logger)
+
+	_, _, err := oracle.Price()
+	assert.ErrorIs(t, err, ErrNoPrice, "there is no price before the first update")
+
+	oracle.Update(context.Background())
+	price, sources, err := oracle.Price()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, sources, "failing sources should be ignored")
+	assert.Equal(t, 12.0, price, "outliers should not move the median")
+
+	oracle.sources = oracle.sources[:2]
+	oracle.quotes = oracle.quotes[:2]
+	price, _, err = oracle.Price()
+	assert.NoError(t, err)
+	assert.Equal(t, 11.0, price, "an even number of prices should be averaged")
+}
+
+func TestOracleStaleness(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	oracle := New([]Source{&StaticSource{price: 10}, &failingSource{}}, time.Minute, logrus.NewEntry(logrus.New()))
+	oracle.now = func() time.Time { return now }
+	oracle.quotes[1] = quote{price: 20, updated: now.Add(-2 * time.Minute)}
+
+	oracle.Update(context.Background())
+	price, sources, err := oracle.Price()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sources, "stale prices should be ignored")
+	assert.Equal(t, 10.0, price)
+
+	now = now.Add(2 * time.Minute)
+	_, _, err = oracle.Price()
+	assert.ErrorIs(t, err, ErrNoPrice)
+}
+
+func TestPriceAt(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "oracle.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.BaseTokenPrice{}))
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err = PriceAt(db, "cosmoshub-4", now, time.Minute)
+	assert.ErrorIs(t, err, ErrNoPrice, "there is no price before the first recorded price")
+
+	assert.NoError(t, db.Create(&models.BaseTokenPrice{ChainID: "cosmoshub-4", PriceUSD: 10, DateCreated: now}).Error)
+	assert.NoError(t, db.Create(&models.BaseTokenPrice{ChainID: "cosmoshub-4", PriceUSD: 11, DateCreated: now.Add(time.Hour)}).Error)
+	price, err := PriceAt(db, "cosmoshub-4", now.Add(time.Minute), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, price, "the latest price at or before the time should be used")
+
+	_, err = PriceAt(db, "cosmoshub-4", now.Add(2*time.Minute), time.Minute)
+	assert.ErrorIs(t, err, ErrNoPrice, "prices older than the max age should not be used")
+	price, err = PriceAt(db, "cosmoshub-4", now.Add(2*time.Minute), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, price, "prices should never expire without a max age")
+
+	_, err = PriceAt(db, "osmosis-1", now.Add(time.Minute), time.Minute)
+	assert.ErrorIs(t, err, ErrNoPrice)
+}
+
+func TestSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/binance":
+			w.Write([]byte(`{"symbol":"ATOMUSDT","price":"9.51000000"}`))
+		case "/coingecko":
+			w.Write([]byte(`{"cosmos":{"usd":9.49}}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tests := map[string]float64{
+		"binance=" + server.URL + "/binance":     9.51,
+		"coingecko=" + server.URL + "/coingecko": 9.49,
+		"static=1.5":                             1.5,
+	}
+	for definition, expected := range tests {
+		source, err := NewSource(definition, server.Client())
+		assert.NoError(t, err)
+		price, err := source.Price(context.Background())
+		assert.NoError(t, err, definition)
+		assert.Equal(t, expected, price, definition)
+	}
+
+	source, err := NewSource("binance="+server.URL+"/down", server.Client())
+	assert.NoError(t, err)
+	_, err = source.Price(context.Background())
+	assert.Error(t, err, "HTTP errors should be returned")
+
+	_, err = NewSource("unknown=1", server.Client())
+	assert.Error(t, err)
+	_, err = NewSource("static=-1", server.Client())
+	assert.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package oracle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Source returns the current USD price of the base token
+type Source interface {
+	Name() string
+	Price(ctx context.Context) (float64, error)
+}
+
+// NewSource parses a source definition in the form kind=value. Supported
+// kinds are binance=<url>, coingecko=<url>, static=<price> and file=<path>
+func NewSource(definition string, client *http.Client) (Source, error) {
+	kind, value, ok := strings.Cut(strings.TrimSpace(definition), "=")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("invalid price source '%s', expected kind=value", definition)
+	}
+
+	switch kind {
+	case "binance":
+		return &BinanceSource{url: value, client: client}, nil
+	case "coingecko":
+		return &CoinGeckoSource{url: value, client: client}, nil
+	case "static":
+		price, err := parsePrice(value)
+		if err != nil {
+			return nil, err
+		}
+		return &StaticSource{price: price}, nil
+	case "file":
+		return &FileSource{path: value}, nil
+	default:
+		return nil, fmt.Errorf("unknown price source '%s'", kind)
+	}
+}
+
+// BinanceSource reads the price from a Binance ticker endpoint, ie
+// https://api.binance.com/api/v3/ticker/price?symbol=ATOMUSDT
+type BinanceSource struct {
+	url    string
+	client *http.Client
+}
+
+// Name returns the name of the source
+func (source *BinanceSource) Name() string {
+	return "binance"
+}
+
+// Price fetches the current price from the ticker
+func (source *BinanceSource) Price(ctx context.Context) (float64, error) {
+	var response struct {
+		Price string `json:"price"`
+	}
+	err := getJSON(ctx, source.client, source.url, &response)
+	if err != nil {
+		return 0, err
+	}
+	return parsePrice(response.Price)
+}
+
+// CoinGeckoSource reads the price from a CoinGecko simple price endpoint
+// for a single coin and currency, ie
+// https://api.coingecko.com/api/v3/simple/price?ids=cosmos&vs_currencies=usd
+type CoinGeckoSource struct {
+	url    string
+	client *http.Client
+}
+
+// Name returns the name of the source
+func (source *CoinGeckoSource) Name() string {
+	return "coingecko"
+}
+
+// Price fetches the current price from the endpoint
+func (source *CoinGeckoSource) Price(ctx context.Context) (float64, error) {
+	var response map[string]map[string]float64
+	err := getJSON(ctx, source.client, source.url, &response)
+	if err != nil {
+		return 0, err
+	}
+	if len(response) != 1 {
+		return 0, fmt.Errorf("expected the price of one coin, got %d", len(response))
+	}
+	for _, currencies := range response {
+		if len(currencies) != 1 {
+			return 0, fmt.Errorf("expected the price in one currency, got %d", len(currencies))
+		}
+		for _, price := range currencies {
+			return validatePrice(price)
+		}
+	}
+	return 0, fmt.Errorf("no price in response")
+}
+
+// StaticSource always returns the same price, it is intended for tests and
+// local networks without a market price
+type StaticSource struct {
+	price float64
+}
+
+// Name returns the name of the source
+func (source *StaticSource) Name() string {
+	return "static"
+}
+
+// Price returns the configured price
+func (source *StaticSource) Price(ctx context.Context) (float64, error) {
+	return validatePrice(source.price)
+}
+
+// FileSource reads the price from a file containing a single number, the
+// file is read on every update so it can be changed while running
+type FileSource struct {
+	path string
+}
+
+// Name returns the name of the source
+func (source *FileSource) Name() string {
+	return "file"
+}
+
+// Price reads the price from the file
+func (source *FileSource) Price(ctx context.Context) (float64, error) {
+	content, err := os.ReadFile(source.path)
+	if err != nil {
+		return 0, err
+	}
+	return parsePrice(string(content))
+}
+
+// getJSON fetches url and decodes the JSON response into target
+func getJSON(ctx context.Context, client *http.Client, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// parsePrice parses and validates a price string
+func parsePrice(value string) (float64, error) {
+	price, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price '%s': %w", value, err)
+	}
+	return validatePrice(price)
+}
+
+// validatePrice rejects prices that can't be a market price
+func validatePrice(price float64) (float64, error) {
+	if math.IsNaN(price) || math.IsInf(price, 0) || price <= 0 {
+		return 0, fmt.Errorf("invalid price %f", price)
+	}
+	return price, nil
+}
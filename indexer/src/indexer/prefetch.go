@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"context"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+)
+
+// fetchedBlock is a block fetched and decoded by the prefetcher
+type fetchedBlock struct {
+	block        types.LCDBlock
+	transactions []types.Transaction
+	err          error
+}
+
+// blockFetchFunc fetches and decodes the block at height
+type blockFetchFunc func(ctx context.Context, height uint64) (types.LCDBlock, []types.Transaction, error)
+
+// prefetchJob is a height scheduled for fetching and the channel to send
+// the result on
+type prefetchJob struct {
+	height uint64
+	result chan fetchedBlock
+}
+
+// blockPrefetcher fetches blocks ahead of the current height with a bounded
+// number of workers. Blocks are fetched concurrently, but are returned
+// strictly in the order they are requested so that a single committer can
+// apply them in height order
+type blockPrefetcher struct {
+	ctx        context.Context
+	fetch      blockFetchFunc
+	window     uint64
+	jobs       chan prefetchJob
+	pending    map[uint64]chan fetchedBlock
+	nextHeight uint64
+}
+
+// newBlockPrefetcher starts workers that prefetch up to window blocks ahead
+// of the requested height. Fetches are cancelled when ctx is done, Stop must
+// be called to stop the workers
+func newBlockPrefetcher(ctx context.Context, fetch blockFetchFunc, workers int, window int) *blockPrefetcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if window < 1 {
+		window = 1
+	}
+
+	prefetcher := &blockPrefetcher{
+		ctx:     ctx,
+		fetch:   fetch,
+		window:  uint64(window),
+		jobs:    make(chan prefetchJob, window),
+		pending: make(map[uint64]chan fetchedBlock),
+	}
+	for worker := 0; worker < workers; worker++ {
+		go prefetcher.work()
+	}
+	return prefetcher
+}
+
+// work fetches the scheduled heights until the prefetcher is stopped
+func (p *blockPrefetcher) work() {
+	for job := range p.jobs {
+		block, transactions, err := p.fetch(p.ctx, job.height)
+		job.result <- fetchedBlock{
+			block:        block,
+			transactions: transactions,
+			err:          err,
+		}
+	}
+}
+
+// Get returns the block at height, scheduling prefetches for the following
+// blocks up to maxHeight. Get must be called with increasing heights from a
+// single goroutine
+func (p *blockPrefetcher) Get(height uint64, maxHeight uint64) fetchedBlock {
+	// Start scheduling from height if it wasn't prefetched
+	if _, ok := p.pending[height]; !ok {
+		p.nextHeight = height
+	}
+
+	// Schedule up to window blocks ahead, but never past the chain height
+	limit := height + p.window
+	if limit > maxHeight {
+		limit = maxHeight
+	}
+	if limit <= height {
+		limit = height + 1
+	}
+	for ; p.nextHeight < limit; p.nextHeight++ {
+		result := make(chan fetchedBlock, 1)
+		p.pending[p.nextHeight] = result
+		p.jobs <- prefetchJob{
+			height: p.nextHeight,
+			result: result,
+		}
+	}
+
+	result := <-p.pending[height]
+	delete(p.pending, height)
+	return result
+}
+
+// Stop stops the workers, blocks that are being fetched are discarded
+func (p *blockPrefetcher) Stop() {
+	close(p.jobs)
+}
@@ -0,0 +1,266 @@
+package indexer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// maxPreflightRequestBytes limits the size of a preflight request, large
+// enough for inscriptions with their content in the extension options
+const maxPreflightRequestBytes = 4 << 20
+
+// preflightStatementTimeout limits how long a single statement of a
+// simulation may run
+const preflightStatementTimeout = 5 * time.Second
+
+// preflightLockTimeout limits how long a simulation may wait on a lock. A
+// simulation that conflicts with the indexer fails instead of queueing
+// behind the block transaction and holding its own locks meanwhile
+const preflightLockTimeout = 50 * time.Millisecond
+
+// preflightTimeout limits how long a simulation may run, including the LCD
+// queries made by the operation. The database transaction is rolled back
+// when it expires
+const preflightTimeout = 10 * time.Second
+
+// errPreflightRollback is used to roll back the simulation transaction
+var errPreflightRollback = errors.New("preflight rollback")
+
+// errPreflightBusy is returned when a simulation needs a lock held by the
+// indexer, the request can be retried after the block is committed
+var errPreflightBusy = errors.New("preflight conflicts with the indexer")
+
+// lockNotAvailable is the Postgres error code of a lock timeout
+const lockNotAvailable = "55P03"
+
+// PreflightRequest is an unsigned transaction to simulate. Tx uses the same
+// JSON encoding as the LCD, only the body is required
+type PreflightRequest struct {
+	// ChainID selects the chain, it may be omitted when a single chain is
+	// configured
+	ChainID string            `json:"chain_id"`
+	Sender  string            `json:"sender"`
+	Tx      types.Transaction `json:"tx"`
+}
+
+// PreflightResponse is the result of a simulation. Error, Code and Details
+// contain the error the transaction would be stored with
+type PreflightResponse struct {
+	Success bool                   `json:"success"`
+	Error   string                 `json:"error,omitempty"`
+	Code    metaprotocol.ErrorCode `json:"code,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// newPreflightServer returns a server for the preflight API on address
+func (s *Service) newPreflightServer(address string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/preflight", s.handlePreflight)
+	return &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// handlePreflight simulates the transaction in the request body against
+// the current state
+func (s *Service) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	// The API is called from the frontend
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writePreflightError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var request PreflightRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPreflightRequestBytes)).Decode(&request)
+	if err != nil {
+		writePreflightError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err))
+		return
+	}
+
+	indexer, err := s.preflightIndexer(request.ChainID)
+	if err != nil {
+		writePreflightError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Requests over the limit are rejected rather than queued, so a burst
+	// of requests can't keep simulations running against the indexer
+	if s.preflightSlots != nil {
+		select {
+		case s.preflightSlots <- struct{}{}:
+			defer func() { <-s.preflightSlots }()
+		default:
+			writePreflightError(w, http.StatusTooManyRequests, "too many preflight requests")
+			return
+		}
+	}
+
+	response, err := indexer.Preflight(r.Context(), request.Tx, request.Sender)
+	if errors.Is(err, errPreflightBusy) {
+		writePreflightError(w, http.StatusServiceUnavailable, "state is being updated, retry the preflight")
+		return
+	}
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"chain_id": indexer.chainID,
+			"err":      err,
+		}).Error("Unable to run preflight")
+		writePreflightError(w, http.StatusInternalServerError, "unable to run preflight")
+		return
+	}
+	writePreflightResponse(w, http.StatusOK, response)
+}
+
+// preflightIndexer returns the indexer for chainID
+func (s *Service) preflightIndexer(chainID string) (*Indexer, error) {
+	if chainID == "" {
+		if len(s.indexers) != 1 {
+			return nil, errors.New("chain_id is required when multiple chains are indexed")
+		}
+		return s.indexers[0], nil
+	}
+	for _, indexer := range s.indexers {
+		if indexer.chainID == chainID {
+			return indexer, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown chain '%s'", chainID)
+}
+
+// writePreflightError responds with a failed preflight
+func writePreflightError(w http.ResponseWriter, status int, message string) {
+	writePreflightResponse(w, status, PreflightResponse{Error: message})
+}
+
+// writePreflightResponse responds with response as JSON
+func writePreflightResponse(w http.ResponseWriter, status int, response PreflightResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Preflight runs the metaprotocol operation of rawTransaction against the
+// current state as if it was included in the next block, all changes are
+// rolled back. An error is only returned if the simulation itself failed
+func (i *Indexer) Preflight(ctx context.Context, rawTransaction types.Transaction, sender string) (PreflightResponse, error) {
+	// The simulation may not outlive the request or the timeout
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	// The transaction is simulated in the block after the last processed
+	// block, the sender is found with the rules of that height
+	var status models.Status
+	err := i.preflightDB.WithContext(ctx).Where("chain_id = ?", i.chainID).First(&status).Error
+	if err != nil {
+		return PreflightResponse{}, fmt.Errorf("unable to fetch status: %w", err)
+	}
+	height := status.LastProcessedHeight + 1
+
+	messageSender, err := i.preflightRouter.SenderAddress(rawTransaction, height)
+	if err != nil {
+		return preflightResult(metaprotocol.WrapError(metaprotocol.CodeInvalidTransaction, err)), nil
+	}
+	if sender != "" && !strings.EqualFold(sender, messageSender) {
+		return preflightResult(metaprotocol.NewError(metaprotocol.CodeNotAuthorized, "sender '%s' does not match the transaction sender '%s'", sender, messageSender)), nil
+	}
+
+	// Simulated transactions get a random hash so they never collide with
+	// an indexed transaction
+	hash := make([]byte, 32)
+	_, err = rand.Read(hash)
+	if err != nil {
+		return PreflightResponse{}, err
+	}
+	rawTransaction.Hash = "PREFLIGHT" + strings.ToUpper(hex.EncodeToString(hash))
+
+	// The transaction is open while the operation queries the LCD. The
+	// operations only write after their LCD queries, so the only row locked
+	// during a query is the simulated transaction itself. Simulations don't
+	// wait on locks, so the locks they do take are only held for as long as
+	// the writes of the operation run
+	var processErr error
+	err = i.preflightDB.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+		settings := map[string]time.Duration{
+			"statement_timeout":                   preflightStatementTimeout,
+			"lock_timeout":                        preflightLockTimeout,
+			"idle_in_transaction_session_timeout": preflightTimeout,
+		}
+		for setting, timeout := range settings {
+			err := dbTx.Exec(fmt.Sprintf("SET LOCAL %s = %d", setting, timeout.Milliseconds())).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		txModel := models.Transaction{
+			ChainID:       i.chainID,
+			Hash:          rawTransaction.Hash,
+			Height:        height,
+			Content:       rawTransaction.ToJSON(),
+			ContentLength: uint64(len(rawTransaction.ToJSON())),
+			Fees:          "[]",
+			DateCreated:   time.Now().UTC(),
+			StatusMessage: types.TransactionStatePending,
+		}
+		err := dbTx.Create(&txModel).Error
+		if err != nil {
+			return err
+		}
+
+		// The operation runs in a nested transaction like processTransaction
+		// so that a failed statement doesn't abort the outer transaction
+		processErr = dbTx.Transaction(func(processTx *gorm.DB) error {
+			metaprotocolURN, sourceChannel, err := i.parseMetaprotocolURN(rawTransaction)
+			if err != nil {
+				return err
+			}
+			return i.preflightRouter.Route(processTx, txModel, metaprotocolURN, rawTransaction, sourceChannel)
+		})
+		return errPreflightRollback
+	})
+	if err != nil && err != errPreflightRollback {
+		return PreflightResponse{}, err
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(processErr, &pgErr) && pgErr.Code == lockNotAvailable {
+		return PreflightResponse{}, errPreflightBusy
+	}
+	return preflightResult(processErr), nil
+}
+
+// preflightResult returns the response for the processing error err, the
+// error is formatted like the transaction status message
+func preflightResult(err error) PreflightResponse {
+	if err != nil {
+		code, details := metaprotocol.ErrorCodeOf(err)
+		return PreflightResponse{
+			Error:   fmt.Sprintf("%s: %s", types.TransactionStateError, err),
+			Code:    code,
+			Details: details,
+		}
+	}
+	return PreflightResponse{Success: true}
+}
@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// preflight posts body to the preflight handler of service
+func preflight(t *testing.T, service *Service, body string) (int, PreflightResponse) {
+	request := httptest.NewRequest(http.MethodPost, "/v1/preflight", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	service.handlePreflight(recorder, request)
+
+	var response PreflightResponse
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	return recorder.Code, response
+}
+
+func TestPreflightRequests(t *testing.T) {
+	db := newTestDB(t, &models.Status{})
+	assert.NoError(t, db.Create(&models.Status{ChainID: "cosmoshub-4", LastProcessedHeight: 99}).Error)
+	service := &Service{
+		indexers: []*Indexer{{
+			chainID:         "cosmoshub-4",
+			preflightDB:     db,
+			preflightRouter: metaprotocol.NewRouter(metaprotocol.Chain{ID: "cosmoshub-4", MessageRulesHeight: 100}),
+		}},
+	}
+
+	status, response := preflight(t, service, `{"tx": `)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, response.Error, "invalid request")
+
+	status, response = preflight(t, service, `{"chain_id": "osmosis-1", "tx": {}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "unknown chain 'osmosis-1'", response.Error)
+
+	status, response = preflight(t, service, `{"tx": {"body": {"memo": "urn:cft20:cosmoshub-4@v1;mint$tic=ROIDS,amt=1"}}}`)
+	assert.Equal(t, http.StatusOK, status, "processing errors are a successful preflight")
+	assert.False(t, response.Success)
+	assert.Contains(t, response.Error, "no sender address found")
+	assert.Equal(t, "INVALID_TRANSACTION", string(response.Code))
+
+	status, response = preflight(t, service, `{"sender": "cosmos1other", "tx": {"body": {"messages": [{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1sender"}]}}}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, response.Success)
+	assert.Contains(t, response.Error, "does not match the transaction sender")
+	assert.Equal(t, "NOT_AUTHORIZED", string(response.Code))
+
+	// The sender is found with the message rules of the next block
+	status, response = preflight(t, service, `{"tx": {"body": {"messages": [{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1sender"}, {"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1other"}]}}}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, response.Success)
+	assert.Equal(t, "INVALID_TRANSACTION", string(response.Code), "messages with different senders should be rejected from the message rules height")
+}
+
+func TestPreflightConcurrency(t *testing.T) {
+	service := &Service{
+		indexers:       []*Indexer{{chainID: "cosmoshub-4"}},
+		preflightSlots: make(chan struct{}, 1),
+	}
+
+	// Requests over the limit are rejected while a simulation runs
+	service.preflightSlots <- struct{}{}
+	status, response := preflight(t, service, `{"tx": {}}`)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, "too many preflight requests", response.Error)
+}
+
+func TestPreflightChainSelection(t *testing.T) {
+	service := &Service{
+		indexers: []*Indexer{{chainID: "cosmoshub-4"}, {chainID: "neutron-1"}},
+	}
+
+	_, err := service.preflightIndexer("")
+	assert.Error(t, err, "the chain is required with multiple chains")
+
+	indexer, err := service.preflightIndexer("neutron-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "neutron-1", indexer.chainID)
+}
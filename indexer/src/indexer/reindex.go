@@ -0,0 +1,626 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// derivedTables contain state that is built by the metaprotocol processors
+// and the worker. These are rebuilt by a reindex, the transaction table and
+// configuration such as bridge_remote_chain are kept. Tables are listed
+// after the tables they reference
+var derivedTables = []string{
+	"token",
+	"token_holder",
+	"token_address_history",
+	"token_open_position",
+	"token_trade_history",
+	"collection",
+	"collection_stats",
+	"collection_traits",
+	"inscription",
+	"inscription_rarity",
+	"inscription_history",
+	"inscription_part",
+	"inscription_trade_history",
+	"migration_permission_grant",
+	"marketplace_listing",
+	"marketplace_listing_history",
+	"marketplace_cft20_detail",
+	"marketplace_cft20_trade_history",
+	"marketplace_inscription_detail",
+	"bridge_history",
+	"bridge_token",
+	"launchpad",
+	"launchpad_stage",
+	"launchpad_whitelist",
+	"launchpad_mint_reservation",
+	"troll_post",
+	"block_checksum",
+}
+
+// explicitTables have a manually moderated is_explicit flag which is
+// restored after a reindex
+var explicitTables = []string{
+	"token",
+	"collection",
+	"inscription",
+	"troll_post",
+}
+
+// reindexSchema holds the tables a reindex replays into. The live tables are
+// only changed when the replayed state is applied
+const reindexSchema = "reindex_scratch"
+
+// copiedTables are copied into the scratch schema with their rows. The
+// replay stores the transactions again with their new status
+var copiedTables = []string{
+	"transaction",
+	"status",
+}
+
+// scratchTables are created empty in the scratch schema so that the events
+// and jobs of the replayed transactions aren't written to the live tables
+var scratchTables = []string{
+	"event_outbox",
+	"job_outbox",
+}
+
+// maxReportedDifferences limits how many state differences are logged
+const maxReportedDifferences = 100
+
+// defaultReindexBatchSize is the number of heights replayed in a single
+// database transaction when no batch size is given
+const defaultReindexBatchSize = 1000
+
+// ReindexOptions configures a reindex run
+type ReindexOptions struct {
+	// FromHeight is the first height to replay. When 0 the height of the
+	// first stored transaction is used. All state is rebuilt from an empty
+	// state, so partial ranges are not supported and FromHeight can't be
+	// after the first stored transaction
+	FromHeight uint64
+	// ToHeight is the last height to replay. When 0 the last processed height
+	// is used
+	ToHeight uint64
+	// BatchSize is the number of heights replayed and committed in a single
+	// database transaction. When 0 defaultReindexBatchSize is used
+	BatchSize uint64
+	// Refetch fetches the blocks from the chain instead of replaying the
+	// stored transactions
+	Refetch bool
+	// DryRun reports the differences with the live state and checksums
+	// without applying the replayed state
+	DryRun bool
+}
+
+// reindexRange is the height range replayed for a chain
+type reindexRange struct {
+	fromHeight uint64
+	toHeight   uint64
+}
+
+// reindexTransaction runs fn in a database transaction
+type reindexTransaction func(fn func(dbTx *gorm.DB) error) error
+
+// Reindex rebuilds the derived metaprotocol state by replaying the
+// transactions of every configured chain through the metaprotocol processors.
+// The state is replayed from an empty state into the tables of a scratch
+// schema, so FromHeight can't be after the first stored transaction and the
+// live tables are only read while replaying. Unless it is a dry run, the
+// replayed state then replaces the live state in a single database
+// transaction. A height range can only be given when a single chain is
+// configured. The indexer service must not be running while reindexing. If
+// ctx is done before the reindex completes the live state is unchanged and
+// the reindex has to be run again
+func (s *Service) Reindex(ctx context.Context, options ReindexOptions) error {
+	if len(s.indexers) > 1 && (options.FromHeight != 0 || options.ToHeight != 0) {
+		return fmt.Errorf("a height range can't be used with multiple chains")
+	}
+	if options.BatchSize == 0 {
+		options.BatchSize = defaultReindexBatchSize
+	}
+
+	ranges := make([]reindexRange, len(s.indexers))
+	for index, indexer := range s.indexers {
+		heights, err := indexer.reindexRange(ctx, options)
+		if err != nil {
+			return err
+		}
+		ranges[index] = heights
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"chains":     len(s.indexers),
+		"refetch":    options.Refetch,
+		"batch_size": options.BatchSize,
+		"dry_run":    options.DryRun,
+	}).Info("Starting reindex")
+
+	err := s.prepareScratch(ctx, ranges)
+	// The scratch schema is removed even if the reindex is interrupted
+	defer func() {
+		err := s.db.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", quoteIdentifier(reindexSchema))).Error
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"schema": reindexSchema,
+				"err":    err,
+			}).Error("Unable to remove the reindex schema")
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("unable to prepare the reindex schema: %w", err)
+	}
+
+	transaction := func(fn func(dbTx *gorm.DB) error) error {
+		return s.inScratch(ctx, fn)
+	}
+	for index, indexer := range s.indexers {
+		err = indexer.reindex(ctx, transaction, ranges[index], options)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.reportReindex(ctx, ranges)
+	if err != nil {
+		return err
+	}
+	if !options.DryRun {
+		err = s.applyReindex(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to apply the reindexed state: %w", err)
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"chains":  len(s.indexers),
+		"dry_run": options.DryRun,
+	}).Info("Reindex complete")
+	return nil
+}
+
+// inScratch runs fn in a database transaction that uses the tables of the
+// scratch schema over the live tables
+func (s *Service) inScratch(ctx context.Context, fn func(dbTx *gorm.DB) error) error {
+	return s.db.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+		err := dbTx.Exec(fmt.Sprintf("SET LOCAL search_path TO %s, public", quoteIdentifier(reindexSchema))).Error
+		if err != nil {
+			return err
+		}
+		return fn(dbTx)
+	})
+}
+
+// prepareScratch creates the scratch schema with empty derived tables and
+// sets the status of the chains to before ranges. The live tables are only
+// read, so the indexed state stays available while replaying
+func (s *Service) prepareScratch(ctx context.Context, ranges []reindexRange) error {
+	return s.db.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+		schema := quoteIdentifier(reindexSchema)
+		err := dbTx.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", schema)).Error
+		if err != nil {
+			return err
+		}
+		err = dbTx.Exec(fmt.Sprintf("CREATE SCHEMA %s", schema)).Error
+		if err != nil {
+			return err
+		}
+
+		tables := append(append(append([]string{}, copiedTables...), scratchTables...), derivedTables...)
+		for _, table := range tables {
+			err = createScratchTable(dbTx, table)
+			if err != nil {
+				return fmt.Errorf("unable to create scratch table '%s': %w", table, err)
+			}
+		}
+		for _, table := range copiedTables {
+			err = dbTx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", qualifiedTable(reindexSchema, table), qualifiedTable("public", table))).Error
+			if err != nil {
+				return fmt.Errorf("unable to copy table '%s': %w", table, err)
+			}
+			err = syncSequences(dbTx, reindexSchema, table)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Nothing is processed until the first batch is committed
+		for index, indexer := range s.indexers {
+			lastProcessedHeight := ranges[index].fromHeight
+			if lastProcessedHeight > 0 {
+				lastProcessedHeight--
+			}
+			err = dbTx.Table(qualifiedTable(reindexSchema, "status")).Where("chain_id = ?", indexer.chainID).UpdateColumns(map[string]interface{}{
+				"last_processed_height": lastProcessedHeight,
+				"state_checksum":        "",
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createScratchTable creates table in the scratch schema with the columns,
+// constraints and indexes of the live table. Serial columns get sequences of
+// their own, so the IDs start at 1 like in an empty database
+func createScratchTable(db *gorm.DB, table string) error {
+	scratchTable := qualifiedTable(reindexSchema, table)
+	err := db.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS INCLUDING INDEXES)", scratchTable, qualifiedTable("public", table))).Error
+	if err != nil {
+		return err
+	}
+
+	columns, err := serialColumns(db, table)
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		sequence := qualifiedTable(reindexSchema, table+"_"+column+"_seq")
+		err = db.Exec(fmt.Sprintf("CREATE SEQUENCE %s OWNED BY %s.%s", sequence, scratchTable, quoteIdentifier(column))).Error
+		if err != nil {
+			return err
+		}
+		// DDL statements can't have parameters
+		err = db.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT nextval(%s::regclass)", scratchTable, quoteIdentifier(column), quoteLiteral(sequence))).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serialColumns returns the columns of the live table that default to the
+// next value of a sequence
+func serialColumns(db *gorm.DB, table string) ([]string, error) {
+	var columns []string
+	err := db.Raw("SELECT column_name FROM information_schema.columns WHERE table_schema = 'public' AND table_name = ? AND column_default LIKE 'nextval(%'", table).Scan(&columns).Error
+	return columns, err
+}
+
+// syncSequences sets the sequences of the serial columns of table in schema
+// to continue after the highest stored value
+func syncSequences(db *gorm.DB, schema string, table string) error {
+	columns, err := serialColumns(db, table)
+	if err != nil {
+		return err
+	}
+	qualified := qualifiedTable(schema, table)
+	for _, column := range columns {
+		err = db.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE(MAX(%s), 0) + 1, false) FROM %s", quoteIdentifier(column), qualified), qualified, column).Error
+		if err != nil {
+			return fmt.Errorf("unable to update the sequence of '%s.%s': %w", table, column, err)
+		}
+	}
+	return nil
+}
+
+// applyReindex replaces the live derived state with the replayed state in a
+// single database transaction. The live rows are deleted rather than
+// truncated, so the previous state can be read until the transaction
+// commits. The explicit flags of the live rows are kept, and the jobs queued
+// by the replayed transactions are added to the job outbox
+func (s *Service) applyReindex(ctx context.Context) error {
+	return s.db.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+		explicitTransactionIDs := make(map[string][]uint64, len(explicitTables))
+		for _, table := range explicitTables {
+			var transactionIDs []uint64
+			err := dbTx.Table(qualifiedTable("public", table)).Where("is_explicit = ?", true).Pluck("transaction_id", &transactionIDs).Error
+			if err != nil {
+				return err
+			}
+			explicitTransactionIDs[table] = transactionIDs
+		}
+
+		// Rows referencing other derived rows are deleted first
+		for index := len(derivedTables) - 1; index >= 0; index-- {
+			err := dbTx.Exec(fmt.Sprintf("DELETE FROM %s", qualifiedTable("public", derivedTables[index]))).Error
+			if err != nil {
+				return fmt.Errorf("unable to remove the state of '%s': %w", derivedTables[index], err)
+			}
+		}
+
+		// Transactions are stored first, refetched blocks may have added
+		// transactions that the derived rows reference
+		err := dbTx.Exec(fmt.Sprintf(`INSERT INTO %s AS live SELECT * FROM %s
+			ON CONFLICT (id) DO UPDATE SET status_message = EXCLUDED.status_message, error_code = EXCLUDED.error_code, error_details = EXCLUDED.error_details
+			WHERE (live.status_message, live.error_code, live.error_details::text) IS DISTINCT FROM (EXCLUDED.status_message, EXCLUDED.error_code, EXCLUDED.error_details::text)`,
+			qualifiedTable("public", "transaction"), qualifiedTable(reindexSchema, "transaction"))).Error
+		if err != nil {
+			return fmt.Errorf("unable to store the replayed transactions: %w", err)
+		}
+		err = syncSequences(dbTx, "public", "transaction")
+		if err != nil {
+			return err
+		}
+
+		for _, table := range derivedTables {
+			err = dbTx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", qualifiedTable("public", table), qualifiedTable(reindexSchema, table))).Error
+			if err != nil {
+				return fmt.Errorf("unable to store the state of '%s': %w", table, err)
+			}
+			err = syncSequences(dbTx, "public", table)
+			if err != nil {
+				return err
+			}
+		}
+
+		for table, transactionIDs := range explicitTransactionIDs {
+			if len(transactionIDs) == 0 {
+				continue
+			}
+			err = dbTx.Table(qualifiedTable("public", table)).Where("transaction_id IN ? AND is_explicit = ?", transactionIDs, false).Update("is_explicit", true).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// The events of the replayed transactions have already been
+		// delivered, only their jobs are queued again
+		err = dbTx.Exec(fmt.Sprintf("INSERT INTO %s (kind, args, scheduled_at, date_created) SELECT kind, args, scheduled_at, date_created FROM %s ORDER BY id",
+			qualifiedTable("public", "job_outbox"), qualifiedTable(reindexSchema, "job_outbox"))).Error
+		if err != nil {
+			return fmt.Errorf("unable to queue the replayed jobs: %w", err)
+		}
+
+		for _, indexer := range s.indexers {
+			var status models.Status
+			err = dbTx.Table(qualifiedTable(reindexSchema, "status")).Where("chain_id = ?", indexer.chainID).First(&status).Error
+			if err != nil {
+				return err
+			}
+			err = dbTx.Table(qualifiedTable("public", "status")).Where("chain_id = ?", indexer.chainID).UpdateColumns(map[string]interface{}{
+				"last_processed_height": status.LastProcessedHeight,
+				"state_checksum":        status.StateChecksum,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// reportReindex logs the differences between the live state and the replayed
+// state, and the first height where the checksums of each chain diverge
+func (s *Service) reportReindex(ctx context.Context, ranges []reindexRange) error {
+	previousState, err := loadStateSummary(s.db.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to load state: %w", err)
+	}
+	var currentState stateSummary
+	err = s.inScratch(ctx, func(dbTx *gorm.DB) error {
+		currentState, err = loadStateSummary(dbTx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to load the replayed state: %w", err)
+	}
+	s.reportStateDifferences(diffStateSummaries(previousState, currentState))
+
+	scratchChecksums := s.db.WithContext(ctx).Table(qualifiedTable(reindexSchema, "block_checksum")).Session(&gorm.Session{})
+	for index, indexer := range s.indexers {
+		divergedHeight, checksum, replayedChecksum, err := firstDivergence(
+			newChecksumReader(s.db.WithContext(ctx), indexer.chainID, ranges[index].toHeight).next,
+			newChecksumReader(scratchChecksums, indexer.chainID, ranges[index].toHeight).next,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to compare the checksums of chain '%s': %w", indexer.chainID, err)
+		}
+
+		fields := logrus.Fields{
+			"chain_id":          indexer.chainID,
+			"checksum":          checksum,
+			"replayed_checksum": replayedChecksum,
+		}
+		if divergedHeight == 0 {
+			s.logger.WithFields(fields).Info("Replayed checksums match the previous index")
+			continue
+		}
+		fields["diverged_height"] = divergedHeight
+		s.logger.WithFields(fields).Warn("Replayed checksums diverge from the previous index")
+	}
+	return nil
+}
+
+// qualifiedTable returns the quoted name of table in schema
+func qualifiedTable(schema string, table string) string {
+	return quoteIdentifier(schema) + "." + quoteIdentifier(table)
+}
+
+// quoteIdentifier quotes a Postgres identifier
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral quotes a Postgres string literal
+func quoteLiteral(value string) string {
+	return `'` + strings.ReplaceAll(value, `'`, `''`) + `'`
+}
+
+// reindexRange returns the height range to replay for the chain
+func (i *Indexer) reindexRange(ctx context.Context, options ReindexOptions) (reindexRange, error) {
+	var status models.Status
+	result := i.db.WithContext(ctx).Where("chain_id = ?", i.chainID).First(&status)
+	if result.Error != nil {
+		return reindexRange{}, fmt.Errorf("unable to fetch status for chain '%s': %w", i.chainID, result.Error)
+	}
+
+	var firstHeight uint64
+	err := i.db.WithContext(ctx).Model(&models.Transaction{}).Where("chain_id = ?", i.chainID).Select("COALESCE(MIN(height), 0)").Scan(&firstHeight).Error
+	if err != nil {
+		return reindexRange{}, err
+	}
+
+	heights := reindexRange{
+		fromHeight: options.FromHeight,
+		toHeight:   options.ToHeight,
+	}
+	if heights.fromHeight == 0 {
+		heights.fromHeight = firstHeight
+	}
+	if heights.toHeight == 0 {
+		heights.toHeight = status.LastProcessedHeight
+	}
+	if heights.fromHeight > heights.toHeight {
+		return reindexRange{}, fmt.Errorf("start height %d is after target height %d", heights.fromHeight, heights.toHeight)
+	}
+	// The state is wiped, the transactions before the start height would
+	// be lost
+	if firstHeight != 0 && heights.fromHeight > firstHeight {
+		return reindexRange{}, fmt.Errorf("start height %d is after the first stored transaction at height %d of chain '%s'", heights.fromHeight, firstHeight, i.chainID)
+	}
+	return heights, nil
+}
+
+// reindex replays the blocks in heights, committing batches of heights with
+// transaction. The last processed height is updated with every batch
+func (i *Indexer) reindex(ctx context.Context, transaction reindexTransaction, heights reindexRange, options ReindexOptions) error {
+	i.logger.WithFields(logrus.Fields{
+		"from_height": heights.fromHeight,
+		"to_height":   heights.toHeight,
+	}).Info("Replaying chain")
+
+	// The checksums are rebuilt along with the state
+	var checksum string
+	for batchHeight := heights.fromHeight; batchHeight <= heights.toHeight; batchHeight += options.BatchSize {
+		lastHeight := min(batchHeight+options.BatchSize-1, heights.toHeight)
+		err := transaction(func(dbTx *gorm.DB) error {
+			batchChecksum, err := i.reindexBatch(ctx, dbTx, batchHeight, lastHeight, options.Refetch, checksum)
+			if err != nil {
+				return err
+			}
+			checksum = batchChecksum
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		i.logger.WithFields(logrus.Fields{
+			"height":    lastHeight,
+			"to_height": heights.toHeight,
+		}).Info("Reindex progress")
+	}
+	return nil
+}
+
+// reindexBatch replays the blocks from fromHeight to toHeight, chaining the
+// checksums onto checksum, and stores toHeight as the last processed height.
+// The checksum after toHeight is returned
+func (i *Indexer) reindexBatch(ctx context.Context, db *gorm.DB, fromHeight uint64, toHeight uint64, refetch bool, checksum string) (string, error) {
+	for height := fromHeight; height <= toHeight; height++ {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		changes := newStateChanges()
+		blockDB := db.WithContext(withStateChanges(ctx, changes))
+		var blockTime time.Time
+		var err error
+		if refetch {
+			blockTime, err = i.reindexFetchedBlock(ctx, blockDB, height)
+		} else {
+			blockTime, err = i.reindexStoredBlock(blockDB, height)
+		}
+		if err != nil {
+			return "", fmt.Errorf("unable to reindex height %d of chain '%s': %w", height, i.chainID, err)
+		}
+
+		checksum, err = i.commitChecksum(blockDB, changes, height, blockTime, checksum)
+		if err != nil {
+			return "", fmt.Errorf("unable to reindex height %d of chain '%s': %w", height, i.chainID, err)
+		}
+	}
+
+	err := db.Model(&models.Status{}).Where("chain_id = ?", i.chainID).UpdateColumns(map[string]interface{}{
+		"last_processed_height": toHeight,
+		"state_checksum":        checksum,
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+// reindexStoredBlock replays the transactions stored for height and returns
+// the block time
+func (i *Indexer) reindexStoredBlock(db *gorm.DB, height uint64) (time.Time, error) {
+	var transactionModels []models.Transaction
+	result := db.Where("chain_id = ? AND height = ?", i.chainID, height).Order("id").Find(&transactionModels)
+	if result.Error != nil {
+		return time.Time{}, result.Error
+	}
+
+	var blockTime time.Time
+	for _, transactionModel := range transactionModels {
+		var rawTransaction types.Transaction
+		err := json.Unmarshal([]byte(transactionModel.Content), &rawTransaction)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to decode transaction %s: %w", transactionModel.Hash, err)
+		}
+		rawTransaction.Hash = transactionModel.Hash
+
+		blockTime = transactionModel.DateCreated
+		err = i.processTransaction(db, height, transactionModel.DateCreated, rawTransaction)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return blockTime, nil
+}
+
+// reindexFetchedBlock fetches the block at height from the chain, processes
+// its transactions and returns the block time
+func (i *Indexer) reindexFetchedBlock(ctx context.Context, db *gorm.DB, height uint64) (time.Time, error) {
+	block, transactions, err := i.fetchTransactions(ctx, height)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	blockHeight, err := strconv.ParseUint(block.Block.Header.Height, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse height: %w", err)
+	}
+
+	for _, rawTransaction := range transactions {
+		err = i.processTransaction(db, blockHeight, block.Block.Header.Time, rawTransaction)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return block.Block.Header.Time, nil
+}
+
+// reportStateDifferences logs the differences found after a reindex
+func (s *Service) reportStateDifferences(differences []stateDifference) {
+	for index, difference := range differences {
+		if index == maxReportedDifferences {
+			s.logger.WithFields(logrus.Fields{
+				"remaining": len(differences) - maxReportedDifferences,
+			}).Warn("Too many state differences, not reporting the rest")
+			break
+		}
+		s.logger.WithFields(logrus.Fields{
+			"table":    difference.Table,
+			"key":      difference.Key,
+			"previous": difference.Previous,
+			"current":  difference.Current,
+		}).Warn("State changed after reindex")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"differences": len(differences),
+	}).Info("Compared state with previous index")
+}
@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReindexRange(t *testing.T) {
+	db := newTestDB(t, &models.Status{}, &models.Transaction{})
+	assert.NoError(t, db.Create(&models.Status{ChainID: "cosmoshub-4", LastProcessedHeight: 200}).Error)
+	assert.NoError(t, db.Create(&models.Transaction{ChainID: "cosmoshub-4", Height: 100, Hash: "ABC"}).Error)
+	indexer := &Indexer{chainID: "cosmoshub-4", db: db}
+
+	heights, err := indexer.reindexRange(context.Background(), ReindexOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, reindexRange{fromHeight: 100, toHeight: 200}, heights)
+
+	heights, err = indexer.reindexRange(context.Background(), ReindexOptions{FromHeight: 50, ToHeight: 150})
+	assert.NoError(t, err)
+	assert.Equal(t, reindexRange{fromHeight: 50, toHeight: 150}, heights)
+
+	_, err = indexer.reindexRange(context.Background(), ReindexOptions{FromHeight: 150})
+	assert.ErrorContains(t, err, "after the first stored transaction", "state before the start height would be wiped")
+}
+
+func TestQualifiedTable(t *testing.T) {
+	assert.Equal(t, `"reindex_scratch"."transaction"`, qualifiedTable(reindexSchema, "transaction"))
+	assert.Equal(t, `"a""b"`, quoteIdentifier(`a"b`))
+	assert.Equal(t, `'"public"."it''s"'`, quoteLiteral(qualifiedTable("public", "it's")))
+}
+
+func TestDerivedTableOrder(t *testing.T) {
+	// The replayed state is inserted in the order of derivedTables, tables
+	// must be listed after the derived tables they reference
+	schema, err := os.ReadFile("../../schema.sql")
+	assert.NoError(t, err)
+	createTable := regexp.MustCompile(`(?i)CREATE TABLE "?public"?\."?(\w+)"? \(`)
+	reference := regexp.MustCompile(`(?i)REFERENCES "?public"?\."?(\w+)"?`)
+
+	positions := make(map[string]int)
+	for index, table := range derivedTables {
+		positions[table] = index
+	}
+	var table string
+	for _, line := range strings.Split(string(schema), "\n") {
+		if match := createTable.FindStringSubmatch(line); match != nil {
+			table = match[1]
+			continue
+		}
+		match := reference.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		tablePosition, derived := positions[table]
+		referencePosition, referenceDerived := positions[match[1]]
+		if derived && referenceDerived {
+			assert.Less(t, referencePosition, tablePosition, "%s references %s", table, match[1])
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// ReloadChannel is notified to reload the processor configuration, such as
+// the collection reservations, of a running indexer
+const ReloadChannel = "indexer_reload"
+
+// maxReloadReconnectDelay limits the wait between reconnection attempts of
+// the reload listener
+const maxReloadReconnectDelay = 30 * time.Second
+
+// Reload reloads the processor configuration of every chain. Processors
+// keep their current configuration if it can't be loaded
+func (s *Service) Reload() error {
+	for _, indexer := range s.indexers {
+		err := indexer.router.Reload()
+		if err != nil {
+			return err
+		}
+		err = indexer.preflightRouter.Reload()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listenReload reloads the processor configuration whenever ReloadChannel is
+// notified until ctx is done
+func (s *Service) listenReload(ctx context.Context) {
+	delay := time.Second
+	for {
+		connected, err := s.waitReload(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = time.Second
+		}
+		s.logger.WithFields(logrus.Fields{
+			"err":   err,
+			"retry": delay,
+		}).Warn("Reload listener connection lost, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReloadReconnectDelay)
+	}
+}
+
+// waitReload listens on ReloadChannel and reloads on every notification
+// until the connection fails. connected is true if listening started
+func (s *Service) waitReload(ctx context.Context) (connected bool, err error) {
+	conn, err := pgx.Connect(ctx, s.dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{ReloadChannel}.Sanitize())
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		_, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+
+		err = s.Reload()
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to reload configuration")
+			continue
+		}
+		s.logger.Info("Reloaded configuration")
+	}
+}
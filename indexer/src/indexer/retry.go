@@ -0,0 +1,139 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// errRetryRollback is used to roll back a retry that isn't applied
+var errRetryRollback = errors.New("retry rolled back")
+
+// RetryResult is the outcome of re-running a stored transaction
+type RetryResult struct {
+	ChainID string `json:"chain_id"`
+	Hash    string `json:"hash"`
+	Height  uint64 `json:"height"`
+	// Applied is set when the changes were kept
+	Applied bool `json:"applied"`
+	// PreviousStatus is the stored status message before the retry
+	PreviousStatus string                 `json:"previous_status"`
+	Status         string                 `json:"status"`
+	Code           metaprotocol.ErrorCode `json:"code,omitempty"`
+	Details        map[string]interface{} `json:"details,omitempty"`
+}
+
+// RetryTransaction re-runs the metaprotocol operation of the stored
+// transaction with hash on chainID against the current state. Changes are rolled back
+// unless apply is set, only failed transactions can be applied. The
+// operation runs with the state as it is now rather than as it was at the
+// height of the transaction, and applied changes are not part of the state
+// checksum of any block. A reindex replays the transaction at its original
+// height and may fail it again
+func (s *Service) RetryTransaction(ctx context.Context, chainID string, hash string, apply bool) (RetryResult, error) {
+	txModel, err := FindTransaction(s.db.WithContext(ctx), chainID, hash)
+	if err != nil {
+		return RetryResult{}, err
+	}
+
+	var indexer *Indexer
+	for _, chainIndexer := range s.indexers {
+		if chainIndexer.chainID == txModel.ChainID {
+			indexer = chainIndexer
+			break
+		}
+	}
+	if indexer == nil {
+		return RetryResult{}, fmt.Errorf("chain '%s' of transaction %s is not configured", txModel.ChainID, txModel.Hash)
+	}
+	if apply && !strings.HasPrefix(txModel.StatusMessage, types.TransactionStateError) {
+		return RetryResult{}, fmt.Errorf("transaction %s has status '%s', only failed transactions can be applied", txModel.Hash, txModel.StatusMessage)
+	}
+
+	return indexer.retryTransaction(ctx, txModel, apply)
+}
+
+// FindTransaction returns the stored transaction with hash. Hashes are only
+// unique per chain, chainID may be empty if the hash is stored on a single
+// chain
+func FindTransaction(db *gorm.DB, chainID string, hash string) (models.Transaction, error) {
+	query := db.Where("hash = ?", strings.ToUpper(hash))
+	if chainID != "" {
+		query = query.Where("chain_id = ?", chainID)
+	}
+	var txModels []models.Transaction
+	err := query.Limit(2).Find(&txModels).Error
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("unable to find transaction %s: %w", hash, err)
+	}
+	switch len(txModels) {
+	case 0:
+		return models.Transaction{}, fmt.Errorf("unable to find transaction %s: %w", hash, gorm.ErrRecordNotFound)
+	case 1:
+		return txModels[0], nil
+	default:
+		return models.Transaction{}, fmt.Errorf("transaction %s is stored on more than one chain, the chain is required", hash)
+	}
+}
+
+// retryTransaction re-runs the metaprotocol operation of txModel and stores
+// the new status if apply is set
+func (i *Indexer) retryTransaction(ctx context.Context, txModel models.Transaction, apply bool) (RetryResult, error) {
+	var rawTransaction types.Transaction
+	err := json.Unmarshal([]byte(txModel.Content), &rawTransaction)
+	if err != nil {
+		return RetryResult{}, fmt.Errorf("unable to decode transaction %s: %w", txModel.Hash, err)
+	}
+	rawTransaction.Hash = txModel.Hash
+
+	result := RetryResult{
+		ChainID:        txModel.ChainID,
+		Hash:           txModel.Hash,
+		Height:         txModel.Height,
+		Applied:        apply,
+		PreviousStatus: txModel.StatusMessage,
+	}
+
+	// A dry run uses the preflight processors so that no jobs are queued
+	router := i.preflightRouter
+	if apply {
+		router = i.router
+	}
+
+	err = i.db.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+		processErr := dbTx.Transaction(func(processTx *gorm.DB) error {
+			return i.processMetaprotocolMemo(processTx, router, txModel, rawTransaction)
+		})
+		err := setTransactionStatus(&txModel, processErr)
+		if err != nil {
+			return err
+		}
+		result.Status = txModel.StatusMessage
+		if processErr != nil {
+			result.Code, result.Details = metaprotocol.ErrorCodeOf(processErr)
+		}
+
+		if !apply {
+			return errRetryRollback
+		}
+		return dbTx.Model(&txModel).Select("status_message", "error_code", "error_details").Updates(&txModel).Error
+	})
+	if err != nil && err != errRetryRollback {
+		return RetryResult{}, err
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"hash":    txModel.Hash,
+		"applied": apply,
+		"status":  result.Status,
+	}).Info("Retried transaction")
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package indexer
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSetTransactionStatus(t *testing.T) {
+	txModel := models.Transaction{Hash: "ABCD"}
+	err := setTransactionStatus(&txModel, metaprotocol.NewError(metaprotocol.CodeTickerReserved, "ticker '%s' is reserved", "ROIDS").With("ticker", "ROIDS"))
+	assert.NoError(t, err)
+	assert.Equal(t, types.TransactionStateError+": ticker 'ROIDS' is reserved", txModel.StatusMessage)
+	assert.Equal(t, sql.NullString{String: string(metaprotocol.CodeTickerReserved), Valid: true}, txModel.ErrorCode)
+	assert.JSONEq(t, `{"ticker":"ROIDS"}`, string(txModel.ErrorDetails))
+
+	// A successful retry clears the previous error
+	err = setTransactionStatus(&txModel, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, types.TransactionStateSuccess, txModel.StatusMessage)
+	assert.False(t, txModel.ErrorCode.Valid)
+	assert.Nil(t, txModel.ErrorDetails)
+}
+
+func TestFindTransaction(t *testing.T) {
+	db := newTestDB(t, &models.Transaction{})
+	assert.NoError(t, db.Create(&models.Transaction{ChainID: "cosmoshub-4", Hash: "ABCD", Height: 10}).Error)
+	assert.NoError(t, db.Create(&models.Transaction{ChainID: "neutron-1", Hash: "ABCD", Height: 20}).Error)
+	assert.NoError(t, db.Create(&models.Transaction{ChainID: "neutron-1", Hash: "EF01", Height: 30}).Error)
+
+	_, err := FindTransaction(db, "", "abcd")
+	assert.Error(t, err, "the chain is required when the hash is stored on more than one chain")
+
+	txModel, err := FindTransaction(db, "neutron-1", "abcd")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), txModel.Height)
+
+	txModel, err = FindTransaction(db, "", "ef01")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(30), txModel.Height)
+
+	_, err = FindTransaction(db, "cosmoshub-4", "EF01")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
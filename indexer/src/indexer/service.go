@@ -0,0 +1,230 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/metaprotocol"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/metrics"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/worker"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Config defines the environment variables shared by all chains
+type Config struct {
+	// Chains lists the names of the chains to index. Each chain is configured
+	// with ChainConfig variables prefixed by its name. When empty a single
+	// chain is configured with the unprefixed variables
+	Chains         []string `envconfig:"CHAINS"`
+	DatabaseDSN    string   `envconfig:"DATABASE_DSN" required:"true"`
+	MetricsAddress string   `envconfig:"METRICS_ADDRESS" default:":9090"`
+	StallTimeoutMS int      `envconfig:"STALL_TIMEOUT_MS" default:"300000"`
+	ReadyMaxLag    uint64   `envconfig:"READY_MAX_LAG" default:"10"`
+	// PreflightAddress serves the unauthenticated preflight API, it is
+	// disabled when empty
+	PreflightAddress string `envconfig:"PREFLIGHT_ADDRESS"`
+	// PreflightMaxConcurrent limits the simulations that run at the same
+	// time, each uses a connection of its own pool
+	PreflightMaxConcurrent int `envconfig:"PREFLIGHT_MAX_CONCURRENT" default:"4"`
+	// NotifyEnabled sends committed blocks and events with NOTIFY
+	NotifyEnabled bool `envconfig:"NOTIFY_ENABLED" default:"true"`
+}
+
+// Service implements the reference indexer service, it runs an independent
+// Indexer for every configured chain against the same database
+type Service struct {
+	logger          *logrus.Entry
+	db              *gorm.DB
+	dsn             string
+	indexers        []*Indexer
+	metricsServer   *metrics.Server
+	preflightServer *http.Server
+	// preflightSlots limits the simulations that run at the same time
+	preflightSlots chan struct{}
+}
+
+// New returns a new instance of the indexer service and returns an error if
+// there was a problem setting up the service
+func New(
+	log *logrus.Entry) (*Service, error) {
+
+	// Parse config environment variables for self
+	var config Config
+	err := envconfig.Process("", &config)
+	if err != nil {
+		log.Fatalf("Unable to process config: %s", err)
+	}
+
+	chainConfigs, err := loadChainConfigs(config.Chains)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(postgres.Open(config.DatabaseDSN), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = registerStateCallbacks(db)
+	if err != nil {
+		return nil, err
+	}
+
+	workerClient, err := worker.NewWorkerClient(log)
+	if err != nil {
+		return nil, err
+	}
+
+	// All chains store content in the same store
+	var contentConfig contentstore.Config
+	err = envconfig.Process("", &contentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to process content store config: %w", err)
+	}
+	contentStore, err := contentstore.New(contentConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &Service{
+		logger: log,
+		db:     db,
+		dsn:    config.DatabaseDSN,
+	}
+
+	stallTimeout := time.Duration(config.StallTimeoutMS) * time.Millisecond
+	for _, chainConfig := range chainConfigs {
+		indexer, err := newIndexer(chainConfig, db, workerClient, contentStore, stallTimeout, config.ReadyMaxLag, log)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create indexer for chain '%s': %w", chainConfig.ChainID, err)
+		}
+		indexer.notify = config.NotifyEnabled
+		service.indexers = append(service.indexers, indexer)
+	}
+
+	// Expose metrics and health checks, the service is ready once all chains
+	// have caught up
+	if config.MetricsAddress != "" {
+		service.metricsServer = metrics.NewServer(config.MetricsAddress, log)
+		service.metricsServer.AddHealthCheck("database", service.checkDatabase)
+		for _, indexer := range service.indexers {
+			service.metricsServer.AddHealthCheck("indexing/"+indexer.chainID, indexer.checkStalled)
+			service.metricsServer.AddReadinessCheck("lag/"+indexer.chainID, indexer.checkLag)
+		}
+	}
+
+	if config.PreflightAddress != "" {
+		// Simulations use a pool of their own, so they can't take the
+		// connections of the indexers
+		preflightDB, err := gorm.Open(postgres.Open(config.DatabaseDSN), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+		})
+		if err != nil {
+			return nil, err
+		}
+		sqlDB, err := preflightDB.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(config.PreflightMaxConcurrent)
+		for _, indexer := range service.indexers {
+			indexer.preflightDB = preflightDB
+		}
+		service.preflightSlots = make(chan struct{}, config.PreflightMaxConcurrent)
+		service.preflightServer = service.newPreflightServer(config.PreflightAddress)
+	}
+
+	return service, nil
+}
+
+// loadChainConfigs reads the configuration of every chain in names, or the
+// unprefixed configuration if names is empty
+func loadChainConfigs(names []string) ([]ChainConfig, error) {
+	prefixes := []string{""}
+	if len(names) > 0 {
+		prefixes = nil
+		for _, name := range names {
+			prefix := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), "-", "_"))
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	var chainConfigs []ChainConfig
+	chainIDs := make(map[string]bool)
+	for _, prefix := range prefixes {
+		var chainConfig ChainConfig
+		err := envconfig.Process(prefix, &chainConfig)
+		if err != nil {
+			return nil, fmt.Errorf("unable to process config for chain '%s': %w", prefix, err)
+		}
+		if chainIDs[chainConfig.ChainID] {
+			return nil, fmt.Errorf("chain ID '%s' is configured more than once", chainConfig.ChainID)
+		}
+		chainIDs[chainConfig.ChainID] = true
+		chainConfigs = append(chainConfigs, chainConfig)
+	}
+	return chainConfigs, nil
+}
+
+// Operations returns the catalogue of supported metaprotocol operations,
+// all chains support the same operations
+func (s *Service) Operations() []metaprotocol.OperationInfo {
+	return s.indexers[0].Operations()
+}
+
+// Run indexes all chains until ctx is done
+func (s *Service) Run(ctx context.Context) error {
+	if s.metricsServer != nil {
+		s.metricsServer.Start()
+	}
+	if s.preflightServer != nil {
+		s.logger.WithFields(logrus.Fields{
+			"address": s.preflightServer.Addr,
+		}).Info("Starting preflight server")
+		go func() {
+			err := s.preflightServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				s.logger.WithFields(logrus.Fields{
+					"err": err,
+				}).Error("Preflight server failed")
+			}
+		}()
+	}
+
+	// Configuration such as the reservations is reloaded when notified by
+	// the admin CLI
+	go s.listenReload(ctx)
+
+	var wg sync.WaitGroup
+	for _, indexer := range s.indexers {
+		wg.Add(1)
+		go func(indexer *Indexer) {
+			defer wg.Done()
+			indexer.Run(ctx)
+		}(indexer)
+	}
+	wg.Wait()
+
+	if s.preflightServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := s.preflightServer.Shutdown(shutdownCtx)
+		if err != nil {
+			return err
+		}
+	}
+	if s.metricsServer != nil {
+		return s.metricsServer.Stop()
+	}
+	return nil
+}
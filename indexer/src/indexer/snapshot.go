@@ -0,0 +1,315 @@
+package indexer
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// snapshotVersion is increased when the snapshot format or the exported
+// tables change in a way that older imports can't handle
+const snapshotVersion = 1
+
+// snapshotBatchSize is the number of rows inserted at a time on import
+const snapshotBatchSize = 1000
+
+// snapshotTable is a table included in a snapshot
+type snapshotTable struct {
+	name string
+	// where limits the exported rows, ie to open listings
+	where string
+	// serial is set when the table has a serial id that must be reset
+	// after the import
+	serial bool
+}
+
+// snapshotTables are exported and imported in this order so that foreign
+// keys are satisfied. History tables are not included, a replica only has
+// history from the snapshot height onwards
+var snapshotTables = []snapshotTable{
+	{name: "bridge_remote_chain", serial: true},
+	{name: "transaction", where: `id IN (
+		SELECT transaction_id FROM "token"
+		UNION SELECT transaction_id FROM token_open_position WHERE is_filled = false AND is_cancelled = false
+		UNION SELECT transaction_id FROM "collection"
+		UNION SELECT transaction_id FROM inscription
+		UNION SELECT transaction_id FROM inscription_part
+		UNION SELECT transaction_id FROM marketplace_listing WHERE is_filled = false AND is_cancelled = false
+		UNION SELECT transaction_id FROM launchpad
+		UNION SELECT transaction_id FROM troll_post)`, serial: true},
+	{name: "token", serial: true},
+	{name: "token_holder", serial: true},
+	{name: "token_open_position", where: "is_filled = false AND is_cancelled = false", serial: true},
+	{name: "collection", serial: true},
+	{name: "collection_stats"},
+	{name: "collection_traits"},
+	{name: "inscription", serial: true},
+	{name: "inscription_rarity"},
+	{name: "inscription_part", serial: true},
+	{name: "migration_permission_grant", serial: true},
+	{name: "marketplace_listing", where: "is_filled = false AND is_cancelled = false", serial: true},
+	{name: "marketplace_cft20_detail", where: "listing_id IN (SELECT id FROM marketplace_listing WHERE is_filled = false AND is_cancelled = false)", serial: true},
+	{name: "marketplace_inscription_detail", where: "listing_id IN (SELECT id FROM marketplace_listing WHERE is_filled = false AND is_cancelled = false)", serial: true},
+	{name: "bridge_token", serial: true},
+	{name: "launchpad", serial: true},
+	{name: "launchpad_stage", serial: true},
+	{name: "launchpad_whitelist", serial: true},
+	{name: "launchpad_mint_reservation", serial: true},
+	{name: "troll_post", serial: true},
+	{name: "block_checksum", serial: true},
+	{name: "status", serial: true},
+}
+
+// SnapshotChain is the processed height of a chain in a snapshot
+type SnapshotChain struct {
+	ChainID       string `json:"chain_id"`
+	Height        uint64 `json:"height"`
+	StateChecksum string `json:"state_checksum"`
+}
+
+// SnapshotHeader is the first record of a snapshot
+type SnapshotHeader struct {
+	Version     int             `json:"version"`
+	DateCreated time.Time       `json:"date_created"`
+	Chains      []SnapshotChain `json:"chains"`
+}
+
+// snapshotRecord is a single row of a snapshot table
+type snapshotRecord struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// ExportOptions configures a snapshot export
+type ExportOptions struct {
+	// ExpectHeight is an assertion on the last processed height, the export
+	// fails if the chain is at a different height. Snapshots are always
+	// taken at the last processed height, the history tables don't hold the
+	// state at earlier heights. It can only be given when a single chain is
+	// configured
+	ExpectHeight uint64
+}
+
+// ExportSnapshot writes the metaprotocol state of all chains at their last
+// processed height to w as gzip compressed JSON. The export reads from a
+// single database snapshot, so it is consistent while the indexer runs
+func (s *Service) ExportSnapshot(ctx context.Context, w io.Writer, options ExportOptions) (SnapshotHeader, error) {
+	if len(s.indexers) > 1 && options.ExpectHeight != 0 {
+		return SnapshotHeader{}, fmt.Errorf("an expected height can't be used with multiple chains")
+	}
+
+	header := SnapshotHeader{
+		Version:     snapshotVersion,
+		DateCreated: time.Now().UTC(),
+	}
+	compressor := gzip.NewWriter(w)
+	encoder := json.NewEncoder(compressor)
+
+	err := s.db.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+		var statuses []models.Status
+		err := dbTx.Order("chain_id").Find(&statuses).Error
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if options.ExpectHeight != 0 && status.ChainID == s.indexers[0].chainID && status.LastProcessedHeight != options.ExpectHeight {
+				return fmt.Errorf("chain '%s' is at height %d, not the expected height %d", status.ChainID, status.LastProcessedHeight, options.ExpectHeight)
+			}
+			header.Chains = append(header.Chains, SnapshotChain{
+				ChainID:       status.ChainID,
+				Height:        status.LastProcessedHeight,
+				StateChecksum: status.StateChecksum,
+			})
+		}
+		if len(header.Chains) == 0 {
+			return fmt.Errorf("no processed chains to export")
+		}
+		if options.ExpectHeight != 0 && !snapshotHasChain(header, s.indexers[0].chainID) {
+			return fmt.Errorf("chain '%s' has not been processed", s.indexers[0].chainID)
+		}
+
+		err = encoder.Encode(header)
+		if err != nil {
+			return err
+		}
+		for _, table := range snapshotTables {
+			count, err := exportSnapshotTable(dbTx, encoder, table)
+			if err != nil {
+				return fmt.Errorf("unable to export table '%s': %w", table.name, err)
+			}
+			s.logger.WithFields(logrus.Fields{
+				"table": table.name,
+				"rows":  count,
+			}).Info("Exported table")
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return SnapshotHeader{}, err
+	}
+
+	return header, compressor.Close()
+}
+
+// snapshotHasChain returns true if chainID is part of the snapshot
+func snapshotHasChain(header SnapshotHeader, chainID string) bool {
+	for _, chain := range header.Chains {
+		if chain.ChainID == chainID {
+			return true
+		}
+	}
+	return false
+}
+
+// exportSnapshotTable writes every row of table as a snapshot record and
+// returns the number of rows
+func exportSnapshotTable(db *gorm.DB, encoder *json.Encoder, table snapshotTable) (int, error) {
+	query := fmt.Sprintf(`SELECT row_to_json(t)::text FROM "%s" t`, table.name)
+	if table.where != "" {
+		query += " WHERE " + table.where
+	}
+	rows, err := db.Raw(query).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var row string
+		err = rows.Scan(&row)
+		if err != nil {
+			return count, err
+		}
+		err = encoder.Encode(snapshotRecord{Table: table.name, Row: json.RawMessage(row)})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// ImportSnapshot loads a snapshot written by ExportSnapshot into an empty
+// database. Indexing resumes after the snapshot heights when the service is
+// started
+func (s *Service) ImportSnapshot(ctx context.Context, r io.Reader) (SnapshotHeader, error) {
+	decompressor, err := gzip.NewReader(r)
+	if err != nil {
+		return SnapshotHeader{}, err
+	}
+	defer decompressor.Close()
+	decoder := json.NewDecoder(decompressor)
+
+	var header SnapshotHeader
+	err = decoder.Decode(&header)
+	if err != nil {
+		return SnapshotHeader{}, fmt.Errorf("unable to read snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return SnapshotHeader{}, fmt.Errorf("unsupported snapshot version %d, expected %d", header.Version, snapshotVersion)
+	}
+
+	tableIndexes := make(map[string]int, len(snapshotTables))
+	for index, table := range snapshotTables {
+		tableIndexes[table.name] = index
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+		var count int64
+		err := dbTx.Model(&models.Status{}).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("a snapshot can only be imported into an empty database")
+		}
+
+		// Records are grouped by table in the snapshot table order, a batch
+		// is inserted when it is full or the next table starts
+		currentIndex := -1
+		var batch []json.RawMessage
+		for {
+			var record snapshotRecord
+			err = decoder.Decode(&record)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("unable to read snapshot: %w", err)
+			}
+
+			index, ok := tableIndexes[record.Table]
+			if !ok {
+				return fmt.Errorf("unknown snapshot table '%s'", record.Table)
+			}
+			if index < currentIndex {
+				return fmt.Errorf("snapshot table '%s' is out of order", record.Table)
+			}
+			if index != currentIndex || len(batch) == snapshotBatchSize {
+				err = importSnapshotRows(dbTx, currentIndex, batch)
+				if err != nil {
+					return err
+				}
+				batch = batch[:0]
+				currentIndex = index
+			}
+			batch = append(batch, record.Row)
+		}
+		err = importSnapshotRows(dbTx, currentIndex, batch)
+		if err != nil {
+			return err
+		}
+
+		// Continue the ID sequences after the imported rows
+		for _, table := range snapshotTables {
+			if !table.serial {
+				continue
+			}
+			err = dbTx.Exec(fmt.Sprintf(`SELECT setval(pg_get_serial_sequence('"%s"', 'id'), MAX(id)) FROM "%s" HAVING MAX(id) IS NOT NULL`, table.name, table.name)).Error
+			if err != nil {
+				return fmt.Errorf("unable to reset sequence of '%s': %w", table.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return SnapshotHeader{}, err
+	}
+
+	for _, chain := range header.Chains {
+		s.logger.WithFields(logrus.Fields{
+			"chain_id":       chain.ChainID,
+			"height":         chain.Height,
+			"state_checksum": chain.StateChecksum,
+		}).Info("Imported chain")
+	}
+	return header, nil
+}
+
+// importSnapshotRows inserts rows into the snapshot table at tableIndex
+func importSnapshotRows(db *gorm.DB, tableIndex int, rows []json.RawMessage) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	table := snapshotTables[tableIndex].name
+
+	content, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	err = db.Exec(fmt.Sprintf(`INSERT INTO "%s" SELECT * FROM json_populate_recordset(NULL::"%s", ?::json)`, table, table), string(content)).Error
+	if err != nil {
+		return fmt.Errorf("unable to import table '%s': %w", table, err)
+	}
+	return nil
+}
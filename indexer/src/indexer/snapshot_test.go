@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportSnapshotVersion(t *testing.T) {
+	var snapshot bytes.Buffer
+	compressor := gzip.NewWriter(&snapshot)
+	_, err := compressor.Write([]byte(`{"version": 99, "chains": []}`))
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	service := &Service{}
+	_, err = service.ImportSnapshot(context.Background(), &snapshot)
+	assert.ErrorContains(t, err, "unsupported snapshot version 99")
+}
+
+func TestSnapshotTableOrder(t *testing.T) {
+	// Tables must be imported after the tables they reference
+	references := map[string][]string{
+		"token":                          {"transaction"},
+		"token_holder":                   {"token"},
+		"token_open_position":            {"transaction", "token"},
+		"collection":                     {"transaction"},
+		"collection_stats":               {"collection"},
+		"collection_traits":              {"collection"},
+		"inscription":                    {"transaction", "collection"},
+		"inscription_rarity":             {"inscription"},
+		"migration_permission_grant":     {"inscription"},
+		"marketplace_listing":            {"transaction"},
+		"marketplace_cft20_detail":       {"marketplace_listing", "token"},
+		"marketplace_inscription_detail": {"marketplace_listing", "inscription"},
+		"bridge_token":                   {"bridge_remote_chain", "token"},
+		"launchpad":                      {"transaction", "collection"},
+		"launchpad_stage":                {"collection", "launchpad"},
+		"launchpad_whitelist":            {"collection", "launchpad", "launchpad_stage"},
+		"launchpad_mint_reservation":     {"collection", "launchpad", "launchpad_stage"},
+		"troll_post":                     {"transaction", "launchpad"},
+	}
+
+	positions := make(map[string]int)
+	for index, table := range snapshotTables {
+		positions[table.name] = index
+	}
+	transactionWhere := snapshotTables[positions["transaction"]].where
+	for table, referenced := range references {
+		assert.Contains(t, positions, table, "%s should be part of the snapshot", table)
+		for _, reference := range referenced {
+			assert.Less(t, positions[reference], positions[table], "%s references %s", table, reference)
+			if reference == "transaction" {
+				assert.Regexp(t, fmt.Sprintf(`FROM "?%s"?\b`, table), transactionWhere, "the transactions of %s should be exported", table)
+			}
+		}
+	}
+}
+
+func TestExportSnapshotExpectHeight(t *testing.T) {
+	service := &Service{
+		indexers: []*Indexer{{chainID: "cosmoshub-4"}, {chainID: "neutron-1"}},
+	}
+	_, err := service.ExportSnapshot(context.Background(), io.Discard, ExportOptions{ExpectHeight: 100})
+	assert.EqualError(t, err, "an expected height can't be used with multiple chains")
+
+	// The export is taken at the last processed height, other heights fail
+	db := newTestDB(t, &models.Status{})
+	assert.NoError(t, db.Create(&models.Status{ChainID: "cosmoshub-4", LastProcessedHeight: 120}).Error)
+	service = &Service{db: db, indexers: []*Indexer{{chainID: "cosmoshub-4"}}}
+	_, err = service.ExportSnapshot(context.Background(), io.Discard, ExportOptions{ExpectHeight: 100})
+	assert.EqualError(t, err, "chain 'cosmoshub-4' is at height 120, not the expected height 100")
+}
@@ -0,0 +1,103 @@
+package indexer
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// stateQueries select the metaprotocol state that is compared between runs
+// as key/value pairs. Keys are based on transaction hashes rather than IDs
+// so that they stay the same when derived tables are rebuilt
+var stateQueries = map[string]string{
+	"token_holder": `
+		SELECT th.id AS id, t.ticker || '/' || th.address AS key, th.amount::text AS value
+		FROM token_holder th
+		INNER JOIN token t ON t.id = th.token_id`,
+	"inscription": `
+		SELECT i.id AS id, tx.hash AS key, i.current_owner AS value
+		FROM inscription i
+		INNER JOIN "transaction" tx ON tx.id = i.transaction_id`,
+	"marketplace_listing": `
+		SELECT ml.id AS id, tx.hash AS key, concat_ws('/', ml.is_deposited, ml.depositor_address, ml.is_filled, ml.is_cancelled) AS value
+		FROM marketplace_listing ml
+		INNER JOIN "transaction" tx ON tx.id = ml.transaction_id`,
+	"launchpad_mint_reservation": `
+		SELECT r.id AS id, tx.hash || '/' || r.token_id AS key, concat_ws('/', r.address, r.is_minted) AS value
+		FROM launchpad_mint_reservation r
+		INNER JOIN launchpad l ON l.id = r.launchpad_id
+		INNER JOIN "transaction" tx ON tx.id = l.transaction_id`,
+}
+
+// stateEntry is a single key/value row returned by the state queries
+type stateEntry struct {
+	ID    uint64
+	Key   string
+	Value string
+}
+
+// stateSummary holds the state per table as key/value pairs
+type stateSummary map[string]map[string]string
+
+// stateDifference describes a single key that differs between two summaries
+type stateDifference struct {
+	Table    string
+	Key      string
+	Previous string
+	Current  string
+}
+
+// loadStateSummary reads the current metaprotocol state from the database
+func loadStateSummary(db *gorm.DB) (stateSummary, error) {
+	summary := make(stateSummary)
+	for table, query := range stateQueries {
+		var entries []stateEntry
+		err := db.Raw(query).Scan(&entries).Error
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[string]string, len(entries))
+		for _, entry := range entries {
+			values[entry.Key] = entry.Value
+		}
+		summary[table] = values
+	}
+	return summary, nil
+}
+
+// diffStateSummaries returns all differences between previous and current,
+// sorted by table and key. Missing values are returned as empty strings
+func diffStateSummaries(previous stateSummary, current stateSummary) []stateDifference {
+	var differences []stateDifference
+	for table := range stateQueries {
+		for key, previousValue := range previous[table] {
+			currentValue, ok := current[table][key]
+			if !ok || currentValue != previousValue {
+				differences = append(differences, stateDifference{
+					Table:    table,
+					Key:      key,
+					Previous: previousValue,
+					Current:  currentValue,
+				})
+			}
+		}
+		for key, currentValue := range current[table] {
+			if _, ok := previous[table][key]; !ok {
+				differences = append(differences, stateDifference{
+					Table:   table,
+					Key:     key,
+					Current: currentValue,
+				})
+			}
+		}
+	}
+
+	sort.Slice(differences, func(a, b int) bool {
+		if differences[a].Table != differences[b].Table {
+			return differences[a].Table < differences[b].Table
+		}
+		return differences[a].Key < differences[b].Key
+	})
+	return differences
+}
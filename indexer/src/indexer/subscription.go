@@ -0,0 +1,193 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/endpoints"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// subscriptionReconnectDelay is the time to wait before reconnecting
+	// after the websocket connection was lost
+	subscriptionReconnectDelay = 5 * time.Second
+	// subscriptionReadTimeout is the maximum time to wait for a new block
+	// before the connection is considered dead
+	subscriptionReadTimeout = 60 * time.Second
+)
+
+// newBlockEvent is the part of the CometBFT NewBlock event we use
+type newBlockEvent struct {
+	Error *struct {
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+	Result struct {
+		Data struct {
+			Value struct {
+				Block struct {
+					Header struct {
+						Height string `json:"height"`
+					} `json:"header"`
+				} `json:"block"`
+			} `json:"value"`
+		} `json:"data"`
+	} `json:"result"`
+}
+
+// blockSubscription subscribes to NewBlock events on the RPC websocket and
+// pushes the new heights. The connection is re-established on a healthy RPC
+// endpoint when it is lost
+type blockSubscription struct {
+	rpcPool   *endpoints.Pool
+	logger    *logrus.Entry
+	heights   chan uint64
+	connected atomic.Bool
+}
+
+// newBlockSubscription returns a new block subscription, call run to start
+// receiving heights
+func newBlockSubscription(rpcPool *endpoints.Pool, log *logrus.Entry) *blockSubscription {
+	return &blockSubscription{
+		rpcPool: rpcPool,
+		logger:  log,
+		heights: make(chan uint64, 1),
+	}
+}
+
+// Heights returns the channel new block heights are sent on. Only the latest
+// height is kept if the heights aren't read fast enough
+func (s *blockSubscription) Heights() <-chan uint64 {
+	return s.heights
+}
+
+// Connected returns true if the subscription is currently receiving blocks
+func (s *blockSubscription) Connected() bool {
+	return s.connected.Load()
+}
+
+// run connects and reconnects to the RPC websocket until ctx is done
+func (s *blockSubscription) run(ctx context.Context) {
+	for {
+		err := s.subscribe(ctx)
+		s.connected.Store(false)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Warn("Block subscription lost, falling back to polling")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(subscriptionReconnectDelay):
+		}
+	}
+}
+
+// subscribe connects to a healthy RPC endpoint and reads NewBlock events
+// until the connection fails
+func (s *blockSubscription) subscribe(ctx context.Context) error {
+	endpoint, err := s.rpcPool.Endpoint(ctx, 0)
+	if err != nil {
+		return err
+	}
+	websocketURL := strings.TrimSuffix(endpoint, "/") + "/websocket"
+	websocketURL = strings.Replace(websocketURL, "https://", "wss://", 1)
+	websocketURL = strings.Replace(websocketURL, "http://", "ws://", 1)
+
+	// Add support for custom endpoint headers
+	headers := http.Header{}
+	for key, value := range s.rpcPool.Headers() {
+		headers.Add(key, value)
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, websocketURL, headers)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Closing the connection stops the blocking reads below
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	err = conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "subscribe",
+		"id":      1,
+		"params": map[string]string{
+			"query": "tm.event='NewBlock'",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"endpoint": endpoint,
+	}).Info("Subscribed to new blocks")
+
+	for {
+		err = conn.SetReadDeadline(time.Now().Add(subscriptionReadTimeout))
+		if err != nil {
+			return err
+		}
+
+		var event newBlockEvent
+		err = conn.ReadJSON(&event)
+		if err != nil {
+			return err
+		}
+		if event.Error != nil {
+			return fmt.Errorf("subscription error: %s %s", event.Error.Message, event.Error.Data)
+		}
+
+		// The first response only confirms the subscription
+		if event.Result.Data.Value.Block.Header.Height == "" {
+			continue
+		}
+		height, err := strconv.ParseUint(event.Result.Data.Value.Block.Header.Height, 10, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse height: %w", err)
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"height":   height,
+			"endpoint": endpoint,
+		}).Debug("Received new block")
+
+		s.connected.Store(true)
+		s.pushHeight(height)
+	}
+}
+
+// pushHeight sends height on the heights channel, replacing any height that
+// hasn't been read yet
+func (s *blockSubscription) pushHeight(height uint64) {
+	select {
+	case s.heights <- height:
+	default:
+		select {
+		case <-s.heights:
+		default:
+		}
+		s.heights <- height
+	}
+}
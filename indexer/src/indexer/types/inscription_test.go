@@ -1,7 +1,6 @@
 package types
 
 import (
-	"encoding/json"
 	"os"
 	"testing"
 
@@ -130,18 +129,12 @@ func TestOldTx(t *testing.T) {
 		t.Fatalf("error reading file: %v", err)
 	}
 
-	jsonTx, err := decodedTx.MarshalToJSON()
+	transaction, err := NewTransaction("", decodedTx)
 	if err != nil {
-		t.Fatalf("error marshalling to json: %v", err)
+		t.Fatalf("error reading transaction: %v", err)
 	}
 
-	var rawTransaction RawTransaction
-	err = json.Unmarshal(jsonTx, &rawTransaction)
-	if err != nil {
-		t.Fatalf("error unmarshalling: %v", err)
-	}
-
-	msg, err := rawTransaction.Body.NonCriticalExtensionOptions[0].UnmarshalData()
+	msg, err := transaction.ExtensionMessage()
 	if err != nil {
 		t.Fatalf("error unmarshalling: %v", err)
 	}
@@ -169,18 +162,12 @@ func TestNewTx(t *testing.T) {
 		t.Fatalf("error reading file: %v", err)
 	}
 
-	jsonTx, err := decodedTx.MarshalToJSON()
-	if err != nil {
-		t.Fatalf("error marshalling to json: %v", err)
-	}
-
-	var rawTransaction RawTransaction
-	err = json.Unmarshal(jsonTx, &rawTransaction)
+	transaction, err := NewTransaction("", decodedTx)
 	if err != nil {
-		t.Fatalf("error unmarshalling: %v", err)
+		t.Fatalf("error reading transaction: %v", err)
 	}
 
-	msg, err := rawTransaction.Body.NonCriticalExtensionOptions[0].UnmarshalData()
+	msg, err := transaction.ExtensionMessage()
 	if err != nil {
 		t.Fatalf("error unmarshalling: %v", err)
 	}
@@ -198,3 +185,11 @@ func TestNewTx(t *testing.T) {
 	assert.Empty(t, inscriptionMetadata.Metadata.RoyaltyPercentage)
 	assert.Empty(t, inscriptionMetadata.Metadata.PaymentAddress)
 }
+
+func TestContentHash(t *testing.T) {
+	content := []byte("hello")
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", ContentHash(content))
+	assert.True(t, ContentHashMatches("2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824", content), "the case of the declared hash should be ignored")
+	assert.False(t, ContentHashMatches("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9825", content))
+	assert.False(t, ContentHashMatches("", content))
+}
@@ -0,0 +1,373 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	cosmostypes "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/cosmos/cosmos-sdk/x/authz"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	ibctransfertypes "github.com/cosmos/ibc-go/modules/apps/transfer/types"
+	channeltypes "github.com/cosmos/ibc-go/modules/core/04-channel/types"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/decoder"
+	"google.golang.org/protobuf/proto"
+)
+
+const extensionDataTypeURL = "/gaia.metaprotocols.ExtensionData"
+const msgRevokeTypeURL = "/cosmos.authz.v1beta1.MsgRevoke"
+
+// ErrNoExtensionMessage is returned when a transaction has no non-critical
+// extension options
+var ErrNoExtensionMessage = errors.New("no extension message found")
+
+// Transaction is a decoded transaction with typed access to its messages.
+// JSON is only used to store the transaction
+type Transaction struct {
+	Hash string
+	tx   *txtypes.Tx
+}
+
+// NewTransaction returns the transaction for a decoded protobuf transaction
+func NewTransaction(hash string, decodedTx decoder.Tx) (Transaction, error) {
+	tx, err := decodedTx.ProtoTx()
+	if err != nil {
+		return Transaction{}, err
+	}
+	return Transaction{Hash: hash, tx: tx}, nil
+}
+
+// DecodeTransaction decodes the protobuf encoded transaction bytes
+func DecodeTransaction(hash string, txBytes []byte) (Transaction, error) {
+	decodedTx, err := decoder.DefaultDecoder.Decode(txBytes)
+	if err != nil {
+		return Transaction{}, err
+	}
+	return NewTransaction(hash, decodedTx)
+}
+
+// UnmarshalJSON decodes a transaction in the JSON encoding of the LCD.
+// Transactions stored before the protobuf model contain fields of other
+// message types and are decoded without their signer infos
+func (tx *Transaction) UnmarshalJSON(jsonBytes []byte) error {
+	protoTx, err := decoder.DefaultDecoder.DecodeJSON(jsonBytes, false)
+	if err == nil {
+		tx.tx = protoTx
+		return nil
+	}
+
+	var legacyTx struct {
+		Hash     string          `json:"hash"`
+		Body     json.RawMessage `json:"body"`
+		AuthInfo struct {
+			Fee json.RawMessage `json:"fee"`
+		} `json:"auth_info"`
+	}
+	legacyErr := json.Unmarshal(jsonBytes, &legacyTx)
+	if legacyErr != nil || legacyTx.Hash == "" {
+		return err
+	}
+
+	// Only the body and fee are kept, the signer infos may not be complete
+	legacyJSON, legacyErr := json.Marshal(map[string]interface{}{
+		"body":      legacyTx.Body,
+		"auth_info": map[string]interface{}{"fee": legacyTx.AuthInfo.Fee},
+	})
+	if legacyErr != nil {
+		return legacyErr
+	}
+	protoTx, legacyErr = decoder.DefaultDecoder.DecodeJSON(legacyJSON, true)
+	if legacyErr != nil {
+		return fmt.Errorf("unable to decode stored transaction: %w", legacyErr)
+	}
+	tx.tx = protoTx
+	tx.Hash = legacyTx.Hash
+	return nil
+}
+
+// MarshalJSON encodes the transaction in the JSON encoding of the LCD, the
+// hash is not included
+func (tx Transaction) MarshalJSON() ([]byte, error) {
+	if tx.tx == nil {
+		return []byte("{}"), nil
+	}
+	return decoder.DefaultDecoder.EncodeJSON(tx.tx)
+}
+
+// ToJSON returns the transaction as stored in transaction.content
+func (tx Transaction) ToJSON() string {
+	jsonBytes, _ := tx.MarshalJSON()
+	return string(jsonBytes)
+}
+
+// Memo returns the memo of the transaction
+func (tx Transaction) Memo() string {
+	return tx.tx.GetBody().GetMemo()
+}
+
+// Messages returns the messages of the transaction
+func (tx Transaction) Messages() []cosmostypes.Msg {
+	if tx.tx.GetBody() == nil {
+		return nil
+	}
+	return tx.tx.GetMsgs()
+}
+
+// GasLimit returns the gas limit of the transaction fee
+func (tx Transaction) GasLimit() uint64 {
+	return tx.tx.GetAuthInfo().GetFee().GetGasLimit()
+}
+
+// Fees returns the fee amount of the transaction
+func (tx Transaction) Fees() cosmostypes.Coins {
+	return tx.tx.GetAuthInfo().GetFee().GetAmount()
+}
+
+// EffectiveMessage is a message as it is executed by the chain. Messages in
+// an authz MsgExec are executed on behalf of the granter, the sender of the
+// message
+type EffectiveMessage struct {
+	cosmostypes.Msg
+	// Grantee is the address that executed the message with an authz grant,
+	// it is empty when the message was signed by the sender
+	Grantee string
+}
+
+// Sender returns the address the message was sent from, it is empty for
+// message types that are not used by the metaprotocols
+func (message EffectiveMessage) Sender() string {
+	switch msg := message.Msg.(type) {
+	case *banktypes.MsgSend:
+		return msg.FromAddress
+	case *ibctransfertypes.MsgTransfer:
+		return msg.Sender
+	case *channeltypes.MsgRecvPacket:
+		packetData, _ := GetPacketData(msg.Packet)
+		if packetData != nil {
+			return packetData.Sender
+		}
+	case *authz.MsgGrant:
+		return msg.Granter
+	}
+	return ""
+}
+
+// EffectiveMessages returns the messages of the transaction with the
+// messages of authz MsgExec unwrapped
+func (tx Transaction) EffectiveMessages() []EffectiveMessage {
+	var messages []EffectiveMessage
+	for _, message := range tx.Messages() {
+		messages = appendEffectiveMessages(messages, message, "")
+	}
+	return messages
+}
+
+// appendEffectiveMessages appends message to messages, a MsgExec is replaced
+// by the messages it executes. The grantee of nested grants is the grantee
+// that signed the transaction
+func appendEffectiveMessages(messages []EffectiveMessage, message cosmostypes.Msg, grantee string) []EffectiveMessage {
+	exec, ok := message.(*authz.MsgExec)
+	if !ok {
+		return append(messages, EffectiveMessage{Msg: message, Grantee: grantee})
+	}
+	if grantee == "" {
+		grantee = exec.Grantee
+	}
+
+	// The messages are unpacked when the transaction is decoded
+	execMessages, err := exec.GetMessages()
+	if err != nil {
+		return messages
+	}
+	for _, execMessage := range execMessages {
+		messages = appendEffectiveMessages(messages, execMessage, grantee)
+	}
+	return messages
+}
+
+// ExecutedBy returns true if all messages were executed with an authz grant
+// by grantee
+func (tx Transaction) ExecutedBy(grantee string) bool {
+	messages := tx.EffectiveMessages()
+	for _, message := range messages {
+		if message.Grantee != grantee {
+			return false
+		}
+	}
+	return len(messages) > 0 && grantee != ""
+}
+
+// Sends returns the bank MsgSend messages of the transaction, including the
+// sends executed with authz
+func (tx Transaction) Sends() []*banktypes.MsgSend {
+	var sends []*banktypes.MsgSend
+	for _, message := range tx.EffectiveMessages() {
+		if send, ok := message.Msg.(*banktypes.MsgSend); ok {
+			sends = append(sends, send)
+		}
+	}
+	return sends
+}
+
+// Transfers returns the IBC MsgTransfer messages of the transaction,
+// including the transfers executed with authz
+func (tx Transaction) Transfers() []*ibctransfertypes.MsgTransfer {
+	var transfers []*ibctransfertypes.MsgTransfer
+	for _, message := range tx.EffectiveMessages() {
+		if transfer, ok := message.Msg.(*ibctransfertypes.MsgTransfer); ok {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
+
+// Execs returns the authz MsgExec messages of the transaction
+func (tx Transaction) Execs() []*authz.MsgExec {
+	var execs []*authz.MsgExec
+	for _, message := range tx.Messages() {
+		if exec, ok := message.(*authz.MsgExec); ok {
+			execs = append(execs, exec)
+		}
+	}
+	return execs
+}
+
+// RecvPackets returns the IBC MsgRecvPacket messages of the transaction
+func (tx Transaction) RecvPackets() []*channeltypes.MsgRecvPacket {
+	var packets []*channeltypes.MsgRecvPacket
+	for _, message := range tx.Messages() {
+		if packet, ok := message.(*channeltypes.MsgRecvPacket); ok {
+			packets = append(packets, packet)
+		}
+	}
+	return packets
+}
+
+// ExtensionOptionCount returns the number of non-critical extension options
+func (tx Transaction) ExtensionOptionCount() int {
+	return len(tx.tx.GetBody().GetNonCriticalExtensionOptions())
+}
+
+// ExtensionMessage decodes the first non-critical extension option, only
+// the first option is used by the metaprotocols
+func (tx Transaction) ExtensionMessage() (ExtensionMsg, error) {
+	options := tx.tx.GetBody().GetNonCriticalExtensionOptions()
+	if len(options) == 0 {
+		return nil, ErrNoExtensionMessage
+	}
+	msg, err := decodeExtensionOption(options[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal extension data '%s'", err)
+	}
+	return msg, nil
+}
+
+// decodeExtensionOption decodes the extension option types that carry
+// inscriptions
+func decodeExtensionOption(option *codectypes.Any) (ExtensionMsg, error) {
+	switch option.TypeUrl {
+	case msgRevokeTypeURL:
+		var msg authz.MsgRevoke
+		err := msg.Unmarshal(option.Value)
+		if err != nil {
+			return nil, err
+		}
+		return RawMsgRevoke{
+			MsgType:    option.TypeUrl,
+			Granter:    msg.Granter,
+			Grantee:    msg.Grantee,
+			MsgTypeURL: msg.MsgTypeUrl,
+		}, nil
+	case extensionDataTypeURL:
+		var msg decoder.ExtensionData
+		err := msg.Unmarshal(option.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		deserializedInscription := &Inscription{}
+		if err := proto.Unmarshal(msg.Data, deserializedInscription); err != nil {
+			return nil, err
+		}
+		return ExtensionDataWrapper{deserializedInscription}, nil
+	default:
+		return nil, errors.New("unknown extension type")
+	}
+}
+
+// GetPacketData decodes the fungible token packet data of an IBC packet
+func GetPacketData(packet channeltypes.Packet) (*IBCPacketData, error) {
+	var ibcPacketData IBCPacketData
+	err := json.Unmarshal(packet.Data, &ibcPacketData)
+	if err != nil {
+		return nil, err
+	}
+	return &ibcPacketData, nil
+}
+
+// GetSenderAddress returns the address that sent the messages of the
+// transaction. Messages executed with authz are sent by the granter. Only the
+// first IBC packet is processed, so the senders of later packets are ignored
+func (tx Transaction) GetSenderAddress() (string, error) {
+	sender := ""
+	hasPacket := false
+	for _, message := range tx.EffectiveMessages() {
+		if _, ok := message.Msg.(*channeltypes.MsgRecvPacket); ok {
+			if hasPacket {
+				continue
+			}
+			hasPacket = true
+		}
+
+		messageSender := message.Sender()
+		if messageSender == "" {
+			continue
+		}
+		if sender == "" {
+			sender = messageSender
+		} else if sender != messageSender {
+			return "", fmt.Errorf("transaction has multiple senders '%s' and '%s'", sender, messageSender)
+		}
+	}
+	if sender == "" {
+		return "", errors.New("no sender address found")
+	}
+	return sender, nil
+}
+
+// FirstSenderAddress returns the sender of the first message that has one,
+// only the first message of an authz MsgExec is checked. These are the
+// sender rules before the message rules height of the chain
+func (tx Transaction) FirstSenderAddress() (string, error) {
+	for _, message := range tx.Messages() {
+		switch message := message.(type) {
+		case *banktypes.MsgSend:
+			if message.FromAddress != "" {
+				return message.FromAddress, nil
+			}
+		case *ibctransfertypes.MsgTransfer:
+			if message.Sender != "" {
+				return message.Sender, nil
+			}
+		case *authz.MsgExec:
+			execMessages, err := message.GetMessages()
+			if err == nil && len(execMessages) > 0 {
+				if send, ok := execMessages[0].(*banktypes.MsgSend); ok && send.FromAddress != "" {
+					return send.FromAddress, nil
+				}
+			}
+		case *channeltypes.MsgRecvPacket:
+			packetData, _ := GetPacketData(message.Packet)
+			if packetData != nil {
+				return packetData.Sender, nil
+			}
+		case *authz.MsgGrant:
+			if message.Granter != "" {
+				return message.Granter, nil
+			}
+		}
+	}
+	return "", errors.New("no sender address found")
+}
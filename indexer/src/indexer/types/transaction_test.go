@@ -0,0 +1,134 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readTransaction decodes the base64 encoded transaction in testdata
+func readTransaction(t *testing.T, name string) Transaction {
+	readFile, err := os.ReadFile("testdata/" + name)
+	assert.NoError(t, err)
+	txBytes, err := base64.StdEncoding.DecodeString(string(readFile))
+	assert.NoError(t, err)
+
+	transaction, err := DecodeTransaction("HASH", txBytes)
+	assert.NoError(t, err)
+	return transaction
+}
+
+func TestTransactionAccessors(t *testing.T) {
+	transaction := readTransaction(t, "tx-extension-data.txt")
+
+	assert.Equal(t, "urn:inscription:gaialocal-1@v1;inscribe$h=d7f755c4b9e8d4b39120a54c3c1c272e24e005eb09edfcfbb31b549f62432487", transaction.Memo())
+	assert.Len(t, transaction.Sends(), 1)
+	assert.Equal(t, "1uatom", transaction.Sends()[0].Amount.String())
+	assert.Empty(t, transaction.Transfers())
+	assert.Equal(t, 1, transaction.ExtensionOptionCount())
+
+	sender, err := transaction.GetSenderAddress()
+	assert.NoError(t, err)
+	assert.Equal(t, "cosmos1m9l358xunhhwds0568za49mzhvuxx9uxre5tud", sender)
+}
+
+func TestTransactionJSON(t *testing.T) {
+	transaction := readTransaction(t, "tx-msg-revoke.txt")
+
+	var decoded Transaction
+	err := json.Unmarshal([]byte(transaction.ToJSON()), &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, transaction.ToJSON(), decoded.ToJSON(), "the stored JSON should decode to the same transaction")
+
+	msg, err := decoded.ExtensionMessage()
+	assert.NoError(t, err)
+	var inscriptionMetadata InscriptionMetadata[Metadata]
+	_, err = msg.GetMetadata(&inscriptionMetadata)
+	assert.NoError(t, err)
+	assert.Equal(t, "ABC", inscriptionMetadata.Metadata.Name)
+
+	err = json.Unmarshal([]byte(`{"body": {"messages": [{"@type": "/cosmos.bank.v1beta1.MsgSend", "receiver": ""}]}}`), &decoded)
+	assert.Error(t, err, "unknown fields should be rejected")
+}
+
+func TestLegacyTransactionJSON(t *testing.T) {
+	// Transactions were stored with the fields of all supported message types
+	legacyJSON := `{"hash":"ABCD","body":{"messages":[{"@type":"/cosmos.bank.v1beta1.MsgSend","from_address":"cosmos1sender","to_address":"cosmos1receiver","amount":[{"denom":"uatom","amount":"1000"}],"receiver":"","sender":"","source_channel":"","token":{"amount":"","denom":""},"msgs":null,"packet":{"data":"","source_channel":""},"granter":"","grantee":""}],"memo":"urn:cft20:cosmoshub-4@v1;mint$tic=ROIDS,amt=1","timeout_height":"0","extension_options":[],"non_critical_extension_options":[]},"auth_info":{"signer_infos":[{"public_key":{"@type":"/cosmos.crypto.multisig.LegacyAminoPubKey","key":""},"mode_info":{"single":{"mode":""}},"sequence":"1"}],"fee":{"amount":[{"denom":"uatom","amount":"500"}],"gas_limit":"200000","payer":"","granter":""}},"signatures":[]}`
+
+	var transaction Transaction
+	err := json.Unmarshal([]byte(legacyJSON), &transaction)
+	assert.NoError(t, err)
+	assert.Equal(t, "ABCD", transaction.Hash)
+	assert.Equal(t, "urn:cft20:cosmoshub-4@v1;mint$tic=ROIDS,amt=1", transaction.Memo())
+	assert.Equal(t, uint64(200000), transaction.GasLimit())
+	assert.Equal(t, "500uatom", transaction.Fees().String())
+	assert.Len(t, transaction.Sends(), 1)
+	assert.Equal(t, "cosmos1receiver", transaction.Sends()[0].ToAddress)
+
+	sender, err := transaction.GetSenderAddress()
+	assert.NoError(t, err)
+	assert.Equal(t, "cosmos1sender", sender)
+}
+
+func TestRecvPacketTransaction(t *testing.T) {
+	packetData := base64.StdEncoding.EncodeToString([]byte(`{"sender":"osmo1sender","receiver":"cosmos1receiver","denom":"uosmo","amount":"1","memo":"urn:bridge:cosmoshub-4@v1;recv$tic=ROIDS"}`))
+
+	var transaction Transaction
+	err := json.Unmarshal([]byte(`{"body": {"messages": [{"@type": "/ibc.core.channel.v1.MsgRecvPacket", "packet": {"source_channel": "channel-141", "data": "`+packetData+`"}, "signer": "cosmos1relayer"}]}}`), &transaction)
+	assert.NoError(t, err)
+	assert.Len(t, transaction.RecvPackets(), 1)
+
+	ibcData, err := GetPacketData(transaction.RecvPackets()[0].Packet)
+	assert.NoError(t, err)
+	assert.Equal(t, "urn:bridge:cosmoshub-4@v1;recv$tic=ROIDS", ibcData.Memo)
+
+	sender, err := transaction.GetSenderAddress()
+	assert.NoError(t, err)
+	assert.Equal(t, "osmo1sender", sender, "the packet sender should be used, not the relayer")
+}
+
+func TestEffectiveMessages(t *testing.T) {
+	// The bot executes a send of the user with authz, the nested exec is
+	// executed on behalf of the same granter
+	execJSON := `{"body": {"messages": [{"@type": "/cosmos.authz.v1beta1.MsgExec", "grantee": "cosmos1bot", "msgs": [
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1user", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "100"}]},
+		{"@type": "/cosmos.authz.v1beta1.MsgExec", "grantee": "cosmos1user", "msgs": [
+			{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1user", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "50"}]}
+		]}
+	]}]}}`
+	var transaction Transaction
+	err := json.Unmarshal([]byte(execJSON), &transaction)
+	assert.NoError(t, err)
+
+	messages := transaction.EffectiveMessages()
+	assert.Len(t, messages, 2)
+	for _, message := range messages {
+		assert.Equal(t, "cosmos1bot", message.Grantee)
+		assert.Equal(t, "cosmos1user", message.Sender())
+	}
+	assert.Len(t, transaction.Sends(), 2)
+	assert.Len(t, transaction.Execs(), 1)
+	assert.True(t, transaction.ExecutedBy("cosmos1bot"))
+	assert.False(t, transaction.ExecutedBy("cosmos1user"))
+	assert.False(t, transaction.ExecutedBy(""))
+
+	sender, err := transaction.GetSenderAddress()
+	assert.NoError(t, err)
+	assert.Equal(t, "cosmos1user", sender, "the granter should be the sender")
+
+	// A signed send next to the exec isn't executed by the bot
+	mixedJSON := `{"body": {"messages": [
+		{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1other", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "1"}]},
+		{"@type": "/cosmos.authz.v1beta1.MsgExec", "grantee": "cosmos1bot", "msgs": [
+			{"@type": "/cosmos.bank.v1beta1.MsgSend", "from_address": "cosmos1user", "to_address": "cosmos1seller", "amount": [{"denom": "uatom", "amount": "100"}]}
+		]}
+	]}}`
+	err = json.Unmarshal([]byte(mixedJSON), &transaction)
+	assert.NoError(t, err)
+	assert.False(t, transaction.ExecutedBy("cosmos1bot"))
+	_, err = transaction.GetSenderAddress()
+	assert.EqualError(t, err, "transaction has multiple senders 'cosmos1other' and 'cosmos1user'")
+}
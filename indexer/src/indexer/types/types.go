@@ -1,14 +1,13 @@
 package types
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
 	fmt "fmt"
 	"strings"
 	"time"
-
-	"google.golang.org/protobuf/proto"
 	// "github.com/calvinlauyh/cosmosutils"
 )
 
@@ -31,6 +30,12 @@ type MultipartMetadata struct {
 	Total uint `json:"total"`
 }
 
+// InscriptionPartMetadata identifies a part of a multipart inscription, the
+// inscription metadata is given with the first part
+type InscriptionPartMetadata struct {
+	Multipart MultipartMetadata `json:"multipart"`
+}
+
 type ContentGenericMetadata struct {
 	Parent    InscriptionParent `json:"parent"`
 	Multipart InscriptionParent `json:"part,omitempty"`
@@ -154,16 +159,6 @@ type RPCBlock struct {
 	} `json:"result"`
 }
 
-type SendMessage struct {
-	Type        string `json:"@type"`
-	FromAddress string `json:"from_address"`
-	ToAddress   string `json:"to_address"`
-	Amount      []struct {
-		Denom  string `json:"denom"`
-		Amount string `json:"amount"`
-	} `json:"amount"`
-}
-
 type IBCPacketData struct {
 	Receiver string `json:"receiver"`
 	Sender   string `json:"sender"`
@@ -172,114 +167,6 @@ type IBCPacketData struct {
 	Memo     string `json:"memo"`
 }
 
-type IBCPacket struct {
-	Data          string `json:"data"`
-	SourceChannel string `json:"source_channel"`
-}
-
-func (packet IBCPacket) GetPacketData() (*IBCPacketData, error) {
-	// parse the base64 in packet.data into bytes
-	// then parse the bytes into json
-	decodedPacketData, err := base64.StdEncoding.DecodeString(packet.Data)
-	if err != nil {
-		return nil, err
-	}
-
-	var ibcPacketData IBCPacketData
-	err = json.Unmarshal(decodedPacketData, &ibcPacketData)
-	if err != nil {
-		return nil, err
-	}
-
-	return &ibcPacketData, nil
-}
-
-type RawTransactionBody struct {
-	Messages []struct {
-		Type        string `json:"@type"`
-		FromAddress string `json:"from_address"`
-		ToAddress   string `json:"to_address"`
-		Amount      []struct {
-			Denom  string `json:"denom"`
-			Amount string `json:"amount"`
-		} `json:"amount"`
-		Receiver      string `json:"receiver"`
-		Sender        string `json:"sender"`
-		SourceChannel string `json:"source_channel"`
-		Token         struct {
-			Amount string `json:"amount"`
-			Denom  string `json:"denom"`
-		} `json:"token"`
-		Msgs    []SendMessage `json:"msgs"`
-		Packet  IBCPacket     `json:"packet"`
-		Granter string        `json:"granter"`
-		Grantee string        `json:"grantee"`
-	} `json:"messages"`
-	Memo                        string         `json:"memo"`
-	TimeoutHeight               string         `json:"timeout_height"`
-	ExtensionOptions            []any          `json:"extension_options"`
-	NonCriticalExtensionOptions []RawExtension `json:"non_critical_extension_options"`
-}
-
-// get extension message
-func (body RawTransactionBody) GetExtensionMessage() (ExtensionMsg, error) {
-	for _, extension := range body.NonCriticalExtensionOptions {
-		msg, err := extension.UnmarshalData()
-		if err != nil {
-			return nil, fmt.Errorf("unable to unmarshal extension data '%s'", err)
-		}
-
-		// We only process the first extension option
-		return msg, nil
-	}
-
-	return nil, errors.New("no extension message found")
-}
-
-type RawTransaction struct {
-	Hash     string             `json:"hash"`
-	Body     RawTransactionBody `json:"body"`
-	AuthInfo struct {
-		SignerInfos []struct {
-			PublicKey struct {
-				Type string `json:"@type"`
-				Key  string `json:"key"`
-			} `json:"public_key"`
-			ModeInfo struct {
-				Single struct {
-					Mode string `json:"mode"`
-				} `json:"single"`
-			} `json:"mode_info"`
-			Sequence string `json:"sequence"`
-		} `json:"signer_infos"`
-		Fee struct {
-			Amount []struct {
-				Denom  string `json:"denom"`
-				Amount string `json:"amount"`
-			} `json:"amount"`
-			GasLimit string `json:"gas_limit"`
-			Payer    string `json:"payer"`
-			Granter  string `json:"granter"`
-		} `json:"fee"`
-	} `json:"auth_info"`
-	Signatures []string `json:"signatures"`
-}
-
-type RawExtension struct {
-	json.RawMessage
-}
-
-type RawGenericMsg struct {
-	Type string `json:"@type"`
-}
-
-type RawExtensionData struct {
-	MsgType         string `json:"@type"`
-	Data            []byte `json:"data"`
-	ProtocolId      string `json:"protocol_id"`
-	ProtocolVersion string `json:"protocol_version"`
-}
-
 type ExtensionDataWrapper struct {
 	*Inscription
 }
@@ -314,37 +201,17 @@ type ExtensionMsg interface {
 	GetContent() ([]byte, error)
 }
 
-func (re RawExtension) UnmarshalData() (ExtensionMsg, error) {
-	var rawMsg RawGenericMsg
-	err := json.Unmarshal(re.RawMessage, &rawMsg)
-	if err != nil {
-		return nil, err
-	}
+// ContentHash returns the hex encoded SHA-256 of inscription content, the
+// hash an inscribe operation declares
+func ContentHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
 
-	switch rawMsg.Type {
-	case "/cosmos.authz.v1beta1.MsgRevoke":
-		var msg RawMsgRevoke
-		err := json.Unmarshal(re.RawMessage, &msg)
-		if err != nil {
-			return nil, err
-		}
-		return msg, nil
-	case "/gaia.metaprotocols.ExtensionData":
-		var msg RawExtensionData
-		err := json.Unmarshal(re.RawMessage, &msg)
-		if err != nil {
-			return nil, err
-		}
-
-		deserializedInscription := &Inscription{}
-		if err := proto.Unmarshal(msg.Data, deserializedInscription); err != nil {
-			return nil, err
-		}
-
-		return ExtensionDataWrapper{deserializedInscription}, nil
-	default:
-		return nil, errors.New("unknown extension type")
-	}
+// ContentHashMatches returns true if declaredHash is the content hash of
+// content, the case of the hex digits is ignored
+func ContentHashMatches(declaredHash string, content []byte) bool {
+	return strings.EqualFold(strings.TrimSpace(declaredHash), ContentHash(content))
 }
 
 type RawMsgRevoke struct {
@@ -401,69 +268,3 @@ func (msg RawMsgRevoke) GetContent() ([]byte, error) {
 
 	return content, nil
 }
-
-func (tx RawTransaction) ToJSON() string {
-	jsonBytes, _ := json.Marshal(tx)
-	return string(jsonBytes)
-}
-
-func (tx RawTransaction) GetTxByteSize() int {
-	jsonBytes, _ := json.Marshal(tx)
-	return len(jsonBytes)
-}
-
-func (tx RawTransaction) GetSenderAddress() (string, error) {
-	for _, message := range tx.Body.Messages {
-		if message.FromAddress != "" {
-			return message.FromAddress, nil
-		}
-		if message.Sender != "" {
-			return message.Sender, nil
-		}
-		if message.Type == "/cosmos.authz.v1beta1.MsgExec" && len(message.Msgs) > 0 && message.Msgs[0].FromAddress != "" {
-			return message.Msgs[0].FromAddress, nil
-		}
-		if message.Type == "/ibc.core.channel.v1.MsgRecvPacket" {
-			packetData, _ := message.Packet.GetPacketData()
-			if packetData != nil {
-				return packetData.Sender, nil
-			}
-		}
-		if message.Type == "/cosmos.authz.v1beta1.MsgGrant" && message.Granter != "" {
-			return message.Granter, nil
-		}
-	}
-	return "", errors.New("no sender address found")
-}
-
-// ValidateBasic checks if the transaction contains a MsgSend as part of
-// messages a memo that contains "urn:"
-func (tx RawTransaction) ValidateBasic() error {
-
-	// Verify that the transaction succeeded
-	// if tx.TxResponse.Code != 0 {
-	// 	return fmt.Errorf("transaction failed: %s", tx.TxResponse.RawLog)
-	// }
-
-	hasSend := false
-	for _, v := range tx.Body.Messages {
-		// TODO: This might need to be a IBC send
-		if v.Type == "/cosmos.bank.v1beta1.MsgSend" {
-			hasSend = true
-			// TODO: In future we can ensure that the send amount if above
-			// a certain minimum
-			break
-		}
-	}
-
-	hasInscriptionMemo := false
-	if strings.Contains(strings.ToLower(tx.Body.Memo), "urn:") {
-		hasInscriptionMemo = true
-	}
-
-	if hasSend && hasInscriptionMemo {
-		return nil
-	}
-
-	return errors.New("transaction does not contain a valid metaprotocol memo")
-}
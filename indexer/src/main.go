@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer"
 	"github.com/joho/godotenv"
@@ -14,9 +18,10 @@ import (
 
 // Config defines the environment variables for the service
 type Config struct {
-	LogFormat   string `envconfig:"LOG_FORMAT" required:"true"`
-	LogLevel    string `envconfig:"LOG_LEVEL" required:"true"`
-	ServiceName string `envconfig:"SERVICE_NAME" required:"true"`
+	LogFormat         string `envconfig:"LOG_FORMAT" required:"true"`
+	LogLevel          string `envconfig:"LOG_LEVEL" required:"true"`
+	ServiceName       string `envconfig:"SERVICE_NAME" required:"true"`
+	ShutdownTimeoutMS int    `envconfig:"SHUTDOWN_TIMEOUT_MS" default:"30000"`
 }
 
 func main() {
@@ -53,9 +58,51 @@ func main() {
 		"service": strings.ToLower(config.ServiceName),
 	})
 
-	// Set up signal handler, ie ctrl+c
+	// Set up signal handler, ie ctrl+c. The context is cancelled on the
+	// first signal, if the service hasn't stopped within the shutdown
+	// timeout we exit anyway
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChannel
+		logger.WithFields(log.Fields{
+			"signal": sig,
+		}).Info("Received OS signal")
+		cancel()
+
+		time.Sleep(time.Duration(config.ShutdownTimeoutMS) * time.Millisecond)
+		logger.Fatal("Shutdown timed out")
+	}()
+
+	// The reindex command replays transactions and exits
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		reindex(ctx, logger, os.Args[2:])
+		return
+	}
+
+	// The operations command lists the supported metaprotocol operations
+	if len(os.Args) > 1 && os.Args[1] == "operations" {
+		operations(logger)
+		return
+	}
+
+	// The compare command compares state checksums with another database
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		compare(ctx, logger, os.Args[2:])
+		return
+	}
+
+	// The export and import commands write and load state snapshots
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		exportSnapshot(ctx, logger, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importSnapshot(ctx, logger, os.Args[2:])
+		return
+	}
 
 	// Construct the service
 	logger.Info("Init service")
@@ -66,20 +113,162 @@ func main() {
 		logger.Fatalf("Unable to create service: %v", err)
 	}
 
-	// Handle stop signals
-	go func() {
-		sig := <-signalChannel
-		logger.WithFields(log.Fields{
-			"signal": sig,
-		}).Info("Received OS signal")
-		service.Stop()
-	}()
-
-	// Run forever
-	err = service.Run()
+	// Run until stopped
+	err = service.Run(ctx)
 	if err != nil {
 		logger.Fatalf("Unable to run service: %v", err)
 	}
 
 	logger.Info("Shutdown")
 }
+
+// operations prints the supported metaprotocol operations as JSON
+func operations(logger *log.Entry) {
+	service, err := indexer.New(
+		logger,
+	)
+	if err != nil {
+		logger.Fatalf("Unable to create service: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(service.Operations())
+	if err != nil {
+		logger.Fatalf("Unable to list operations: %v", err)
+	}
+}
+
+// reindex rebuilds the metaprotocol state over a height range
+func reindex(ctx context.Context, logger *log.Entry, args []string) {
+	var options indexer.ReindexOptions
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	flags.Uint64Var(&options.FromHeight, "from", 0, "first height to replay, defaults to the first stored transaction, partial ranges are not supported so it can't be after it")
+	flags.Uint64Var(&options.ToHeight, "to", 0, "last height to replay, defaults to the last processed height")
+	flags.Uint64Var(&options.BatchSize, "batch", 1000, "heights replayed and committed to the scratch tables per database transaction")
+	flags.BoolVar(&options.Refetch, "refetch", false, "fetch blocks from the chain instead of replaying stored transactions")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "report state and checksum differences without applying the replayed state")
+	flags.Parse(args)
+
+	logger.Info("Init reindex")
+	service, err := indexer.New(
+		logger,
+	)
+	if err != nil {
+		logger.Fatalf("Unable to create service: %v", err)
+	}
+
+	err = service.Reindex(ctx, options)
+	if err != nil {
+		logger.Fatalf("Unable to reindex: %v", err)
+	}
+}
+
+// compare reports the first height where the state checksums of another
+// database differ and exits with an error status if any chain diverged
+func compare(ctx context.Context, logger *log.Entry, args []string) {
+	var otherDSN string
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	flags.StringVar(&otherDSN, "dsn", "", "DSN of the database to compare with")
+	flags.Parse(args)
+	if otherDSN == "" {
+		logger.Fatal("The -dsn flag is required")
+	}
+
+	service, err := indexer.New(
+		logger,
+	)
+	if err != nil {
+		logger.Fatalf("Unable to create service: %v", err)
+	}
+
+	comparisons, err := service.CompareChecksums(ctx, otherDSN)
+	if err != nil {
+		logger.Fatalf("Unable to compare checksums: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(comparisons)
+	if err != nil {
+		logger.Fatalf("Unable to print comparison: %v", err)
+	}
+
+	for _, comparison := range comparisons {
+		if comparison.DivergedHeight != 0 {
+			os.Exit(1)
+		}
+	}
+}
+
+// exportSnapshot writes the metaprotocol state to a snapshot file
+func exportSnapshot(ctx context.Context, logger *log.Entry, args []string) {
+	var path string
+	var options indexer.ExportOptions
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&path, "out", "", "snapshot file to write")
+	flags.Uint64Var(&options.ExpectHeight, "expect-height", 0, "fail unless the chain is at this height, snapshots can only be taken at the last processed height")
+	flags.Parse(args)
+	if path == "" {
+		logger.Fatal("The -out flag is required")
+	}
+
+	service, err := indexer.New(
+		logger,
+	)
+	if err != nil {
+		logger.Fatalf("Unable to create service: %v", err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		logger.Fatalf("Unable to create snapshot file: %v", err)
+	}
+
+	header, err := service.ExportSnapshot(ctx, file, options)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		logger.Fatalf("Unable to export snapshot: %v", err)
+	}
+	err = file.Close()
+	if err != nil {
+		logger.Fatalf("Unable to write snapshot file: %v", err)
+	}
+
+	for _, chain := range header.Chains {
+		logger.WithFields(log.Fields{
+			"chain_id": chain.ChainID,
+			"height":   chain.Height,
+		}).Info("Exported snapshot")
+	}
+}
+
+// importSnapshot loads a snapshot file into an empty database
+func importSnapshot(ctx context.Context, logger *log.Entry, args []string) {
+	var path string
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.StringVar(&path, "in", "", "snapshot file to import")
+	flags.Parse(args)
+	if path == "" {
+		logger.Fatal("The -in flag is required")
+	}
+
+	service, err := indexer.New(
+		logger,
+	)
+	if err != nil {
+		logger.Fatalf("Unable to create service: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.Fatalf("Unable to open snapshot file: %v", err)
+	}
+	defer file.Close()
+
+	_, err = service.ImportSnapshot(ctx, file)
+	if err != nil {
+		logger.Fatalf("Unable to import snapshot: %v", err)
+	}
+}
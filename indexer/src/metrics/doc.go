@@ -0,0 +1,3 @@
+// Package metrics defines the Prometheus metrics of the indexer and worker
+// and serves them together with health and readiness checks
+package metrics
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// operationLabel limits the operation label to sane values, operations are
+// taken from user supplied memos
+var operationLabel = regexp.MustCompile(`^[a-z0-9.\-]{1,32}$`)
+
+// baseTokenPriceUpdated is the time the base token price was last updated
+// per chain
+var (
+	baseTokenPriceLock    sync.Mutex
+	baseTokenPriceUpdated = make(map[string]time.Time)
+)
+
+var (
+	// CurrentHeight is the next height to be processed by the indexer
+	CurrentHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "indexer_current_height",
+		Help: "The next height to be processed by the indexer",
+	}, []string{"chain"})
+	// KnownHeight is the latest height known on the chain
+	KnownHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "indexer_known_height",
+		Help: "The latest height known on the chain",
+	}, []string{"chain"})
+	// Lag is the number of blocks the indexer is behind the chain
+	Lag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "indexer_lag_blocks",
+		Help: "The number of blocks the indexer is behind the chain",
+	}, []string{"chain"})
+	// BlockDuration is the time taken to apply a block
+	BlockDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "indexer_block_processing_seconds",
+		Help:    "The time taken to apply a block to the database",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"chain"})
+	// MetaprotocolOperations counts the processed metaprotocol operations
+	MetaprotocolOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "indexer_metaprotocol_operations_total",
+		Help: "The number of processed metaprotocol operations",
+	}, []string{"chain", "metaprotocol", "operation", "result"})
+	// EndpointErrors counts the failed requests per endpoint
+	EndpointErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "indexer_endpoint_errors_total",
+		Help: "The number of failed requests per endpoint",
+	}, []string{"pool", "endpoint"})
+	// EndpointEjections counts how often an endpoint was ejected from a pool
+	EndpointEjections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "indexer_endpoint_ejections_total",
+		Help: "The number of times an endpoint was ejected as unhealthy",
+	}, []string{"pool", "endpoint"})
+	// WorkerJobs counts the river job outcomes
+	WorkerJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_jobs_total",
+		Help: "The number of river jobs by kind and outcome",
+	}, []string{"kind", "result"})
+	// WorkerJobDuration is the time taken to run a river job
+	WorkerJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_job_run_seconds",
+		Help:    "The time taken to run a river job",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"kind"})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "indexer_base_token_price_age_seconds",
+		Help: "The time since the stalest base token price was last updated",
+	}, func() float64 {
+		baseTokenPriceLock.Lock()
+		defer baseTokenPriceLock.Unlock()
+
+		var age float64
+		for _, updated := range baseTokenPriceUpdated {
+			if since := time.Since(updated).Seconds(); since > age {
+				age = since
+			}
+		}
+		return age
+	})
+}
+
+// SetHeights updates the height and lag gauges of chainID
+func SetHeights(chainID string, currentHeight uint64, knownHeight uint64) {
+	CurrentHeight.WithLabelValues(chainID).Set(float64(currentHeight))
+	KnownHeight.WithLabelValues(chainID).Set(float64(knownHeight))
+	if knownHeight > currentHeight {
+		Lag.WithLabelValues(chainID).Set(float64(knownHeight - currentHeight))
+	} else {
+		Lag.WithLabelValues(chainID).Set(0)
+	}
+}
+
+// ObserveOperation counts a processed metaprotocol operation
+func ObserveOperation(chainID string, metaprotocol string, operation string, err error) {
+	if !operationLabel.MatchString(operation) {
+		operation = "invalid"
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	MetaprotocolOperations.WithLabelValues(chainID, metaprotocol, operation, result).Inc()
+}
+
+// SetBaseTokenPriceUpdated records when the base token price of chainID was
+// updated
+func SetBaseTokenPriceUpdated(chainID string, updated time.Time) {
+	baseTokenPriceLock.Lock()
+	defer baseTokenPriceLock.Unlock()
+	baseTokenPriceUpdated[chainID] = updated
+}
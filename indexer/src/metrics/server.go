@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// Check returns an error if the service is not healthy or ready
+type Check func() error
+
+// namedCheck is a check with the name it is reported as
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Server serves the Prometheus metrics on /metrics and the health and
+// readiness checks on /healthz and /readyz
+type Server struct {
+	server          *http.Server
+	logger          *logrus.Entry
+	lock            sync.Mutex
+	healthChecks    []namedCheck
+	readinessChecks []namedCheck
+}
+
+// NewServer returns a new metrics server listening on address
+func NewServer(address string, log *logrus.Entry) *Server {
+	server := &Server{
+		logger: log,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		server.handleChecks(w, server.checks(false))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		server.handleChecks(w, server.checks(true))
+	})
+	server.server = &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return server
+}
+
+// AddHealthCheck adds a check that must pass for the service to be healthy.
+// Health checks are also required for readiness
+func (s *Server) AddHealthCheck(name string, check Check) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.healthChecks = append(s.healthChecks, namedCheck{name: name, check: check})
+}
+
+// AddReadinessCheck adds a check that must pass for the service to be ready
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.readinessChecks = append(s.readinessChecks, namedCheck{name: name, check: check})
+}
+
+// Start serves the metrics in the background
+func (s *Server) Start() {
+	s.logger.WithFields(logrus.Fields{
+		"address": s.server.Addr,
+	}).Info("Starting metrics server")
+
+	go func() {
+		err := s.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			s.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Metrics server failed")
+		}
+	}()
+}
+
+// Stop shuts down the metrics server
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// checks returns the health checks, and the readiness checks if readiness
+// is true
+func (s *Server) checks(readiness bool) []namedCheck {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	checks := append([]namedCheck{}, s.healthChecks...)
+	if readiness {
+		checks = append(checks, s.readinessChecks...)
+	}
+	return checks
+}
+
+// handleChecks runs checks and responds with the result of each check. The
+// status is 503 if any of the checks failed
+func (s *Server) handleChecks(w http.ResponseWriter, checks []namedCheck) {
+	status := http.StatusOK
+	results := make(map[string]string)
+	for _, check := range checks {
+		err := check.check()
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			results[check.name] = err.Error()
+			continue
+		}
+		results[check.name] = "ok"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(results)
+}
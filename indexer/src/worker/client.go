@@ -2,8 +2,11 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
 	workers "github.com/donovansolms/cosmos-inscriptions/indexer/src/worker/workers"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -11,6 +14,8 @@ import (
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/riverdriver/riverpgxv5"
 	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type ClientConfig struct {
@@ -18,6 +23,7 @@ type ClientConfig struct {
 }
 
 type WorkerClient struct {
+	dbPool *pgxpool.Pool
 	client *river.Client[pgx.Tx]
 	logger *logrus.Entry
 	ctx    context.Context
@@ -45,26 +51,196 @@ func NewWorkerClient(logger *logrus.Entry) (*WorkerClient, error) {
 	}
 
 	return &WorkerClient{
+		dbPool: dbPool,
 		client: riverClient,
 		logger: logger,
 		ctx:    ctx,
 	}, nil
 }
 
-func (p *WorkerClient) UpdateCollectionStats(collectionId uint64) {
-	_, err := p.client.Insert(p.ctx, workers.CollectionStatsArgs{
+// UpdateCollectionStats queues a collection stats update in the transaction
+// of db, a nil client doesn't queue any jobs
+func (p *WorkerClient) UpdateCollectionStats(db *gorm.DB, collectionId uint64) error {
+	if p == nil {
+		return nil
+	}
+	err := p.insertBlockTx(db, workers.CollectionStatsArgs{
 		CollectionID: collectionId,
 	}, &river.InsertOpts{ScheduledAt: time.Now().Add(workers.DebouncePeriod)})
 	if err != nil {
-		p.logger.Errorf("failed to insert collection stats job '%s'", err)
+		return fmt.Errorf("failed to insert collection stats job: %w", err)
 	}
+	return nil
 }
 
-func (p *WorkerClient) UpdateCollectionTraits(collectionId uint64) {
-	_, err := p.client.Insert(p.ctx, workers.CollectionTraitsArgs{
+// UpdateCollectionTraits queues a collection traits update in the
+// transaction of db, a nil client doesn't queue any jobs
+func (p *WorkerClient) UpdateCollectionTraits(db *gorm.DB, collectionId uint64) error {
+	if p == nil {
+		return nil
+	}
+	err := p.insertBlockTx(db, workers.CollectionTraitsArgs{
 		CollectionID: collectionId,
 	}, &river.InsertOpts{ScheduledAt: time.Now().Add(workers.DebouncePeriod)})
 	if err != nil {
-		p.logger.Errorf("failed to insert collection traits job '%s'", err)
+		return fmt.Errorf("failed to insert collection traits job: %w", err)
+	}
+	return nil
+}
+
+// GeneratePreview queues a preview of the content of the row with id in
+// table in the transaction of db, a nil client doesn't queue any jobs
+func (p *WorkerClient) GeneratePreview(db *gorm.DB, table string, id uint64) error {
+	if p == nil {
+		return nil
+	}
+	err := p.insertBlockTx(db, workers.PreviewArgs{
+		Table: table,
+		ID:    id,
+	}, &river.InsertOpts{ScheduledAt: time.Now().Add(workers.PreviewDelay)})
+	if err != nil {
+		return fmt.Errorf("failed to insert preview job: %w", err)
+	}
+	return nil
+}
+
+// outboxBatchSize is the number of outbox jobs moved to the job queue in a
+// single transaction
+const outboxBatchSize = 100
+
+// outboxKinds decodes the args of the jobs that can be queued by a block
+var outboxKinds = map[string]func(json.RawMessage) (river.JobArgs, error){
+	workers.CollectionStatsArgs{}.Kind():  decodeOutboxArgs[workers.CollectionStatsArgs],
+	workers.CollectionTraitsArgs{}.Kind(): decodeOutboxArgs[workers.CollectionTraitsArgs],
+	workers.PreviewArgs{}.Kind():          decodeOutboxArgs[workers.PreviewArgs],
+}
+
+// decodeOutboxArgs decodes the args of an outbox job of kind T
+func decodeOutboxArgs[T river.JobArgs](data json.RawMessage) (river.JobArgs, error) {
+	var args T
+	err := json.Unmarshal(data, &args)
+	if err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// insertBlockTx writes a job to the outbox in the block transaction of db,
+// so the job is dropped if the block is rolled back. The job is queued by
+// EnqueueOutbox once the block commits
+func (p *WorkerClient) insertBlockTx(db *gorm.DB, args river.JobArgs, opts *river.InsertOpts) error {
+	if _, ok := outboxKinds[args.Kind()]; !ok {
+		return fmt.Errorf("job kind '%s' can't be queued by a block", args.Kind())
+	}
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	job := models.JobOutbox{
+		Kind:        args.Kind(),
+		Args:        datatypes.JSON(encodedArgs),
+		ScheduledAt: now,
+		DateCreated: now,
+	}
+	if opts != nil && !opts.ScheduledAt.IsZero() {
+		job.ScheduledAt = opts.ScheduledAt.UTC()
+	}
+	return db.Create(&job).Error
+}
+
+// EnqueueOutbox moves the jobs written by committed blocks to the job queue
+// and returns the number of jobs moved. The jobs are inserted by river in
+// the transaction that removes them from the outbox, so a job is queued
+// exactly once and the unique options of its kind apply
+func (p *WorkerClient) EnqueueOutbox(ctx context.Context) (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	var total int
+	for {
+		count, err := p.enqueueOutboxBatch(ctx)
+		if err != nil {
+			return total, err
+		}
+		total += count
+		if count < outboxBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// enqueueOutboxBatch moves a batch of outbox jobs to the job queue. Batches
+// that are being moved by another client are skipped
+func (p *WorkerClient) enqueueOutboxBatch(ctx context.Context) (int, error) {
+	tx, err := p.dbPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, "SELECT id, kind, args, scheduled_at FROM job_outbox ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED", outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var jobs []models.JobOutbox
+	for rows.Next() {
+		var job models.JobOutbox
+		err = rows.Scan(&job.ID, &job.Kind, &job.Args, &job.ScheduledAt)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, rows.Err()
+	}
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int64, len(jobs))
+	for index, job := range jobs {
+		decode, ok := outboxKinds[job.Kind]
+		if !ok {
+			return 0, fmt.Errorf("unknown kind '%s' of outbox job %d", job.Kind, job.ID)
+		}
+		args, err := decode(json.RawMessage(job.Args))
+		if err != nil {
+			return 0, fmt.Errorf("unable to decode outbox job %d: %w", job.ID, err)
+		}
+		_, err = p.client.InsertTx(ctx, tx, args, &river.InsertOpts{ScheduledAt: job.ScheduledAt})
+		if err != nil {
+			return 0, fmt.Errorf("unable to queue outbox job %d: %w", job.ID, err)
+		}
+		ids[index] = int64(job.ID)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM job_outbox WHERE id = ANY($1)", ids)
+	if err != nil {
+		return 0, err
+	}
+	return len(jobs), tx.Commit(ctx)
+}
+
+// Insert queues a job to run immediately and returns its ID. Jobs with unique
+// options return the existing job if one is already queued
+func (p *WorkerClient) Insert(ctx context.Context, args river.JobArgs) (int64, error) {
+	job, err := p.client.Insert(ctx, args, nil)
+	if err != nil {
+		return 0, err
+	}
+	return job.ID, nil
+}
+
+// InsertMany queues jobs to run immediately and returns the number of jobs
+// queued
+func (p *WorkerClient) InsertMany(ctx context.Context, args []river.JobArgs) (int64, error) {
+	params := make([]river.InsertManyParams, len(args))
+	for i := range args {
+		params[i] = river.InsertManyParams{Args: args[i]}
 	}
+	return p.client.InsertMany(ctx, params)
 }
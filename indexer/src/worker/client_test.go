@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/worker/workers"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestQueueInBlockTransaction(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "worker.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.JobOutbox{}))
+
+	var client *WorkerClient
+	assert.NoError(t, client.GeneratePreview(db, "inscription", 1), "a nil client should not queue jobs")
+
+	// Jobs of a block that is rolled back are dropped
+	client = &WorkerClient{}
+	rollback := errors.New("rollback")
+	err = db.Transaction(func(dbTx *gorm.DB) error {
+		assert.NoError(t, client.UpdateCollectionStats(dbTx, 1))
+		return rollback
+	})
+	assert.ErrorIs(t, err, rollback)
+	var count int64
+	assert.NoError(t, db.Model(&models.JobOutbox{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	err = db.Transaction(func(dbTx *gorm.DB) error {
+		return client.GeneratePreview(dbTx, "inscription", 12)
+	})
+	assert.NoError(t, err)
+
+	var jobs []models.JobOutbox
+	assert.NoError(t, db.Find(&jobs).Error)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "preview", jobs[0].Kind)
+	assert.WithinDuration(t, time.Now().Add(workers.PreviewDelay), jobs[0].ScheduledAt, time.Minute)
+
+	// The outbox job decodes to the args it was queued with
+	args, err := outboxKinds[jobs[0].Kind](json.RawMessage(jobs[0].Args))
+	assert.NoError(t, err)
+	assert.Equal(t, workers.PreviewArgs{Table: "inscription", ID: 12}, args)
+}
+
+func TestQueueUnknownKind(t *testing.T) {
+	client := &WorkerClient{}
+	err := client.insertBlockTx(nil, workers.WebhookDeliveryArgs{}, nil)
+	assert.EqualError(t, err, "job kind 'webhook-delivery' can't be queued by a block")
+}
@@ -17,15 +17,10 @@ import (
 
 // Config defines the environment variables for the service
 type Config struct {
-	LogFormat   string `envconfig:"LOG_FORMAT" required:"true"`
-	LogLevel    string `envconfig:"LOG_LEVEL" required:"true"`
-	ServiceName string `envconfig:"SERVICE_NAME" required:"true"`
-}
-
-func forever() {
-	for {
-		time.Sleep(time.Second)
-	}
+	LogFormat         string `envconfig:"LOG_FORMAT" required:"true"`
+	LogLevel          string `envconfig:"LOG_LEVEL" required:"true"`
+	ServiceName       string `envconfig:"SERVICE_NAME" required:"true"`
+	ShutdownTimeoutMS int    `envconfig:"SHUTDOWN_TIMEOUT_MS" default:"30000"`
 }
 
 func main() {
@@ -63,8 +58,10 @@ func main() {
 	})
 	logger.Info("Init worker")
 
-	// create worker service
-	ctx := context.Background()
+	// create worker service, the context is cancelled once the worker has
+	// stopped to cancel anything still running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	service, err := worker.NewWorker(ctx, logger)
 	if err != nil {
@@ -79,14 +76,14 @@ func main() {
 	quitChannel := make(chan os.Signal, 1)
 	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM)
 
-	go forever()
-
-	// cleanup
+	// cleanup, running jobs are given until the shutdown timeout to finish
 	sig := <-quitChannel
 	logger.WithFields(log.Fields{
 		"signal": sig,
 	}).Info("Received OS signal")
-	err = service.Stop()
+	stopCtx, stopCancel := context.WithTimeout(ctx, time.Duration(config.ShutdownTimeoutMS)*time.Millisecond)
+	defer stopCancel()
+	err = service.Stop(stopCtx)
 	if err != nil {
 		log.WithError(err).Error("Failed to stop service")
 	}
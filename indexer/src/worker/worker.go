@@ -2,7 +2,11 @@ package worker
 
 import (
 	"context"
+	"net/http"
+	"time"
 
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/metrics"
 	workers "github.com/donovansolms/cosmos-inscriptions/indexer/src/worker/workers"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -16,13 +20,21 @@ import (
 )
 
 type Config struct {
-	DatabaseDSN string `envconfig:"DATABASE_DSN" required:"true"`
+	DatabaseDSN      string `envconfig:"DATABASE_DSN" required:"true"`
+	MetricsAddress   string `envconfig:"WORKER_METRICS_ADDRESS" default:":9091"`
+	WebhookTimeoutMS int    `envconfig:"WEBHOOK_TIMEOUT_MS" default:"10000"`
+	WebhookBatchSize int    `envconfig:"WEBHOOK_BATCH_SIZE" default:"100"`
+	PreviewSize      int    `envconfig:"PREVIEW_SIZE" default:"256"`
+	PreviewTextBytes int    `envconfig:"PREVIEW_TEXT_BYTES" default:"1024"`
 }
 
 type Worker struct {
-	ctx    context.Context
-	dbPool *pgxpool.Pool
-	client *river.Client[pgx.Tx]
+	ctx                 context.Context
+	dbPool              *pgxpool.Pool
+	client              *river.Client[pgx.Tx]
+	logger              *logrus.Entry
+	metricsServer       *metrics.Server
+	cancelSubscriptions func()
 }
 
 func NewWorker(ctx context.Context, log *logrus.Entry) (*Worker, error) {
@@ -47,12 +59,37 @@ func NewWorker(ctx context.Context, log *logrus.Entry) (*Worker, error) {
 		return nil, err
 	}
 
+	// Previews are stored with the content
+	var contentStoreConfig contentstore.Config
+	err = envconfig.Process("", &contentStoreConfig)
+	if err != nil {
+		log.Fatalf("Unable to process content store config: %s", err)
+	}
+	contentStore, err := contentstore.New(contentStoreConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	// Setup workers
 	w := river.NewWorkers()
 	river.AddWorker(w, &workers.CollectionStatsWorker{DB: db})
 	river.AddWorker(w, &workers.CollectionTraitsWorker{DB: db})
 	river.AddWorker(w, &workers.CollectionsStatsWorker{DB: db})
 	river.AddWorker(w, &workers.ExpireLaunchpadReservationWorker{DB: db})
+	river.AddWorker(w, &workers.ExpireInscriptionPartsWorker{DB: db})
+	river.AddWorker(w, &workers.ContentHashAuditWorker{DB: db, Logger: log})
+	river.AddWorker(w, &workers.PreviewWorker{
+		DB:           db,
+		ContentStore: contentStore,
+		Size:         config.PreviewSize,
+		TextBytes:    config.PreviewTextBytes,
+	})
+	river.AddWorker(w, &workers.WebhookDeliveryWorker{
+		DB:        db,
+		Client:    &http.Client{Timeout: time.Duration(config.WebhookTimeoutMS) * time.Millisecond},
+		BatchSize: config.WebhookBatchSize,
+		Logger:    log,
+	})
 
 	// Setup periodic jobs
 	periodicJobs := []*river.PeriodicJob{
@@ -70,6 +107,20 @@ func NewWorker(ctx context.Context, log *logrus.Entry) (*Worker, error) {
 			},
 			&river.PeriodicJobOpts{RunOnStart: true},
 		),
+		river.NewPeriodicJob(
+			river.PeriodicInterval(workers.ExpireInscriptionPartsPeriod),
+			func() (river.JobArgs, *river.InsertOpts) {
+				return workers.ExpireInscriptionPartsArgs{}, nil
+			},
+			&river.PeriodicJobOpts{RunOnStart: true},
+		),
+		river.NewPeriodicJob(
+			river.PeriodicInterval(workers.WebhookDeliveryPeriod),
+			func() (river.JobArgs, *river.InsertOpts) {
+				return workers.WebhookDeliveryArgs{}, nil
+			},
+			&river.PeriodicJobOpts{RunOnStart: true},
+		),
 	}
 
 	riverClient, err := river.NewClient(riverpgxv5.New(dbPool), &river.Config{
@@ -83,19 +134,78 @@ func NewWorker(ctx context.Context, log *logrus.Entry) (*Worker, error) {
 		panic(err)
 	}
 
-	return &Worker{
+	worker := &Worker{
 		ctx:    ctx,
 		dbPool: dbPool,
 		client: riverClient,
-	}, nil
+		logger: log,
+	}
+	if config.MetricsAddress != "" {
+		worker.metricsServer = metrics.NewServer(config.MetricsAddress, log)
+		worker.metricsServer.AddHealthCheck("database", func() error {
+			return dbPool.Ping(ctx)
+		})
+	}
+
+	return worker, nil
 }
 
 func (w *Worker) Start() error {
+	if w.metricsServer != nil {
+		w.metricsServer.Start()
+	}
+
+	// Count job outcomes, subscribe before starting so no events are missed
+	events, cancel := w.client.Subscribe(
+		river.EventKindJobCompleted,
+		river.EventKindJobFailed,
+		river.EventKindJobCancelled,
+		river.EventKindJobSnoozed,
+	)
+	w.cancelSubscriptions = cancel
+	go w.observeJobs(events)
+
 	return w.client.Start(w.ctx)
 }
 
-func (w *Worker) Stop() error {
-	err := w.client.StopAndCancel(w.ctx)
+// Stop waits for running jobs to complete until ctx is done, after which the
+// remaining jobs are cancelled
+func (w *Worker) Stop(ctx context.Context) error {
+	err := w.client.Stop(ctx)
+	if err != nil {
+		w.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Warn("Jobs did not finish in time, cancelling")
+
+		cancelCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = w.client.StopAndCancel(cancelCtx)
+	}
+	if w.cancelSubscriptions != nil {
+		w.cancelSubscriptions()
+	}
+	if w.metricsServer != nil {
+		metricsErr := w.metricsServer.Stop()
+		if metricsErr != nil {
+			w.logger.WithFields(logrus.Fields{
+				"err": metricsErr,
+			}).Warn("Unable to stop metrics server")
+		}
+	}
 	w.dbPool.Close()
 	return err
 }
+
+// observeJobs records the job events in the metrics until the subscription
+// is cancelled
+func (w *Worker) observeJobs(events <-chan *river.Event) {
+	for event := range events {
+		if event.Job == nil {
+			continue
+		}
+		metrics.WorkerJobs.WithLabelValues(event.Job.Kind, string(event.Kind)).Inc()
+		if event.JobStats != nil {
+			metrics.WorkerJobDuration.WithLabelValues(event.Job.Kind).Observe(event.JobStats.RunDuration.Seconds())
+		}
+	}
+}
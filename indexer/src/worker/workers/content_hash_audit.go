@@ -0,0 +1,156 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/riverqueue/river"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// contentHashAuditBatchSize is the number of rows audited per query
+const contentHashAuditBatchSize = 500
+
+// contentHashAuditTables are created by the inscribe operation
+var contentHashAuditTables = []string{
+	"collection",
+	"inscription",
+}
+
+type ContentHashAuditArgs struct {
+}
+
+func (ContentHashAuditArgs) Kind() string { return "content-hash-audit" }
+
+func (ContentHashAuditArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: time.Hour,
+		},
+	}
+}
+
+// contentHashAuditRow is a collection or inscription with the content of
+// its inscribe transaction
+type contentHashAuditRow struct {
+	ID              uint64
+	ContentHash     string
+	TokenID         sql.NullInt64
+	TransactionHash string
+	Content         string
+}
+
+// ContentHashAuditWorker computes the content hash of collections and
+// inscriptions indexed before content hashes were verified, and flags the
+// ones with a declared hash that doesn't match their content. Rows that have
+// a computed hash are skipped, so an interrupted audit continues where it
+// stopped
+type ContentHashAuditWorker struct {
+	DB     *gorm.DB
+	Logger *logrus.Entry
+	river.WorkerDefaults[ContentHashAuditArgs]
+}
+
+// Timeout allows the audit to run longer than the default job timeout
+func (w *ContentHashAuditWorker) Timeout(job *river.Job[ContentHashAuditArgs]) time.Duration {
+	return 30 * time.Minute
+}
+
+func (w *ContentHashAuditWorker) Work(ctx context.Context, job *river.Job[ContentHashAuditArgs]) error {
+	for _, table := range contentHashAuditTables {
+		audited, mismatches, err := w.auditTable(ctx, table)
+		if err != nil {
+			return err
+		}
+		w.Logger.WithFields(logrus.Fields{
+			"table":      table,
+			"audited":    audited,
+			"mismatches": mismatches,
+		}).Info("Audited content hashes")
+	}
+	return nil
+}
+
+// auditTable computes the content hash of the rows of table without one
+func (w *ContentHashAuditWorker) auditTable(ctx context.Context, table string) (audited int, mismatches int, err error) {
+	tokenIDColumn := "CAST(NULL AS integer)"
+	if table == "inscription" {
+		tokenIDColumn = "t.token_id"
+	}
+
+	var lastID uint64
+	for {
+		var rows []contentHashAuditRow
+		err := w.DB.WithContext(ctx).Raw(fmt.Sprintf(`SELECT t.id, t.content_hash, %s AS token_id, tx.hash AS transaction_hash, tx.content
+			FROM %s t JOIN "transaction" tx ON tx.id = t.transaction_id
+			WHERE t.computed_hash IS NULL AND t.id > ?
+			ORDER BY t.id LIMIT ?`, tokenIDColumn, table), lastID, contentHashAuditBatchSize).Scan(&rows).Error
+		if err != nil {
+			return audited, mismatches, err
+		}
+		if len(rows) == 0 {
+			return audited, mismatches, nil
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+			computedHash, mismatch, err := auditContentHash(row)
+			if err != nil {
+				// The row is left unaudited and reported, it doesn't stop
+				// the rest of the audit
+				w.Logger.WithFields(logrus.Fields{
+					"table": table,
+					"id":    row.ID,
+					"hash":  row.TransactionHash,
+					"err":   err,
+				}).Warn("Unable to audit content hash")
+				continue
+			}
+
+			err = w.DB.WithContext(ctx).Table(table).Where("id = ?", row.ID).UpdateColumns(map[string]interface{}{
+				"computed_hash":    computedHash,
+				"is_hash_mismatch": mismatch,
+			}).Error
+			if err != nil {
+				return audited, mismatches, err
+			}
+			audited++
+			if mismatch {
+				mismatches++
+			}
+		}
+	}
+}
+
+// auditContentHash returns the hash of the content inscribed by the
+// transaction of row and whether it differs from the declared hash
+func auditContentHash(row contentHashAuditRow) (string, bool, error) {
+	var rawTransaction types.Transaction
+	err := json.Unmarshal([]byte(row.Content), &rawTransaction)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to decode transaction: %w", err)
+	}
+	msg, err := rawTransaction.ExtensionMessage()
+	if err != nil {
+		return "", false, err
+	}
+	content, err := msg.GetContent()
+	if err != nil {
+		return "", false, err
+	}
+
+	// Inscriptions of a collection that reuse content have the token ID
+	// appended to the declared hash
+	declaredHash := row.ContentHash
+	if row.TokenID.Valid {
+		declaredHash = strings.TrimSuffix(declaredHash, fmt.Sprintf("-%d", row.TokenID.Int64))
+	}
+	return types.ContentHash(content), !types.ContentHashMatches(declaredHash, content), nil
+}
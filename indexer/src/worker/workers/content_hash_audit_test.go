@@ -0,0 +1,75 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/types"
+	"github.com/riverqueue/river"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// inscribeTransactionJSON returns a stored transaction that inscribes content
+func inscribeTransactionJSON(content string) string {
+	return fmt.Sprintf(`{"body": {"messages": [], "non_critical_extension_options": [{"@type": "/cosmos.authz.v1beta1.MsgRevoke", "granter": %q, "grantee": %q, "msg_type_url": "/cosmos.bank.v1beta1.MsgSend"}]}}`,
+		base64.StdEncoding.EncodeToString([]byte(`{"metadata": {"mime": "text/plain"}}`)),
+		base64.StdEncoding.EncodeToString([]byte(content)),
+	)
+}
+
+func TestContentHashAudit(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "audit.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.Transaction{}, &models.Collection{}, &models.Inscription{}))
+
+	hash := types.ContentHash([]byte("content"))
+	transactions := []models.Transaction{
+		{Hash: "MATCH", Content: inscribeTransactionJSON("content")},
+		{Hash: "MISMATCH", Content: inscribeTransactionJSON("other content")},
+		{Hash: "TOKEN", Content: inscribeTransactionJSON("content")},
+		{Hash: "INVALID", Content: "{"},
+		{Hash: "COLLECTION", Content: inscribeTransactionJSON("other content")},
+	}
+	assert.NoError(t, db.Create(&transactions).Error)
+	inscriptions := []models.Inscription{
+		{TransactionID: transactions[0].ID, ContentHash: hash},
+		{TransactionID: transactions[1].ID, ContentHash: hash},
+		{TransactionID: transactions[2].ID, ContentHash: hash + "-7", TokenID: sql.NullInt64{Int64: 7, Valid: true}},
+		{TransactionID: transactions[3].ID, ContentHash: hash},
+		// Audited rows are skipped
+		{TransactionID: transactions[1].ID, ContentHash: hash, ComputedHash: sql.NullString{String: "audited", Valid: true}},
+	}
+	assert.NoError(t, db.Create(&inscriptions).Error)
+	assert.NoError(t, db.Create(&models.Collection{TransactionID: transactions[4].ID, ContentHash: hash}).Error)
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	worker := &ContentHashAuditWorker{DB: db, Logger: logrus.NewEntry(log)}
+	assert.NoError(t, worker.Work(context.Background(), &river.Job[ContentHashAuditArgs]{}))
+
+	var audited []models.Inscription
+	assert.NoError(t, db.Order("id").Find(&audited).Error)
+	assert.Equal(t, hash, audited[0].ComputedHash.String)
+	assert.False(t, audited[0].IsHashMismatch)
+	assert.Equal(t, types.ContentHash([]byte("other content")), audited[1].ComputedHash.String)
+	assert.True(t, audited[1].IsHashMismatch)
+	assert.False(t, audited[2].IsHashMismatch, "the token ID appended to duplicate content should be ignored")
+	assert.False(t, audited[3].ComputedHash.Valid, "rows that can't be audited should be left for another audit")
+	assert.Equal(t, "audited", audited[4].ComputedHash.String)
+
+	var collection models.Collection
+	assert.NoError(t, db.First(&collection).Error)
+	assert.True(t, collection.IsHashMismatch)
+}
@@ -0,0 +1,38 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+)
+
+const ExpireInscriptionPartsPeriod = time.Hour
+
+type ExpireInscriptionPartsArgs struct {
+}
+
+func (ExpireInscriptionPartsArgs) Kind() string { return "expire-inscription-parts" }
+
+func (ExpireInscriptionPartsArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: ExpireInscriptionPartsPeriod,
+		},
+	}
+}
+
+// ExpireInscriptionPartsWorker removes the parts of multipart uploads that
+// expired before the last processed height of their chain. The indexer
+// ignores expired parts, removing them only frees the space
+type ExpireInscriptionPartsWorker struct {
+	DB *gorm.DB
+	river.WorkerDefaults[ExpireInscriptionPartsArgs]
+}
+
+func (w *ExpireInscriptionPartsWorker) Work(ctx context.Context, job *river.Job[ExpireInscriptionPartsArgs]) error {
+	return w.DB.WithContext(ctx).Exec(`DELETE FROM inscription_part p USING status s
+		WHERE s.chain_id = p.chain_id AND p.expires_height < s.last_processed_height`).Error
+}
@@ -0,0 +1,242 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentpolicy"
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/contentstore"
+	"github.com/riverqueue/river"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"gorm.io/gorm"
+)
+
+// PreviewDelay is the delay before a preview is generated, so that the
+// block that stored the content has been committed
+const PreviewDelay time.Duration = 30 * time.Second
+
+// maxPreviewPixels limits the size of images that are decoded
+const maxPreviewPixels = 50_000_000
+
+// previewJPEGQuality is the quality of opaque thumbnails
+const previewJPEGQuality = 80
+
+// previewTextType is the type text previews are stored with
+const previewTextType = "text/plain; charset=utf-8"
+
+// PreviewTables are the tables with content that previews are generated for
+var PreviewTables = map[string]bool{
+	"collection":  true,
+	"inscription": true,
+	"troll_post":  true,
+}
+
+// previewImageTypes are the image types thumbnails are generated for, GIF
+// thumbnails are the first frame
+var previewImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type PreviewArgs struct {
+	// Table is collection, inscription or troll_post
+	Table string `json:"table"`
+	ID    uint64 `json:"id"`
+}
+
+func (PreviewArgs) Kind() string { return "preview" }
+
+func (PreviewArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		// A row that was rolled back is only retried for a few minutes
+		MaxAttempts: 5,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: DebouncePeriod,
+		},
+	}
+}
+
+// previewContent is the stored content of a row
+type previewContent struct {
+	ContentPath     string
+	DeclaredMime    sql.NullString
+	DetectedMime    sql.NullString
+	IsActiveContent bool
+}
+
+// preview is a generated thumbnail or text preview
+type preview struct {
+	Content  []byte
+	MimeType string
+	// Width and Height are 0 for text previews
+	Width  int
+	Height int
+}
+
+// PreviewWorker generates a thumbnail of image content, or a preview of text
+// content, and stores it in the content store. Active content and other
+// types don't get a preview
+type PreviewWorker struct {
+	DB *gorm.DB
+	// ContentStore holds the content and previews, no previews are
+	// generated when it is nil
+	ContentStore contentstore.ContentStore
+	// Size is the maximum width and height of thumbnails
+	Size int
+	// TextBytes is the maximum length of text previews
+	TextBytes int
+	river.WorkerDefaults[PreviewArgs]
+}
+
+func (w *PreviewWorker) Work(ctx context.Context, job *river.Job[PreviewArgs]) error {
+	if !PreviewTables[job.Args.Table] {
+		return fmt.Errorf("previews are not generated for table '%s'", job.Args.Table)
+	}
+	if w.ContentStore == nil {
+		return nil
+	}
+
+	var row previewContent
+	result := w.DB.WithContext(ctx).Table(job.Args.Table).
+		Select("content_path", "declared_mime", "detected_mime", "is_active_content").
+		Where("id = ?", job.Args.ID).
+		Take(&row)
+	if result.Error != nil {
+		// The job is retried if the block that created the row has not been
+		// committed yet
+		return fmt.Errorf("unable to load %s %d: %w", job.Args.Table, job.Args.ID, result.Error)
+	}
+	if row.ContentPath == "" || row.IsActiveContent {
+		return nil
+	}
+
+	content, err := w.ContentStore.Get(ctx, row.ContentPath)
+	if err != nil {
+		return err
+	}
+
+	// Rows indexed before content types were detected only have the
+	// declared type, if any
+	mimeType := row.DetectedMime.String
+	if !row.DetectedMime.Valid {
+		mimeType = contentpolicy.Detect(row.DeclaredMime.String, content)
+	}
+
+	var generated *preview
+	switch {
+	case previewImageTypes[mimeType]:
+		generated, err = thumbnail(content, w.Size)
+		if err != nil {
+			// The content won't decode on a retry either
+			return river.JobCancel(fmt.Errorf("unable to generate thumbnail of %s %d: %w", job.Args.Table, job.Args.ID, err))
+		}
+	case isPreviewText(mimeType):
+		generated = textPreview(content, w.TextBytes)
+	}
+	if generated == nil {
+		return nil
+	}
+
+	previewPath, err := contentstore.Store(ctx, w.ContentStore, generated.MimeType, generated.Content)
+	if err != nil {
+		return err
+	}
+	return w.DB.WithContext(ctx).Table(job.Args.Table).Where("id = ?", job.Args.ID).UpdateColumns(map[string]interface{}{
+		"preview_path":   previewPath,
+		"preview_width":  sql.NullInt32{Int32: int32(generated.Width), Valid: generated.Width > 0},
+		"preview_height": sql.NullInt32{Int32: int32(generated.Height), Valid: generated.Height > 0},
+	}).Error
+}
+
+// thumbnail returns the image in content scaled down to fit in size by size
+// pixels. Opaque thumbnails are encoded as JPEG, others as PNG
+func thumbnail(content []byte, size int) (*preview, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPreviewPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is not supported", config.Width, config.Height)
+	}
+	source, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	// Images are only scaled down, keeping the aspect ratio
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			height = max(1, height*size/width)
+			width = size
+		} else {
+			width = max(1, width*size/height)
+			height = size
+		}
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), source, bounds, draw.Src, nil)
+
+	var encoded bytes.Buffer
+	mimeType := "image/png"
+	if scaled.Opaque() {
+		mimeType = "image/jpeg"
+		err = jpeg.Encode(&encoded, scaled, &jpeg.Options{Quality: previewJPEGQuality})
+	} else {
+		err = png.Encode(&encoded, scaled)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &preview{
+		Content:  encoded.Bytes(),
+		MimeType: mimeType,
+		Width:    width,
+		Height:   height,
+	}, nil
+}
+
+// textPreview returns the first length bytes of content, cut at a character
+// boundary. Content that isn't UTF-8 text has no preview
+func textPreview(content []byte, length int) *preview {
+	if len(content) > length {
+		content = content[:length]
+		// Drop the bytes of a character that was cut off
+		for i := 1; i < utf8.UTFMax && len(content) > 0 && !utf8.Valid(content); i++ {
+			content = content[:len(content)-1]
+		}
+	}
+	if !utf8.Valid(content) {
+		return nil
+	}
+	return &preview{
+		Content:  content,
+		MimeType: previewTextType,
+	}
+}
+
+// isPreviewText returns true if content of mimeType gets a text preview.
+// Markup isn't previewed, it is shown sandboxed if at all
+func isPreviewText(mimeType string) bool {
+	switch mimeType {
+	case "text/html", "text/xml", "image/svg+xml":
+		return false
+	case "application/json":
+		return true
+	}
+	return strings.HasPrefix(mimeType, "text/")
+}
@@ -0,0 +1,55 @@
+package workers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var encoded bytes.Buffer
+	err := png.Encode(&encoded, img)
+	assert.NoError(t, err)
+	return encoded.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	for x := 0; x < 1000; x++ {
+		for y := 0; y < 500; y++ {
+			opaque.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	generated, err := thumbnail(encodePNG(t, opaque), 256)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", generated.MimeType, "opaque images should be encoded as JPEG")
+	assert.Equal(t, 256, generated.Width)
+	assert.Equal(t, 128, generated.Height, "the aspect ratio should be kept")
+
+	transparent := image.NewRGBA(image.Rect(0, 0, 10, 20))
+	generated, err = thumbnail(encodePNG(t, transparent), 256)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", generated.MimeType, "transparent images should be encoded as PNG")
+	assert.Equal(t, 10, generated.Width, "small images should not be scaled up")
+	assert.Equal(t, 20, generated.Height)
+
+	_, err = thumbnail([]byte("not an image"), 256)
+	assert.Error(t, err)
+}
+
+func TestTextPreview(t *testing.T) {
+	generated := textPreview([]byte("héllo world"), 2)
+	assert.Equal(t, "h", string(generated.Content), "a cut off character should be dropped")
+	assert.Zero(t, generated.Width)
+
+	generated = textPreview([]byte("short"), 1024)
+	assert.Equal(t, "short", string(generated.Content))
+
+	assert.Nil(t, textPreview([]byte{0xff, 0xfe, 0x00}, 1024), "binary content should not have a text preview")
+	assert.True(t, isPreviewText("text/markdown"))
+	assert.False(t, isPreviewText("text/html"))
+}
@@ -0,0 +1,222 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/riverqueue/river"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const WebhookDeliveryPeriod = 10 * time.Second
+
+// webhookMaxBackoff limits the wait between retries of a failing subscriber
+const webhookMaxBackoff = time.Hour
+
+type WebhookDeliveryArgs struct {
+}
+
+func (WebhookDeliveryArgs) Kind() string { return "webhook-delivery" }
+
+func (WebhookDeliveryArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: WebhookDeliveryPeriod,
+		},
+	}
+}
+
+// WebhookEvent is the body posted to a webhook
+type WebhookEvent struct {
+	ID              uint64          `json:"id"`
+	Type            string          `json:"type"`
+	ChainID         string          `json:"chain_id"`
+	Height          uint64          `json:"height"`
+	TransactionHash string          `json:"transaction_hash"`
+	Data            json.RawMessage `json:"data"`
+	DateCreated     time.Time       `json:"date_created"`
+}
+
+// WebhookDeliveryWorker posts the events in the outbox to the enabled webhook
+// subscriptions. Each subscription has its own cursor, a failing subscriber
+// is retried with a backoff without holding up the others
+type WebhookDeliveryWorker struct {
+	DB        *gorm.DB
+	Client    *http.Client
+	BatchSize int
+	Logger    *logrus.Entry
+	river.WorkerDefaults[WebhookDeliveryArgs]
+}
+
+func (w *WebhookDeliveryWorker) Work(ctx context.Context, job *river.Job[WebhookDeliveryArgs]) error {
+	var subscriptionIDs []uint64
+	err := w.DB.WithContext(ctx).Model(&models.WebhookSubscription{}).
+		Where("is_enabled = ? AND (retry_at IS NULL OR retry_at <= ?)", true, time.Now().UTC()).
+		Order("id").
+		Pluck("id", &subscriptionIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = w.deliverSubscription(ctx, subscriptionID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverSubscription posts the next batch of events to a subscription. The
+// subscription is locked while delivering, so overlapping runs skip it. Only
+// database errors are returned, delivery errors are stored on the
+// subscription
+func (w *WebhookDeliveryWorker) deliverSubscription(ctx context.Context, subscriptionID uint64) error {
+	return w.DB.WithContext(ctx).Transaction(func(dbTx *gorm.DB) error {
+		var subscription models.WebhookSubscription
+		result := dbTx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ?", subscriptionID).
+			Limit(1).
+			Find(&subscription)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Delivered by another run
+			return nil
+		}
+
+		query := dbTx.Where("chain_id = ? AND id > ?", subscription.ChainID, subscription.LastEventID)
+		if eventTypes := parseEventTypes(subscription.EventTypes); len(eventTypes) > 0 {
+			query = query.Where("event_type IN ?", eventTypes)
+		}
+		var events []models.EventOutbox
+		err := query.Order("id").Limit(w.BatchSize).Find(&events).Error
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		var deliveryErr error
+		for _, event := range events {
+			deliveryErr = w.post(ctx, subscription, event)
+			if deliveryErr != nil {
+				break
+			}
+			subscription.LastEventID = event.ID
+		}
+
+		subscription.DateUpdated = time.Now().UTC()
+		if deliveryErr != nil {
+			subscription.FailureCount++
+			subscription.RetryAt = sql.NullTime{Time: subscription.DateUpdated.Add(webhookBackoff(subscription.FailureCount)), Valid: true}
+			subscription.LastError = deliveryErr.Error()
+			w.Logger.WithFields(logrus.Fields{
+				"subscription_id": subscription.ID,
+				"failures":        subscription.FailureCount,
+				"retry_at":        subscription.RetryAt.Time,
+				"err":             deliveryErr,
+			}).Warn("Unable to deliver webhook")
+		} else {
+			subscription.FailureCount = 0
+			subscription.RetryAt = sql.NullTime{}
+			subscription.LastError = ""
+		}
+		return dbTx.Save(&subscription).Error
+	})
+}
+
+// post delivers a single event, any response other than 2xx is a failure
+func (w *WebhookDeliveryWorker) post(ctx context.Context, subscription models.WebhookSubscription, event models.EventOutbox) error {
+	body, err := json.Marshal(WebhookEvent{
+		ID:              event.ID,
+		Type:            event.EventType,
+		ChainID:         event.ChainID,
+		Height:          event.Height,
+		TransactionHash: event.TransactionHash,
+		Data:            json.RawMessage(event.Data),
+		DateCreated:     event.DateCreated,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-ID", strconv.FormatUint(event.ID, 10))
+	request.Header.Set("X-Webhook-Event", event.EventType)
+	request.Header.Set("X-Webhook-Timestamp", timestamp)
+	request.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(subscription.Secret, timestamp, body))
+
+	response, err := w.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d for event %d", response.StatusCode, event.ID)
+	}
+	return nil
+}
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of the timestamp and body
+// with the subscription secret, signed as "timestamp.body"
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseEventTypes returns the event types of a comma separated list
+func parseEventTypes(eventTypes string) []string {
+	var parsed []string
+	for _, eventType := range strings.Split(eventTypes, ",") {
+		eventType = strings.TrimSpace(eventType)
+		if eventType != "" {
+			parsed = append(parsed, eventType)
+		}
+	}
+	return parsed
+}
+
+// webhookBackoff returns the wait before retrying after failures consecutive
+// failures, doubling from the delivery period up to webhookMaxBackoff
+func webhookBackoff(failures uint64) time.Duration {
+	backoff := WebhookDeliveryPeriod
+	for i := uint64(1); i < failures; i++ {
+		backoff *= 2
+		if backoff >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/cosmos-inscriptions/indexer/src/indexer/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func TestWebhookPost(t *testing.T) {
+	var received WebhookEvent
+	var signatureValid bool
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		signature := strings.TrimPrefix(r.Header.Get("X-Webhook-Signature"), "sha256=")
+		signatureValid = signature == SignWebhook("secret", r.Header.Get("X-Webhook-Timestamp"), body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	worker := &WebhookDeliveryWorker{Client: server.Client()}
+	subscription := models.WebhookSubscription{URL: server.URL, Secret: "secret"}
+	event := models.EventOutbox{
+		ID:              7,
+		ChainID:         "cosmoshub-4",
+		Height:          100,
+		TransactionHash: "ABCD",
+		EventType:       "cft20.mint",
+		Data:            datatypes.JSON(`{"ticker":"ROIDS","amount":1000}`),
+		DateCreated:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	err := worker.post(context.Background(), subscription, event)
+	assert.NoError(t, err)
+	assert.True(t, signatureValid, "the signature should verify with the secret")
+	assert.Equal(t, uint64(7), received.ID)
+	assert.Equal(t, "cft20.mint", received.Type)
+	assert.JSONEq(t, `{"ticker":"ROIDS","amount":1000}`, string(received.Data))
+
+	status = http.StatusInternalServerError
+	err = worker.post(context.Background(), subscription, event)
+	assert.EqualError(t, err, "webhook returned status 500 for event 7")
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, WebhookDeliveryPeriod, webhookBackoff(1))
+	assert.Equal(t, 4*WebhookDeliveryPeriod, webhookBackoff(3))
+	assert.Equal(t, webhookMaxBackoff, webhookBackoff(100))
+	assert.Equal(t, []string{"cft20.mint", "listing.filled"}, parseEventTypes(" cft20.mint, ,listing.filled"))
+	assert.Nil(t, parseEventTypes(""))
+}